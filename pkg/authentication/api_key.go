@@ -0,0 +1,237 @@
+package authentication
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrKeyNotFound is returned by a KeyStore when the requested API key doesn't
+// exist.
+var ErrKeyNotFound = errors.New("api key not found")
+
+// APIKey contains the information stored about an API key. Only a salted hash of
+// the key secret is stored, the secret can't be recovered from it.
+//
+// API keys have the "<prefix>_<id>_<secret>" format, where prefix identifies the
+// kind of key, such as "gzci" for CI bots, and id identifies the key in a
+// KeyStore.
+type APIKey struct {
+	// ID is the unique identifier of the key.
+	ID string
+	// Prefix identifies the kind of key.
+	Prefix string
+	// Owner is the identifier of the principal the key belongs to.
+	Owner string
+	// Name is a human-readable description of the key.
+	Name string
+	// Scopes contains the scopes granted to the key.
+	Scopes []string
+	// Salt is the random salt used to hash the key secret.
+	Salt []byte
+	// Hash is the SHA-256 hash of the salt followed by the key secret.
+	Hash []byte
+	// CreatedAt is the time when the key was created.
+	CreatedAt time.Time
+	// ExpiresAt is the time when the key expires. Keys without an expiration
+	// time never expire.
+	ExpiresAt time.Time
+	// LastUsedAt is the last time the key was successfully verified.
+	LastUsedAt time.Time
+	// RevokedAt is the time when the key was revoked. Revoked keys are rejected.
+	RevokedAt time.Time
+}
+
+// HasScope returns true if the key was granted the given scope.
+func (k *APIKey) HasScope(scope string) bool {
+	return contains(k.Scopes, scope)
+}
+
+// IsRevoked returns true if the key has been revoked.
+func (k *APIKey) IsRevoked() bool {
+	return !k.RevokedAt.IsZero()
+}
+
+// IsExpired returns true if the key is expired at the given time.
+func (k *APIKey) IsExpired(now time.Time) bool {
+	return !k.ExpiresAt.IsZero() && !now.Before(k.ExpiresAt)
+}
+
+// SetSecret generates a new random salt and stores the salted hash of the given
+// secret.
+func (k *APIKey) SetSecret(secret string) error {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+	k.Salt = salt
+	k.Hash = hashAPIKeySecret(salt, secret)
+	return nil
+}
+
+// matchSecret returns true if the given secret matches the stored hash. The
+// hashes are compared in constant time.
+func (k *APIKey) matchSecret(secret string) bool {
+	return subtle.ConstantTimeCompare(k.Hash, hashAPIKeySecret(k.Salt, secret)) == 1
+}
+
+// formatAPIKey returns an API key in the "<prefix>_<id>_<secret>" format.
+func formatAPIKey(prefix, id, secret string) string {
+	return prefix + "_" + id + "_" + secret
+}
+
+// ParseAPIKey splits the given key into its prefix, id and secret.
+func ParseAPIKey(key string) (prefix string, id string, secret string, err error) {
+	parts := strings.SplitN(key, "_", 3)
+	if len(parts) != 3 || len(parts[0]) == 0 || len(parts[1]) == 0 || len(parts[2]) == 0 {
+		return "", "", "", errors.New("invalid api key format")
+	}
+	return parts[0], parts[1], parts[2], nil
+}
+
+// hashAPIKeySecret returns the SHA-256 hash of the given salt followed by the
+// given secret.
+func hashAPIKeySecret(salt []byte, secret string) []byte {
+	h := sha256.New()
+	h.Write(salt)
+	h.Write([]byte(secret))
+	return h.Sum(nil)
+}
+
+// KeyStore contains the API keys verified by an APIKeyAuthentication.
+type KeyStore interface {
+	// GetKey returns the API key identified by the given id. It returns
+	// ErrKeyNotFound if the key doesn't exist.
+	GetKey(ctx context.Context, id string) (*APIKey, error)
+	// TouchKey sets the last time the API key identified by the given id was used.
+	TouchKey(ctx context.Context, id string, usedAt time.Time) error
+}
+
+// APIKeyAuthentication verifies API keys.
+type APIKeyAuthentication interface {
+	// VerifyAPIKey verifies that the given API key exists, matches the stored
+	// hash, and is neither expired nor revoked. It returns the stored
+	// information about the key.
+	VerifyAPIKey(ctx context.Context, key string) (*APIKey, error)
+}
+
+// APIKeyOption configures an APIKeyAuthentication.
+type APIKeyOption func(*apiKeyAuthentication)
+
+// WithAPIKeyPrefixes restricts the accepted API keys to the ones using any of the
+// given prefixes. By default, keys with any prefix are accepted.
+func WithAPIKeyPrefixes(prefixes ...string) APIKeyOption {
+	return func(auth *apiKeyAuthentication) {
+		auth.prefixes = prefixes
+	}
+}
+
+// WithAPIKeyChecksum rejects API keys without a valid checksum, such as the ones
+// generated by an APIKeyManager, before looking them up in the KeyStore.
+func WithAPIKeyChecksum() APIKeyOption {
+	return func(auth *apiKeyAuthentication) {
+		auth.checksum = true
+	}
+}
+
+// WithLastUsedResolution sets the minimum time between updates of the last time
+// a key was used, in order to reduce the number of writes to the KeyStore.
+// Defaults to 1 minute.
+func WithLastUsedResolution(d time.Duration) APIKeyOption {
+	return func(auth *apiKeyAuthentication) {
+		auth.lastUsedResolution = d
+	}
+}
+
+// apiKeyAuthentication is an APIKeyAuthentication implementation backed by a
+// KeyStore.
+type apiKeyAuthentication struct {
+	store              KeyStore
+	prefixes           []string
+	checksum           bool
+	lastUsedResolution time.Duration
+	now                func() time.Time
+}
+
+// VerifyAPIKey verifies the given API key. Failures are reported as a
+// *VerificationError.
+func (auth *apiKeyAuthentication) VerifyAPIKey(ctx context.Context, key string) (*APIKey, error) {
+	if len(key) == 0 {
+		return nil, NewVerificationError(ProviderAPIKey, ReasonNotProvided, ErrTokenNotProvided)
+	}
+	prefix, id, secret, err := ParseAPIKey(key)
+	if err != nil {
+		return nil, NewVerificationError(ProviderAPIKey, ReasonMalformed, err)
+	}
+	if len(auth.prefixes) > 0 && !contains(auth.prefixes, prefix) {
+		return nil, NewVerificationError(ProviderAPIKey, ReasonMalformed, fmt.Errorf("invalid api key prefix: %s", prefix))
+	}
+	if auth.checksum && !ValidAPIKeyChecksum(key) {
+		return nil, NewVerificationError(ProviderAPIKey, ReasonMalformed, errors.New("invalid api key checksum"))
+	}
+	stored, err := auth.store.GetKey(ctx, id)
+	if errors.Is(err, ErrKeyNotFound) {
+		// Hash the secret anyway so unknown keys take as long as invalid ones.
+		hashAPIKeySecret(nil, secret)
+		return nil, NewVerificationError(ProviderAPIKey, ReasonUnknownKey, err)
+	}
+	if err != nil {
+		return nil, NewVerificationError(ProviderAPIKey, ReasonProviderUnavailable, err)
+	}
+	if !stored.matchSecret(secret) || stored.Prefix != prefix {
+		return nil, NewVerificationError(ProviderAPIKey, ReasonInvalid, errors.New("api key does not match"))
+	}
+	if stored.IsRevoked() {
+		return nil, NewVerificationError(ProviderAPIKey, ReasonRevoked, nil)
+	}
+	now := auth.now()
+	if stored.IsExpired(now) {
+		return nil, NewVerificationError(ProviderAPIKey, ReasonExpired, nil)
+	}
+	if now.Sub(stored.LastUsedAt) >= auth.lastUsedResolution {
+		// Failing to record the last usage doesn't invalidate the key.
+		if err := auth.store.TouchKey(ctx, id, now); err == nil {
+			stored.LastUsedAt = now
+		}
+	}
+	return stored, nil
+}
+
+// NewAPIKeyAuthentication initializes a new APIKeyAuthentication that verifies the
+// API keys stored in the given KeyStore.
+func NewAPIKeyAuthentication(store KeyStore, opts ...APIKeyOption) APIKeyAuthentication {
+	auth := &apiKeyAuthentication{
+		store:              store,
+		lastUsedResolution: time.Minute,
+		now:                time.Now,
+	}
+	for _, opt := range opts {
+		opt(auth)
+	}
+	return auth
+}
+
+// APIKeyAccessToken returns an AccessTokenAuthentication that verifies API keys
+// using the given APIKeyAuthentication. Keys must be granted every one of the
+// given scopes, ErrMissingPermissions is returned otherwise.
+//
+//	auth := APIKeyAccessToken(NewAPIKeyAuthentication(store), "simulations.run")
+func APIKeyAccessToken(auth APIKeyAuthentication, scopes ...string) AccessTokenAuthentication {
+	return func(ctx context.Context, token string) error {
+		key, err := auth.VerifyAPIKey(ctx, token)
+		if err != nil {
+			return err
+		}
+		for _, scope := range scopes {
+			if !key.HasScope(scope) {
+				return NewVerificationError(ProviderAPIKey, ReasonInvalid, fmt.Errorf("%w: missing scope %s", ErrMissingPermissions, scope))
+			}
+		}
+		return nil
+	}
+}
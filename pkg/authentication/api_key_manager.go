@@ -0,0 +1,245 @@
+package authentication
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// base62Alphabet contains the characters used to encode API key secrets and
+// checksums.
+const base62Alphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+const (
+	// apiKeySecretLength is the number of random base62 characters in the secret
+	// of generated API keys, about 190 bits of entropy.
+	apiKeySecretLength = 32
+	// apiKeyChecksumLength is the number of base62 characters used to encode the
+	// CRC32 checksum appended to generated API keys.
+	apiKeyChecksumLength = 6
+)
+
+// ErrKeyNotRotatable is returned when rotating an API key that is revoked or
+// expired.
+var ErrKeyNotRotatable = errors.New("api key cannot be rotated")
+
+// APIKeyRequest contains the information used to generate a new API key.
+type APIKeyRequest struct {
+	// Prefix identifies the kind of key, such as "gzci". It can only contain
+	// letters and digits.
+	Prefix string
+	// Owner is the identifier of the principal the key belongs to.
+	Owner string
+	// Name is a human-readable description of the key.
+	Name string
+	// Scopes contains the scopes granted to the key.
+	Scopes []string
+	// TTL is the lifetime of the key. Keys without a TTL never expire.
+	TTL time.Duration
+}
+
+// APIKeyManager issues and manages API keys.
+type APIKeyManager interface {
+	// Generate creates a new API key. It returns the key, which must be handed to
+	// the owner since it can't be recovered, and the stored information about it.
+	Generate(ctx context.Context, req APIKeyRequest) (string, *APIKey, error)
+	// Rotate creates a new API key with the same prefix, owner, name and scopes
+	// as the key identified by id, and expires the old key after the given
+	// overlap period, during which both keys are valid. Revoked and expired keys
+	// can't be rotated.
+	Rotate(ctx context.Context, id string, overlap time.Duration) (string, *APIKey, error)
+	// Revoke revokes the API key identified by id. Revoked keys are rejected
+	// immediately.
+	Revoke(ctx context.Context, id string) error
+	// List returns the API keys of the given owner, sorted by creation time.
+	List(ctx context.Context, owner string) ([]APIKey, error)
+}
+
+// apiKeyManager is an APIKeyManager implementation backed by a KeyManagementStore.
+type apiKeyManager struct {
+	store KeyManagementStore
+	now   func() time.Time
+}
+
+// Generate creates a new API key.
+func (m *apiKeyManager) Generate(ctx context.Context, req APIKeyRequest) (string, *APIKey, error) {
+	secret, key, err := m.newKey(req)
+	if err != nil {
+		return "", nil, err
+	}
+	if err := m.store.CreateKey(ctx, key); err != nil {
+		return "", nil, err
+	}
+	return secret, key, nil
+}
+
+// Rotate replaces the API key identified by id with a new one. The expiration of
+// the old key is updated and the new one is stored in a single store operation,
+// which fails if the old key is revoked concurrently.
+func (m *apiKeyManager) Rotate(ctx context.Context, id string, overlap time.Duration) (string, *APIKey, error) {
+	old, err := m.store.GetKey(ctx, id)
+	if err != nil {
+		return "", nil, err
+	}
+	now := m.now()
+	if old.IsRevoked() {
+		return "", nil, fmt.Errorf("%w: %s has been revoked", ErrKeyNotRotatable, id)
+	}
+	if old.IsExpired(now) {
+		return "", nil, fmt.Errorf("%w: %s has expired", ErrKeyNotRotatable, id)
+	}
+	req := APIKeyRequest{
+		Prefix: old.Prefix,
+		Owner:  old.Owner,
+		Name:   old.Name,
+		Scopes: old.Scopes,
+	}
+	if !old.ExpiresAt.IsZero() {
+		req.TTL = old.ExpiresAt.Sub(old.CreatedAt)
+	}
+	secret, key, err := m.newKey(req)
+	if err != nil {
+		return "", nil, err
+	}
+	expiresAt := now.Add(overlap)
+	if !old.ExpiresAt.IsZero() && old.ExpiresAt.Before(expiresAt) {
+		expiresAt = old.ExpiresAt
+	}
+	if err := m.store.RotateKey(ctx, id, expiresAt, key); err != nil {
+		return "", nil, err
+	}
+	return secret, key, nil
+}
+
+// newKey builds a new API key for the given request without storing it.
+func (m *apiKeyManager) newKey(req APIKeyRequest) (string, *APIKey, error) {
+	if !isAlphanumeric(req.Prefix) {
+		return "", nil, fmt.Errorf("invalid api key prefix %q: must only contain letters and digits", req.Prefix)
+	}
+	if len(req.Owner) == 0 {
+		return "", nil, errors.New("invalid api key request: missing owner")
+	}
+	id, err := randomHex(8)
+	if err != nil {
+		return "", nil, err
+	}
+	random, err := randomBase62(apiKeySecretLength)
+	if err != nil {
+		return "", nil, err
+	}
+	secret := random + apiKeyChecksum(formatAPIKey(req.Prefix, id, random))
+
+	now := m.now()
+	key := &APIKey{
+		ID:        id,
+		Prefix:    req.Prefix,
+		Owner:     req.Owner,
+		Name:      req.Name,
+		Scopes:    req.Scopes,
+		CreatedAt: now,
+	}
+	if req.TTL > 0 {
+		key.ExpiresAt = now.Add(req.TTL)
+	}
+	if err := key.SetSecret(secret); err != nil {
+		return "", nil, err
+	}
+	return formatAPIKey(req.Prefix, id, secret), key, nil
+}
+
+// Revoke revokes the API key identified by id.
+func (m *apiKeyManager) Revoke(ctx context.Context, id string) error {
+	return m.store.RevokeKey(ctx, id, m.now())
+}
+
+// List returns the API keys of the given owner.
+func (m *apiKeyManager) List(ctx context.Context, owner string) ([]APIKey, error) {
+	return m.store.ListKeys(ctx, owner)
+}
+
+// NewAPIKeyManager initializes a new APIKeyManager that stores API keys in the
+// given KeyManagementStore. Use the same store with NewAPIKeyAuthentication to
+// verify the generated keys.
+//
+// Generated keys have the "<prefix>_<id>_<secret><checksum>" format, where the
+// checksum is a CRC32 of the rest of the key. The checksum allows secret scanners
+// to detect leaked keys with few false positives, see ValidAPIKeyChecksum.
+//
+//	manager := NewAPIKeyManager(store)
+//	key, info, err := manager.Generate(ctx, APIKeyRequest{
+//		Prefix: "gzci",
+//		Owner:  "ci-bot",
+//		Scopes: []string{"simulations.run"},
+//		TTL:    90 * 24 * time.Hour,
+//	})
+func NewAPIKeyManager(store KeyManagementStore) APIKeyManager {
+	return &apiKeyManager{
+		store: store,
+		now:   time.Now,
+	}
+}
+
+// ValidAPIKeyChecksum returns true if the given API key ends with a valid
+// checksum, as generated by an APIKeyManager.
+func ValidAPIKeyChecksum(key string) bool {
+	if len(key) <= apiKeyChecksumLength {
+		return false
+	}
+	body, checksum := key[:len(key)-apiKeyChecksumLength], key[len(key)-apiKeyChecksumLength:]
+	if _, _, _, err := ParseAPIKey(body); err != nil {
+		return false
+	}
+	return apiKeyChecksum(body) == checksum
+}
+
+// apiKeyChecksum returns the base62-encoded CRC32 checksum of the given value.
+func apiKeyChecksum(value string) string {
+	sum := crc32.ChecksumIEEE([]byte(value))
+	encoded := make([]byte, apiKeyChecksumLength)
+	for i := len(encoded) - 1; i >= 0; i-- {
+		encoded[i] = base62Alphabet[sum%62]
+		sum /= 62
+	}
+	return string(encoded)
+}
+
+// randomBase62 returns a cryptographically random base62 string of the given
+// length.
+func randomBase62(length int) (string, error) {
+	var sb strings.Builder
+	max := big.NewInt(int64(len(base62Alphabet)))
+	for i := 0; i < length; i++ {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		sb.WriteByte(base62Alphabet[n.Int64()])
+	}
+	return sb.String(), nil
+}
+
+// randomHex returns the hex encoding of n cryptographically random bytes.
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// isAlphanumeric returns true if the given value is not empty and only contains
+// ASCII letters and digits.
+func isAlphanumeric(value string) bool {
+	for _, r := range value {
+		if !strings.ContainsRune(base62Alphabet, r) {
+			return false
+		}
+	}
+	return len(value) > 0
+}
@@ -0,0 +1,197 @@
+package authentication
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPIKeyManager_Generate(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryKeyStore()
+	manager := NewAPIKeyManager(store)
+
+	key, info, err := manager.Generate(ctx, APIKeyRequest{
+		Prefix: "gzci",
+		Owner:  "ci-bot",
+		Name:   "CI",
+		Scopes: []string{"simulations.run"},
+		TTL:    time.Hour,
+	})
+	require.NoError(t, err)
+	assert.Regexp(t, regexp.MustCompile(`^gzci_[0-9a-f]{16}_[0-9A-Za-z]{38}$`), key)
+	assert.True(t, ValidAPIKeyChecksum(key))
+	assert.NotContains(t, string(info.Hash), key)
+	assert.Equal(t, "ci-bot", info.Owner)
+	assert.Equal(t, time.Hour, info.ExpiresAt.Sub(info.CreatedAt))
+
+	verified, err := NewAPIKeyAuthentication(store, WithAPIKeyChecksum()).VerifyAPIKey(ctx, key)
+	require.NoError(t, err)
+	assert.Equal(t, info.ID, verified.ID)
+
+	other, _, err := manager.Generate(ctx, APIKeyRequest{Prefix: "gzci", Owner: "ci-bot"})
+	require.NoError(t, err)
+	assert.NotEqual(t, key, other)
+}
+
+func TestAPIKeyManager_Generate_InvalidRequest(t *testing.T) {
+	manager := NewAPIKeyManager(NewMemoryKeyStore())
+	for _, req := range []APIKeyRequest{
+		{Owner: "ci-bot"},
+		{Prefix: "gz_ci", Owner: "ci-bot"},
+		{Prefix: "gzci"},
+	} {
+		_, _, err := manager.Generate(context.Background(), req)
+		assert.Error(t, err)
+	}
+}
+
+func TestValidAPIKeyChecksum(t *testing.T) {
+	key, _, err := NewAPIKeyManager(NewMemoryKeyStore()).Generate(context.Background(), APIKeyRequest{Prefix: "gzci", Owner: "ci-bot"})
+	require.NoError(t, err)
+
+	tampered := []byte(key)
+	tampered[len("gzci_")+20] ^= 1
+	assert.False(t, ValidAPIKeyChecksum(string(tampered)))
+	assert.False(t, ValidAPIKeyChecksum("gzci_1234_secret"))
+	assert.False(t, ValidAPIKeyChecksum("abc"))
+
+	_, err = NewAPIKeyAuthentication(NewMemoryKeyStore(), WithAPIKeyChecksum()).VerifyAPIKey(context.Background(), string(tampered))
+	assert.Equal(t, ReasonMalformed, ReasonOf(err))
+}
+
+func TestAPIKeyManager_Rotate(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryKeyStore()
+	manager := NewAPIKeyManager(store).(*apiKeyManager)
+	now := time.Now()
+	manager.now = func() time.Time { return now }
+	auth := NewAPIKeyAuthentication(store).(*apiKeyAuthentication)
+	auth.now = func() time.Time { return now }
+
+	oldKey, old, err := manager.Generate(ctx, APIKeyRequest{Prefix: "gzci", Owner: "ci-bot", Scopes: []string{"simulations.run"}, TTL: 24 * time.Hour})
+	require.NoError(t, err)
+
+	newKey, rotated, err := manager.Rotate(ctx, old.ID, time.Hour)
+	require.NoError(t, err)
+	assert.NotEqual(t, old.ID, rotated.ID)
+	assert.Equal(t, old.Scopes, rotated.Scopes)
+	assert.Equal(t, now.Add(24*time.Hour), rotated.ExpiresAt)
+
+	// Both keys work during the overlap period.
+	_, err = auth.VerifyAPIKey(ctx, oldKey)
+	assert.NoError(t, err)
+	_, err = auth.VerifyAPIKey(ctx, newKey)
+	assert.NoError(t, err)
+
+	now = now.Add(time.Hour)
+	_, err = auth.VerifyAPIKey(ctx, oldKey)
+	assert.Equal(t, ReasonExpired, ReasonOf(err))
+	_, err = auth.VerifyAPIKey(ctx, newKey)
+	assert.NoError(t, err)
+
+	_, _, err = manager.Rotate(ctx, "missing", time.Hour)
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+}
+
+func TestAPIKeyManager_Rotate_KeepsEarlierExpiration(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryKeyStore()
+	manager := NewAPIKeyManager(store)
+
+	_, old, err := manager.Generate(ctx, APIKeyRequest{Prefix: "gzci", Owner: "ci-bot", TTL: time.Minute})
+	require.NoError(t, err)
+	_, _, err = manager.Rotate(ctx, old.ID, time.Hour)
+	require.NoError(t, err)
+
+	stored, err := store.GetKey(ctx, old.ID)
+	require.NoError(t, err)
+	assert.Equal(t, old.ExpiresAt, stored.ExpiresAt)
+}
+
+func TestAPIKeyManager_Rotate_Expired(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryKeyStore()
+	manager := NewAPIKeyManager(store).(*apiKeyManager)
+	now := time.Now()
+	manager.now = func() time.Time { return now }
+
+	_, old, err := manager.Generate(ctx, APIKeyRequest{Prefix: "gzci", Owner: "ci-bot", TTL: time.Minute})
+	require.NoError(t, err)
+	now = now.Add(time.Minute)
+	_, _, err = manager.Rotate(ctx, old.ID, time.Hour)
+	assert.ErrorIs(t, err, ErrKeyNotRotatable)
+
+	keys, err := manager.List(ctx, "ci-bot")
+	require.NoError(t, err)
+	assert.Len(t, keys, 1)
+}
+
+// revokingKeyStore is a KeyManagementStore that revokes every key after it's
+// read, simulating a revocation concurrent with a rotation.
+type revokingKeyStore struct {
+	KeyManagementStore
+}
+
+func (s revokingKeyStore) GetKey(ctx context.Context, id string) (*APIKey, error) {
+	key, err := s.KeyManagementStore.GetKey(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return key, s.RevokeKey(ctx, id, time.Now())
+}
+
+func TestAPIKeyManager_Rotate_ConcurrentRevocation(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryKeyStore()
+	_, old, err := NewAPIKeyManager(store).Generate(ctx, APIKeyRequest{Prefix: "gzci", Owner: "ci-bot"})
+	require.NoError(t, err)
+
+	_, _, err = NewAPIKeyManager(revokingKeyStore{store}).Rotate(ctx, old.ID, time.Hour)
+	assert.ErrorIs(t, err, ErrKeyNotRotatable)
+
+	// The revocation is kept and no key is created.
+	keys, err := store.ListKeys(ctx, "ci-bot")
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	assert.True(t, keys[0].IsRevoked())
+	assert.True(t, keys[0].ExpiresAt.IsZero())
+}
+
+func TestAPIKeyManager_Revoke(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryKeyStore()
+	manager := NewAPIKeyManager(store)
+
+	key, info, err := manager.Generate(ctx, APIKeyRequest{Prefix: "gzci", Owner: "ci-bot"})
+	require.NoError(t, err)
+	require.NoError(t, manager.Revoke(ctx, info.ID))
+	require.NoError(t, manager.Revoke(ctx, info.ID))
+
+	_, err = NewAPIKeyAuthentication(store).VerifyAPIKey(ctx, key)
+	assert.Equal(t, ReasonRevoked, ReasonOf(err))
+
+	_, _, err = manager.Rotate(ctx, info.ID, time.Hour)
+	assert.ErrorIs(t, err, ErrKeyNotRotatable)
+	assert.ErrorIs(t, manager.Revoke(ctx, "missing"), ErrKeyNotFound)
+}
+
+func TestAPIKeyManager_List(t *testing.T) {
+	ctx := context.Background()
+	manager := NewAPIKeyManager(NewMemoryKeyStore())
+	_, a, err := manager.Generate(ctx, APIKeyRequest{Prefix: "gzci", Owner: "ci-bot"})
+	require.NoError(t, err)
+	_, b, err := manager.Generate(ctx, APIKeyRequest{Prefix: "gzci", Owner: "ci-bot"})
+	require.NoError(t, err)
+	_, _, err = manager.Generate(ctx, APIKeyRequest{Prefix: "gzci", Owner: "other"})
+	require.NoError(t, err)
+
+	keys, err := manager.List(ctx, "ci-bot")
+	require.NoError(t, err)
+	require.Len(t, keys, 2)
+	assert.ElementsMatch(t, []string{a.ID, b.ID}, []string{keys[0].ID, keys[1].ID})
+}
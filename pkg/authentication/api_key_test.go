@@ -0,0 +1,149 @@
+package authentication
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// failingKeyStore is a KeyStore implementation that always fails.
+type failingKeyStore struct {
+	err error
+}
+
+func (s failingKeyStore) GetKey(ctx context.Context, id string) (*APIKey, error) {
+	return nil, s.err
+}
+
+func (s failingKeyStore) TouchKey(ctx context.Context, id string, usedAt time.Time) error {
+	return s.err
+}
+
+func newTestAPIKey(t *testing.T, prefix, id, secret string) APIKey {
+	key := APIKey{
+		ID:        id,
+		Prefix:    prefix,
+		Owner:     "ci-bot",
+		Scopes:    []string{"simulations.run"},
+		CreatedAt: time.Now(),
+	}
+	require.NoError(t, key.SetSecret(secret))
+	return key
+}
+
+func TestAPIKey_SetSecret(t *testing.T) {
+	a := newTestAPIKey(t, "gzci", "1", "secret")
+	b := newTestAPIKey(t, "gzci", "2", "secret")
+	assert.Len(t, a.Salt, 16)
+	assert.NotEqual(t, a.Salt, b.Salt)
+	assert.NotEqual(t, a.Hash, b.Hash)
+	assert.True(t, a.matchSecret("secret"))
+	assert.False(t, a.matchSecret("Secret"))
+}
+
+func TestParseAPIKey(t *testing.T) {
+	prefix, id, secret, err := ParseAPIKey("gzci_1234_abc_def")
+	require.NoError(t, err)
+	assert.Equal(t, "gzci", prefix)
+	assert.Equal(t, "1234", id)
+	assert.Equal(t, "abc_def", secret)
+	assert.Equal(t, "gzci_1234_abc_def", formatAPIKey(prefix, id, secret))
+
+	for _, key := range []string{"", "gzci", "gzci_1234", "gzci_1234_", "_1234_secret", "gzci__secret"} {
+		_, _, _, err := ParseAPIKey(key)
+		assert.Error(t, err, key)
+	}
+}
+
+func TestAPIKeyAuthentication(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryKeyStore(newTestAPIKey(t, "gzci", "1234", "secret"))
+	auth := NewAPIKeyAuthentication(store)
+
+	key, err := auth.VerifyAPIKey(ctx, "gzci_1234_secret")
+	require.NoError(t, err)
+	assert.Equal(t, "ci-bot", key.Owner)
+	assert.True(t, key.HasScope("simulations.run"))
+	assert.False(t, key.LastUsedAt.IsZero())
+
+	stored, err := store.GetKey(ctx, "1234")
+	require.NoError(t, err)
+	assert.Equal(t, key.LastUsedAt, stored.LastUsedAt)
+}
+
+func TestAPIKeyAuthentication_Errors(t *testing.T) {
+	ctx := context.Background()
+	expired := newTestAPIKey(t, "gzci", "expired", "secret")
+	expired.ExpiresAt = time.Now().Add(-time.Minute)
+	revoked := newTestAPIKey(t, "gzci", "revoked", "secret")
+	revoked.RevokedAt = time.Now()
+	store := NewMemoryKeyStore(newTestAPIKey(t, "gzci", "1234", "secret"), expired, revoked)
+	auth := NewAPIKeyAuthentication(store, WithAPIKeyPrefixes("gzci", "gzsim"))
+
+	testCases := []struct {
+		name   string
+		key    string
+		reason Reason
+	}{
+		{name: "empty", key: "", reason: ReasonNotProvided},
+		{name: "malformed", key: "gzci1234secret", reason: ReasonMalformed},
+		{name: "unknown prefix", key: "other_1234_secret", reason: ReasonMalformed},
+		{name: "unknown key", key: "gzci_5678_secret", reason: ReasonUnknownKey},
+		{name: "wrong secret", key: "gzci_1234_other", reason: ReasonInvalid},
+		{name: "wrong prefix", key: "gzsim_1234_secret", reason: ReasonInvalid},
+		{name: "expired", key: "gzci_expired_secret", reason: ReasonExpired},
+		{name: "revoked", key: "gzci_revoked_secret", reason: ReasonRevoked},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := auth.VerifyAPIKey(ctx, tc.key)
+			var verificationErr *VerificationError
+			require.ErrorAs(t, err, &verificationErr)
+			assert.Equal(t, tc.reason, verificationErr.Reason)
+			assert.Equal(t, ProviderAPIKey, verificationErr.Provider)
+		})
+	}
+
+	_, err := NewAPIKeyAuthentication(failingKeyStore{err: errors.New("connection refused")}).VerifyAPIKey(ctx, "gzci_1234_secret")
+	assert.ErrorIs(t, err, ErrProviderUnavailable)
+}
+
+func TestAPIKeyAuthentication_LastUsedResolution(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryKeyStore(newTestAPIKey(t, "gzci", "1234", "secret"))
+	auth := NewAPIKeyAuthentication(store, WithLastUsedResolution(time.Hour)).(*apiKeyAuthentication)
+	now := time.Now()
+	auth.now = func() time.Time { return now }
+
+	_, err := auth.VerifyAPIKey(ctx, "gzci_1234_secret")
+	require.NoError(t, err)
+	first := now
+
+	now = now.Add(time.Minute)
+	key, err := auth.VerifyAPIKey(ctx, "gzci_1234_secret")
+	require.NoError(t, err)
+	assert.True(t, key.LastUsedAt.Equal(first))
+
+	now = now.Add(time.Hour)
+	key, err = auth.VerifyAPIKey(ctx, "gzci_1234_secret")
+	require.NoError(t, err)
+	assert.True(t, key.LastUsedAt.Equal(now))
+}
+
+func TestAPIKeyAccessToken(t *testing.T) {
+	ctx := context.Background()
+	auth := NewAPIKeyAuthentication(NewMemoryKeyStore(newTestAPIKey(t, "gzci", "1234", "secret")))
+
+	assert.NoError(t, APIKeyAccessToken(auth)(ctx, "gzci_1234_secret"))
+	assert.NoError(t, APIKeyAccessToken(auth, "simulations.run")(ctx, "gzci_1234_secret"))
+
+	err := APIKeyAccessToken(auth, "simulations.run", "worlds.delete")(ctx, "gzci_1234_secret")
+	assert.ErrorIs(t, err, ErrMissingPermissions)
+	assert.ErrorIs(t, err, ErrTokenInvalid)
+
+	assert.ErrorIs(t, APIKeyAccessToken(auth)(ctx, ""), ErrTokenNotProvided)
+}
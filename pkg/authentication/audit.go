@@ -0,0 +1,255 @@
+package authentication
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// AuditOutcome is the outcome of an authentication event.
+type AuditOutcome string
+
+const (
+	// AuditOutcomeSuccess is used when the credential was successfully verified.
+	AuditOutcomeSuccess AuditOutcome = "success"
+	// AuditOutcomeFailure is used when the credential failed verification.
+	AuditOutcomeFailure AuditOutcome = "failure"
+)
+
+// AuditEvent describes an authentication attempt. It never contains the raw
+// credential, only its fingerprint.
+type AuditEvent struct {
+	// Time is the time when the authentication attempt finished.
+	Time time.Time `json:"time"`
+	// Provider is the name of the provider that verified the credential.
+	Provider string `json:"provider"`
+	// Outcome is the outcome of the authentication attempt.
+	Outcome AuditOutcome `json:"outcome"`
+	// Reason describes why the authentication attempt failed.
+	Reason Reason `json:"reason,omitempty"`
+	// Subject is the subject (sub) of the verified credential.
+	Subject string `json:"subject,omitempty"`
+	// Issuer is the issuer (iss) of the verified credential.
+	Issuer string `json:"issuer,omitempty"`
+	// TokenFingerprint is the fingerprint of the credential, see TokenFingerprint.
+	TokenFingerprint string `json:"token_fingerprint,omitempty"`
+	// Request contains the metadata of the request that presented the credential.
+	Request *RequestMetadata `json:"request,omitempty"`
+}
+
+// AuditSink records authentication events.
+type AuditSink interface {
+	// Record records the given event.
+	Record(ctx context.Context, event AuditEvent) error
+}
+
+// TokenFingerprint returns a fingerprint that identifies the given token without
+// revealing it. It's the hex-encoded prefix of the token's SHA-256 hash, which
+// allows correlating authentication events produced by the same token.
+func TokenFingerprint(token string) string {
+	if len(token) == 0 {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(token))
+	return "sha256:" + hex.EncodeToString(sum[:16])
+}
+
+// slogAuditSink is an AuditSink implementation using log/slog.
+type slogAuditSink struct {
+	logger *slog.Logger
+}
+
+// Record logs the given event. Successful attempts are logged with the info
+// level, and failures with the warn level.
+func (s *slogAuditSink) Record(ctx context.Context, event AuditEvent) error {
+	level := slog.LevelInfo
+	if event.Outcome == AuditOutcomeFailure {
+		level = slog.LevelWarn
+	}
+	attrs := []slog.Attr{
+		slog.Time("time", event.Time),
+		slog.String("provider", event.Provider),
+		slog.String("outcome", string(event.Outcome)),
+	}
+	if len(event.Reason) > 0 {
+		attrs = append(attrs, slog.String("reason", string(event.Reason)))
+	}
+	if len(event.Subject) > 0 {
+		attrs = append(attrs, slog.String("subject", event.Subject))
+	}
+	if len(event.Issuer) > 0 {
+		attrs = append(attrs, slog.String("issuer", event.Issuer))
+	}
+	if len(event.TokenFingerprint) > 0 {
+		attrs = append(attrs, slog.String("token_fingerprint", event.TokenFingerprint))
+	}
+	if event.Request != nil {
+		attrs = append(attrs, slog.Group("request",
+			slog.String("remote_addr", event.Request.RemoteAddr),
+			slog.String("user_agent", event.Request.UserAgent),
+			slog.String("method", event.Request.Method),
+			slog.String("path", event.Request.Path),
+			slog.String("request_id", event.Request.RequestID),
+		))
+	}
+	s.logger.LogAttrs(ctx, level, "authentication", attrs...)
+	return nil
+}
+
+// NewSlogAuditSink initializes a new AuditSink that records events using the given logger.
+func NewSlogAuditSink(logger *slog.Logger) AuditSink {
+	return &slogAuditSink{
+		logger: logger,
+	}
+}
+
+// JSONLinesAuditSink is an AuditSink implementation that writes every event as
+// a single line of JSON. It's safe for concurrent use.
+type JSONLinesAuditSink struct {
+	mu     sync.Mutex
+	w      io.Writer
+	closer io.Closer
+}
+
+// Record writes the given event as a single line of JSON.
+func (s *JSONLinesAuditSink) Record(ctx context.Context, event AuditEvent) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.w.Write(line)
+	return err
+}
+
+// Close closes the underlying file if the sink was opened with OpenJSONLinesAuditFile.
+func (s *JSONLinesAuditSink) Close() error {
+	if s.closer == nil {
+		return nil
+	}
+	return s.closer.Close()
+}
+
+// NewJSONLinesAuditSink initializes a new JSONLinesAuditSink that writes events to w.
+func NewJSONLinesAuditSink(w io.Writer) *JSONLinesAuditSink {
+	return &JSONLinesAuditSink{
+		w: w,
+	}
+}
+
+// OpenJSONLinesAuditFile initializes a new JSONLinesAuditSink that appends events
+// to the file located at the given path, creating it if it doesn't exist.
+// The sink must be closed when it's no longer used.
+func OpenJSONLinesAuditFile(path string) (*JSONLinesAuditSink, error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &JSONLinesAuditSink{
+		w:      f,
+		closer: f,
+	}, nil
+}
+
+// auditedAuthentication is an Authentication decorator that records every
+// verification in an AuditSink.
+type auditedAuthentication struct {
+	authentication Authentication
+	provider       string
+	sink           AuditSink
+}
+
+// VerifyJWT verifies the given token using the underlying Authentication and
+// records the result in the AuditSink. Failures to record the event don't
+// affect the result of the verification.
+func (auth *auditedAuthentication) VerifyJWT(ctx context.Context, token string) (jwt.Claims, error) {
+	claims, err := auth.authentication.VerifyJWT(ctx, token)
+	event := AuditEvent{
+		Time:             time.Now().UTC(),
+		Provider:         auth.provider,
+		Outcome:          AuditOutcomeSuccess,
+		TokenFingerprint: TokenFingerprint(token),
+	}
+	if metadata, ok := RequestMetadataFromContext(ctx); ok {
+		event.Request = &metadata
+	}
+	if err != nil {
+		event.Outcome = AuditOutcomeFailure
+		event.Reason = ReasonOf(err)
+	} else {
+		event.Subject, _ = claims.GetSubject()
+		event.Issuer, _ = claims.GetIssuer()
+	}
+	_ = auth.sink.Record(ctx, event)
+	return claims, err
+}
+
+// NewAudited initializes a new Authentication implementation that wraps the given
+// Authentication and records every verification performed by the given provider
+// in sink. The request metadata is taken from the context, see WithRequestMetadata.
+//
+//	sink := NewSlogAuditSink(slog.Default())
+//	auth := NewAudited(NewAuth0(publicKey), ProviderAuth0, sink)
+func NewAudited(authentication Authentication, provider string, sink AuditSink) Authentication {
+	return &auditedAuthentication{
+		authentication: authentication,
+		provider:       provider,
+		sink:           sink,
+	}
+}
+
+// auditedCertificateAuthentication is a CertificateAuthentication decorator that
+// records every verification in an AuditSink.
+type auditedCertificateAuthentication struct {
+	authentication CertificateAuthentication
+	sink           AuditSink
+}
+
+// VerifyCertificate verifies the given certificate using the underlying
+// CertificateAuthentication and records the result in the AuditSink. The
+// fingerprint of the event identifies the certificate.
+func (auth *auditedCertificateAuthentication) VerifyCertificate(ctx context.Context, cert *x509.Certificate) (*Principal, error) {
+	principal, err := auth.authentication.VerifyCertificate(ctx, cert)
+	event := AuditEvent{
+		Time:     time.Now().UTC(),
+		Provider: ProviderMTLS,
+		Outcome:  AuditOutcomeSuccess,
+	}
+	if cert != nil {
+		event.TokenFingerprint = TokenFingerprint(string(cert.Raw))
+	}
+	if metadata, ok := RequestMetadataFromContext(ctx); ok {
+		event.Request = &metadata
+	}
+	if err != nil {
+		event.Outcome = AuditOutcomeFailure
+		event.Reason = ReasonOf(err)
+	} else {
+		event.Subject = principal.ID
+		event.Issuer = principal.Issuer
+	}
+	_ = auth.sink.Record(ctx, event)
+	return principal, err
+}
+
+// NewAuditedCertificate initializes a new CertificateAuthentication that wraps
+// the given CertificateAuthentication and records every verification in sink.
+//
+//	auth := NewAuditedCertificate(NewCertificateAuthentication(WithTrustDomains("cluster.local")), sink)
+func NewAuditedCertificate(authentication CertificateAuthentication, sink AuditSink) CertificateAuthentication {
+	return &auditedCertificateAuthentication{
+		authentication: authentication,
+		sink:           sink,
+	}
+}
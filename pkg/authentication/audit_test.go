@@ -0,0 +1,131 @@
+package authentication
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryAuditSink is an AuditSink implementation that stores events in memory.
+type memoryAuditSink struct {
+	events []AuditEvent
+}
+
+func (s *memoryAuditSink) Record(ctx context.Context, event AuditEvent) error {
+	s.events = append(s.events, event)
+	return nil
+}
+
+func TestTokenFingerprint(t *testing.T) {
+	assert.Empty(t, TokenFingerprint(""))
+	fingerprint := TokenFingerprint("token")
+	assert.True(t, strings.HasPrefix(fingerprint, "sha256:"))
+	assert.Len(t, fingerprint, len("sha256:")+32)
+	assert.Equal(t, fingerprint, TokenFingerprint("token"))
+	assert.NotEqual(t, fingerprint, TokenFingerprint("other"))
+}
+
+func TestNewAudited(t *testing.T) {
+	sink := &memoryAuditSink{}
+	ctx := WithRequestMetadata(context.Background(), RequestMetadata{RemoteAddr: "10.0.0.1:1234", Path: "/worlds"})
+
+	auth := NewAudited(authenticationWithClaims(jwt.MapClaims{"sub": "gazebo-web", "iss": "https://gazebosim.org"}), ProviderAuth0, sink)
+	_, err := auth.VerifyJWT(ctx, "secret-token")
+	require.NoError(t, err)
+
+	auth = NewAudited(authenticationWithError(NewVerificationError(ProviderAuth0, ReasonExpired, nil)), ProviderAuth0, sink)
+	_, err = auth.VerifyJWT(context.Background(), "expired-token")
+	require.Error(t, err)
+
+	require.Len(t, sink.events, 2)
+	success := sink.events[0]
+	assert.Equal(t, AuditOutcomeSuccess, success.Outcome)
+	assert.Equal(t, ProviderAuth0, success.Provider)
+	assert.Equal(t, "gazebo-web", success.Subject)
+	assert.Equal(t, "https://gazebosim.org", success.Issuer)
+	assert.Equal(t, TokenFingerprint("secret-token"), success.TokenFingerprint)
+	require.NotNil(t, success.Request)
+	assert.Equal(t, "10.0.0.1:1234", success.Request.RemoteAddr)
+
+	failure := sink.events[1]
+	assert.Equal(t, AuditOutcomeFailure, failure.Outcome)
+	assert.Equal(t, ReasonExpired, failure.Reason)
+	assert.Empty(t, failure.Subject)
+	assert.Nil(t, failure.Request)
+}
+
+func TestNewAudited_HTTPMiddleware(t *testing.T) {
+	sink := &memoryAuditSink{}
+	auth := NewAudited(authenticationWithClaims(jwt.MapClaims{"sub": "gazebo-web"}), ProviderAuth0, sink)
+	handler := HTTPMiddleware(auth)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	r := httptest.NewRequest(http.MethodGet, "/worlds", nil)
+	r.Header.Set("Authorization", "Bearer token")
+	r.Header.Set("User-Agent", "gz-test")
+	r.Header.Set("X-Request-Id", "abc")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	require.Len(t, sink.events, 1)
+	require.NotNil(t, sink.events[0].Request)
+	assert.Equal(t, RequestMetadata{
+		RemoteAddr: r.RemoteAddr,
+		UserAgent:  "gz-test",
+		Method:     http.MethodGet,
+		Path:       "/worlds",
+		RequestID:  "abc",
+	}, *sink.events[0].Request)
+}
+
+func TestSlogAuditSink(t *testing.T) {
+	var buf bytes.Buffer
+	sink := NewSlogAuditSink(slog.New(slog.NewJSONHandler(&buf, nil)))
+
+	err := sink.Record(context.Background(), AuditEvent{
+		Provider:         ProviderFirebase,
+		Outcome:          AuditOutcomeFailure,
+		Reason:           ReasonRevoked,
+		TokenFingerprint: TokenFingerprint("token"),
+		Request:          &RequestMetadata{Path: "/worlds"},
+	})
+	require.NoError(t, err)
+
+	var record map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+	assert.Equal(t, "WARN", record["level"])
+	assert.Equal(t, "firebase", record["provider"])
+	assert.Equal(t, "revoked", record["reason"])
+	assert.Equal(t, "/worlds", record["request"].(map[string]any)["path"])
+	assert.NotContains(t, buf.String(), `"token"`)
+}
+
+func TestJSONLinesAuditFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	sink, err := OpenJSONLinesAuditFile(path)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	require.NoError(t, sink.Record(ctx, AuditEvent{Provider: ProviderAuth0, Outcome: AuditOutcomeSuccess, Subject: "a"}))
+	require.NoError(t, sink.Record(ctx, AuditEvent{Provider: ProviderAuth0, Outcome: AuditOutcomeFailure, Reason: ReasonExpired}))
+	require.NoError(t, sink.Close())
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	require.Len(t, lines, 2)
+
+	var event AuditEvent
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &event))
+	assert.Equal(t, AuditOutcomeFailure, event.Outcome)
+	assert.Equal(t, ReasonExpired, event.Reason)
+}
@@ -3,6 +3,8 @@ package authentication
 import (
 	"context"
 	"errors"
+	"fmt"
+
 	"github.com/golang-jwt/jwt/v5"
 )
 
@@ -20,18 +22,23 @@ type auth0 struct {
 }
 
 // VerifyJWT verifies that the given token is a valid JWT and was correctly signed by Auth0.
+// It returns the claims as jwt.MapClaims.
 func (auth *auth0) VerifyJWT(ctx context.Context, token string) (jwt.Claims, error) {
 	if err := validateJWT(token); err != nil {
-		return nil, err
+		return nil, jwtVerificationError(ProviderAuth0, err)
 	}
 	parsedToken, err := jwt.Parse(token, auth.keyFunc)
 	if err != nil {
-		return nil, err
+		return nil, jwtVerificationError(ProviderAuth0, err)
 	}
 	if !parsedToken.Valid {
-		return nil, ErrTokenInvalid
+		return nil, NewVerificationError(ProviderAuth0, ReasonInvalid, ErrTokenInvalid)
+	}
+	claims, ok := parsedToken.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, NewVerificationError(ProviderAuth0, ReasonMalformed, ErrTokenInvalid)
 	}
-	return parsedToken.Claims, nil
+	return claims, nil
 }
 
 func (auth *auth0) keyFunc(token *jwt.Token) (interface{}, error) {
@@ -45,3 +52,72 @@ func NewAuth0(key []byte) Authentication {
 		publicKey: key,
 	}
 }
+
+var _ jwt.Claims = (*auth0Claims)(nil)
+var _ EmailClaimer = (*auth0Claims)(nil)
+var _ EmailVerifiedClaimer = (*auth0Claims)(nil)
+var _ CustomClaimer = (*auth0Claims)(nil)
+var _ AuthenticationContextClaimer = (*auth0Claims)(nil)
+
+// auth0Claims extends jwt.MapClaims with the accessors used to read custom claims
+// from JWTs signed by Auth0.
+type auth0Claims struct {
+	jwt.MapClaims
+}
+
+// GetEmail gets the Auth0 user's email address.
+func (c auth0Claims) GetEmail() (string, error) {
+	const key = "email"
+	v, err := c.GetCustomClaim(key)
+	if err != nil {
+		return "", err
+	}
+	email, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("invalid %s value: should be a string", key)
+	}
+	return email, nil
+}
+
+// IsEmailVerified returns true if Auth0 verified the user's email address.
+func (c auth0Claims) IsEmailVerified() (bool, error) {
+	const key = "email_verified"
+	v, err := c.GetCustomClaim(key)
+	if err != nil {
+		return false, err
+	}
+	verified, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("invalid %s value: should be a boolean", key)
+	}
+	return verified, nil
+}
+
+// GetAuthenticationMethods gets the authentication methods (amr) from the JWT.
+func (c auth0Claims) GetAuthenticationMethods() ([]string, error) {
+	return getStringsClaim(c, "amr")
+}
+
+// GetAuthenticationContextClass gets the authentication context class (acr) from the JWT.
+func (c auth0Claims) GetAuthenticationContextClass() (string, error) {
+	return getStringClaim(c, "acr")
+}
+
+// GetAuthTime gets the time when the user authenticated (auth_time) from the JWT.
+func (c auth0Claims) GetAuthTime() (*jwt.NumericDate, error) {
+	return getNumericDateClaim(c, "auth_time")
+}
+
+// GetCustomClaim gets the value from the given key.
+func (c auth0Claims) GetCustomClaim(key string) (any, error) {
+	v, ok := c.MapClaims[key]
+	if !ok {
+		return nil, fmt.Errorf("failed to get %s value: not found", key)
+	}
+	return v, nil
+}
+
+// NewAuth0Claims initializes a new set of claims from the given Auth0 JWT claims.
+func NewAuth0Claims(claims jwt.MapClaims) jwt.Claims {
+	return auth0Claims{MapClaims: claims}
+}
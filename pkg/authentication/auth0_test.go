@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
 )
 
@@ -64,6 +65,7 @@ func (suite *auth0TestSuite) TestVerifyCredentials_Success() {
 
 	claims, err := suite.authentication.VerifyJWT(ctx, signedToken)
 	suite.Assert().NoError(err)
+	suite.Assert().IsType(jwt.MapClaims{}, claims)
 
 	sub, err := claims.GetSubject()
 	suite.Assert().NoError(err)
@@ -78,3 +80,32 @@ func (suite *auth0TestSuite) TearDownTest() {
 func (suite *auth0TestSuite) TearDownSuite() {
 
 }
+
+func TestNewAuth0Claims(t *testing.T) {
+	claims := NewAuth0Claims(jwt.MapClaims{
+		"sub":            "gazebo-web",
+		"email":          "test@gazebosim.org",
+		"email_verified": true,
+	})
+
+	sub, err := claims.GetSubject()
+	assert.NoError(t, err)
+	assert.Equal(t, "gazebo-web", sub)
+
+	email, ok := claims.(EmailClaimer)
+	assert.True(t, ok)
+	value, err := email.GetEmail()
+	assert.NoError(t, err)
+	assert.Equal(t, "test@gazebosim.org", value)
+
+	verified, ok := claims.(EmailVerifiedClaimer)
+	assert.True(t, ok)
+	isVerified, err := verified.IsEmailVerified()
+	assert.NoError(t, err)
+	assert.True(t, isVerified)
+
+	custom, ok := claims.(CustomClaimer)
+	assert.True(t, ok)
+	_, err = custom.GetCustomClaim("missing")
+	assert.Error(t, err)
+}
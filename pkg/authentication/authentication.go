@@ -2,8 +2,10 @@ package authentication
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
@@ -34,6 +36,13 @@ type EmailClaimer interface {
 	GetEmail() (string, error)
 }
 
+// EmailVerifiedClaimer allows to check whether the authentication provider
+// verified the email address embedded in a JWT.
+type EmailVerifiedClaimer interface {
+	// IsEmailVerified returns true if the user's email address has been verified.
+	IsEmailVerified() (bool, error)
+}
+
 // CustomClaimer allows getting custom claims from JWTs.
 type CustomClaimer interface {
 	// GetCustomClaim returns the value of the claim identified by the given key.
@@ -41,6 +50,99 @@ type CustomClaimer interface {
 	GetCustomClaim(key string) (any, error)
 }
 
+// AuthenticationContextClaimer allows getting the claims that describe how a user
+// authenticated: the authentication methods (amr), the authentication context
+// class (acr) and the time when the authentication occurred (auth_time).
+type AuthenticationContextClaimer interface {
+	// GetAuthenticationMethods returns the authentication methods (amr) used to
+	// authenticate the user, such as "pwd" or "mfa". See RFC 8176.
+	GetAuthenticationMethods() ([]string, error)
+	// GetAuthenticationContextClass returns the authentication context class
+	// reference (acr) satisfied by the authentication.
+	GetAuthenticationContextClass() (string, error)
+	// GetAuthTime returns the time when the user authenticated (auth_time).
+	GetAuthTime() (*jwt.NumericDate, error)
+}
+
+// getClaim returns the value of the claim identified by the given key. It
+// supports claims implementing CustomClaimer as well as jwt.MapClaims.
+func getClaim(claims jwt.Claims, key string) (any, error) {
+	switch c := claims.(type) {
+	case CustomClaimer:
+		return c.GetCustomClaim(key)
+	case jwt.MapClaims:
+		v, ok := c[key]
+		if !ok {
+			return nil, fmt.Errorf("failed to get %s value: not found", key)
+		}
+		return v, nil
+	default:
+		return nil, fmt.Errorf("failed to get %s value: claims do not support custom claims", key)
+	}
+}
+
+// getStringsClaim returns the value of the claim identified by the given key as
+// a list of strings.
+func getStringsClaim(claims jwt.Claims, key string) ([]string, error) {
+	v, err := getClaim(claims, key)
+	if err != nil {
+		return nil, err
+	}
+	switch value := v.(type) {
+	case []string:
+		return value, nil
+	case []any:
+		list := make([]string, 0, len(value))
+		for _, item := range value {
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("invalid %s value: should be a list of strings", key)
+			}
+			list = append(list, s)
+		}
+		return list, nil
+	}
+	return nil, fmt.Errorf("invalid %s value: should be a list of strings", key)
+}
+
+// getStringClaim returns the value of the claim identified by the given key as
+// a string.
+func getStringClaim(claims jwt.Claims, key string) (string, error) {
+	v, err := getClaim(claims, key)
+	if err != nil {
+		return "", err
+	}
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("invalid %s value: should be a string", key)
+	}
+	return s, nil
+}
+
+// getNumericDateClaim returns the value of the claim identified by the given key
+// as a jwt.NumericDate.
+func getNumericDateClaim(claims jwt.Claims, key string) (*jwt.NumericDate, error) {
+	v, err := getClaim(claims, key)
+	if err != nil {
+		return nil, err
+	}
+	switch value := v.(type) {
+	case float64:
+		return jwt.NewNumericDate(time.Unix(0, int64(value*float64(time.Second)))), nil
+	case int64:
+		return jwt.NewNumericDate(time.Unix(value, 0)), nil
+	case int:
+		return jwt.NewNumericDate(time.Unix(int64(value), 0)), nil
+	case json.Number:
+		n, err := value.Float64()
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s value: %w", key, err)
+		}
+		return jwt.NewNumericDate(time.Unix(0, int64(n*float64(time.Second)))), nil
+	}
+	return nil, fmt.Errorf("invalid %s value: should be a number", key)
+}
+
 // validateJWT validates that the given token is a valid JWT.
 func validateJWT(token string) error {
 	if len(token) == 0 {
@@ -0,0 +1,165 @@
+package authentication
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ErrInsufficientUserAuthentication is returned when the authentication event
+// that produced a token doesn't satisfy the requirements of a resource.
+// See RFC 9470.
+var ErrInsufficientUserAuthentication = errors.New("insufficient_user_authentication")
+
+// InsufficientUserAuthenticationError contains the details of an authentication
+// event that doesn't satisfy a set of AuthenticationContextRequirements. It can
+// be matched with errors.Is using ErrInsufficientUserAuthentication.
+type InsufficientUserAuthenticationError struct {
+	// Requirements contains the requirements that were not satisfied.
+	Requirements AuthenticationContextRequirements
+	// Reason describes why the requirements were not satisfied.
+	Reason string
+}
+
+// Error returns the error message.
+func (e *InsufficientUserAuthenticationError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrInsufficientUserAuthentication, e.Reason)
+}
+
+// Unwrap returns ErrInsufficientUserAuthentication.
+func (e *InsufficientUserAuthenticationError) Unwrap() error {
+	return ErrInsufficientUserAuthentication
+}
+
+// AuthenticationContextRequirements defines how a user must have authenticated
+// in order to access a resource, allowing applications to request step-up
+// authentication for sensitive operations.
+type AuthenticationContextRequirements struct {
+	// ACRValues contains the list of accepted authentication context classes
+	// (acr). Any acr is accepted if empty.
+	ACRValues []string
+	// RequireMFA requires the authentication methods (amr) to include "mfa".
+	RequireMFA bool
+	// MaxAge is the maximum time elapsed since the user authenticated
+	// (auth_time). No maximum is enforced if zero.
+	MaxAge time.Duration
+}
+
+// Check verifies that the given claims satisfy the requirements at the given
+// time. Claims must implement AuthenticationContextClaimer, or be jwt.MapClaims.
+// It returns an *InsufficientUserAuthenticationError if they don't.
+func (r AuthenticationContextRequirements) Check(claims jwt.Claims, now time.Time) error {
+	if len(r.ACRValues) > 0 {
+		acr, err := getAuthenticationContextClass(claims)
+		if err != nil || !contains(r.ACRValues, acr) {
+			return r.insufficient("authentication context class is not accepted")
+		}
+	}
+	if r.RequireMFA {
+		amr, err := getAuthenticationMethods(claims)
+		if err != nil || !contains(amr, "mfa") {
+			return r.insufficient("multi-factor authentication is required")
+		}
+	}
+	if r.MaxAge > 0 {
+		authTime, err := getAuthTime(claims)
+		if err != nil || authTime == nil || now.Sub(authTime.Time) > r.MaxAge {
+			return r.insufficient("authentication is too old")
+		}
+	}
+	return nil
+}
+
+// insufficient returns a new *InsufficientUserAuthenticationError with the given reason.
+func (r AuthenticationContextRequirements) insufficient(reason string) error {
+	return &InsufficientUserAuthenticationError{Requirements: r, Reason: reason}
+}
+
+// challenge returns the WWW-Authenticate parameters used to request the client
+// to perform step-up authentication, as defined in RFC 9470 Section 3.
+func (r AuthenticationContextRequirements) challenge(reason string) map[string]string {
+	params := map[string]string{
+		"error":             ErrInsufficientUserAuthentication.Error(),
+		"error_description": reason,
+	}
+	if len(r.ACRValues) > 0 {
+		params["acr_values"] = strings.Join(r.ACRValues, " ")
+	}
+	if r.MaxAge > 0 {
+		params["max_age"] = strconv.FormatInt(int64(r.MaxAge/time.Second), 10)
+	}
+	return params
+}
+
+// RequireAuthenticationContext returns an HTTP middleware that enforces the given
+// requirements on the claims stored in the request context by HTTPMiddleware.
+//
+// Requests that don't satisfy the requirements are rejected with 401 Unauthorized
+// and an RFC 9470 insufficient_user_authentication challenge, signaling the
+// client to authenticate again with the requested acr_values and max_age.
+//
+//	admin := RequireAuthenticationContext(AuthenticationContextRequirements{
+//		RequireMFA: true,
+//		MaxAge:     10 * time.Minute,
+//	})
+//	mux.Handle("/admin", HTTPMiddleware(auth)(admin(adminHandler)))
+func RequireAuthenticationContext(requirements AuthenticationContextRequirements) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := ClaimsFromContext(r.Context())
+			if !ok {
+				writeBearerChallenge(w, http.StatusUnauthorized, nil)
+				return
+			}
+			if err := requirements.Check(claims, time.Now()); err != nil {
+				var insufficient *InsufficientUserAuthenticationError
+				reason := err.Error()
+				if errors.As(err, &insufficient) {
+					reason = insufficient.Reason
+				}
+				writeBearerChallenge(w, http.StatusUnauthorized, requirements.challenge(reason))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// getAuthenticationMethods returns the authentication methods (amr) from the given claims.
+func getAuthenticationMethods(claims jwt.Claims) ([]string, error) {
+	if c, ok := claims.(AuthenticationContextClaimer); ok {
+		return c.GetAuthenticationMethods()
+	}
+	return getStringsClaim(claims, "amr")
+}
+
+// getAuthenticationContextClass returns the authentication context class (acr) from the given claims.
+func getAuthenticationContextClass(claims jwt.Claims) (string, error) {
+	if c, ok := claims.(AuthenticationContextClaimer); ok {
+		return c.GetAuthenticationContextClass()
+	}
+	return getStringClaim(claims, "acr")
+}
+
+// getAuthTime returns the time when the user authenticated (auth_time) from the given claims.
+func getAuthTime(claims jwt.Claims) (*jwt.NumericDate, error) {
+	if c, ok := claims.(AuthenticationContextClaimer); ok {
+		return c.GetAuthTime()
+	}
+	return getNumericDateClaim(claims, "auth_time")
+}
+
+// contains returns true if the given list contains value.
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,102 @@
+package authentication
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuthenticationContextRequirements_Check(t *testing.T) {
+	now := time.Now()
+	claims := NewAuth0Claims(jwt.MapClaims{
+		"sub":       "gazebo-web",
+		"acr":       "urn:gazebo:acr:strong",
+		"amr":       []any{"pwd", "mfa"},
+		"auth_time": float64(now.Add(-5 * time.Minute).Unix()),
+	})
+
+	assert.NoError(t, AuthenticationContextRequirements{}.Check(claims, now))
+	assert.NoError(t, AuthenticationContextRequirements{
+		ACRValues:  []string{"urn:gazebo:acr:strong"},
+		RequireMFA: true,
+		MaxAge:     10 * time.Minute,
+	}.Check(claims, now))
+
+	err := AuthenticationContextRequirements{ACRValues: []string{"urn:gazebo:acr:phr"}}.Check(claims, now)
+	assert.ErrorIs(t, err, ErrInsufficientUserAuthentication)
+
+	err = AuthenticationContextRequirements{MaxAge: time.Minute}.Check(claims, now)
+	assert.ErrorIs(t, err, ErrInsufficientUserAuthentication)
+
+	err = AuthenticationContextRequirements{RequireMFA: true}.Check(NewAuth0Claims(jwt.MapClaims{"amr": []any{"pwd"}}), now)
+	assert.ErrorIs(t, err, ErrInsufficientUserAuthentication)
+
+	err = AuthenticationContextRequirements{RequireMFA: true}.Check(NewAuth0Claims(jwt.MapClaims{}), now)
+	assert.ErrorIs(t, err, ErrInsufficientUserAuthentication)
+}
+
+func TestAuthenticationContextRequirements_Check_Firebase(t *testing.T) {
+	now := time.Now()
+	token := NewFirebaseTestToken()
+	token.AuthTime = now.Add(-time.Minute).Unix()
+	requirements := AuthenticationContextRequirements{RequireMFA: true, MaxAge: 5 * time.Minute}
+
+	err := requirements.Check(NewFirebaseClaims(token), now)
+	assert.ErrorIs(t, err, ErrInsufficientUserAuthentication)
+
+	token.Claims["firebase"] = map[string]interface{}{
+		"sign_in_provider":      "google.com",
+		"sign_in_second_factor": "phone",
+	}
+	assert.NoError(t, requirements.Check(NewFirebaseClaims(token), now))
+}
+
+func TestRequireAuthenticationContext(t *testing.T) {
+	requirements := AuthenticationContextRequirements{
+		ACRValues:  []string{"urn:gazebo:acr:strong"},
+		RequireMFA: true,
+		MaxAge:     5 * time.Minute,
+	}
+	claims := jwt.MapClaims{
+		"acr":       "urn:gazebo:acr:strong",
+		"amr":       []any{"pwd", "mfa"},
+		"auth_time": float64(time.Now().Add(-10 * time.Minute).Unix()),
+	}
+	handler := HTTPMiddleware(authenticationWithClaims(claims))(
+		RequireAuthenticationContext(requirements)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			t.Fatal("handler should not be called")
+		})),
+	)
+
+	r := httptest.NewRequest(http.MethodGet, "/admin", nil)
+	r.Header.Set("Authorization", "Bearer token")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t,
+		`Bearer acr_values="urn:gazebo:acr:strong", error="insufficient_user_authentication", error_description="authentication is too old", max_age="300"`,
+		w.Header().Get("WWW-Authenticate"),
+	)
+}
+
+func TestRequireAuthenticationContext_Success(t *testing.T) {
+	claims := jwt.MapClaims{"amr": []any{"mfa"}}
+	var called bool
+	handler := HTTPMiddleware(authenticationWithClaims(claims))(
+		RequireAuthenticationContext(AuthenticationContextRequirements{RequireMFA: true})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			called = true
+		})),
+	)
+
+	r := httptest.NewRequest(http.MethodGet, "/admin", nil)
+	r.Header.Set("Authorization", "Bearer token")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	assert.True(t, called)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"testing"
 
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -24,3 +25,27 @@ func AssertJsonWebTokenValidation(t *testing.T, authentication Authentication) {
 	_, err = authentication.VerifyJWT(ctx, "eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9.eyJpc3MiOiJodHRwczovL215LWRvbWFpbi5hdXRoMC5jb20vIiwic3ViIjoiYXV0aDB8MTIzNDU2IiwiYXVkIjpbImh0dHBzOi8vZXhhbXBsZS5jb20vaGVhbHRoLWFwaSIsImh0dHBzOi8vbXktZG9tYWluLmF1dGgwLmNvbS91c2VyaW5mbyJdLCJhenAiOiJteV9jbGllbnRfaWQiLCJleHAiOjEzMTEyODE5NzAsImlhdCI6MTMxMTI4MDk3MCwic2NvcGUiOiJvcGVuaWQgcHJvZmlsZSByZWFkOnBhdGllbnRzIHJlYWQ6YWRtaW4ifQ.")
 	assert.Error(t, err)
 }
+
+// fakeAuthentication is an Authentication implementation that returns a
+// predefined set of claims or error.
+type fakeAuthentication struct {
+	claims jwt.Claims
+	err    error
+	calls  int
+}
+
+func (auth *fakeAuthentication) VerifyJWT(ctx context.Context, token string) (jwt.Claims, error) {
+	auth.calls++
+	if auth.err != nil {
+		return nil, auth.err
+	}
+	return auth.claims, nil
+}
+
+func authenticationWithClaims(claims jwt.Claims) *fakeAuthentication {
+	return &fakeAuthentication{claims: claims}
+}
+
+func authenticationWithError(err error) *fakeAuthentication {
+	return &fakeAuthentication{err: err}
+}
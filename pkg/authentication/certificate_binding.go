@@ -0,0 +1,77 @@
+package authentication
+
+import (
+	"crypto/subtle"
+	"crypto/x509"
+	"errors"
+	"fmt"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	// ErrCertificateBindingMismatch is returned when an access token bound to a
+	// client certificate is presented without that certificate.
+	ErrCertificateBindingMismatch = errors.New("access token is bound to a different certificate")
+	// ErrTokenNotBound is returned when an access token that must be bound to a
+	// client certificate doesn't contain a cnf claim.
+	ErrTokenNotBound = errors.New("access token is not bound to a certificate")
+)
+
+// certificateThumbprintKey is the cnf member containing the thumbprint of the
+// certificate an access token is bound to, as defined in RFC 8705 Section 3.1.
+const certificateThumbprintKey = "x5t#S256"
+
+// VerifyCertificateBinding verifies that the access token with the given claims
+// is bound to the given client certificate: its cnf claim must contain an
+// x5t#S256 member equal to the SHA-256 thumbprint of the certificate, see
+// RFC 8705.
+//
+// It returns ErrTokenNotBound if the claims don't contain a certificate
+// thumbprint, and ErrCertificateBindingMismatch if the certificate is missing or
+// doesn't match the thumbprint.
+func VerifyCertificateBinding(claims jwt.Claims, cert *x509.Certificate) error {
+	thumbprint, err := getConfirmationClaim(claims, certificateThumbprintKey)
+	if err != nil {
+		return err
+	}
+	if cert == nil {
+		return fmt.Errorf("%w: client certificate not provided", ErrCertificateBindingMismatch)
+	}
+	if subtle.ConstantTimeCompare([]byte(thumbprint), []byte(CertificateThumbprint(cert))) != 1 {
+		return ErrCertificateBindingMismatch
+	}
+	return nil
+}
+
+// getConfirmationClaim returns the member identified by the given key of the
+// cnf claim, as defined in RFC 7800. It returns ErrTokenNotBound if the member
+// is not present.
+func getConfirmationClaim(claims jwt.Claims, key string) (string, error) {
+	v, err := getClaim(claims, "cnf")
+	if err != nil {
+		return "", ErrTokenNotBound
+	}
+	cnf, ok := v.(map[string]any)
+	if !ok {
+		return "", fmt.Errorf("%w: invalid cnf value: should be an object", ErrTokenInvalid)
+	}
+	raw, ok := cnf[key]
+	if !ok {
+		return "", ErrTokenNotBound
+	}
+	value, ok := raw.(string)
+	if !ok || len(value) == 0 {
+		return "", fmt.Errorf("%w: invalid cnf %s value: should be a string", ErrTokenInvalid, key)
+	}
+	return value, nil
+}
+
+// certificateBindingError converts the given certificate binding error into a
+// VerificationError for the given provider.
+func certificateBindingError(provider string, err error) error {
+	if errors.Is(err, ErrTokenInvalid) {
+		return NewVerificationError(provider, ReasonMalformed, err)
+	}
+	return NewVerificationError(provider, ReasonBindingMismatch, err)
+}
@@ -0,0 +1,107 @@
+package authentication
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+func TestVerifyCertificateBinding(t *testing.T) {
+	ca := newTestCA(t)
+	cert := ca.issue(t, withSPIFFEID("spiffe://cluster.local/sa/worker")).Leaf
+	other := ca.issue(t, withSPIFFEID("spiffe://cluster.local/sa/other")).Leaf
+	bound := jwt.MapClaims{"sub": "worker", "cnf": map[string]any{"x5t#S256": CertificateThumbprint(cert)}}
+
+	assert.NoError(t, VerifyCertificateBinding(bound, cert))
+	assert.ErrorIs(t, VerifyCertificateBinding(bound, other), ErrCertificateBindingMismatch)
+	assert.ErrorIs(t, VerifyCertificateBinding(bound, nil), ErrCertificateBindingMismatch)
+
+	assert.ErrorIs(t, VerifyCertificateBinding(jwt.MapClaims{"sub": "worker"}, cert), ErrTokenNotBound)
+	assert.ErrorIs(t, VerifyCertificateBinding(jwt.MapClaims{"cnf": map[string]any{"jkt": "abc"}}, cert), ErrTokenNotBound)
+	assert.ErrorIs(t, VerifyCertificateBinding(jwt.MapClaims{"cnf": "abc"}, cert), ErrTokenInvalid)
+	assert.ErrorIs(t, VerifyCertificateBinding(jwt.MapClaims{"cnf": map[string]any{"x5t#S256": 1}}, cert), ErrTokenInvalid)
+}
+
+func newTLSRequest(cert *x509.Certificate) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Authorization", "Bearer token")
+	if cert != nil {
+		r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+	}
+	return r
+}
+
+func TestHTTPMiddleware_CertificateBinding(t *testing.T) {
+	ca := newTestCA(t)
+	cert := ca.issue(t, withSPIFFEID("spiffe://cluster.local/sa/worker")).Leaf
+	other := ca.issue(t, withSPIFFEID("spiffe://cluster.local/sa/other")).Leaf
+	bound := jwt.MapClaims{"sub": "worker", "cnf": map[string]any{"x5t#S256": CertificateThumbprint(cert)}}
+	unbound := jwt.MapClaims{"sub": "worker"}
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	cases := []struct {
+		name   string
+		claims jwt.Claims
+		cert   *x509.Certificate
+		opts   []MiddlewareOption
+		status int
+	}{
+		{name: "bound", claims: bound, cert: cert, status: http.StatusOK},
+		{name: "mismatch", claims: bound, cert: other, status: http.StatusUnauthorized},
+		{name: "no certificate", claims: bound, status: http.StatusUnauthorized},
+		{name: "unbound", claims: unbound, cert: cert, status: http.StatusOK},
+		{name: "unbound without certificate", claims: unbound, status: http.StatusOK},
+		{name: "unbound required", claims: unbound, cert: cert, opts: []MiddlewareOption{WithRequiredCertificateBinding()}, status: http.StatusUnauthorized},
+		{name: "bound required", claims: bound, cert: cert, opts: []MiddlewareOption{WithRequiredCertificateBinding()}, status: http.StatusOK},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			handler := HTTPMiddleware(authenticationWithClaims(tc.claims), tc.opts...)(ok)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, newTLSRequest(tc.cert))
+			assert.Equal(t, tc.status, w.Code)
+			if tc.status == http.StatusUnauthorized {
+				assert.Equal(t, `Bearer error="invalid_token"`, w.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+}
+
+func TestUnaryServerInterceptor_CertificateBinding(t *testing.T) {
+	ca := newTestCA(t)
+	cert := ca.issue(t, withSPIFFEID("spiffe://cluster.local/sa/worker")).Leaf
+	other := ca.issue(t, withSPIFFEID("spiffe://cluster.local/sa/other")).Leaf
+	claims := jwt.MapClaims{"sub": "worker", "cnf": map[string]any{"x5t#S256": CertificateThumbprint(cert)}}
+	interceptor := UnaryServerInterceptor(authenticationWithClaims(claims))
+	info := &grpc.UnaryServerInfo{FullMethod: "/gazebo.Worlds/List"}
+	handler := func(ctx context.Context, req any) (any, error) { return "ok", nil }
+
+	newContext := func(cert *x509.Certificate) context.Context {
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer token"))
+		return peer.NewContext(ctx, &peer.Peer{
+			AuthInfo: credentials.TLSInfo{State: tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}},
+		})
+	}
+
+	res, err := interceptor(newContext(cert), nil, info, handler)
+	require.NoError(t, err)
+	assert.Equal(t, "ok", res)
+
+	_, err = interceptor(newContext(other), nil, info, handler)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	assert.Contains(t, status.Convert(err).Message(), string(ReasonBindingMismatch))
+}
@@ -0,0 +1,600 @@
+package authentication
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	// ErrClaimRuleFailed is returned when a set of claims doesn't satisfy a ClaimRule.
+	ErrClaimRuleFailed = errors.New("claim rule failed")
+
+	// ErrNoClaimRules is returned when a set of claim rules is empty.
+	ErrNoClaimRules = errors.New("no claim rules defined")
+)
+
+// ClaimRuleError contains the details of a ClaimRule that was not satisfied. It
+// can be matched with errors.Is using ErrClaimRuleFailed.
+type ClaimRuleError struct {
+	// Rule is the description of the rule that failed.
+	Rule string
+	// Reason describes why the rule failed.
+	Reason string
+}
+
+// Error returns the error message.
+func (e *ClaimRuleError) Error() string {
+	return fmt.Sprintf("%s: %s: %s", ErrClaimRuleFailed, e.Rule, e.Reason)
+}
+
+// Unwrap returns ErrClaimRuleFailed.
+func (e *ClaimRuleError) Unwrap() error {
+	return ErrClaimRuleFailed
+}
+
+// ClaimRule validates a set of JWT claims.
+type ClaimRule interface {
+	// Validate returns a *ClaimRuleError if the given claims don't satisfy the rule.
+	Validate(claims jwt.Claims) error
+	// String returns a human-readable description of the rule, used to report
+	// which rule failed.
+	String() string
+}
+
+// Equals returns a ClaimRule that checks that the claim identified by the given
+// key is equal to value. Numeric values are compared regardless of their type.
+func Equals(claim string, value any) ClaimRule {
+	return &equalsRule{claim: claim, value: value}
+}
+
+// Contains returns a ClaimRule that checks that the claim identified by the
+// given key is a list containing value. String claims are treated as
+// space-delimited lists, as used by the OAuth 2.0 scope claim.
+func Contains(claim string, value any) ClaimRule {
+	return &containsRule{claim: claim, value: value}
+}
+
+// OneOf returns a ClaimRule that checks that the claim identified by the given
+// key is equal to any of the given values.
+func OneOf(claim string, values ...any) ClaimRule {
+	return &oneOfRule{claim: claim, values: values}
+}
+
+// Regex returns a ClaimRule that checks that the claim identified by the given
+// key is a string matching the given regular expression.
+// It panics if the expression cannot be parsed.
+func Regex(claim string, pattern string) ClaimRule {
+	return &regexRule{claim: claim, expr: regexp.MustCompile(pattern)}
+}
+
+// And returns a ClaimRule that is satisfied when all the given rules are satisfied.
+func And(rules ...ClaimRule) ClaimRule {
+	return &andRule{rules: rules}
+}
+
+// Or returns a ClaimRule that is satisfied when at least one of the given rules
+// is satisfied.
+func Or(rules ...ClaimRule) ClaimRule {
+	return &orRule{rules: rules}
+}
+
+// Not returns a ClaimRule that is satisfied when the given rule is not satisfied.
+func Not(rule ClaimRule) ClaimRule {
+	return &notRule{rule: rule}
+}
+
+// Named returns a ClaimRule that reports failures using the given name instead
+// of the description of the underlying rule.
+func Named(name string, rule ClaimRule) ClaimRule {
+	return &namedRule{name: name, rule: rule}
+}
+
+// equalsRule implements the Equals ClaimRule.
+type equalsRule struct {
+	claim string
+	value any
+}
+
+// Validate validates the rule against the given claims.
+func (r *equalsRule) Validate(claims jwt.Claims) error {
+	v, err := getRuleClaim(claims, r.claim)
+	if err != nil {
+		return &ClaimRuleError{Rule: r.String(), Reason: err.Error()}
+	}
+	if !equalValues(v, r.value) {
+		return &ClaimRuleError{Rule: r.String(), Reason: fmt.Sprintf("got %v", v)}
+	}
+	return nil
+}
+
+// String returns the description of the rule.
+func (r *equalsRule) String() string {
+	return fmt.Sprintf("%s == %v", r.claim, r.value)
+}
+
+// containsRule implements the Contains ClaimRule.
+type containsRule struct {
+	claim string
+	value any
+}
+
+// Validate validates the rule against the given claims.
+func (r *containsRule) Validate(claims jwt.Claims) error {
+	v, err := getRuleClaim(claims, r.claim)
+	if err != nil {
+		return &ClaimRuleError{Rule: r.String(), Reason: err.Error()}
+	}
+	list, ok := claimList(v)
+	if !ok {
+		return &ClaimRuleError{Rule: r.String(), Reason: "claim is not a list"}
+	}
+	for _, item := range list {
+		if equalValues(item, r.value) {
+			return nil
+		}
+	}
+	return &ClaimRuleError{Rule: r.String(), Reason: fmt.Sprintf("got %v", v)}
+}
+
+// String returns the description of the rule.
+func (r *containsRule) String() string {
+	return fmt.Sprintf("%s contains %v", r.claim, r.value)
+}
+
+// oneOfRule implements the OneOf ClaimRule.
+type oneOfRule struct {
+	claim  string
+	values []any
+}
+
+// Validate validates the rule against the given claims.
+func (r *oneOfRule) Validate(claims jwt.Claims) error {
+	v, err := getRuleClaim(claims, r.claim)
+	if err != nil {
+		return &ClaimRuleError{Rule: r.String(), Reason: err.Error()}
+	}
+	for _, value := range r.values {
+		if equalValues(v, value) {
+			return nil
+		}
+	}
+	return &ClaimRuleError{Rule: r.String(), Reason: fmt.Sprintf("got %v", v)}
+}
+
+// String returns the description of the rule.
+func (r *oneOfRule) String() string {
+	return fmt.Sprintf("%s in %v", r.claim, r.values)
+}
+
+// regexRule implements the Regex ClaimRule.
+type regexRule struct {
+	claim string
+	expr  *regexp.Regexp
+}
+
+// Validate validates the rule against the given claims.
+func (r *regexRule) Validate(claims jwt.Claims) error {
+	v, err := getRuleClaim(claims, r.claim)
+	if err != nil {
+		return &ClaimRuleError{Rule: r.String(), Reason: err.Error()}
+	}
+	s, ok := v.(string)
+	if !ok {
+		return &ClaimRuleError{Rule: r.String(), Reason: "claim is not a string"}
+	}
+	if !r.expr.MatchString(s) {
+		return &ClaimRuleError{Rule: r.String(), Reason: fmt.Sprintf("got %s", s)}
+	}
+	return nil
+}
+
+// String returns the description of the rule.
+func (r *regexRule) String() string {
+	return fmt.Sprintf("%s matches %s", r.claim, r.expr)
+}
+
+// andRule implements the And ClaimRule.
+type andRule struct {
+	rules []ClaimRule
+}
+
+// Validate validates the rule against the given claims. It returns the error of
+// the first rule that is not satisfied.
+func (r *andRule) Validate(claims jwt.Claims) error {
+	for _, rule := range r.rules {
+		if err := rule.Validate(claims); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// String returns the description of the rule.
+func (r *andRule) String() string {
+	return joinRules(r.rules, " && ")
+}
+
+// orRule implements the Or ClaimRule.
+type orRule struct {
+	rules []ClaimRule
+}
+
+// Validate validates the rule against the given claims.
+func (r *orRule) Validate(claims jwt.Claims) error {
+	reasons := make([]string, 0, len(r.rules))
+	for _, rule := range r.rules {
+		err := rule.Validate(claims)
+		if err == nil {
+			return nil
+		}
+		reasons = append(reasons, err.Error())
+	}
+	return &ClaimRuleError{Rule: r.String(), Reason: strings.Join(reasons, "; ")}
+}
+
+// String returns the description of the rule.
+func (r *orRule) String() string {
+	return joinRules(r.rules, " || ")
+}
+
+// notRule implements the Not ClaimRule.
+type notRule struct {
+	rule ClaimRule
+}
+
+// Validate validates the rule against the given claims.
+func (r *notRule) Validate(claims jwt.Claims) error {
+	if err := r.rule.Validate(claims); err != nil {
+		return nil
+	}
+	return &ClaimRuleError{Rule: r.String(), Reason: "rule is satisfied"}
+}
+
+// String returns the description of the rule.
+func (r *notRule) String() string {
+	return fmt.Sprintf("!(%s)", r.rule)
+}
+
+// namedRule implements the Named ClaimRule.
+type namedRule struct {
+	name string
+	rule ClaimRule
+}
+
+// Validate validates the rule against the given claims.
+func (r *namedRule) Validate(claims jwt.Claims) error {
+	if err := r.rule.Validate(claims); err != nil {
+		return &ClaimRuleError{Rule: r.name, Reason: err.Error()}
+	}
+	return nil
+}
+
+// String returns the name of the rule.
+func (r *namedRule) String() string {
+	return r.name
+}
+
+// claimRulesAuthentication is an Authentication decorator that validates the
+// claims returned by the underlying Authentication against a set of rules.
+type claimRulesAuthentication struct {
+	authentication Authentication
+	rule           ClaimRule
+}
+
+// VerifyJWT verifies the given token using the underlying Authentication and
+// validates the resulting claims against the configured rules.
+func (auth *claimRulesAuthentication) VerifyJWT(ctx context.Context, token string) (jwt.Claims, error) {
+	claims, err := auth.authentication.VerifyJWT(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if err := auth.rule.Validate(claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// NewClaimRules initializes a new Authentication implementation that wraps the
+// given Authentication and only accepts JWTs whose claims satisfy all the given
+// rules. It returns an error if no rules are given, since an empty set of rules
+// would accept every token.
+//
+//	auth, err := NewClaimRules(NewAuth0(publicKey),
+//		Equals("org_id", "org_123"),
+//		Or(Contains("roles", "admin"), Contains("amr", "mfa")),
+//	)
+func NewClaimRules(authentication Authentication, rules ...ClaimRule) (Authentication, error) {
+	if len(rules) == 0 {
+		return nil, ErrNoClaimRules
+	}
+	return &claimRulesAuthentication{
+		authentication: authentication,
+		rule:           And(rules...),
+	}, nil
+}
+
+// ClaimPolicy is the declarative representation of a set of ClaimRule, used to
+// load rules from YAML or JSON files.
+//
+//	rules:
+//	  - name: organization
+//	    claim: org_id
+//	    equals: org_123
+//	  - or:
+//	      - claim: roles
+//	        contains: admin
+//	      - claim: amr
+//	        contains: mfa
+type ClaimPolicy struct {
+	// Rules contains the rules that every set of claims must satisfy.
+	Rules []ClaimRuleDefinition `json:"rules" yaml:"rules"`
+}
+
+// Build converts the policy into a ClaimRule. It returns ErrNoClaimRules if the
+// policy doesn't contain any rule.
+func (p ClaimPolicy) Build() (ClaimRule, error) {
+	if len(p.Rules) == 0 {
+		return nil, ErrNoClaimRules
+	}
+	rules, err := buildClaimRules(p.Rules)
+	if err != nil {
+		return nil, err
+	}
+	return And(rules...), nil
+}
+
+// ClaimRuleDefinition is the declarative representation of a ClaimRule. Exactly
+// one of Equals, Contains, OneOf, Regex, And, Or and Not must be set. Claim is
+// required by Equals, Contains, OneOf and Regex.
+type ClaimRuleDefinition struct {
+	// Name is used to report failures instead of the description of the rule.
+	Name string `json:"name,omitempty" yaml:"name,omitempty"`
+	// Claim is the key of the claim the rule applies to.
+	Claim string `json:"claim,omitempty" yaml:"claim,omitempty"`
+
+	Equals   any                   `json:"equals,omitempty" yaml:"equals,omitempty"`
+	Contains any                   `json:"contains,omitempty" yaml:"contains,omitempty"`
+	OneOf    []any                 `json:"one_of,omitempty" yaml:"one_of,omitempty"`
+	Regex    string                `json:"regex,omitempty" yaml:"regex,omitempty"`
+	And      []ClaimRuleDefinition `json:"and,omitempty" yaml:"and,omitempty"`
+	Or       []ClaimRuleDefinition `json:"or,omitempty" yaml:"or,omitempty"`
+	Not      *ClaimRuleDefinition  `json:"not,omitempty" yaml:"not,omitempty"`
+}
+
+// Build converts the definition into a ClaimRule.
+func (d ClaimRuleDefinition) Build() (ClaimRule, error) {
+	rule, err := d.build()
+	if err != nil {
+		return nil, err
+	}
+	if len(d.Name) > 0 {
+		rule = Named(d.Name, rule)
+	}
+	return rule, nil
+}
+
+// build converts the definition into an unnamed ClaimRule.
+func (d ClaimRuleDefinition) build() (ClaimRule, error) {
+	var operators int
+	for _, set := range []bool{d.Equals != nil, d.Contains != nil, d.OneOf != nil, len(d.Regex) > 0, d.And != nil, d.Or != nil, d.Not != nil} {
+		if set {
+			operators++
+		}
+	}
+	if operators != 1 {
+		return nil, fmt.Errorf("invalid claim rule %q: exactly one operator must be defined, got %d", d.Name, operators)
+	}
+	requiresClaim := d.Equals != nil || d.Contains != nil || d.OneOf != nil || len(d.Regex) > 0
+	if requiresClaim && len(d.Claim) == 0 {
+		return nil, fmt.Errorf("invalid claim rule %q: missing claim", d.Name)
+	}
+
+	switch {
+	case d.Equals != nil:
+		return Equals(d.Claim, d.Equals), nil
+	case d.Contains != nil:
+		return Contains(d.Claim, d.Contains), nil
+	case d.OneOf != nil:
+		if len(d.OneOf) == 0 {
+			return nil, fmt.Errorf("invalid claim rule %q: one_of requires at least one value", d.Name)
+		}
+		return OneOf(d.Claim, d.OneOf...), nil
+	case len(d.Regex) > 0:
+		expr, err := regexp.Compile(d.Regex)
+		if err != nil {
+			return nil, fmt.Errorf("invalid claim rule %q: %w", d.Name, err)
+		}
+		return &regexRule{claim: d.Claim, expr: expr}, nil
+	case d.And != nil:
+		if len(d.And) == 0 {
+			return nil, fmt.Errorf("invalid claim rule %q: and requires at least one rule", d.Name)
+		}
+		rules, err := buildClaimRules(d.And)
+		if err != nil {
+			return nil, err
+		}
+		return And(rules...), nil
+	case d.Or != nil:
+		if len(d.Or) == 0 {
+			return nil, fmt.Errorf("invalid claim rule %q: or requires at least one rule", d.Name)
+		}
+		rules, err := buildClaimRules(d.Or)
+		if err != nil {
+			return nil, err
+		}
+		return Or(rules...), nil
+	default:
+		rule, err := d.Not.Build()
+		if err != nil {
+			return nil, err
+		}
+		return Not(rule), nil
+	}
+}
+
+// ParseClaimPolicy parses the given YAML or JSON policy and returns the
+// resulting ClaimRule. Unknown keys are rejected, so misspelled rules don't
+// silently accept every token.
+func ParseClaimPolicy(data []byte) (ClaimRule, error) {
+	var policy ClaimPolicy
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	// Empty documents are reported by Build as a policy without rules.
+	if err := decoder.Decode(&policy); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to parse claim policy: %w", err)
+	}
+	return policy.Build()
+}
+
+// LoadClaimPolicy reads the YAML or JSON policy file located at the given path
+// and returns the resulting ClaimRule.
+func LoadClaimPolicy(path string) (ClaimRule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseClaimPolicy(data)
+}
+
+// buildClaimRules converts a list of definitions into a list of ClaimRule.
+func buildClaimRules(definitions []ClaimRuleDefinition) ([]ClaimRule, error) {
+	rules := make([]ClaimRule, 0, len(definitions))
+	for _, d := range definitions {
+		rule, err := d.Build()
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// getRuleClaim returns the value of the claim identified by the given key.
+// Registered claims that are not available as custom claims, such as the ones
+// stripped by Firebase, are read using the jwt.Claims getters. Dates are
+// returned as seconds since the epoch, as they would be decoded from JSON.
+func getRuleClaim(claims jwt.Claims, key string) (any, error) {
+	v, err := getClaim(claims, key)
+	if err == nil {
+		return v, nil
+	}
+	switch key {
+	case "sub":
+		return nonEmptyClaim(key, claims.GetSubject)
+	case "iss":
+		return nonEmptyClaim(key, claims.GetIssuer)
+	case "aud":
+		aud, audErr := claims.GetAudience()
+		if audErr != nil || len(aud) == 0 {
+			return nil, err
+		}
+		if len(aud) == 1 {
+			return aud[0], nil
+		}
+		list := make([]any, 0, len(aud))
+		for _, a := range aud {
+			list = append(list, a)
+		}
+		return list, nil
+	case "exp":
+		return dateClaim(err, claims.GetExpirationTime)
+	case "iat":
+		return dateClaim(err, claims.GetIssuedAt)
+	case "nbf":
+		return dateClaim(err, claims.GetNotBefore)
+	}
+	return nil, err
+}
+
+// nonEmptyClaim returns the value returned by the given getter, or an error if
+// it's empty.
+func nonEmptyClaim(key string, get func() (string, error)) (any, error) {
+	v, err := get()
+	if err != nil {
+		return nil, err
+	}
+	if len(v) == 0 {
+		return nil, fmt.Errorf("failed to get %s value: not found", key)
+	}
+	return v, nil
+}
+
+// dateClaim returns the date returned by the given getter as seconds since the
+// epoch, or notFound if it's not set.
+func dateClaim(notFound error, get func() (*jwt.NumericDate, error)) (any, error) {
+	v, err := get()
+	if err != nil || v == nil {
+		return nil, notFound
+	}
+	return float64(v.Unix()), nil
+}
+
+// joinRules joins the descriptions of the given rules using sep.
+func joinRules(rules []ClaimRule, sep string) string {
+	descriptions := make([]string, 0, len(rules))
+	for _, rule := range rules {
+		descriptions = append(descriptions, rule.String())
+	}
+	return "(" + strings.Join(descriptions, sep) + ")"
+}
+
+// claimList converts the given claim value into a list. Strings are split
+// by spaces.
+func claimList(v any) ([]any, bool) {
+	switch value := v.(type) {
+	case []any:
+		return value, true
+	case string:
+		fields := strings.Fields(value)
+		list := make([]any, 0, len(fields))
+		for _, f := range fields {
+			list = append(list, f)
+		}
+		return list, true
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, false
+	}
+	list := make([]any, 0, rv.Len())
+	for i := 0; i < rv.Len(); i++ {
+		list = append(list, rv.Index(i).Interface())
+	}
+	return list, true
+}
+
+// equalValues returns true if both values are equal. Numeric values are
+// compared by value regardless of their type, given that JSON decoding
+// produces float64 while YAML and Go code usually produce integers.
+func equalValues(a, b any) bool {
+	fa, okA := toFloat(a)
+	fb, okB := toFloat(b)
+	if okA && okB {
+		return fa == fb
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// toFloat converts numeric values into float64.
+func toFloat(v any) (float64, bool) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	}
+	return 0, false
+}
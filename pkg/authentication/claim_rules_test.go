@@ -0,0 +1,167 @@
+package authentication
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClaimRules_Equals(t *testing.T) {
+	claims := jwt.MapClaims{"org_id": "org_123", "level": float64(3)}
+	assert.NoError(t, Equals("org_id", "org_123").Validate(claims))
+	assert.NoError(t, Equals("level", 3).Validate(claims))
+	assert.ErrorIs(t, Equals("org_id", "org_456").Validate(claims), ErrClaimRuleFailed)
+	assert.ErrorIs(t, Equals("missing", "value").Validate(claims), ErrClaimRuleFailed)
+}
+
+func TestClaimRules_Contains(t *testing.T) {
+	claims := jwt.MapClaims{"roles": []any{"admin", "user"}, "scope": "read:worlds write:worlds"}
+	assert.NoError(t, Contains("roles", "admin").Validate(claims))
+	assert.NoError(t, Contains("scope", "write:worlds").Validate(claims))
+	assert.ErrorIs(t, Contains("roles", "owner").Validate(claims), ErrClaimRuleFailed)
+	assert.ErrorIs(t, Contains("scope", "delete:worlds").Validate(claims), ErrClaimRuleFailed)
+
+	firebase := NewFirebaseTestToken()
+	firebase.Claims["roles"] = []string{"admin"}
+	assert.NoError(t, Contains("roles", "admin").Validate(NewFirebaseClaims(firebase)))
+}
+
+func TestClaimRules_OneOf(t *testing.T) {
+	claims := jwt.MapClaims{"tier": "gold"}
+	assert.NoError(t, OneOf("tier", "gold", "silver").Validate(claims))
+	assert.ErrorIs(t, OneOf("tier", "bronze").Validate(claims), ErrClaimRuleFailed)
+}
+
+func TestClaimRules_RegisteredClaims(t *testing.T) {
+	token := NewFirebaseTestToken()
+	token.Subject = "user-1"
+	token.Issuer = "https://securetoken.google.com/gazebo"
+	token.Audience = "gazebo"
+	claims := NewFirebaseClaims(token)
+
+	assert.NoError(t, Equals("sub", "user-1").Validate(claims))
+	assert.NoError(t, OneOf("iss", "https://securetoken.google.com/gazebo").Validate(claims))
+	assert.NoError(t, Equals("aud", "gazebo").Validate(claims))
+	assert.NoError(t, Contains("aud", "gazebo").Validate(claims))
+	assert.ErrorIs(t, Equals("sub", "user-2").Validate(claims), ErrClaimRuleFailed)
+}
+
+func TestClaimRules_Regex(t *testing.T) {
+	claims := jwt.MapClaims{"email": "user@openrobotics.org", "level": 1}
+	assert.NoError(t, Regex("email", `@openrobotics\.org$`).Validate(claims))
+	assert.ErrorIs(t, Regex("email", `@example\.com$`).Validate(claims), ErrClaimRuleFailed)
+	assert.ErrorIs(t, Regex("level", `1`).Validate(claims), ErrClaimRuleFailed)
+	assert.Panics(t, func() { Regex("email", "(") })
+}
+
+func TestClaimRules_Combinators(t *testing.T) {
+	claims := jwt.MapClaims{"org_id": "org_123", "roles": []any{"user"}}
+
+	assert.NoError(t, And(Equals("org_id", "org_123"), Contains("roles", "user")).Validate(claims))
+	err := And(Equals("org_id", "org_123"), Contains("roles", "admin")).Validate(claims)
+	var target *ClaimRuleError
+	require.True(t, errors.As(err, &target))
+	assert.Equal(t, "roles contains admin", target.Rule)
+
+	assert.NoError(t, Or(Contains("roles", "admin"), Contains("roles", "user")).Validate(claims))
+	assert.ErrorIs(t, Or(Contains("roles", "admin"), Equals("org_id", "org_456")).Validate(claims), ErrClaimRuleFailed)
+
+	assert.NoError(t, Not(Contains("roles", "banned")).Validate(claims))
+	assert.ErrorIs(t, Not(Contains("roles", "user")).Validate(claims), ErrClaimRuleFailed)
+
+	err = Named("admins only", Contains("roles", "admin")).Validate(claims)
+	require.True(t, errors.As(err, &target))
+	assert.Equal(t, "admins only", target.Rule)
+}
+
+func TestLoadClaimPolicy_YAML(t *testing.T) {
+	rule, err := LoadClaimPolicy("./testdata/claim_policy.yaml")
+	require.NoError(t, err)
+
+	assert.NoError(t, rule.Validate(jwt.MapClaims{
+		"org_id": "org_123",
+		"amr":    []any{"pwd", "mfa"},
+		"email":  "user@openrobotics.org",
+	}))
+
+	err = rule.Validate(jwt.MapClaims{
+		"org_id": "org_456",
+		"roles":  []any{"admin"},
+		"email":  "user@openrobotics.org",
+	})
+	var target *ClaimRuleError
+	require.True(t, errors.As(err, &target))
+	assert.Equal(t, "organization", target.Rule)
+
+	assert.ErrorIs(t, rule.Validate(jwt.MapClaims{
+		"org_id": "org_123",
+		"roles":  []any{"admin"},
+		"email":  "user@example.com",
+	}), ErrClaimRuleFailed)
+}
+
+func TestLoadClaimPolicy_JSON(t *testing.T) {
+	rule, err := LoadClaimPolicy("./testdata/claim_policy.json")
+	require.NoError(t, err)
+
+	assert.NoError(t, rule.Validate(jwt.MapClaims{"level": float64(3), "tier": "gold"}))
+	assert.ErrorIs(t, rule.Validate(jwt.MapClaims{"level": float64(2), "tier": "gold"}), ErrClaimRuleFailed)
+}
+
+func TestParseClaimPolicy_Invalid(t *testing.T) {
+	_, err := ParseClaimPolicy([]byte(`rules: [{claim: org_id}]`))
+	assert.Error(t, err)
+
+	_, err = ParseClaimPolicy([]byte(`rules: [{claim: org_id, equals: a, contains: b}]`))
+	assert.Error(t, err)
+
+	_, err = ParseClaimPolicy([]byte(`rules: [{equals: a}]`))
+	assert.Error(t, err)
+
+	_, err = ParseClaimPolicy([]byte(`rules: [{claim: email, regex: "("}]`))
+	assert.Error(t, err)
+
+	_, err = ParseClaimPolicy([]byte(`rules: [{claim: tier, one_of: []}]`))
+	assert.Error(t, err)
+
+	_, err = ParseClaimPolicy([]byte(`rules: [{and: []}]`))
+	assert.Error(t, err)
+
+	// Policies without rules would accept every token.
+	_, err = ParseClaimPolicy([]byte(``))
+	assert.ErrorIs(t, err, ErrNoClaimRules)
+	_, err = ParseClaimPolicy([]byte(`rules: []`))
+	assert.ErrorIs(t, err, ErrNoClaimRules)
+
+	// Unknown keys, such as misspelled ones, are rejected.
+	_, err = ParseClaimPolicy([]byte(`rule: [{claim: org_id, equals: org_123}]`))
+	assert.Error(t, err)
+	_, err = ParseClaimPolicy([]byte(`rules: [{claim: org_id, equal: org_123}]`))
+	assert.Error(t, err)
+
+	_, err = LoadClaimPolicy("./testdata/missing.yaml")
+	assert.Error(t, err)
+}
+
+func TestNewClaimRules(t *testing.T) {
+	ctx := context.Background()
+	claims := NewAuth0Claims(jwt.MapClaims{"sub": "gazebo-web", "org_id": "org_123"})
+
+	auth, err := NewClaimRules(authenticationWithClaims(claims), Equals("org_id", "org_123"))
+	require.NoError(t, err)
+	result, err := auth.VerifyJWT(ctx, "token")
+	assert.NoError(t, err)
+	assert.Equal(t, claims, result)
+
+	auth, err = NewClaimRules(authenticationWithClaims(claims), Equals("org_id", "org_456"))
+	require.NoError(t, err)
+	_, err = auth.VerifyJWT(ctx, "token")
+	assert.ErrorIs(t, err, ErrClaimRuleFailed)
+
+	_, err = NewClaimRules(authenticationWithClaims(claims))
+	assert.ErrorIs(t, err, ErrNoClaimRules)
+}
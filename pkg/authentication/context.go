@@ -0,0 +1,50 @@
+package authentication
+
+import (
+	"context"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// claimsContextKey is the key used to store the verified claims in a context.Context.
+type claimsContextKey struct{}
+
+// WithClaims returns a copy of ctx that carries the given verified claims.
+func WithClaims(ctx context.Context, claims jwt.Claims) context.Context {
+	return context.WithValue(ctx, claimsContextKey{}, claims)
+}
+
+// ClaimsFromContext returns the verified claims stored in ctx by WithClaims.
+func ClaimsFromContext(ctx context.Context) (jwt.Claims, bool) {
+	claims, ok := ctx.Value(claimsContextKey{}).(jwt.Claims)
+	return claims, ok
+}
+
+// RequestMetadata contains information about the request that presented a
+// credential, used to enrich audit events.
+type RequestMetadata struct {
+	// RemoteAddr is the network address of the client that sent the request.
+	RemoteAddr string `json:"remote_addr,omitempty"`
+	// UserAgent is the user agent of the client that sent the request.
+	UserAgent string `json:"user_agent,omitempty"`
+	// Method is the HTTP method or the gRPC full method name of the request.
+	Method string `json:"method,omitempty"`
+	// Path is the path of the request.
+	Path string `json:"path,omitempty"`
+	// RequestID is the identifier of the request, if any.
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// requestMetadataContextKey is the key used to store the RequestMetadata in a context.Context.
+type requestMetadataContextKey struct{}
+
+// WithRequestMetadata returns a copy of ctx that carries the given request metadata.
+func WithRequestMetadata(ctx context.Context, metadata RequestMetadata) context.Context {
+	return context.WithValue(ctx, requestMetadataContextKey{}, metadata)
+}
+
+// RequestMetadataFromContext returns the request metadata stored in ctx by WithRequestMetadata.
+func RequestMetadataFromContext(ctx context.Context) (RequestMetadata, bool) {
+	metadata, ok := ctx.Value(requestMetadataContextKey{}).(RequestMetadata)
+	return metadata, ok
+}
@@ -0,0 +1,482 @@
+package authentication
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	// ErrInvalidDPoPProof is returned when the DPoP proof of a request is missing
+	// or invalid.
+	ErrInvalidDPoPProof = errors.New("invalid dpop proof")
+	// ErrDPoPNonceRequired is returned when a DPoP proof doesn't contain the
+	// nonce provided by the server. Clients should retry using the nonce sent in
+	// the DPoP-Nonce header.
+	ErrDPoPNonceRequired = errors.New("dpop nonce required")
+	// ErrDPoPKeyMismatch is returned when an access token bound to a DPoP key is
+	// presented with a proof signed by a different key.
+	ErrDPoPKeyMismatch = errors.New("access token is bound to a different dpop key")
+	// ErrDPoPProofRequired is returned when an access token bound to a DPoP key
+	// is presented as a bearer token, without a proof.
+	ErrDPoPProofRequired = errors.New("access token is bound to a dpop key")
+)
+
+const (
+	// DPoPHeader is the header containing the DPoP proof of a request.
+	DPoPHeader = "DPoP"
+	// DPoPNonceHeader is the header used by servers to provide nonces to clients.
+	DPoPNonceHeader = "DPoP-Nonce"
+	// dpopProofType is the typ header of DPoP proofs.
+	dpopProofType = "dpop+jwt"
+	// dpopKeyThumbprintKey is the cnf member containing the thumbprint of the key
+	// an access token is bound to, as defined in RFC 9449 Section 6.1.
+	dpopKeyThumbprintKey = "jkt"
+	// dpopClockSkew is the tolerance applied to proofs issued in the future.
+	dpopClockSkew = time.Minute
+)
+
+// DPoPProof contains the verified claims of a DPoP proof.
+type DPoPProof struct {
+	// Key is the public key the proof was signed with.
+	Key JWK
+	// Thumbprint is the RFC 7638 thumbprint of Key.
+	Thumbprint string
+	// ID is the unique identifier of the proof (jti).
+	ID string
+	// Method is the HTTP method of the request the proof was issued for (htm).
+	Method string
+	// URL is the HTTP URL of the request the proof was issued for (htu).
+	URL string
+	// IssuedAt is the time when the proof was issued (iat).
+	IssuedAt time.Time
+	// Nonce is the server-provided nonce, if any.
+	Nonce string
+}
+
+// DPoPVerifier verifies DPoP proofs, as defined in RFC 9449.
+type DPoPVerifier interface {
+	// VerifyProof verifies that the given proof was issued for the given
+	// request. If accessToken is not empty, the proof must contain its hash.
+	VerifyProof(r *http.Request, proof string, accessToken string) (*DPoPProof, error)
+	// NextNonce returns the nonce clients must include in their next proofs, or
+	// an empty string if the verifier doesn't use nonces.
+	NextNonce(ctx context.Context) (string, error)
+}
+
+// DPoPNonces issues and validates the nonces servers provide to DPoP clients in
+// order to limit the lifetime of proofs.
+type DPoPNonces interface {
+	// Nonce returns a fresh nonce.
+	Nonce(ctx context.Context) (string, error)
+	// Valid returns true if the given nonce is valid.
+	Valid(ctx context.Context, nonce string) bool
+}
+
+// dpopNonces is a stateless DPoPNonces implementation. Nonces contain the
+// current time window and its HMAC, so they can be validated by any server
+// sharing the same secret.
+type dpopNonces struct {
+	secret []byte
+	window time.Duration
+	now    func() time.Time
+}
+
+// Nonce returns the nonce of the current time window.
+func (n *dpopNonces) Nonce(ctx context.Context) (string, error) {
+	return n.nonce(n.now().UnixNano() / int64(n.window)), nil
+}
+
+// Valid returns true if the given nonce belongs to the current or the previous
+// time window.
+func (n *dpopNonces) Valid(ctx context.Context, nonce string) bool {
+	current := n.now().UnixNano() / int64(n.window)
+	for _, w := range []int64{current, current - 1} {
+		if subtle.ConstantTimeCompare([]byte(nonce), []byte(n.nonce(w))) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// nonce returns the nonce of the given time window.
+func (n *dpopNonces) nonce(window int64) string {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(window))
+	mac := hmac.New(sha256.New, n.secret)
+	mac.Write(b)
+	return base64.RawURLEncoding.EncodeToString(append(b, mac.Sum(nil)[:16]...))
+}
+
+// NewDPoPNonces initializes a new DPoPNonces that issues a new nonce every
+// window, and accepts nonces from the current and previous windows. Nonces are
+// derived from the given secret, which must be shared by every server. The
+// window defaults to 1 minute if it's not positive.
+func NewDPoPNonces(secret []byte, window time.Duration) DPoPNonces {
+	if window <= 0 {
+		window = time.Minute
+	}
+	return &dpopNonces{
+		secret: secret,
+		window: window,
+		now:    time.Now,
+	}
+}
+
+// DPoPOption configures a DPoPVerifier.
+type DPoPOption func(*dpopVerifier)
+
+// WithDPoPLifetime sets the maximum age of DPoP proofs. Defaults to 5 minutes.
+func WithDPoPLifetime(d time.Duration) DPoPOption {
+	return func(v *dpopVerifier) {
+		v.lifetime = d
+	}
+}
+
+// WithDPoPReplayStore sets the ReplayCache used to record the jti of verified
+// proofs in order to reject replayed proofs. Defaults to a ReplayCache that keeps
+// identifiers in memory, which only protects against replays sent to the same
+// server.
+func WithDPoPReplayStore(store ReplayCache) DPoPOption {
+	return func(v *dpopVerifier) {
+		v.replays = store
+	}
+}
+
+// WithDPoPNonces requires proofs to contain a nonce issued by the given
+// DPoPNonces, see RFC 9449 Section 8.
+func WithDPoPNonces(nonces DPoPNonces) DPoPOption {
+	return func(v *dpopVerifier) {
+		v.nonces = nonces
+	}
+}
+
+// WithDPoPAlgorithms sets the signing algorithms accepted for DPoP proofs.
+// Defaults to ES256, ES384, ES512, PS256, PS384, PS512, RS256 and EdDSA.
+func WithDPoPAlgorithms(algs ...string) DPoPOption {
+	return func(v *dpopVerifier) {
+		v.algorithms = algs
+	}
+}
+
+// WithDPoPRequestURL sets the function used to compute the URL of incoming
+// requests, which is compared against the htu claim of proofs. Defaults to the
+// scheme of the connection, the Host header and the path of the request. Use
+// this option when running behind a proxy that rewrites any of them.
+func WithDPoPRequestURL(fn func(r *http.Request) string) DPoPOption {
+	return func(v *dpopVerifier) {
+		v.requestURL = fn
+	}
+}
+
+// dpopVerifier is a DPoPVerifier implementation.
+type dpopVerifier struct {
+	lifetime   time.Duration
+	replays    ReplayCache
+	nonces     DPoPNonces
+	algorithms []string
+	requestURL func(r *http.Request) string
+	now        func() time.Time
+}
+
+// NextNonce returns a fresh nonce if nonces are enabled.
+func (v *dpopVerifier) NextNonce(ctx context.Context) (string, error) {
+	if v.nonces == nil {
+		return "", nil
+	}
+	return v.nonces.Nonce(ctx)
+}
+
+// VerifyProof verifies the given DPoP proof, following RFC 9449 Section 4.3.
+// Failures are reported as a *VerificationError matching ErrInvalidDPoPProof.
+func (v *dpopVerifier) VerifyProof(r *http.Request, proof string, accessToken string) (*DPoPProof, error) {
+	ctx := r.Context()
+	if len(proof) == 0 {
+		return nil, dpopProofError(ReasonNotProvided, errors.New("proof not provided"))
+	}
+
+	var key JWK
+	parser := jwt.NewParser(jwt.WithValidMethods(v.algorithms), jwt.WithoutClaimsValidation())
+	token, err := parser.Parse(proof, func(t *jwt.Token) (any, error) {
+		if typ, _ := t.Header["typ"].(string); typ != dpopProofType {
+			return nil, fmt.Errorf("invalid typ header: %q", typ)
+		}
+		raw, err := json.Marshal(t.Header["jwk"])
+		if err != nil || json.Unmarshal(raw, &key) != nil || len(key.Kty) == 0 {
+			return nil, errors.New("invalid jwk header")
+		}
+		if key.IsPrivate() {
+			return nil, errors.New("jwk header must not contain a private key")
+		}
+		return key.PublicKey()
+	})
+	if err != nil {
+		if errors.Is(err, jwt.ErrTokenSignatureInvalid) {
+			return nil, dpopProofError(ReasonBadSignature, err)
+		}
+		return nil, dpopProofError(ReasonMalformed, err)
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, dpopProofError(ReasonMalformed, errors.New("invalid claims"))
+	}
+
+	p := &DPoPProof{Key: key}
+	if p.Thumbprint, err = key.Thumbprint(); err != nil {
+		return nil, dpopProofError(ReasonMalformed, err)
+	}
+	p.ID, _ = claims["jti"].(string)
+	p.Method, _ = claims["htm"].(string)
+	p.URL, _ = claims["htu"].(string)
+	p.Nonce, _ = claims["nonce"].(string)
+	iat, err := claims.GetIssuedAt()
+	if err != nil || iat == nil || len(p.ID) == 0 || len(p.Method) == 0 || len(p.URL) == 0 {
+		return nil, dpopProofError(ReasonMalformed, errors.New("missing jti, htm, htu or iat claims"))
+	}
+	p.IssuedAt = iat.Time
+
+	if p.Method != r.Method {
+		return nil, dpopProofError(ReasonInvalid, fmt.Errorf("htm %q does not match request method", p.Method))
+	}
+	if normalizeHTU(p.URL) != normalizeHTU(v.requestURL(r)) {
+		return nil, dpopProofError(ReasonInvalid, fmt.Errorf("htu %q does not match request url", p.URL))
+	}
+
+	now := v.now()
+	if p.IssuedAt.Before(now.Add(-v.lifetime)) {
+		return nil, dpopProofError(ReasonExpired, errors.New("proof is too old"))
+	}
+	if p.IssuedAt.After(now.Add(dpopClockSkew)) {
+		return nil, dpopProofError(ReasonNotYetValid, errors.New("proof is issued in the future"))
+	}
+
+	if v.nonces != nil && !v.nonces.Valid(ctx, p.Nonce) {
+		return nil, NewVerificationError(ProviderDPoP, ReasonInvalid, ErrDPoPNonceRequired)
+	}
+
+	if len(accessToken) > 0 {
+		ath, _ := claims["ath"].(string)
+		sum := sha256.Sum256([]byte(accessToken))
+		if subtle.ConstantTimeCompare([]byte(ath), []byte(base64.RawURLEncoding.EncodeToString(sum[:]))) != 1 {
+			return nil, dpopProofError(ReasonInvalid, errors.New("ath does not match access token"))
+		}
+	}
+
+	ok, err = v.replays.Use(ctx, p.Thumbprint+":"+p.ID, p.IssuedAt.Add(v.lifetime))
+	if err != nil {
+		return nil, NewVerificationError(ProviderDPoP, ReasonProviderUnavailable, err)
+	}
+	if !ok {
+		return nil, dpopProofError(ReasonReplayed, ErrReplayed)
+	}
+	return p, nil
+}
+
+// NewDPoPVerifier initializes a new DPoPVerifier.
+func NewDPoPVerifier(opts ...DPoPOption) DPoPVerifier {
+	v := &dpopVerifier{
+		lifetime:   5 * time.Minute,
+		replays:    NewMemoryReplayCache(),
+		algorithms: []string{"ES256", "ES384", "ES512", "PS256", "PS384", "PS512", "RS256", "EdDSA"},
+		requestURL: dpopRequestURL,
+		now:        time.Now,
+	}
+	for _, opt := range opts {
+		opt(v)
+	}
+	return v
+}
+
+// dpopProofError returns a VerificationError matching ErrInvalidDPoPProof.
+func dpopProofError(reason Reason, err error) error {
+	return NewVerificationError(ProviderDPoP, reason, fmt.Errorf("%w: %w", ErrInvalidDPoPProof, err))
+}
+
+// dpopRequestURL returns the URL of the given request, using the scheme of the
+// connection and the Host header.
+func dpopRequestURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + r.URL.EscapedPath()
+}
+
+// normalizeHTU normalizes the given URL for comparison, following RFC 9449
+// Section 4.3: the query and fragment are removed, the scheme and host are
+// lower-cased, and default ports are removed.
+func normalizeHTU(value string) string {
+	u, err := url.Parse(value)
+	if err != nil {
+		return value
+	}
+	scheme := strings.ToLower(u.Scheme)
+	host := strings.ToLower(u.Hostname())
+	if port := u.Port(); len(port) > 0 && !(scheme == "http" && port == "80") && !(scheme == "https" && port == "443") {
+		host += ":" + port
+	}
+	path := u.EscapedPath()
+	if len(path) == 0 {
+		path = "/"
+	}
+	return scheme + "://" + host + path
+}
+
+// VerifyDPoPBinding verifies that the access token with the given claims is
+// bound to the key of the given proof: its cnf claim must contain a jkt member
+// equal to the thumbprint of the key, see RFC 9449 Section 6.
+//
+// It returns ErrTokenNotBound if the claims don't contain a key thumbprint, and
+// ErrDPoPKeyMismatch if the thumbprint doesn't match.
+func VerifyDPoPBinding(claims jwt.Claims, proof *DPoPProof) error {
+	jkt, err := getConfirmationClaim(claims, dpopKeyThumbprintKey)
+	if err != nil {
+		return err
+	}
+	if subtle.ConstantTimeCompare([]byte(jkt), []byte(proof.Thumbprint)) != 1 {
+		return ErrDPoPKeyMismatch
+	}
+	return nil
+}
+
+// dpopBindingError converts the given DPoP binding error into a VerificationError
+// for the given provider.
+func dpopBindingError(provider string, err error) error {
+	if errors.Is(err, ErrTokenInvalid) {
+		return NewVerificationError(provider, ReasonMalformed, err)
+	}
+	return NewVerificationError(provider, ReasonBindingMismatch, err)
+}
+
+// rejectDPoPBinding returns ErrDPoPProofRequired if the access token with the
+// given claims is bound to a DPoP key. It's used to reject DPoP-bound tokens sent
+// without a proof, see RFC 9449 Section 7.2.
+func rejectDPoPBinding(claims jwt.Claims) error {
+	_, err := getConfirmationClaim(claims, dpopKeyThumbprintKey)
+	if errors.Is(err, ErrTokenNotBound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return ErrDPoPProofRequired
+}
+
+// DPoPTokenExtractor returns a TokenExtractor that reads the token from the
+// Authorization header using the DPoP scheme.
+func DPoPTokenExtractor() TokenExtractor {
+	return func(r *http.Request) (string, error) {
+		values := r.Header.Values("Authorization")
+		if len(values) > 1 {
+			return "", ErrMultipleTokens
+		}
+		if len(values) == 0 || len(values[0]) == 0 {
+			return "", ErrTokenNotProvided
+		}
+		scheme, token, ok := strings.Cut(values[0], " ")
+		if !ok || !strings.EqualFold(scheme, "DPoP") || len(strings.TrimSpace(token)) == 0 {
+			return "", fmt.Errorf("%w: invalid authorization header", ErrTokenInvalid)
+		}
+		return strings.TrimSpace(token), nil
+	}
+}
+
+// DPoPMiddleware returns an HTTP middleware that verifies DPoP-bound access
+// tokens, as defined in RFC 9449. Tokens are read from the Authorization header
+// using the DPoP scheme and verified using the given Authentication, while the
+// proof sent in the DPoP header is verified using the given DPoPVerifier. The
+// access token must be bound to the key of the proof through its cnf claim.
+//
+// Requests are rejected with a DPoP challenge. When the verifier uses nonces,
+// every response includes a fresh nonce in the DPoP-Nonce header.
+//
+// Like HTTPMiddleware, the claims and the Principal are stored in the request
+// context.
+//
+//	verifier := NewDPoPVerifier(WithDPoPNonces(NewDPoPNonces(secret, time.Minute)))
+//	mux.Handle("/worlds", DPoPMiddleware(auth, verifier)(worldsHandler))
+func DPoPMiddleware(auth Authentication, verifier DPoPVerifier, opts ...MiddlewareOption) func(http.Handler) http.Handler {
+	cfg := newMiddlewareConfig(DPoPTokenExtractor(), opts)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r = r.WithContext(WithRequestMetadata(r.Context(), newHTTPRequestMetadata(r)))
+			nonce, err := verifier.NextNonce(r.Context())
+			if err != nil {
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+			if len(nonce) > 0 {
+				w.Header().Set(DPoPNonceHeader, nonce)
+			}
+
+			token, err := cfg.extractor(r)
+			if err != nil {
+				writeDPoPError(w, err)
+				return
+			}
+			proofs := r.Header.Values(DPoPHeader)
+			if len(proofs) > 1 {
+				writeDPoPError(w, dpopProofError(ReasonMalformed, errors.New("multiple proofs provided")))
+				return
+			}
+			var proof string
+			if len(proofs) == 1 {
+				proof = proofs[0]
+			}
+			p, err := verifier.VerifyProof(r, proof, token)
+			if err != nil {
+				writeDPoPError(w, err)
+				return
+			}
+			claims, err := auth.VerifyJWT(r.Context(), token)
+			if err != nil {
+				writeDPoPError(w, err)
+				return
+			}
+			principal, err := cfg.mapper(claims)
+			if err != nil {
+				writeDPoPError(w, err)
+				return
+			}
+			if err := VerifyDPoPBinding(claims, p); err != nil {
+				writeDPoPError(w, dpopBindingError(principal.Provider, err))
+				return
+			}
+			ctx := WithPrincipal(WithClaims(r.Context(), claims), principal)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// writeDPoPError responds with the status code matching the given verification
+// error. Unauthorized responses include a DPoP challenge, as defined in RFC 9449
+// Section 7.1.
+func writeDPoPError(w http.ResponseWriter, err error) {
+	status := HTTPStatusCode(err)
+	switch {
+	case errors.Is(err, ErrMultipleTokens):
+		writeChallenge(w, "DPoP", status, map[string]string{"error": "invalid_request"})
+	case status != http.StatusUnauthorized:
+		http.Error(w, http.StatusText(status), status)
+	case errors.Is(err, ErrDPoPNonceRequired):
+		writeChallenge(w, "DPoP", status, map[string]string{"error": "use_dpop_nonce"})
+	case errors.Is(err, ErrInvalidDPoPProof):
+		writeChallenge(w, "DPoP", status, map[string]string{"error": "invalid_dpop_proof"})
+	case ReasonOf(err) == ReasonNotProvided:
+		writeChallenge(w, "DPoP", status, nil)
+	default:
+		writeChallenge(w, "DPoP", status, map[string]string{"error": "invalid_token"})
+	}
+}
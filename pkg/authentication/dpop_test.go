@@ -0,0 +1,336 @@
+package authentication
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// testDPoPClient signs DPoP proofs in tests.
+type testDPoPClient struct {
+	key *ecdsa.PrivateKey
+	jwk JWK
+}
+
+func newTestDPoPClient(t *testing.T) *testDPoPClient {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	jwk, err := NewJWK(&key.PublicKey)
+	require.NoError(t, err)
+	return &testDPoPClient{key: key, jwk: jwk}
+}
+
+func (c *testDPoPClient) thumbprint(t *testing.T) string {
+	thumbprint, err := c.jwk.Thumbprint()
+	require.NoError(t, err)
+	return thumbprint
+}
+
+// proof returns a signed proof after applying the given function to its claims.
+func (c *testDPoPClient) proof(t *testing.T, method, url string, fn func(header map[string]any, claims jwt.MapClaims)) string {
+	jti, err := randomHex(8)
+	require.NoError(t, err)
+	claims := jwt.MapClaims{
+		"jti": jti,
+		"htm": method,
+		"htu": url,
+		"iat": time.Now().Unix(),
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+	token.Header["typ"] = "dpop+jwt"
+	token.Header["jwk"] = c.jwk
+	if fn != nil {
+		fn(token.Header, claims)
+	}
+	signed, err := token.SignedString(c.key)
+	require.NoError(t, err)
+	return signed
+}
+
+func accessTokenHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func TestDPoPVerifier_VerifyProof(t *testing.T) {
+	client := newTestDPoPClient(t)
+	v := NewDPoPVerifier()
+
+	r := httptest.NewRequest(http.MethodPost, "https://api.gazebosim.org/v1/worlds?page=2", nil)
+	proof := client.proof(t, http.MethodPost, "https://API.gazebosim.org:443/v1/worlds", func(_ map[string]any, claims jwt.MapClaims) {
+		claims["ath"] = accessTokenHash("token")
+	})
+	p, err := v.VerifyProof(r, proof, "token")
+	require.NoError(t, err)
+	assert.Equal(t, client.thumbprint(t), p.Thumbprint)
+	assert.Equal(t, http.MethodPost, p.Method)
+
+	// Proofs can only be used once.
+	_, err = v.VerifyProof(r, proof, "token")
+	assert.ErrorIs(t, err, ErrInvalidDPoPProof)
+	assert.ErrorIs(t, err, ErrReplayed)
+	assert.Equal(t, ReasonReplayed, ReasonOf(err))
+}
+
+func TestDPoPVerifier_VerifyProofErrors(t *testing.T) {
+	client := newTestDPoPClient(t)
+	other := newTestDPoPClient(t)
+	const url = "https://api.gazebosim.org/v1/worlds"
+
+	cases := []struct {
+		name   string
+		proof  string
+		reason Reason
+	}{
+		{name: "missing", proof: "", reason: ReasonNotProvided},
+		{name: "malformed", proof: "not-a-jwt", reason: ReasonMalformed},
+		{
+			name: "wrong typ",
+			proof: client.proof(t, http.MethodGet, url, func(header map[string]any, _ jwt.MapClaims) {
+				header["typ"] = "JWT"
+			}),
+			reason: ReasonMalformed,
+		},
+		{
+			name: "missing jwk",
+			proof: client.proof(t, http.MethodGet, url, func(header map[string]any, _ jwt.MapClaims) {
+				delete(header, "jwk")
+			}),
+			reason: ReasonMalformed,
+		},
+		{
+			name: "private jwk",
+			proof: client.proof(t, http.MethodGet, url, func(header map[string]any, _ jwt.MapClaims) {
+				jwk := client.jwk
+				jwk.D = "AQ"
+				header["jwk"] = jwk
+			}),
+			reason: ReasonMalformed,
+		},
+		{
+			name: "different jwk",
+			proof: client.proof(t, http.MethodGet, url, func(header map[string]any, _ jwt.MapClaims) {
+				header["jwk"] = other.jwk
+			}),
+			reason: ReasonBadSignature,
+		},
+		{
+			name: "missing jti",
+			proof: client.proof(t, http.MethodGet, url, func(_ map[string]any, claims jwt.MapClaims) {
+				delete(claims, "jti")
+			}),
+			reason: ReasonMalformed,
+		},
+		{name: "wrong htm", proof: client.proof(t, http.MethodPost, url, nil), reason: ReasonInvalid},
+		{name: "wrong htu", proof: client.proof(t, http.MethodGet, "https://api.gazebosim.org/v1/users", nil), reason: ReasonInvalid},
+		{
+			name: "too old",
+			proof: client.proof(t, http.MethodGet, url, func(_ map[string]any, claims jwt.MapClaims) {
+				claims["iat"] = time.Now().Add(-10 * time.Minute).Unix()
+			}),
+			reason: ReasonExpired,
+		},
+		{
+			name: "in the future",
+			proof: client.proof(t, http.MethodGet, url, func(_ map[string]any, claims jwt.MapClaims) {
+				claims["iat"] = time.Now().Add(10 * time.Minute).Unix()
+			}),
+			reason: ReasonNotYetValid,
+		},
+		{
+			name: "wrong ath",
+			proof: client.proof(t, http.MethodGet, url, func(_ map[string]any, claims jwt.MapClaims) {
+				claims["ath"] = accessTokenHash("other")
+			}),
+			reason: ReasonInvalid,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, url, nil)
+			_, err := NewDPoPVerifier().VerifyProof(r, tc.proof, "token")
+			assert.ErrorIs(t, err, ErrInvalidDPoPProof)
+			assert.Equal(t, tc.reason, ReasonOf(err))
+		})
+	}
+}
+
+func TestDPoPVerifier_Nonces(t *testing.T) {
+	client := newTestDPoPClient(t)
+	now := time.Now()
+	nonces := NewDPoPNonces([]byte("secret"), time.Minute).(*dpopNonces)
+	nonces.now = func() time.Time { return now }
+	v := NewDPoPVerifier(WithDPoPNonces(nonces))
+	const url = "https://api.gazebosim.org/v1/worlds"
+	r := httptest.NewRequest(http.MethodGet, url, nil)
+
+	_, err := v.VerifyProof(r, client.proof(t, http.MethodGet, url, nil), "")
+	assert.ErrorIs(t, err, ErrDPoPNonceRequired)
+
+	nonce, err := v.NextNonce(context.Background())
+	require.NoError(t, err)
+	require.NotEmpty(t, nonce)
+	withNonce := func(_ map[string]any, claims jwt.MapClaims) { claims["nonce"] = nonce }
+	_, err = v.VerifyProof(r, client.proof(t, http.MethodGet, url, withNonce), "")
+	assert.NoError(t, err)
+
+	// Nonces from the previous window are still accepted.
+	now = now.Add(time.Minute)
+	_, err = v.VerifyProof(r, client.proof(t, http.MethodGet, url, withNonce), "")
+	assert.NoError(t, err)
+
+	now = now.Add(time.Minute)
+	_, err = v.VerifyProof(r, client.proof(t, http.MethodGet, url, withNonce), "")
+	assert.ErrorIs(t, err, ErrDPoPNonceRequired)
+
+	assert.False(t, NewDPoPNonces([]byte("other"), time.Minute).Valid(context.Background(), nonce))
+
+	// Windows that are not positive use the default instead of panicking.
+	nonce, err = NewDPoPNonces([]byte("secret"), 0).Nonce(context.Background())
+	require.NoError(t, err)
+	assert.True(t, NewDPoPNonces([]byte("secret"), -time.Second).Valid(context.Background(), nonce))
+}
+
+func TestVerifyDPoPBinding(t *testing.T) {
+	proof := &DPoPProof{Thumbprint: "abc"}
+	assert.NoError(t, VerifyDPoPBinding(jwt.MapClaims{"cnf": map[string]any{"jkt": "abc"}}, proof))
+	assert.ErrorIs(t, VerifyDPoPBinding(jwt.MapClaims{"cnf": map[string]any{"jkt": "xyz"}}, proof), ErrDPoPKeyMismatch)
+	assert.ErrorIs(t, VerifyDPoPBinding(jwt.MapClaims{}, proof), ErrTokenNotBound)
+}
+
+func TestHTTPMiddleware_DPoPBoundToken(t *testing.T) {
+	bound := jwt.MapClaims{"sub": "gazebo-web", "cnf": map[string]any{"jkt": "abc"}}
+	handler := HTTPMiddleware(authenticationWithClaims(bound))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("handler should not be called")
+	}))
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Authorization", "Bearer token")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	interceptor := UnaryServerInterceptor(authenticationWithClaims(bound))
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer token"))
+	_, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{}, func(ctx context.Context, req any) (any, error) {
+		t.Fatal("handler should not be called")
+		return nil, nil
+	})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	assert.Contains(t, status.Convert(err).Message(), string(ReasonBindingMismatch))
+}
+
+func TestDPoPTokenExtractor(t *testing.T) {
+	extract := DPoPTokenExtractor()
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	_, err := extract(r)
+	assert.ErrorIs(t, err, ErrTokenNotProvided)
+
+	r.Header.Set("Authorization", "DPoP token")
+	token, err := extract(r)
+	require.NoError(t, err)
+	assert.Equal(t, "token", token)
+
+	r.Header.Set("Authorization", "Bearer token")
+	_, err = extract(r)
+	assert.ErrorIs(t, err, ErrTokenInvalid)
+}
+
+func TestDPoPMiddleware(t *testing.T) {
+	client := newTestDPoPClient(t)
+	const url = "https://api.gazebosim.org/v1/worlds"
+	bound := jwt.MapClaims{"sub": "gazebo-web", "cnf": map[string]any{"jkt": client.thumbprint(t)}}
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, found := PrincipalFromContext(r.Context())
+		require.True(t, found)
+		assert.Equal(t, "gazebo-web", principal.ID)
+	})
+	withATH := func(_ map[string]any, claims jwt.MapClaims) { claims["ath"] = accessTokenHash("token") }
+
+	cases := []struct {
+		name      string
+		claims    jwt.Claims
+		scheme    string
+		proof     string
+		status    int
+		challenge string
+	}{
+		{name: "valid", claims: bound, scheme: "DPoP", proof: client.proof(t, http.MethodGet, url, withATH), status: http.StatusOK},
+		{name: "no token", claims: bound, status: http.StatusUnauthorized, challenge: "DPoP"},
+		{name: "bearer scheme", claims: bound, scheme: "Bearer", proof: client.proof(t, http.MethodGet, url, withATH), status: http.StatusUnauthorized, challenge: `DPoP error="invalid_token"`},
+		{name: "no proof", claims: bound, scheme: "DPoP", status: http.StatusUnauthorized, challenge: `DPoP error="invalid_dpop_proof"`},
+		{name: "missing ath", claims: bound, scheme: "DPoP", proof: client.proof(t, http.MethodGet, url, nil), status: http.StatusUnauthorized, challenge: `DPoP error="invalid_dpop_proof"`},
+		{name: "unbound token", claims: jwt.MapClaims{"sub": "gazebo-web"}, scheme: "DPoP", proof: client.proof(t, http.MethodGet, url, withATH), status: http.StatusUnauthorized, challenge: `DPoP error="invalid_token"`},
+		{
+			name:      "different key",
+			claims:    jwt.MapClaims{"sub": "gazebo-web", "cnf": map[string]any{"jkt": newTestDPoPClient(t).thumbprint(t)}},
+			scheme:    "DPoP",
+			proof:     client.proof(t, http.MethodGet, url, withATH),
+			status:    http.StatusUnauthorized,
+			challenge: `DPoP error="invalid_token"`,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			handler := DPoPMiddleware(authenticationWithClaims(tc.claims), NewDPoPVerifier())(ok)
+			r := httptest.NewRequest(http.MethodGet, url, nil)
+			if len(tc.scheme) > 0 {
+				r.Header.Set("Authorization", tc.scheme+" token")
+			}
+			if len(tc.proof) > 0 {
+				r.Header.Set(DPoPHeader, tc.proof)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			assert.Equal(t, tc.status, w.Code)
+			assert.Equal(t, tc.challenge, w.Header().Get("WWW-Authenticate"))
+		})
+	}
+}
+
+func TestDPoPMiddleware_Nonce(t *testing.T) {
+	client := newTestDPoPClient(t)
+	const url = "https://api.gazebosim.org/v1/worlds"
+	claims := jwt.MapClaims{"sub": "gazebo-web", "cnf": map[string]any{"jkt": client.thumbprint(t)}}
+	verifier := NewDPoPVerifier(WithDPoPNonces(NewDPoPNonces([]byte("secret"), time.Minute)))
+	handler := DPoPMiddleware(authenticationWithClaims(claims), verifier)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	send := func(nonce string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, url, nil)
+		r.Header.Set("Authorization", "DPoP token")
+		r.Header.Set(DPoPHeader, client.proof(t, http.MethodGet, url, func(_ map[string]any, claims jwt.MapClaims) {
+			claims["ath"] = accessTokenHash("token")
+			if len(nonce) > 0 {
+				claims["nonce"] = nonce
+			}
+		}))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	w := send("")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, `DPoP error="use_dpop_nonce"`, w.Header().Get("WWW-Authenticate"))
+	nonce := w.Header().Get(DPoPNonceHeader)
+	require.NotEmpty(t, nonce)
+
+	w = send(nonce)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotEmpty(t, w.Header().Get(DPoPNonceHeader))
+}
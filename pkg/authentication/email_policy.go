@@ -0,0 +1,201 @@
+package authentication
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ErrEmailNotAllowed is returned when the email address embedded in a JWT is
+// rejected by an EmailPolicy.
+var ErrEmailNotAllowed = errors.New("email not allowed")
+
+// EmailNotAllowedError contains the details of an email address rejected by an
+// EmailPolicy. It can be matched with errors.Is using ErrEmailNotAllowed.
+type EmailNotAllowedError struct {
+	// Email is the email address that was rejected. It's empty if the token
+	// didn't contain an email address.
+	Email string
+	// Reason describes why the email address was rejected.
+	Reason string
+}
+
+// Error returns the error message.
+func (e *EmailNotAllowedError) Error() string {
+	if len(e.Email) == 0 {
+		return fmt.Sprintf("%s: %s", ErrEmailNotAllowed, e.Reason)
+	}
+	return fmt.Sprintf("%s: %s: %s", ErrEmailNotAllowed, e.Email, e.Reason)
+}
+
+// Unwrap returns ErrEmailNotAllowed.
+func (e *EmailNotAllowedError) Unwrap() error {
+	return ErrEmailNotAllowed
+}
+
+// EmailPolicy defines the set of rules an email address embedded in a JWT must
+// satisfy in order to be accepted.
+//
+// Domains are matched case-insensitively. A domain entry starting with "*."
+// matches any subdomain of the given domain, but not the domain itself:
+//
+//	"openrobotics.org"   matches "user@openrobotics.org"
+//	"*.openrobotics.org" matches "user@dev.openrobotics.org"
+//
+// Deny lists take precedence over allow lists. Empty allow lists accept every
+// email address that is not denied.
+type EmailPolicy struct {
+	// RequireVerified rejects email addresses that were not verified by the
+	// authentication provider.
+	RequireVerified bool
+	// AllowedDomains contains the list of domains that are accepted.
+	AllowedDomains []string
+	// DeniedDomains contains the list of domains that are rejected.
+	DeniedDomains []string
+	// AllowedEmails contains the list of email addresses that are accepted.
+	// Addresses in this list are accepted even if their domain is not present in
+	// AllowedDomains.
+	AllowedEmails []string
+	// DeniedEmails contains the list of email addresses that are rejected.
+	DeniedEmails []string
+}
+
+// Check verifies that the email address embedded in the given claims satisfies
+// the policy. It returns an *EmailNotAllowedError if it doesn't.
+func (p EmailPolicy) Check(claims jwt.Claims) error {
+	email, err := getEmail(claims)
+	if err != nil {
+		return &EmailNotAllowedError{Reason: err.Error()}
+	}
+	if p.RequireVerified {
+		verified, err := isEmailVerified(claims)
+		if err != nil || !verified {
+			return &EmailNotAllowedError{Email: email, Reason: "email is not verified"}
+		}
+	}
+	return p.CheckEmail(email)
+}
+
+// CheckEmail verifies that the given email address satisfies the policy's
+// allow and deny lists. It doesn't check whether the email is verified.
+func (p EmailPolicy) CheckEmail(email string) error {
+	local, domain, ok := splitEmail(email)
+	if !ok {
+		return &EmailNotAllowedError{Email: email, Reason: "malformed email address"}
+	}
+	address := local + "@" + domain
+	if containsFold(p.DeniedEmails, address) {
+		return &EmailNotAllowedError{Email: email, Reason: "email is denied"}
+	}
+	if matchDomains(p.DeniedDomains, domain) {
+		return &EmailNotAllowedError{Email: email, Reason: "domain is denied"}
+	}
+	if len(p.AllowedEmails) == 0 && len(p.AllowedDomains) == 0 {
+		return nil
+	}
+	if containsFold(p.AllowedEmails, address) || matchDomains(p.AllowedDomains, domain) {
+		return nil
+	}
+	return &EmailNotAllowedError{Email: email, Reason: "email is not in the allow list"}
+}
+
+// emailPolicyAuthentication is an Authentication decorator that enforces an
+// EmailPolicy on the claims returned by the underlying Authentication.
+type emailPolicyAuthentication struct {
+	authentication Authentication
+	policy         EmailPolicy
+}
+
+// VerifyJWT verifies the given token using the underlying Authentication and
+// checks that the email address embedded in it satisfies the policy.
+func (auth *emailPolicyAuthentication) VerifyJWT(ctx context.Context, token string) (jwt.Claims, error) {
+	claims, err := auth.authentication.VerifyJWT(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if err := auth.policy.Check(claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// NewEmailPolicy initializes a new Authentication implementation that wraps the
+// given Authentication and only accepts JWTs whose email address satisfies the
+// given policy.
+//
+//	auth := NewEmailPolicy(NewFirebaseWithTokenVerifier(fbAuth), EmailPolicy{
+//		RequireVerified: true,
+//		AllowedDomains:  []string{"openrobotics.org", "*.openrobotics.org"},
+//	})
+func NewEmailPolicy(authentication Authentication, policy EmailPolicy) Authentication {
+	return &emailPolicyAuthentication{
+		authentication: authentication,
+		policy:         policy,
+	}
+}
+
+// getEmail returns the email address embedded in the given claims.
+func getEmail(claims jwt.Claims) (string, error) {
+	if c, ok := claims.(EmailClaimer); ok {
+		return c.GetEmail()
+	}
+	return getStringClaim(claims, "email")
+}
+
+// isEmailVerified returns true if the email address embedded in the given claims
+// has been verified.
+func isEmailVerified(claims jwt.Claims) (bool, error) {
+	if c, ok := claims.(EmailVerifiedClaimer); ok {
+		return c.IsEmailVerified()
+	}
+	v, err := getClaim(claims, "email_verified")
+	if err != nil {
+		return false, err
+	}
+	verified, ok := v.(bool)
+	if !ok {
+		return false, errors.New("invalid email_verified value: should be a boolean")
+	}
+	return verified, nil
+}
+
+// splitEmail splits the given email address into its local part and its
+// lower-cased domain.
+func splitEmail(email string) (string, string, bool) {
+	i := strings.LastIndex(email, "@")
+	if i <= 0 || i == len(email)-1 {
+		return "", "", false
+	}
+	return email[:i], strings.ToLower(email[i+1:]), true
+}
+
+// matchDomains returns true if the given domain matches any of the given
+// patterns. Patterns starting with "*." match subdomains.
+func matchDomains(patterns []string, domain string) bool {
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(pattern)
+		if strings.HasPrefix(pattern, "*.") {
+			if strings.HasSuffix(domain, pattern[1:]) {
+				return true
+			}
+			continue
+		}
+		if domain == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// containsFold returns true if the given list contains value, ignoring case.
+func containsFold(list []string, value string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,99 @@
+package authentication
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEmailPolicy_CheckEmail(t *testing.T) {
+	policy := EmailPolicy{
+		AllowedDomains: []string{"openrobotics.org", "*.gazebosim.org"},
+		DeniedDomains:  []string{"blocked.gazebosim.org"},
+		AllowedEmails:  []string{"partner@example.com"},
+		DeniedEmails:   []string{"former@openrobotics.org"},
+	}
+
+	assert.NoError(t, policy.CheckEmail("user@openrobotics.org"))
+	assert.NoError(t, policy.CheckEmail("user@OpenRobotics.org"))
+	assert.NoError(t, policy.CheckEmail("user@dev.gazebosim.org"))
+	assert.NoError(t, policy.CheckEmail("Partner@example.com"))
+
+	assert.ErrorIs(t, policy.CheckEmail("user@gazebosim.org"), ErrEmailNotAllowed)
+	assert.ErrorIs(t, policy.CheckEmail("user@sub.openrobotics.org"), ErrEmailNotAllowed)
+	assert.ErrorIs(t, policy.CheckEmail("user@blocked.gazebosim.org"), ErrEmailNotAllowed)
+	assert.ErrorIs(t, policy.CheckEmail("former@openrobotics.org"), ErrEmailNotAllowed)
+	assert.ErrorIs(t, policy.CheckEmail("other@example.com"), ErrEmailNotAllowed)
+	assert.ErrorIs(t, policy.CheckEmail("user@evilopenrobotics.org"), ErrEmailNotAllowed)
+	assert.ErrorIs(t, policy.CheckEmail("not-an-email"), ErrEmailNotAllowed)
+}
+
+func TestEmailPolicy_CheckEmail_EmptyAllowList(t *testing.T) {
+	policy := EmailPolicy{
+		DeniedDomains: []string{"example.com"},
+	}
+	assert.NoError(t, policy.CheckEmail("user@openrobotics.org"))
+	assert.ErrorIs(t, policy.CheckEmail("user@example.com"), ErrEmailNotAllowed)
+}
+
+func TestEmailPolicy_Check_RequireVerified(t *testing.T) {
+	policy := EmailPolicy{RequireVerified: true}
+
+	err := policy.Check(jwt.MapClaims{"email": "user@openrobotics.org", "email_verified": true})
+	assert.NoError(t, err)
+
+	err = policy.Check(jwt.MapClaims{"email": "user@openrobotics.org", "email_verified": false})
+	var target *EmailNotAllowedError
+	assert.True(t, errors.As(err, &target))
+	assert.Equal(t, "user@openrobotics.org", target.Email)
+	assert.Equal(t, "email is not verified", target.Reason)
+
+	err = policy.Check(jwt.MapClaims{"email": "user@openrobotics.org"})
+	assert.ErrorIs(t, err, ErrEmailNotAllowed)
+}
+
+func TestEmailPolicy_Check_MissingEmail(t *testing.T) {
+	policy := EmailPolicy{}
+	err := policy.Check(jwt.MapClaims{"sub": "gazebo-web"})
+	assert.ErrorIs(t, err, ErrEmailNotAllowed)
+}
+
+func TestEmailPolicy_Check_Firebase(t *testing.T) {
+	token := NewFirebaseTestToken()
+	token.Claims["email_verified"] = true
+	policy := EmailPolicy{RequireVerified: true, AllowedDomains: []string{"gazebosim.org"}}
+	assert.NoError(t, policy.Check(NewFirebaseClaims(token)))
+}
+
+func TestNewEmailPolicy(t *testing.T) {
+	ctx := context.Background()
+	policy := EmailPolicy{
+		RequireVerified: true,
+		AllowedDomains:  []string{"openrobotics.org"},
+	}
+
+	auth := NewEmailPolicy(authenticationWithClaims(NewAuth0Claims(jwt.MapClaims{
+		"sub":            "gazebo-web",
+		"email":          "user@openrobotics.org",
+		"email_verified": true,
+	})), policy)
+	claims, err := auth.VerifyJWT(ctx, "token")
+	assert.NoError(t, err)
+	assert.NotNil(t, claims)
+
+	auth = NewEmailPolicy(authenticationWithClaims(NewAuth0Claims(jwt.MapClaims{
+		"sub":            "gazebo-web",
+		"email":          "user@example.com",
+		"email_verified": true,
+	})), policy)
+	_, err = auth.VerifyJWT(ctx, "token")
+	assert.ErrorIs(t, err, ErrEmailNotAllowed)
+
+	expected := errors.New("invalid token")
+	auth = NewEmailPolicy(authenticationWithError(expected), policy)
+	_, err = auth.VerifyJWT(ctx, "token")
+	assert.ErrorIs(t, err, expected)
+}
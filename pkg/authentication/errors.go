@@ -0,0 +1,276 @@
+package authentication
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+
+	"firebase.google.com/go/v4/auth"
+	"github.com/golang-jwt/jwt/v5"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/grpc/codes"
+)
+
+// ErrProviderUnavailable is returned when the authentication provider couldn't be
+// reached to verify a credential. These failures are transient, the credential
+// may be valid and the operation can be retried.
+var ErrProviderUnavailable = errors.New("authentication provider unavailable")
+
+const (
+	// ProviderAuth0 is the name used to identify the Auth0 provider.
+	ProviderAuth0 = "auth0"
+	// ProviderFirebase is the name used to identify the Firebase provider.
+	ProviderFirebase = "firebase"
+	// ProviderGCPIam is the name used to identify the GCP IAM access token provider.
+	ProviderGCPIam = "gcp-iam"
+	// ProviderGCPIDToken is the name used to identify the GCP ID token provider.
+	ProviderGCPIDToken = "gcp-id-token"
+	// ProviderAPIKey is the name used to identify the API key provider.
+	ProviderAPIKey = "api-key"
+	// ProviderHMAC is the name used to identify the HMAC request signing provider.
+	ProviderHMAC = "hmac"
+	// ProviderMTLS is the name used to identify the client certificate provider.
+	ProviderMTLS = "mtls"
+	// ProviderDPoP is the name used to identify the DPoP proof verifier.
+	ProviderDPoP = "dpop"
+)
+
+// Reason is a code describing why a credential failed verification.
+type Reason string
+
+const (
+	// ReasonNotProvided is used when no credential was provided.
+	ReasonNotProvided Reason = "not-provided"
+	// ReasonMalformed is used when the credential cannot be parsed.
+	ReasonMalformed Reason = "malformed"
+	// ReasonExpired is used when the credential has expired.
+	ReasonExpired Reason = "expired"
+	// ReasonNotYetValid is used when the credential is used before it becomes valid.
+	ReasonNotYetValid Reason = "not-yet-valid"
+	// ReasonBadSignature is used when the signature of the credential is invalid.
+	ReasonBadSignature Reason = "bad-signature"
+	// ReasonUnknownKey is used when the key used to sign the credential is unknown.
+	ReasonUnknownKey Reason = "unknown-key"
+	// ReasonRevoked is used when the credential, or the user it belongs to, has been revoked.
+	ReasonRevoked Reason = "revoked"
+	// ReasonWrongAudience is used when the credential was issued for a different audience.
+	ReasonWrongAudience Reason = "wrong-audience"
+	// ReasonProviderUnavailable is used when the authentication provider couldn't
+	// be reached to verify the credential.
+	ReasonProviderUnavailable Reason = "provider-unavailable"
+	// ReasonReplayed is used when a single-use credential, such as a signed
+	// request nonce, was already used.
+	ReasonReplayed Reason = "replayed"
+	// ReasonBindingMismatch is used when a sender-constrained credential, such as
+	// a certificate-bound access token, is presented by a different client.
+	ReasonBindingMismatch Reason = "binding-mismatch"
+	// ReasonInvalid is used when the credential was rejected for any other reason.
+	ReasonInvalid Reason = "invalid"
+)
+
+// VerificationError is returned by the Authentication providers when a
+// credential fails verification. It carries a Reason that callers can use to
+// branch on the type of failure, the name of the provider that verified the
+// credential and the underlying error returned by the provider.
+//
+// VerificationError matches ErrTokenNotProvided, ErrTokenInvalid and
+// ErrProviderUnavailable when using errors.Is, depending on its Reason.
+type VerificationError struct {
+	// Reason describes why the credential failed verification.
+	Reason Reason
+	// Provider is the name of the provider that verified the credential.
+	Provider string
+	// Err is the underlying error returned by the provider.
+	Err error
+}
+
+// Error returns the error message.
+func (e *VerificationError) Error() string {
+	if e.Err == nil {
+		return fmt.Sprintf("%s: verification failed: %s", e.Provider, e.Reason)
+	}
+	return fmt.Sprintf("%s: verification failed: %s: %s", e.Provider, e.Reason, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *VerificationError) Unwrap() error {
+	return e.Err
+}
+
+// Is allows matching a VerificationError with ErrTokenNotProvided, ErrTokenInvalid
+// and ErrProviderUnavailable.
+func (e *VerificationError) Is(target error) bool {
+	switch target {
+	case ErrTokenNotProvided:
+		return e.Reason == ReasonNotProvided
+	case ErrProviderUnavailable:
+		return e.Reason == ReasonProviderUnavailable
+	case ErrTokenInvalid:
+		return e.Reason != ReasonNotProvided && e.Reason != ReasonProviderUnavailable
+	}
+	return false
+}
+
+// NewVerificationError initializes a new VerificationError.
+func NewVerificationError(provider string, reason Reason, err error) error {
+	return &VerificationError{
+		Reason:   reason,
+		Provider: provider,
+		Err:      err,
+	}
+}
+
+// ReasonOf returns the Reason of the given error. It returns an empty reason if
+// err is nil, and ReasonInvalid if err doesn't carry a reason.
+func ReasonOf(err error) Reason {
+	if err == nil {
+		return ""
+	}
+	var verificationErr *VerificationError
+	if errors.As(err, &verificationErr) {
+		return verificationErr.Reason
+	}
+	if errors.Is(err, ErrTokenNotProvided) {
+		return ReasonNotProvided
+	}
+	if errors.Is(err, ErrProviderUnavailable) {
+		return ReasonProviderUnavailable
+	}
+	if errors.Is(err, ErrReplayed) {
+		return ReasonReplayed
+	}
+	return ReasonInvalid
+}
+
+// IsRetryable returns true if the given error was caused by a transient failure
+// while contacting the authentication provider, and the operation can be retried.
+func IsRetryable(err error) bool {
+	return errors.Is(err, ErrProviderUnavailable)
+}
+
+// HTTPStatusCode returns the HTTP status code that should be returned to clients
+// when a request fails with the given error.
+func HTTPStatusCode(err error) int {
+	switch {
+	case err == nil:
+		return http.StatusOK
+	case errors.Is(err, ErrMultipleTokens):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrEmailNotAllowed), errors.Is(err, ErrClaimRuleFailed), errors.Is(err, ErrTrustDomainNotAllowed):
+		return http.StatusForbidden
+	case ReasonOf(err) == ReasonProviderUnavailable:
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusUnauthorized
+}
+
+// GRPCStatusCode returns the gRPC status code that should be returned to clients
+// when a request fails with the given error.
+func GRPCStatusCode(err error) codes.Code {
+	switch {
+	case err == nil:
+		return codes.OK
+	case errors.Is(err, ErrMultipleTokens):
+		return codes.InvalidArgument
+	case errors.Is(err, ErrEmailNotAllowed), errors.Is(err, ErrClaimRuleFailed), errors.Is(err, ErrTrustDomainNotAllowed):
+		return codes.PermissionDenied
+	case ReasonOf(err) == ReasonProviderUnavailable:
+		return codes.Unavailable
+	}
+	return codes.Unauthenticated
+}
+
+// jwtVerificationError maps the errors returned by validateJWT and the jwt
+// library into a VerificationError.
+func jwtVerificationError(provider string, err error) error {
+	var reason Reason
+	switch {
+	case errors.Is(err, ErrTokenNotProvided):
+		reason = ReasonNotProvided
+	case errors.Is(err, jwt.ErrTokenExpired):
+		reason = ReasonExpired
+	case errors.Is(err, jwt.ErrTokenNotValidYet), errors.Is(err, jwt.ErrTokenUsedBeforeIssued):
+		reason = ReasonNotYetValid
+	case errors.Is(err, jwt.ErrTokenSignatureInvalid):
+		reason = ReasonBadSignature
+	case errors.Is(err, jwt.ErrTokenUnverifiable):
+		reason = ReasonUnknownKey
+	case errors.Is(err, jwt.ErrTokenInvalidAudience):
+		reason = ReasonWrongAudience
+	case errors.Is(err, jwt.ErrTokenMalformed), errors.Is(err, ErrTokenInvalid):
+		reason = ReasonMalformed
+	default:
+		reason = ReasonInvalid
+	}
+	return NewVerificationError(provider, reason, err)
+}
+
+// firebaseVerificationError maps the errors returned by Firebase into a
+// VerificationError. Firebase only exposes error codes for some failures, the
+// remaining ones are identified by their message.
+func firebaseVerificationError(err error) error {
+	var reason Reason
+	msg := err.Error()
+	switch {
+	case auth.IsCertificateFetchFailed(err), isTransientError(err):
+		reason = ReasonProviderUnavailable
+	case auth.IsIDTokenExpired(err):
+		reason = ReasonExpired
+	case auth.IsIDTokenRevoked(err), auth.IsUserDisabled(err):
+		reason = ReasonRevoked
+	case strings.Contains(msg, "'aud'"):
+		reason = ReasonWrongAudience
+	case strings.Contains(msg, "future timestamp"):
+		reason = ReasonNotYetValid
+	case strings.Contains(msg, "no matching public key"):
+		reason = ReasonUnknownKey
+	case strings.Contains(msg, "signature"):
+		reason = ReasonBadSignature
+	case strings.Contains(msg, "segments"), strings.Contains(msg, "decode"):
+		reason = ReasonMalformed
+	default:
+		reason = ReasonInvalid
+	}
+	return NewVerificationError(ProviderFirebase, reason, err)
+}
+
+// googleAPIVerificationError maps the errors returned by Google Cloud APIs into
+// a VerificationError.
+func googleAPIVerificationError(provider string, err error) error {
+	reason := ReasonInvalid
+	var apiErr *googleapi.Error
+	switch {
+	case errors.As(err, &apiErr):
+		switch {
+		case apiErr.Code == http.StatusBadRequest:
+			reason = ReasonMalformed
+		case apiErr.Code == http.StatusTooManyRequests, apiErr.Code >= http.StatusInternalServerError:
+			reason = ReasonProviderUnavailable
+		}
+	case isTransientError(err):
+		reason = ReasonProviderUnavailable
+	}
+	return NewVerificationError(provider, reason, err)
+}
+
+// isTransientError returns true if the given error was caused by a network
+// failure or a timeout while contacting a remote service.
+func isTransientError(err error) bool {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return true
+	case errors.Is(err, io.ErrUnexpectedEOF), errors.Is(err, io.EOF):
+		return true
+	case errors.Is(err, syscall.ECONNREFUSED), errors.Is(err, syscall.ECONNRESET):
+		return true
+	case errors.As(err, &netErr):
+		return true
+	}
+	return false
+}
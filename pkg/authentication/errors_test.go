@@ -0,0 +1,178 @@
+package authentication
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/grpc/codes"
+)
+
+func TestVerificationError_Is(t *testing.T) {
+	err := NewVerificationError(ProviderAuth0, ReasonExpired, jwt.ErrTokenExpired)
+	assert.ErrorIs(t, err, ErrTokenInvalid)
+	assert.ErrorIs(t, err, jwt.ErrTokenExpired)
+	assert.NotErrorIs(t, err, ErrTokenNotProvided)
+	assert.Equal(t, "auth0: verification failed: expired: token is expired", err.Error())
+
+	err = NewVerificationError(ProviderAuth0, ReasonNotProvided, nil)
+	assert.ErrorIs(t, err, ErrTokenNotProvided)
+	assert.NotErrorIs(t, err, ErrTokenInvalid)
+
+	err = NewVerificationError(ProviderFirebase, ReasonProviderUnavailable, errors.New("timeout"))
+	assert.NotErrorIs(t, err, ErrTokenInvalid)
+
+	var target *VerificationError
+	require.True(t, errors.As(fmt.Errorf("wrapped: %w", err), &target))
+	assert.Equal(t, ProviderFirebase, target.Provider)
+}
+
+func TestReasonOf(t *testing.T) {
+	assert.Equal(t, Reason(""), ReasonOf(nil))
+	assert.Equal(t, ReasonNotProvided, ReasonOf(ErrTokenNotProvided))
+	assert.Equal(t, ReasonInvalid, ReasonOf(errors.New("unknown")))
+	assert.Equal(t, ReasonRevoked, ReasonOf(NewVerificationError(ProviderFirebase, ReasonRevoked, nil)))
+}
+
+func TestHTTPStatusCode(t *testing.T) {
+	assert.Equal(t, http.StatusOK, HTTPStatusCode(nil))
+	assert.Equal(t, http.StatusUnauthorized, HTTPStatusCode(ErrTokenNotProvided))
+	assert.Equal(t, http.StatusUnauthorized, HTTPStatusCode(NewVerificationError(ProviderAuth0, ReasonExpired, nil)))
+	assert.Equal(t, http.StatusServiceUnavailable, HTTPStatusCode(NewVerificationError(ProviderAuth0, ReasonProviderUnavailable, nil)))
+	assert.Equal(t, http.StatusForbidden, HTTPStatusCode(&EmailNotAllowedError{}))
+	assert.Equal(t, http.StatusForbidden, HTTPStatusCode(&ClaimRuleError{}))
+}
+
+func TestGRPCStatusCode(t *testing.T) {
+	assert.Equal(t, codes.OK, GRPCStatusCode(nil))
+	assert.Equal(t, codes.Unauthenticated, GRPCStatusCode(ErrTokenNotProvided))
+	assert.Equal(t, codes.Unauthenticated, GRPCStatusCode(NewVerificationError(ProviderAuth0, ReasonBadSignature, nil)))
+	assert.Equal(t, codes.Unavailable, GRPCStatusCode(NewVerificationError(ProviderAuth0, ReasonProviderUnavailable, nil)))
+	assert.Equal(t, codes.PermissionDenied, GRPCStatusCode(&EmailNotAllowedError{}))
+}
+
+func TestAuth0_VerificationErrors(t *testing.T) {
+	ctx := context.Background()
+	publicKey, err := os.ReadFile("./testdata/key.pem")
+	require.NoError(t, err)
+	pk, err := os.ReadFile("./testdata/key.private.pem")
+	require.NoError(t, err)
+	block, _ := pem.Decode(pk)
+	privateKey, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	require.NoError(t, err)
+
+	auth := NewAuth0(publicKey)
+
+	_, err = auth.VerifyJWT(ctx, "")
+	assert.Equal(t, ReasonNotProvided, ReasonOf(err))
+
+	_, err = auth.VerifyJWT(ctx, "1234")
+	assert.Equal(t, ReasonMalformed, ReasonOf(err))
+
+	expired, err := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"sub": "gazebo-web",
+		"exp": time.Now().Add(-time.Hour).Unix(),
+	}).SignedString(privateKey)
+	require.NoError(t, err)
+	_, err = auth.VerifyJWT(ctx, expired)
+	assert.Equal(t, ReasonExpired, ReasonOf(err))
+	assert.ErrorIs(t, err, ErrTokenInvalid)
+
+	notYetValid, err := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"sub": "gazebo-web",
+		"nbf": time.Now().Add(time.Hour).Unix(),
+	}).SignedString(privateKey)
+	require.NoError(t, err)
+	_, err = auth.VerifyJWT(ctx, notYetValid)
+	assert.Equal(t, ReasonNotYetValid, ReasonOf(err))
+
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	forged, err := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"sub": "gazebo-web",
+	}).SignedString(otherKey)
+	require.NoError(t, err)
+	_, err = auth.VerifyJWT(ctx, forged)
+	assert.Equal(t, ReasonBadSignature, ReasonOf(err))
+
+	var target *VerificationError
+	require.True(t, errors.As(err, &target))
+	assert.Equal(t, ProviderAuth0, target.Provider)
+
+	_, err = NewAuth0([]byte("invalid")).VerifyJWT(ctx, forged)
+	assert.Equal(t, ReasonUnknownKey, ReasonOf(err))
+}
+
+func TestFirebaseVerificationError(t *testing.T) {
+	err := firebaseVerificationError(errors.New("ID token has invalid 'aud' (audience) claim"))
+	assert.Equal(t, ReasonWrongAudience, ReasonOf(err))
+
+	err = firebaseVerificationError(errors.New("failed to verify token signature"))
+	assert.Equal(t, ReasonBadSignature, ReasonOf(err))
+
+	err = firebaseVerificationError(errors.New("ID token issued at future timestamp: 1"))
+	assert.Equal(t, ReasonNotYetValid, ReasonOf(err))
+
+	err = firebaseVerificationError(errors.New("something else"))
+	assert.Equal(t, ReasonInvalid, ReasonOf(err))
+}
+
+func TestGoogleAPIVerificationError(t *testing.T) {
+	err := googleAPIVerificationError(ProviderGCPIam, &googleapi.Error{Code: http.StatusServiceUnavailable})
+	assert.Equal(t, ReasonProviderUnavailable, ReasonOf(err))
+
+	err = googleAPIVerificationError(ProviderGCPIam, &googleapi.Error{Code: http.StatusUnauthorized})
+	assert.Equal(t, ReasonInvalid, ReasonOf(err))
+	assert.ErrorIs(t, err, ErrTokenInvalid)
+
+	err = googleAPIVerificationError(ProviderGCPIam, &googleapi.Error{Code: http.StatusBadRequest})
+	assert.Equal(t, ReasonMalformed, ReasonOf(err))
+}
+
+func TestProviderUnavailable(t *testing.T) {
+	err := googleAPIVerificationError(ProviderGCPIam, &url.Error{Op: "Post", URL: "https://iam.googleapis.com", Err: context.DeadlineExceeded})
+	assert.ErrorIs(t, err, ErrProviderUnavailable)
+	assert.NotErrorIs(t, err, ErrTokenInvalid)
+	assert.True(t, IsRetryable(err))
+	assert.Equal(t, http.StatusServiceUnavailable, HTTPStatusCode(err))
+
+	err = googleAPIVerificationError(ProviderGCPIam, &net.OpError{Op: "dial", Err: syscall.ECONNREFUSED})
+	assert.True(t, IsRetryable(err))
+
+	err = firebaseVerificationError(fmt.Errorf("failed to fetch keys: %w", io.ErrUnexpectedEOF))
+	assert.True(t, IsRetryable(err))
+
+	assert.False(t, IsRetryable(NewVerificationError(ProviderAuth0, ReasonExpired, nil)))
+	assert.False(t, IsRetryable(errors.New("unknown")))
+}
+
+func TestHTTPMiddleware_ProviderUnavailable(t *testing.T) {
+	handler := HTTPMiddleware(authenticationWithError(NewVerificationError(ProviderFirebase, ReasonProviderUnavailable, nil)))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			t.Fatal("handler should not be called")
+		}),
+	)
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Authorization", "Bearer token")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Empty(t, w.Header().Get("WWW-Authenticate"))
+}
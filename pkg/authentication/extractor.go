@@ -0,0 +1,191 @@
+package authentication
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc/metadata"
+)
+
+// ErrMultipleTokens is returned when a request presents a token using more than
+// one method, which is forbidden by RFC 6750 Section 2.
+var ErrMultipleTokens = errors.New("token provided using multiple methods")
+
+// TokenExtractor extracts a token from an HTTP request. It returns
+// ErrTokenNotProvided if the request doesn't contain a token.
+//
+// Extractors are also used by the gRPC interceptors, in which case the request
+// only carries the incoming context, see MetadataTokenExtractor.
+type TokenExtractor func(r *http.Request) (string, error)
+
+// BearerTokenExtractor returns a TokenExtractor that reads the token from the
+// Authorization header using the Bearer scheme.
+func BearerTokenExtractor() TokenExtractor {
+	return func(r *http.Request) (string, error) {
+		if len(r.Header.Values("Authorization")) > 1 {
+			return "", ErrMultipleTokens
+		}
+		return bearerToken(r)
+	}
+}
+
+// CookieTokenExtractor returns a TokenExtractor that reads the token from the
+// cookie identified by the given name.
+func CookieTokenExtractor(name string) TokenExtractor {
+	return func(r *http.Request) (string, error) {
+		var token string
+		for _, c := range r.Cookies() {
+			if c.Name != name {
+				continue
+			}
+			if len(token) > 0 {
+				return "", ErrMultipleTokens
+			}
+			token = c.Value
+		}
+		if len(token) == 0 {
+			return "", ErrTokenNotProvided
+		}
+		return token, nil
+	}
+}
+
+// QueryTokenExtractor returns a TokenExtractor that reads the token from the
+// query parameter identified by the given name, such as "access_token".
+//
+// Tokens sent in URLs are likely to be logged, this extractor should only be
+// used for requests that cannot set headers, such as WebSocket upgrades
+// performed by browsers.
+func QueryTokenExtractor(param string) TokenExtractor {
+	return func(r *http.Request) (string, error) {
+		values := r.URL.Query()[param]
+		switch len(values) {
+		case 0:
+			return "", ErrTokenNotProvided
+		case 1:
+			if len(values[0]) == 0 {
+				return "", ErrTokenNotProvided
+			}
+			return values[0], nil
+		default:
+			return "", ErrMultipleTokens
+		}
+	}
+}
+
+// MetadataTokenExtractor returns a TokenExtractor that reads the token from the
+// gRPC metadata key identified by the given name in the incoming context of the
+// request. Use GRPCBearerTokenExtractor to read bearer tokens from the
+// authorization key.
+func MetadataTokenExtractor(key string) TokenExtractor {
+	return func(r *http.Request) (string, error) {
+		values := metadata.ValueFromIncomingContext(r.Context(), key)
+		switch len(values) {
+		case 0:
+			return "", ErrTokenNotProvided
+		case 1:
+			if len(values[0]) == 0 {
+				return "", ErrTokenNotProvided
+			}
+			return values[0], nil
+		default:
+			return "", ErrMultipleTokens
+		}
+	}
+}
+
+// GRPCBearerTokenExtractor returns a TokenExtractor that reads the token from the
+// gRPC authorization metadata key using the Bearer scheme.
+func GRPCBearerTokenExtractor() TokenExtractor {
+	extract := MetadataTokenExtractor("authorization")
+	return func(r *http.Request) (string, error) {
+		value, err := extract(r)
+		if err != nil {
+			return "", err
+		}
+		return parseBearer(value)
+	}
+}
+
+// WebSocketProtocolTokenExtractor returns a TokenExtractor that reads the token
+// from the Sec-WebSocket-Protocol header, where browsers can send it during
+// WebSocket upgrades. The token is the value of the protocol entry starting with
+// the given prefix:
+//
+//	Sec-WebSocket-Protocol: gazebo.v1, access_token.<token>
+func WebSocketProtocolTokenExtractor(prefix string) TokenExtractor {
+	return func(r *http.Request) (string, error) {
+		var token string
+		for _, header := range r.Header.Values("Sec-WebSocket-Protocol") {
+			for _, protocol := range strings.Split(header, ",") {
+				protocol = strings.TrimSpace(protocol)
+				if !strings.HasPrefix(protocol, prefix) {
+					continue
+				}
+				if len(token) > 0 {
+					return "", ErrMultipleTokens
+				}
+				token = strings.TrimPrefix(protocol, prefix)
+			}
+		}
+		if len(token) == 0 {
+			return "", ErrTokenNotProvided
+		}
+		return token, nil
+	}
+}
+
+// MultiTokenExtractor returns a TokenExtractor that combines the given extractors
+// in priority order. Every extractor is evaluated, and the request is rejected
+// with ErrMultipleTokens if more than one of them finds a token.
+//
+//	extractor := MultiTokenExtractor(
+//		BearerTokenExtractor(),
+//		CookieTokenExtractor("session"),
+//		QueryTokenExtractor("access_token"),
+//	)
+func MultiTokenExtractor(extractors ...TokenExtractor) TokenExtractor {
+	return func(r *http.Request) (string, error) {
+		var token string
+		var found int
+		for _, extract := range extractors {
+			t, err := extract(r)
+			if errors.Is(err, ErrTokenNotProvided) {
+				continue
+			}
+			if err != nil {
+				return "", err
+			}
+			found++
+			if found > 1 {
+				return "", ErrMultipleTokens
+			}
+			token = t
+		}
+		if found == 0 {
+			return "", ErrTokenNotProvided
+		}
+		return token, nil
+	}
+}
+
+// bearerToken returns the bearer token sent in the Authorization header.
+func bearerToken(r *http.Request) (string, error) {
+	header := r.Header.Get("Authorization")
+	if len(header) == 0 {
+		return "", ErrTokenNotProvided
+	}
+	return parseBearer(header)
+}
+
+// parseBearer returns the token from the given Authorization header value
+// using the Bearer scheme.
+func parseBearer(value string) (string, error) {
+	scheme, token, ok := strings.Cut(value, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || len(strings.TrimSpace(token)) == 0 {
+		return "", fmt.Errorf("%w: invalid authorization header", ErrTokenInvalid)
+	}
+	return strings.TrimSpace(token), nil
+}
@@ -0,0 +1,150 @@
+package authentication
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestBearerTokenExtractor(t *testing.T) {
+	extract := BearerTokenExtractor()
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	_, err := extract(r)
+	assert.ErrorIs(t, err, ErrTokenNotProvided)
+
+	r.Header.Set("Authorization", "bearer token")
+	token, err := extract(r)
+	assert.NoError(t, err)
+	assert.Equal(t, "token", token)
+
+	r.Header.Set("Authorization", "Basic dXNlcjpwYXNz")
+	_, err = extract(r)
+	assert.ErrorIs(t, err, ErrTokenInvalid)
+
+	r.Header.Set("Authorization", "Bearer a")
+	r.Header.Add("Authorization", "Bearer b")
+	_, err = extract(r)
+	assert.ErrorIs(t, err, ErrMultipleTokens)
+}
+
+func TestCookieTokenExtractor(t *testing.T) {
+	extract := CookieTokenExtractor("session")
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	_, err := extract(r)
+	assert.ErrorIs(t, err, ErrTokenNotProvided)
+
+	r.AddCookie(&http.Cookie{Name: "session", Value: "token"})
+	token, err := extract(r)
+	assert.NoError(t, err)
+	assert.Equal(t, "token", token)
+
+	r.AddCookie(&http.Cookie{Name: "session", Value: "other"})
+	_, err = extract(r)
+	assert.ErrorIs(t, err, ErrMultipleTokens)
+}
+
+func TestQueryTokenExtractor(t *testing.T) {
+	extract := QueryTokenExtractor("access_token")
+
+	_, err := extract(httptest.NewRequest(http.MethodGet, "/ws", nil))
+	assert.ErrorIs(t, err, ErrTokenNotProvided)
+
+	token, err := extract(httptest.NewRequest(http.MethodGet, "/ws?access_token=token", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, "token", token)
+
+	_, err = extract(httptest.NewRequest(http.MethodGet, "/ws?access_token=a&access_token=b", nil))
+	assert.ErrorIs(t, err, ErrMultipleTokens)
+}
+
+func TestMetadataTokenExtractor(t *testing.T) {
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+		"x-api-token", "token",
+		"authorization", "Bearer jwt",
+	))
+	r := NewGRPCRequest(ctx)
+
+	token, err := MetadataTokenExtractor("x-api-token")(r)
+	assert.NoError(t, err)
+	assert.Equal(t, "token", token)
+
+	token, err = GRPCBearerTokenExtractor()(r)
+	assert.NoError(t, err)
+	assert.Equal(t, "jwt", token)
+
+	_, err = MetadataTokenExtractor("missing")(r)
+	assert.ErrorIs(t, err, ErrTokenNotProvided)
+
+	_, err = GRPCBearerTokenExtractor()(NewGRPCRequest(context.Background()))
+	assert.ErrorIs(t, err, ErrTokenNotProvided)
+}
+
+func TestWebSocketProtocolTokenExtractor(t *testing.T) {
+	extract := WebSocketProtocolTokenExtractor("access_token.")
+
+	r := httptest.NewRequest(http.MethodGet, "/ws", nil)
+	r.Header.Set("Sec-WebSocket-Protocol", "gazebo.v1")
+	_, err := extract(r)
+	assert.ErrorIs(t, err, ErrTokenNotProvided)
+
+	r.Header.Set("Sec-WebSocket-Protocol", "gazebo.v1, access_token.aaa.bbb.ccc")
+	token, err := extract(r)
+	assert.NoError(t, err)
+	assert.Equal(t, "aaa.bbb.ccc", token)
+
+	r.Header.Add("Sec-WebSocket-Protocol", "access_token.other")
+	_, err = extract(r)
+	assert.ErrorIs(t, err, ErrMultipleTokens)
+}
+
+func TestMultiTokenExtractor(t *testing.T) {
+	extract := MultiTokenExtractor(
+		BearerTokenExtractor(),
+		CookieTokenExtractor("session"),
+		QueryTokenExtractor("access_token"),
+	)
+
+	_, err := extract(httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.ErrorIs(t, err, ErrTokenNotProvided)
+
+	token, err := extract(httptest.NewRequest(http.MethodGet, "/?access_token=query", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, "query", token)
+
+	r := httptest.NewRequest(http.MethodGet, "/?access_token=query", nil)
+	r.Header.Set("Authorization", "Bearer header")
+	_, err = extract(r)
+	assert.ErrorIs(t, err, ErrMultipleTokens)
+
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Authorization", "Basic dXNlcjpwYXNz")
+	_, err = extract(r)
+	assert.ErrorIs(t, err, ErrTokenInvalid)
+}
+
+func TestHTTPMiddleware_WithTokenExtractor(t *testing.T) {
+	auth := authenticationWithClaims(jwt.MapClaims{"sub": "gazebo-web"})
+	handler := HTTPMiddleware(auth, WithTokenExtractor(MultiTokenExtractor(
+		BearerTokenExtractor(),
+		QueryTokenExtractor("access_token"),
+	)))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ws?access_token=token", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	r := httptest.NewRequest(http.MethodGet, "/ws?access_token=token", nil)
+	r.Header.Set("Authorization", "Bearer token")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, `Bearer error="invalid_request"`, w.Header().Get("WWW-Authenticate"))
+}
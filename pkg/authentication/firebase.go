@@ -28,12 +28,12 @@ type firebaseAuthentication struct {
 // VerifyJWT verifies that the given Token is a valid JWT and was correctly signed by Firebase.
 func (auth *firebaseAuthentication) VerifyJWT(ctx context.Context, token string) (jwt.Claims, error) {
 	if err := validateJWT(token); err != nil {
-		return nil, err
+		return nil, jwtVerificationError(ProviderFirebase, err)
 	}
 
 	verifiedToken, err := auth.firebaseAuth.VerifyIDToken(ctx, token)
 	if err != nil {
-		return nil, err
+		return nil, firebaseVerificationError(err)
 	}
 
 	return NewFirebaseClaims(*verifiedToken), nil
@@ -97,7 +97,9 @@ func NewFirebase(app *firebase.App) (FirebaseTokenVerifier, error) {
 
 var _ jwt.Claims = (*firebaseClaims)(nil)
 var _ EmailClaimer = (*firebaseClaims)(nil)
+var _ EmailVerifiedClaimer = (*firebaseClaims)(nil)
 var _ CustomClaimer = (*firebaseClaims)(nil)
+var _ AuthenticationContextClaimer = (*firebaseClaims)(nil)
 
 // firebaseClaims implements the jwt.Claims interface on auth.Token.
 type firebaseClaims auth.Token
@@ -116,6 +118,52 @@ func (ft firebaseClaims) GetEmail() (string, error) {
 	return email, nil
 }
 
+// IsEmailVerified returns true if Firebase verified the user's email address.
+func (ft firebaseClaims) IsEmailVerified() (bool, error) {
+	const key = "email_verified"
+	v, err := ft.GetCustomClaim(key)
+	if err != nil {
+		return false, err
+	}
+	verified, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("invalid %s value: should be a boolean", key)
+	}
+	return verified, nil
+}
+
+// GetAuthenticationMethods gets the authentication methods (amr) from the JWT.
+// Firebase doesn't issue the amr claim, the methods are derived from the sign-in provider instead, and "mfa" is
+// added when the user signed in using a second factor.
+func (ft firebaseClaims) GetAuthenticationMethods() ([]string, error) {
+	if _, ok := ft.Claims["amr"]; ok {
+		return getStringsClaim(ft, "amr")
+	}
+	var methods []string
+	if len(ft.Firebase.SignInProvider) > 0 {
+		methods = append(methods, ft.Firebase.SignInProvider)
+	}
+	if info, ok := ft.Claims["firebase"].(map[string]interface{}); ok {
+		if factor, ok := info["sign_in_second_factor"].(string); ok && len(factor) > 0 {
+			methods = append(methods, factor, "mfa")
+		}
+	}
+	if len(methods) == 0 {
+		return nil, errors.New("failed to get amr value: not found")
+	}
+	return methods, nil
+}
+
+// GetAuthenticationContextClass gets the authentication context class (acr) from the custom claims.
+func (ft firebaseClaims) GetAuthenticationContextClass() (string, error) {
+	return getStringClaim(ft, "acr")
+}
+
+// GetAuthTime gets the time when the user authenticated (auth_time) from the JWT.
+func (ft firebaseClaims) GetAuthTime() (*jwt.NumericDate, error) {
+	return jwt.NewNumericDate(time.Unix(ft.AuthTime, 0)), nil
+}
+
 // GetCustomClaim gets the value from the given key.
 func (ft firebaseClaims) GetCustomClaim(key string) (any, error) {
 	v, ok := ft.Claims[key]
@@ -11,10 +11,17 @@ import (
 	"google.golang.org/api/option"
 )
 
+// ErrMissingPermissions is returned when a GCP access token is not allowed to act
+// as the expected service account.
+var ErrMissingPermissions = errors.New("missing permissions")
+
 // GCPIamServiceAccountAccessToken is a higher order function that returns an
 // AccessTokenAuthentication func.
 // The resulting function allows verifying access tokens provided by GCP IAM for
 // service accounts.
+//
+// Failures to reach the GCP IAM API are reported as ErrProviderUnavailable, use
+// NewAccessTokenRetry to retry them.
 func GCPIamServiceAccountAccessToken(project, serviceAccountName string) AccessTokenAuthentication {
 	svc, err := newIamService()
 	if err != nil {
@@ -22,12 +29,12 @@ func GCPIamServiceAccountAccessToken(project, serviceAccountName string) AccessT
 	}
 	return func(ctx context.Context, token string) error {
 		permissionCall := newTestPermissionCall(svc, project, serviceAccountName, token)
-		res, err := permissionCall.Do()
+		res, err := permissionCall.Context(ctx).Do()
 		if err != nil {
-			return err
+			return googleAPIVerificationError(ProviderGCPIam, err)
 		}
 		if len(res.Permissions) == 0 {
-			return errors.New("missing permissions")
+			return NewVerificationError(ProviderGCPIam, ReasonInvalid, ErrMissingPermissions)
 		}
 		return nil
 	}
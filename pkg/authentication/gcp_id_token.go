@@ -0,0 +1,181 @@
+package authentication
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// GoogleCertsURL is the URL of the JWKS endpoint publishing the keys used by
+// Google to sign ID tokens.
+const GoogleCertsURL = "https://www.googleapis.com/oauth2/v3/certs"
+
+// googleIssuers contains the issuers of the ID tokens signed by Google.
+var googleIssuers = []string{"https://accounts.google.com", "accounts.google.com"}
+
+// GCPIDTokenOption configures the Authentication returned by NewGCPIDToken.
+type GCPIDTokenOption func(*gcpIDToken)
+
+// WithServiceAccounts sets the emails of the service accounts allowed to
+// authenticate. Tokens issued for any other account are rejected with an
+// *EmailNotAllowedError. Defaults to accepting every service account, but not
+// the accounts of end users.
+func WithServiceAccounts(emails ...string) GCPIDTokenOption {
+	return func(auth *gcpIDToken) {
+		auth.serviceAccounts = emails
+	}
+}
+
+// WithCertsURL sets the URL of the JWKS endpoint used to fetch Google's public
+// keys. Defaults to GoogleCertsURL, it's only meant to be overridden in tests.
+func WithCertsURL(url string) GCPIDTokenOption {
+	return func(auth *gcpIDToken) {
+		auth.certsURL = url
+	}
+}
+
+// WithCertsHTTPClient sets the HTTP client used to fetch Google's public keys.
+// Defaults to a client with a 30 seconds timeout.
+func WithCertsHTTPClient(client *http.Client) GCPIDTokenOption {
+	return func(auth *gcpIDToken) {
+		auth.client = client
+	}
+}
+
+// gcpIDToken is an Authentication implementation that verifies the OpenID
+// Connect ID tokens signed by Google for GCP service accounts.
+type gcpIDToken struct {
+	audience        string
+	serviceAccounts []string
+	certsURL        string
+	client          *http.Client
+	keys            *remoteKeySet
+}
+
+// VerifyJWT verifies that the given token is an ID token signed by Google for
+// the configured audience, and that it belongs to one of the allowed service
+// accounts.
+func (auth *gcpIDToken) VerifyJWT(ctx context.Context, token string) (jwt.Claims, error) {
+	if err := validateJWT(token); err != nil {
+		return nil, jwtVerificationError(ProviderGCPIDToken, err)
+	}
+	parser := jwt.NewParser(
+		jwt.WithValidMethods([]string{"RS256"}),
+		jwt.WithAudience(auth.audience),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	)
+	parsed, err := parser.Parse(token, func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+		return auth.keys.key(ctx, kid)
+	})
+	if errors.Is(err, ErrProviderUnavailable) {
+		return nil, NewVerificationError(ProviderGCPIDToken, ReasonProviderUnavailable, err)
+	}
+	if err != nil {
+		return nil, jwtVerificationError(ProviderGCPIDToken, err)
+	}
+	claims := gcpIDTokenClaims{MapClaims: parsed.Claims.(jwt.MapClaims)}
+
+	iss, err := claims.GetIssuer()
+	if err != nil || !contains(googleIssuers, iss) {
+		return nil, NewVerificationError(ProviderGCPIDToken, ReasonInvalid, fmt.Errorf("%w: unexpected issuer %q", ErrTokenInvalid, iss))
+	}
+	email, _ := claims.GetEmail()
+	if verified, _ := claims.IsEmailVerified(); !verified {
+		return nil, &EmailNotAllowedError{Email: email, Reason: "email is not verified"}
+	}
+	if len(auth.serviceAccounts) > 0 && !containsFold(auth.serviceAccounts, email) {
+		return nil, &EmailNotAllowedError{Email: email, Reason: "service account is not allowed"}
+	}
+	if !isServiceAccountEmail(email) {
+		return nil, &EmailNotAllowedError{Email: email, Reason: "not a service account"}
+	}
+	return claims, nil
+}
+
+// isServiceAccountEmail returns true if the given email belongs to a GCP service
+// account, such as name@project.iam.gserviceaccount.com.
+func isServiceAccountEmail(email string) bool {
+	_, domain, ok := strings.Cut(strings.ToLower(email), "@")
+	return ok && (domain == "gserviceaccount.com" || strings.HasSuffix(domain, ".gserviceaccount.com"))
+}
+
+// NewGCPIDToken initializes a new Authentication implementation that verifies
+// the OpenID Connect ID tokens signed by Google, such as the ones sent by Cloud
+// Run, Pub/Sub push subscriptions and Cloud Scheduler on behalf of service
+// accounts. Tokens must be issued for the given audience, usually the URL of the
+// receiving service, and it returns an error if the audience is empty. Only
+// tokens of service accounts with a verified email are accepted, use
+// WithServiceAccounts to restrict them further.
+//
+// GCPIamServiceAccountAccessToken should be used for opaque access tokens
+// instead.
+//
+//	auth, err := NewGCPIDToken("https://worker.gazebosim.org",
+//		WithServiceAccounts("scheduler@gazebo.iam.gserviceaccount.com"),
+//	)
+func NewGCPIDToken(audience string, opts ...GCPIDTokenOption) (Authentication, error) {
+	// An empty audience disables the audience validation of the JWT parser.
+	if len(audience) == 0 {
+		return nil, errors.New("invalid gcp id token audience: must not be empty")
+	}
+	auth := &gcpIDToken{
+		audience: audience,
+		certsURL: GoogleCertsURL,
+		client:   &http.Client{Timeout: 30 * time.Second},
+	}
+	for _, opt := range opts {
+		opt(auth)
+	}
+	auth.keys = newRemoteKeySet(auth.certsURL, auth.client)
+	return auth, nil
+}
+
+var _ jwt.Claims = (*gcpIDTokenClaims)(nil)
+var _ EmailClaimer = (*gcpIDTokenClaims)(nil)
+var _ EmailVerifiedClaimer = (*gcpIDTokenClaims)(nil)
+var _ CustomClaimer = (*gcpIDTokenClaims)(nil)
+
+// gcpIDTokenClaims extends jwt.MapClaims with the accessors used to read the
+// claims of the ID tokens signed by Google.
+type gcpIDTokenClaims struct {
+	jwt.MapClaims
+}
+
+// GetEmail gets the email address of the service account.
+func (c gcpIDTokenClaims) GetEmail() (string, error) {
+	return getStringClaim(c, "email")
+}
+
+// IsEmailVerified returns true if Google verified the email address of the
+// service account.
+func (c gcpIDTokenClaims) IsEmailVerified() (bool, error) {
+	const key = "email_verified"
+	v, err := c.GetCustomClaim(key)
+	if err != nil {
+		return false, err
+	}
+	// Google has historically sent this claim both as a boolean and as a string.
+	switch verified := v.(type) {
+	case bool:
+		return verified, nil
+	case string:
+		return strings.EqualFold(verified, "true"), nil
+	}
+	return false, fmt.Errorf("invalid %s value: should be a boolean", key)
+}
+
+// GetCustomClaim gets the value from the given key.
+func (c gcpIDTokenClaims) GetCustomClaim(key string) (any, error) {
+	v, ok := c.MapClaims[key]
+	if !ok {
+		return nil, fmt.Errorf("failed to get %s value: not found", key)
+	}
+	return v, nil
+}
@@ -0,0 +1,211 @@
+package authentication
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testGCPAudience = "https://worker.gazebosim.org"
+
+// testGoogleCerts is a fake Google certs endpoint serving the public key of
+// a locally generated RSA key.
+type testGoogleCerts struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+	kid string
+}
+
+func newTestGoogleCerts(t *testing.T) *testGoogleCerts {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	certs := &testGoogleCerts{key: key, kid: "test-key"}
+	certs.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "public, max-age=3600")
+		require.NoError(t, json.NewEncoder(w).Encode(JWKS{Keys: []JWK{mustJWK(t, &key.PublicKey, certs.kid)}}))
+	}))
+	t.Cleanup(certs.Close)
+	return certs
+}
+
+func newTestGCPIDToken(t *testing.T, audience string, opts ...GCPIDTokenOption) Authentication {
+	auth, err := NewGCPIDToken(audience, opts...)
+	require.NoError(t, err)
+	return auth
+}
+
+func (c *testGoogleCerts) sign(t *testing.T, fn func(claims jwt.MapClaims)) string {
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":            "https://accounts.google.com",
+		"aud":            testGCPAudience,
+		"sub":            "106148340718593218475",
+		"email":          "scheduler@gazebo.iam.gserviceaccount.com",
+		"email_verified": true,
+		"iat":            now.Unix(),
+		"exp":            now.Add(time.Hour).Unix(),
+	}
+	if fn != nil {
+		fn(claims)
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = c.kid
+	signed, err := token.SignedString(c.key)
+	require.NoError(t, err)
+	return signed
+}
+
+func TestGCPIDToken_VerifyJWT(t *testing.T) {
+	certs := newTestGoogleCerts(t)
+	auth := newTestGCPIDToken(t, testGCPAudience,
+		WithCertsURL(certs.URL),
+		WithCertsHTTPClient(certs.Client()),
+		WithServiceAccounts("scheduler@gazebo.iam.gserviceaccount.com"),
+	)
+
+	claims, err := auth.VerifyJWT(context.Background(), certs.sign(t, nil))
+	require.NoError(t, err)
+
+	email, err := claims.(EmailClaimer).GetEmail()
+	require.NoError(t, err)
+	assert.Equal(t, "scheduler@gazebo.iam.gserviceaccount.com", email)
+	verified, err := claims.(EmailVerifiedClaimer).IsEmailVerified()
+	require.NoError(t, err)
+	assert.True(t, verified)
+
+	principal, err := DefaultPrincipalMapper()(claims)
+	require.NoError(t, err)
+	assert.Equal(t, "106148340718593218475", principal.ID)
+	assert.Equal(t, ProviderGCPIDToken, principal.Provider)
+	assert.Equal(t, "scheduler@gazebo.iam.gserviceaccount.com", principal.Email)
+	assert.Equal(t, "scheduler@gazebo.iam.gserviceaccount.com", claimsMap(claims)["email"])
+}
+
+func TestGCPIDToken_VerifyJWTErrors(t *testing.T) {
+	certs := newTestGoogleCerts(t)
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	auth := newTestGCPIDToken(t, testGCPAudience,
+		WithCertsURL(certs.URL),
+		WithCertsHTTPClient(certs.Client()),
+		WithServiceAccounts("scheduler@gazebo.iam.gserviceaccount.com"),
+	)
+
+	wrongKey := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss": "https://accounts.google.com",
+		"aud": testGCPAudience,
+		"exp": time.Now().Add(time.Hour).Unix(),
+	})
+	wrongKey.Header["kid"] = certs.kid
+	wrongKeyToken, err := wrongKey.SignedString(other)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		token  string
+		reason Reason
+	}{
+		{name: "missing", token: "", reason: ReasonNotProvided},
+		{name: "malformed", token: "not-a-jwt", reason: ReasonMalformed},
+		{
+			name: "wrong audience",
+			token: certs.sign(t, func(claims jwt.MapClaims) {
+				claims["aud"] = "https://other.gazebosim.org"
+			}),
+			reason: ReasonWrongAudience,
+		},
+		{
+			name: "wrong issuer",
+			token: certs.sign(t, func(claims jwt.MapClaims) {
+				claims["iss"] = "https://issuer.gazebosim.org"
+			}),
+			reason: ReasonInvalid,
+		},
+		{
+			name: "expired",
+			token: certs.sign(t, func(claims jwt.MapClaims) {
+				claims["exp"] = time.Now().Add(-time.Hour).Unix()
+			}),
+			reason: ReasonExpired,
+		},
+		{name: "bad signature", token: wrongKeyToken, reason: ReasonBadSignature},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := auth.VerifyJWT(context.Background(), tt.token)
+			assert.Error(t, err)
+			assert.Equal(t, tt.reason, ReasonOf(err))
+		})
+	}
+}
+
+func TestGCPIDToken_ServiceAccounts(t *testing.T) {
+	certs := newTestGoogleCerts(t)
+	auth := newTestGCPIDToken(t, testGCPAudience,
+		WithCertsURL(certs.URL),
+		WithCertsHTTPClient(certs.Client()),
+		WithServiceAccounts("scheduler@gazebo.iam.gserviceaccount.com"),
+	)
+
+	_, err := auth.VerifyJWT(context.Background(), certs.sign(t, func(claims jwt.MapClaims) {
+		claims["email"] = "other@gazebo.iam.gserviceaccount.com"
+	}))
+	var target *EmailNotAllowedError
+	require.ErrorAs(t, err, &target)
+	assert.Equal(t, "other@gazebo.iam.gserviceaccount.com", target.Email)
+	assert.Equal(t, http.StatusForbidden, HTTPStatusCode(err))
+
+	_, err = auth.VerifyJWT(context.Background(), certs.sign(t, func(claims jwt.MapClaims) {
+		claims["email_verified"] = "false"
+	}))
+	assert.ErrorIs(t, err, ErrEmailNotAllowed)
+
+	// Every service account is allowed when no service accounts are configured.
+	auth = newTestGCPIDToken(t, testGCPAudience, WithCertsURL(certs.URL), WithCertsHTTPClient(certs.Client()))
+	_, err = auth.VerifyJWT(context.Background(), certs.sign(t, func(claims jwt.MapClaims) {
+		claims["email"] = "123456-compute@developer.gserviceaccount.com"
+	}))
+	assert.NoError(t, err)
+
+	// Tokens of end users and unverified emails are still rejected.
+	_, err = auth.VerifyJWT(context.Background(), certs.sign(t, func(claims jwt.MapClaims) {
+		claims["email"] = "user@gmail.com"
+	}))
+	assert.ErrorIs(t, err, ErrEmailNotAllowed)
+	_, err = auth.VerifyJWT(context.Background(), certs.sign(t, func(claims jwt.MapClaims) {
+		claims["email"] = "user@gserviceaccount.com.example.org"
+	}))
+	assert.ErrorIs(t, err, ErrEmailNotAllowed)
+	_, err = auth.VerifyJWT(context.Background(), certs.sign(t, func(claims jwt.MapClaims) {
+		claims["email_verified"] = false
+	}))
+	assert.ErrorIs(t, err, ErrEmailNotAllowed)
+}
+
+func TestNewGCPIDToken_MissingAudience(t *testing.T) {
+	_, err := NewGCPIDToken("")
+	assert.Error(t, err)
+}
+
+func TestGCPIDToken_CertsUnavailable(t *testing.T) {
+	certs := newTestGoogleCerts(t)
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+	auth := newTestGCPIDToken(t, testGCPAudience, WithCertsURL(down.URL), WithCertsHTTPClient(down.Client()))
+
+	_, err := auth.VerifyJWT(context.Background(), certs.sign(t, nil))
+	assert.ErrorIs(t, err, ErrProviderUnavailable)
+	assert.Equal(t, ReasonProviderUnavailable, ReasonOf(err))
+	assert.Equal(t, http.StatusServiceUnavailable, HTTPStatusCode(err))
+}
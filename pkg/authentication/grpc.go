@@ -0,0 +1,137 @@
+package authentication
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// UnaryServerInterceptor returns a gRPC unary server interceptor that verifies
+// the token sent in every request using the given Authentication. Tokens are
+// read from the authorization metadata key using the Bearer scheme, use
+// WithTokenExtractor to read them from a different place.
+//
+// Requests without a valid token are rejected with the status code returned by
+// GRPCStatusCode. The claims of valid tokens are stored in the request context
+// and can be retrieved by the handlers using ClaimsFromContext, together with the
+// Principal built from them, see PrincipalFromContext.
+//
+//	server := grpc.NewServer(grpc.UnaryInterceptor(UnaryServerInterceptor(auth)))
+func UnaryServerInterceptor(auth Authentication, opts ...MiddlewareOption) grpc.UnaryServerInterceptor {
+	cfg := newMiddlewareConfig(GRPCBearerTokenExtractor(), opts)
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx, err := authenticateGRPC(ctx, info.FullMethod, auth, cfg)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor returns a gRPC stream server interceptor that verifies
+// the token sent when opening every stream using the given Authentication.
+// See UnaryServerInterceptor for more information.
+//
+//	server := grpc.NewServer(grpc.StreamInterceptor(StreamServerInterceptor(auth)))
+func StreamServerInterceptor(auth Authentication, opts ...MiddlewareOption) grpc.StreamServerInterceptor {
+	cfg := newMiddlewareConfig(GRPCBearerTokenExtractor(), opts)
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := authenticateGRPC(ss.Context(), info.FullMethod, auth, cfg)
+		if err != nil {
+			return err
+		}
+		return handler(srv, NewServerStream(ss, ctx))
+	}
+}
+
+// authenticateGRPC verifies the token sent in the gRPC request identified by the
+// given context and method, and returns a new context with the verified claims
+// and principal.
+func authenticateGRPC(ctx context.Context, method string, auth Authentication, cfg middlewareConfig) (context.Context, error) {
+	ctx = WithRequestMetadata(ctx, newGRPCRequestMetadata(ctx, method))
+	token, err := cfg.extractor(NewGRPCRequest(ctx))
+	if err != nil {
+		return nil, grpcVerificationError(err)
+	}
+	claims, err := auth.VerifyJWT(ctx, token)
+	if err != nil {
+		return nil, grpcVerificationError(err)
+	}
+	principal, err := cfg.mapper(claims)
+	if err != nil {
+		return nil, grpcVerificationError(err)
+	}
+	if err := cfg.verifyTokenBinding(principal.Provider, claims, grpcPeerCertificate(ctx)); err != nil {
+		return nil, grpcVerificationError(err)
+	}
+	return WithPrincipal(WithClaims(ctx, claims), principal), nil
+}
+
+// grpcVerificationError converts the given verification error into a gRPC status
+// error. Only the Reason of the error is sent to clients, the underlying error
+// may expose internal details such as the address of the provider.
+func grpcVerificationError(err error) error {
+	return status.Errorf(GRPCStatusCode(err), "verification failed: %s", ReasonOf(err))
+}
+
+// NewGRPCRequest returns an HTTP request that carries the given gRPC context,
+// allowing functions written for HTTP requests, such as TokenExtractor
+// implementations, to read the incoming metadata. The request headers are
+// populated with the incoming metadata, and the host with the :authority
+// pseudo-header.
+func NewGRPCRequest(ctx context.Context) *http.Request {
+	r := (&http.Request{URL: &url.URL{}, Header: http.Header{}}).WithContext(ctx)
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		for k, values := range md {
+			for _, v := range values {
+				r.Header.Add(k, v)
+			}
+		}
+		if authority := md.Get(":authority"); len(authority) > 0 {
+			r.Host = authority[0]
+		}
+	}
+	return r
+}
+
+// newGRPCRequestMetadata returns the RequestMetadata of the gRPC request
+// identified by the given context and method.
+func newGRPCRequestMetadata(ctx context.Context, method string) RequestMetadata {
+	md := RequestMetadata{
+		Method: method,
+		Path:   method,
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		md.RemoteAddr = p.Addr.String()
+	}
+	if values := metadata.ValueFromIncomingContext(ctx, "user-agent"); len(values) > 0 {
+		md.UserAgent = values[0]
+	}
+	if values := metadata.ValueFromIncomingContext(ctx, "x-request-id"); len(values) > 0 {
+		md.RequestID = values[0]
+	}
+	return md
+}
+
+// NewServerStream returns a grpc.ServerStream that wraps the given stream and
+// returns ctx as its context. It's used by stream interceptors to pass the values
+// they store in the context to the handler.
+func NewServerStream(ss grpc.ServerStream, ctx context.Context) grpc.ServerStream {
+	return &serverStream{ServerStream: ss, ctx: ctx}
+}
+
+// serverStream wraps a grpc.ServerStream in order to override its context.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+// Context returns the context of the stream.
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
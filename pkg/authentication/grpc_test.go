@@ -0,0 +1,115 @@
+package authentication
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	interceptor := UnaryServerInterceptor(authenticationWithClaims(jwt.MapClaims{"sub": "gazebo-web"}))
+	info := &grpc.UnaryServerInfo{FullMethod: "/gazebo.Worlds/List"}
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+		"authorization", "Bearer token",
+		"user-agent", "grpc-go",
+	))
+	ctx = peer.NewContext(ctx, &peer.Peer{Addr: &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 1234}})
+
+	res, err := interceptor(ctx, nil, info, func(ctx context.Context, req any) (any, error) {
+		claims, ok := ClaimsFromContext(ctx)
+		require.True(t, ok)
+		sub, err := claims.GetSubject()
+		require.NoError(t, err)
+
+		principal, ok := PrincipalFromContext(ctx)
+		require.True(t, ok)
+		assert.Equal(t, sub, principal.ID)
+
+		md, ok := RequestMetadataFromContext(ctx)
+		require.True(t, ok)
+		assert.Equal(t, "/gazebo.Worlds/List", md.Method)
+		assert.Equal(t, "10.0.0.1:1234", md.RemoteAddr)
+		assert.Equal(t, "grpc-go", md.UserAgent)
+		return sub, nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "gazebo-web", res)
+}
+
+func TestUnaryServerInterceptor_Errors(t *testing.T) {
+	info := &grpc.UnaryServerInfo{FullMethod: "/gazebo.Worlds/List"}
+	handler := func(ctx context.Context, req any) (any, error) {
+		t.Fatal("handler should not be called")
+		return nil, nil
+	}
+
+	interceptor := UnaryServerInterceptor(authenticationWithClaims(jwt.MapClaims{}))
+	_, err := interceptor(context.Background(), nil, info, handler)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	interceptor = UnaryServerInterceptor(authenticationWithError(NewVerificationError(ProviderFirebase, ReasonProviderUnavailable, errors.New("dial tcp 10.0.0.1:443: i/o timeout"))))
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer token"))
+	_, err = interceptor(ctx, nil, info, handler)
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	assert.Equal(t, "verification failed: provider-unavailable", status.Convert(err).Message())
+}
+
+func TestUnaryServerInterceptor_QueryTokenExtractor(t *testing.T) {
+	interceptor := UnaryServerInterceptor(authenticationWithClaims(jwt.MapClaims{"sub": "gazebo-web"}),
+		WithTokenExtractor(MultiTokenExtractor(QueryTokenExtractor("access_token"), GRPCBearerTokenExtractor())),
+	)
+	info := &grpc.UnaryServerInfo{FullMethod: "/gazebo.Worlds/List"}
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer token"))
+
+	res, err := interceptor(ctx, nil, info, func(ctx context.Context, req any) (any, error) {
+		return "ok", nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "ok", res)
+}
+
+// testServerStream is a grpc.ServerStream implementation used for testing.
+type testServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *testServerStream) Context() context.Context {
+	return s.ctx
+}
+
+func TestStreamServerInterceptor(t *testing.T) {
+	interceptor := StreamServerInterceptor(
+		authenticationWithClaims(jwt.MapClaims{"sub": "gazebo-web"}),
+		WithTokenExtractor(MetadataTokenExtractor("x-token")),
+	)
+	info := &grpc.StreamServerInfo{FullMethod: "/gazebo.Simulations/Stream"}
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-token", "token"))
+	var called bool
+	err := interceptor(nil, &testServerStream{ctx: ctx}, info, func(srv any, stream grpc.ServerStream) error {
+		called = true
+		_, ok := ClaimsFromContext(stream.Context())
+		assert.True(t, ok)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.True(t, called)
+
+	err = interceptor(nil, &testServerStream{ctx: context.Background()}, info, func(srv any, stream grpc.ServerStream) error {
+		t.Fatal("handler should not be called")
+		return nil
+	})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
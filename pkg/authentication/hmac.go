@@ -0,0 +1,452 @@
+package authentication
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// HMACAlgorithm is the name of the signature scheme used in the Authorization
+	// header of signed requests.
+	HMACAlgorithm = "GZ-HMAC-SHA256"
+	// HMACDateHeader is the header containing the time when a request was signed.
+	HMACDateHeader = "X-Gz-Date"
+	// HMACNonceHeader is the header containing the unique nonce of a signed request.
+	HMACNonceHeader = "X-Gz-Nonce"
+	// HMACContentHashHeader is the header containing the hex-encoded SHA-256 hash
+	// of the body of a signed request.
+	HMACContentHashHeader = "X-Gz-Content-Sha256"
+	// hmacDateFormat is the format of the HMACDateHeader.
+	hmacDateFormat = "20060102T150405Z"
+)
+
+// hmacRequiredHeaders contains the headers that must be signed in every request.
+var hmacRequiredHeaders = []string{"host", strings.ToLower(HMACDateHeader), strings.ToLower(HMACNonceHeader), strings.ToLower(HMACContentHashHeader)}
+
+// HMACKey is a shared secret used to sign requests.
+type HMACKey struct {
+	// ID is the unique identifier of the key, sent in signed requests.
+	ID string
+	// Secret is the shared secret used to compute signatures.
+	Secret []byte
+	// Owner is the identifier of the principal the key belongs to.
+	Owner string
+}
+
+// HMACKeyStore contains the keys used to verify signed requests.
+type HMACKeyStore interface {
+	// GetHMACKey returns the key identified by the given id. It returns
+	// ErrKeyNotFound if the key doesn't exist.
+	GetHMACKey(ctx context.Context, id string) (*HMACKey, error)
+}
+
+// memoryHMACKeyStore is an HMACKeyStore implementation that keeps keys in memory.
+type memoryHMACKeyStore struct {
+	mu   sync.RWMutex
+	keys map[string]HMACKey
+}
+
+// GetHMACKey returns the key identified by the given id.
+func (s *memoryHMACKeyStore) GetHMACKey(ctx context.Context, id string) (*HMACKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	key, ok := s.keys[id]
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+	return &key, nil
+}
+
+// NewMemoryHMACKeyStore initializes a new HMACKeyStore that keeps the given keys
+// in memory.
+func NewMemoryHMACKeyStore(keys ...HMACKey) HMACKeyStore {
+	s := &memoryHMACKeyStore{
+		keys: make(map[string]HMACKey, len(keys)),
+	}
+	for _, key := range keys {
+		s.keys[key.ID] = key
+	}
+	return s
+}
+
+// SignRequest signs the given request with the given key, using the given time
+// and nonce. It sets the HMACDateHeader, HMACNonceHeader, HMACContentHashHeader
+// and Authorization headers. The request body is read and replaced.
+//
+// Signatures follow a scheme similar to AWS Signature Version 4: a canonical
+// request is built from the method, path, query, signed headers and body hash,
+// and the signature is the HMAC-SHA256 of the algorithm, date, nonce and hash of
+// the canonical request:
+//
+//	Authorization: GZ-HMAC-SHA256 KeyId=<id>, SignedHeaders=host;x-gz-content-sha256;x-gz-date;x-gz-nonce, Signature=<hex>
+func SignRequest(r *http.Request, key HMACKey, now time.Time, nonce string) error {
+	body, err := readRequestBody(r, -1)
+	if err != nil {
+		return err
+	}
+	if len(r.Host) == 0 {
+		r.Host = r.URL.Host
+	}
+	date := now.UTC().Format(hmacDateFormat)
+	r.Header.Set(HMACDateHeader, date)
+	r.Header.Set(HMACNonceHeader, nonce)
+	r.Header.Set(HMACContentHashHeader, hashHex(body))
+
+	signed := append([]string(nil), hmacRequiredHeaders...)
+	if len(r.Header.Get("Content-Type")) > 0 {
+		signed = append(signed, "content-type")
+	}
+	sort.Strings(signed)
+	signature := computeHMACSignature(key.Secret, canonicalRequest(r, signed), date, nonce)
+	r.Header.Set("Authorization", fmt.Sprintf("%s KeyId=%s, SignedHeaders=%s, Signature=%s",
+		HMACAlgorithm, key.ID, strings.Join(signed, ";"), signature))
+	return nil
+}
+
+// hmacTransport is an http.RoundTripper that signs every request.
+type hmacTransport struct {
+	key  HMACKey
+	base http.RoundTripper
+	now  func() time.Time
+}
+
+// RoundTrip signs a copy of the given request and sends it using the base
+// RoundTripper.
+func (t *hmacTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	nonce, err := randomHex(16)
+	if err != nil {
+		return nil, err
+	}
+	// RoundTrippers must not modify the original request.
+	signed := r.Clone(r.Context())
+	if err := SignRequest(signed, t.key, t.now(), nonce); err != nil {
+		return nil, err
+	}
+	return t.base.RoundTrip(signed)
+}
+
+// NewHMACTransport initializes a new http.RoundTripper that signs every request
+// with the given key before sending it using base. If base is nil,
+// http.DefaultTransport is used.
+//
+//	client := &http.Client{Transport: NewHMACTransport(HMACKey{ID: "worker-1", Secret: secret}, nil)}
+func NewHMACTransport(key HMACKey, base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &hmacTransport{
+		key:  key,
+		base: base,
+		now:  time.Now,
+	}
+}
+
+// HMACVerifier verifies signed requests.
+type HMACVerifier interface {
+	// VerifyRequest verifies the signature of the given request, and returns the
+	// key used to sign it. The request body is read and replaced.
+	VerifyRequest(r *http.Request) (*HMACKey, error)
+}
+
+// HMACOption configures an HMACVerifier.
+type HMACOption func(*hmacVerifier)
+
+// WithClockSkew sets the maximum difference between the time a request was
+// signed and the time it's verified. Defaults to 5 minutes.
+func WithClockSkew(d time.Duration) HMACOption {
+	return func(v *hmacVerifier) {
+		v.skew = d
+	}
+}
+
+// WithNonceStore sets the ReplayCache used to record the nonce of verified
+// requests in order to reject replayed requests. Defaults to a ReplayCache that
+// keeps nonces in memory, which only protects against replays sent to the same
+// server.
+func WithNonceStore(store ReplayCache) HMACOption {
+	return func(v *hmacVerifier) {
+		v.replays = store
+	}
+}
+
+// WithMaxBodySize sets the maximum size of the body of signed requests. Defaults
+// to 10 MiB.
+func WithMaxBodySize(size int64) HMACOption {
+	return func(v *hmacVerifier) {
+		v.maxBodySize = size
+	}
+}
+
+// hmacVerifier is an HMACVerifier implementation.
+type hmacVerifier struct {
+	store       HMACKeyStore
+	replays     ReplayCache
+	skew        time.Duration
+	maxBodySize int64
+	now         func() time.Time
+}
+
+// VerifyRequest verifies the signature of the given request. Failures are
+// reported as a *VerificationError.
+func (v *hmacVerifier) VerifyRequest(r *http.Request) (*HMACKey, error) {
+	ctx := r.Context()
+	authorization := r.Header.Get("Authorization")
+	if len(authorization) == 0 {
+		return nil, NewVerificationError(ProviderHMAC, ReasonNotProvided, ErrTokenNotProvided)
+	}
+	params, err := parseHMACAuthorization(authorization)
+	if err != nil {
+		return nil, NewVerificationError(ProviderHMAC, ReasonMalformed, err)
+	}
+	signed := strings.Split(params.signedHeaders, ";")
+	for _, h := range hmacRequiredHeaders {
+		if !contains(signed, h) {
+			return nil, NewVerificationError(ProviderHMAC, ReasonMalformed, fmt.Errorf("header %s must be signed", h))
+		}
+	}
+
+	date := r.Header.Get(HMACDateHeader)
+	signedAt, err := time.Parse(hmacDateFormat, date)
+	if err != nil {
+		return nil, NewVerificationError(ProviderHMAC, ReasonMalformed, fmt.Errorf("invalid %s header: %w", HMACDateHeader, err))
+	}
+	now := v.now()
+	if signedAt.Before(now.Add(-v.skew)) {
+		return nil, NewVerificationError(ProviderHMAC, ReasonExpired, errors.New("request signature is too old"))
+	}
+	if signedAt.After(now.Add(v.skew)) {
+		return nil, NewVerificationError(ProviderHMAC, ReasonNotYetValid, errors.New("request signature is in the future"))
+	}
+	nonce := r.Header.Get(HMACNonceHeader)
+	if len(nonce) == 0 {
+		return nil, NewVerificationError(ProviderHMAC, ReasonMalformed, fmt.Errorf("missing %s header", HMACNonceHeader))
+	}
+
+	body, err := readRequestBody(r, v.maxBodySize)
+	if err != nil {
+		return nil, NewVerificationError(ProviderHMAC, ReasonMalformed, err)
+	}
+	if !hmac.Equal([]byte(hashHex(body)), []byte(r.Header.Get(HMACContentHashHeader))) {
+		return nil, NewVerificationError(ProviderHMAC, ReasonBadSignature, errors.New("body does not match content hash"))
+	}
+
+	key, err := v.store.GetHMACKey(ctx, params.keyID)
+	if errors.Is(err, ErrKeyNotFound) {
+		return nil, NewVerificationError(ProviderHMAC, ReasonUnknownKey, err)
+	}
+	if err != nil {
+		return nil, NewVerificationError(ProviderHMAC, ReasonProviderUnavailable, err)
+	}
+	expected := computeHMACSignature(key.Secret, canonicalRequest(r, signed), date, nonce)
+	if !hmac.Equal([]byte(expected), []byte(params.signature)) {
+		return nil, NewVerificationError(ProviderHMAC, ReasonBadSignature, errors.New("signature does not match"))
+	}
+
+	// Nonces are only recorded for valid signatures, so they can't be burned by
+	// unauthenticated clients.
+	ok, err := v.replays.Use(ctx, key.ID+":"+nonce, signedAt.Add(v.skew))
+	if err != nil {
+		return nil, NewVerificationError(ProviderHMAC, ReasonProviderUnavailable, err)
+	}
+	if !ok {
+		return nil, NewVerificationError(ProviderHMAC, ReasonReplayed, ErrReplayed)
+	}
+	return key, nil
+}
+
+// NewHMACVerifier initializes a new HMACVerifier that verifies requests signed
+// with the keys stored in the given HMACKeyStore.
+func NewHMACVerifier(store HMACKeyStore, opts ...HMACOption) HMACVerifier {
+	v := &hmacVerifier{
+		store:       store,
+		replays:     NewMemoryReplayCache(),
+		skew:        5 * time.Minute,
+		maxBodySize: 10 << 20,
+		now:         time.Now,
+	}
+	for _, opt := range opts {
+		opt(v)
+	}
+	return v
+}
+
+// HMACMiddleware returns an HTTP middleware that verifies the signature of every
+// request using the given HMACVerifier. Requests with an invalid signature are
+// rejected with 401 Unauthorized.
+//
+// The Principal stored in the request context of valid requests uses the owner
+// of the key as ID, or the key ID if the key doesn't have an owner.
+//
+//	mux.Handle("/internal/", HMACMiddleware(NewHMACVerifier(store))(internalHandler))
+func HMACMiddleware(verifier HMACVerifier) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := WithRequestMetadata(r.Context(), newHTTPRequestMetadata(r))
+			r = r.WithContext(ctx)
+			key, err := verifier.VerifyRequest(r)
+			if err != nil {
+				status := HTTPStatusCode(err)
+				if status == http.StatusUnauthorized {
+					w.Header().Set("WWW-Authenticate", HMACAlgorithm)
+				}
+				http.Error(w, http.StatusText(status), status)
+				return
+			}
+			id := key.Owner
+			if len(id) == 0 {
+				id = key.ID
+			}
+			principal := &Principal{
+				ID:       id,
+				Provider: ProviderHMAC,
+				Claims:   map[string]any{"sub": id, "kid": key.ID},
+			}
+			next.ServeHTTP(w, r.WithContext(WithPrincipal(ctx, principal)))
+		})
+	}
+}
+
+// hmacAuthorization contains the parameters of the Authorization header of a
+// signed request.
+type hmacAuthorization struct {
+	keyID         string
+	signedHeaders string
+	signature     string
+}
+
+// parseHMACAuthorization parses the Authorization header of a signed request.
+func parseHMACAuthorization(value string) (hmacAuthorization, error) {
+	var params hmacAuthorization
+	scheme, rest, ok := strings.Cut(value, " ")
+	if !ok || scheme != HMACAlgorithm {
+		return params, fmt.Errorf("unsupported authorization scheme: %s", scheme)
+	}
+	for _, part := range strings.Split(rest, ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return params, fmt.Errorf("invalid authorization parameter: %s", part)
+		}
+		switch k {
+		case "KeyId":
+			params.keyID = v
+		case "SignedHeaders":
+			params.signedHeaders = strings.ToLower(v)
+		case "Signature":
+			params.signature = v
+		}
+	}
+	if len(params.keyID) == 0 || len(params.signedHeaders) == 0 || len(params.signature) == 0 {
+		return params, errors.New("missing authorization parameters")
+	}
+	return params, nil
+}
+
+// canonicalRequest returns the canonical representation of the given request,
+// including the given lower-cased, sorted headers:
+//
+//	METHOD
+//	/escaped/path
+//	sorted=query&string=values
+//	header:value (one line per signed header)
+//	signed;headers
+//	content hash
+func canonicalRequest(r *http.Request, signedHeaders []string) string {
+	var sb strings.Builder
+	sb.WriteString(r.Method)
+	sb.WriteByte('\n')
+	path := r.URL.EscapedPath()
+	if len(path) == 0 {
+		path = "/"
+	}
+	sb.WriteString(path)
+	sb.WriteByte('\n')
+	sb.WriteString(canonicalQuery(r.URL.Query()))
+	sb.WriteByte('\n')
+	for _, h := range signedHeaders {
+		var value string
+		if h == "host" {
+			value = r.Host
+		} else {
+			value = strings.Join(r.Header.Values(h), ",")
+		}
+		sb.WriteString(h)
+		sb.WriteByte(':')
+		sb.WriteString(strings.TrimSpace(value))
+		sb.WriteByte('\n')
+	}
+	sb.WriteString(strings.Join(signedHeaders, ";"))
+	sb.WriteByte('\n')
+	sb.WriteString(r.Header.Get(HMACContentHashHeader))
+	return sb.String()
+}
+
+// canonicalQuery encodes the given query sorting keys and values.
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		values := append([]string(nil), query[k]...)
+		sort.Strings(values)
+		for _, v := range values {
+			parts = append(parts, url.QueryEscape(k)+"="+url.QueryEscape(v))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// computeHMACSignature returns the hex-encoded signature of the given canonical
+// request.
+func computeHMACSignature(secret []byte, canonical string, date string, nonce string) string {
+	stringToSign := strings.Join([]string{HMACAlgorithm, date, nonce, hashHex([]byte(canonical))}, "\n")
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(stringToSign))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// hashHex returns the hex-encoded SHA-256 hash of the given data.
+func hashHex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// readRequestBody reads the body of the given request and replaces it, so it can
+// be read again. It returns an error if the body is larger than maxSize, a
+// negative maxSize disables the limit.
+func readRequestBody(r *http.Request, maxSize int64) ([]byte, error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, nil
+	}
+	reader := io.Reader(r.Body)
+	if maxSize >= 0 {
+		reader = io.LimitReader(r.Body, maxSize+1)
+	}
+	body, err := io.ReadAll(reader)
+	r.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	if maxSize >= 0 && int64(len(body)) > maxSize {
+		return nil, errors.New("request body too large")
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	r.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+	return body, nil
+}
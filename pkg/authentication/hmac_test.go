@@ -0,0 +1,283 @@
+package authentication
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// failingHMACKeyStore is an HMACKeyStore implementation that always fails.
+type failingHMACKeyStore struct {
+	err error
+}
+
+func (s failingHMACKeyStore) GetHMACKey(ctx context.Context, id string) (*HMACKey, error) {
+	return nil, s.err
+}
+
+var testHMACKey = HMACKey{ID: "worker-1", Secret: []byte("s3cr3t"), Owner: "svc-worker"}
+
+func newTestHMACVerifier(now time.Time, opts ...HMACOption) HMACVerifier {
+	nonces := NewMemoryReplayCache().(*memoryReplayCache)
+	nonces.now = func() time.Time { return now }
+	opts = append([]HMACOption{WithNonceStore(nonces)}, opts...)
+	v := NewHMACVerifier(NewMemoryHMACKeyStore(testHMACKey), opts...).(*hmacVerifier)
+	v.now = func() time.Time { return now }
+	return v
+}
+
+func newSignedRequest(t *testing.T, key HMACKey, now time.Time, nonce string, body string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "https://api.gazebosim.org/v1/jobs?b=2&a=1", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	require.NoError(t, SignRequest(r, key, now, nonce))
+	return r
+}
+
+func TestSignRequest(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	r := newSignedRequest(t, testHMACKey, now, "n1", `{"name":"test"}`)
+
+	assert.Equal(t, "20240101T120000Z", r.Header.Get(HMACDateHeader))
+	assert.Equal(t, "n1", r.Header.Get(HMACNonceHeader))
+	assert.Equal(t, hashHex([]byte(`{"name":"test"}`)), r.Header.Get(HMACContentHashHeader))
+	assert.True(t, strings.HasPrefix(r.Header.Get("Authorization"),
+		"GZ-HMAC-SHA256 KeyId=worker-1, SignedHeaders=content-type;host;x-gz-content-sha256;x-gz-date;x-gz-nonce, Signature="))
+
+	// The body can still be read after signing.
+	body, err := io.ReadAll(r.Body)
+	require.NoError(t, err)
+	assert.Equal(t, `{"name":"test"}`, string(body))
+
+	// Signatures are deterministic.
+	other := newSignedRequest(t, testHMACKey, now, "n1", `{"name":"test"}`)
+	assert.Equal(t, r.Header.Get("Authorization"), other.Header.Get("Authorization"))
+}
+
+func TestCanonicalQuery(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/?b=2&a=2&a=1&c=x%20y", nil)
+	assert.Equal(t, "a=1&a=2&b=2&c=x+y", canonicalQuery(r.URL.Query()))
+}
+
+func TestHMACVerifier_VerifyRequest(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	v := newTestHMACVerifier(now)
+
+	r := newSignedRequest(t, testHMACKey, now.Add(-time.Minute), "n1", `{"name":"test"}`)
+	key, err := v.VerifyRequest(r)
+	require.NoError(t, err)
+	assert.Equal(t, "worker-1", key.ID)
+
+	// The body can still be read by handlers.
+	body, err := io.ReadAll(r.Body)
+	require.NoError(t, err)
+	assert.Equal(t, `{"name":"test"}`, string(body))
+}
+
+func TestHMACVerifier_VerifyRequestErrors(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		name     string
+		request  func(t *testing.T) *http.Request
+		verifier HMACVerifier
+		reason   Reason
+	}{
+		{
+			name: "missing authorization",
+			request: func(t *testing.T) *http.Request {
+				return httptest.NewRequest(http.MethodGet, "/", nil)
+			},
+			reason: ReasonNotProvided,
+		},
+		{
+			name: "unsupported scheme",
+			request: func(t *testing.T) *http.Request {
+				r := httptest.NewRequest(http.MethodGet, "/", nil)
+				r.Header.Set("Authorization", "Bearer token")
+				return r
+			},
+			reason: ReasonMalformed,
+		},
+		{
+			name: "missing signed header",
+			request: func(t *testing.T) *http.Request {
+				r := newSignedRequest(t, testHMACKey, now, "n1", "")
+				r.Header.Set("Authorization", strings.Replace(r.Header.Get("Authorization"), ";x-gz-nonce", "", 1))
+				return r
+			},
+			reason: ReasonMalformed,
+		},
+		{
+			name: "unknown key",
+			request: func(t *testing.T) *http.Request {
+				return newSignedRequest(t, HMACKey{ID: "other", Secret: []byte("s3cr3t")}, now, "n1", "")
+			},
+			reason: ReasonUnknownKey,
+		},
+		{
+			name: "wrong secret",
+			request: func(t *testing.T) *http.Request {
+				return newSignedRequest(t, HMACKey{ID: "worker-1", Secret: []byte("wrong")}, now, "n1", "")
+			},
+			reason: ReasonBadSignature,
+		},
+		{
+			name: "tampered body",
+			request: func(t *testing.T) *http.Request {
+				r := newSignedRequest(t, testHMACKey, now, "n1", `{"name":"test"}`)
+				r.Body = io.NopCloser(strings.NewReader(`{"name":"evil"}`))
+				return r
+			},
+			reason: ReasonBadSignature,
+		},
+		{
+			name: "tampered path",
+			request: func(t *testing.T) *http.Request {
+				r := newSignedRequest(t, testHMACKey, now, "n1", "")
+				r.URL.Path = "/v1/admin"
+				return r
+			},
+			reason: ReasonBadSignature,
+		},
+		{
+			name: "tampered query",
+			request: func(t *testing.T) *http.Request {
+				r := newSignedRequest(t, testHMACKey, now, "n1", "")
+				r.URL.RawQuery = "a=1&b=3"
+				return r
+			},
+			reason: ReasonBadSignature,
+		},
+		{
+			name: "too old",
+			request: func(t *testing.T) *http.Request {
+				return newSignedRequest(t, testHMACKey, now.Add(-10*time.Minute), "n1", "")
+			},
+			reason: ReasonExpired,
+		},
+		{
+			name: "in the future",
+			request: func(t *testing.T) *http.Request {
+				return newSignedRequest(t, testHMACKey, now.Add(10*time.Minute), "n1", "")
+			},
+			reason: ReasonNotYetValid,
+		},
+		{
+			name: "body too large",
+			request: func(t *testing.T) *http.Request {
+				return newSignedRequest(t, testHMACKey, now, "n1", "0123456789")
+			},
+			verifier: newTestHMACVerifier(now, WithMaxBodySize(5)),
+			reason:   ReasonMalformed,
+		},
+		{
+			name: "store unavailable",
+			request: func(t *testing.T) *http.Request {
+				return newSignedRequest(t, testHMACKey, now, "n1", "")
+			},
+			verifier: func() HMACVerifier {
+				v := NewHMACVerifier(failingHMACKeyStore{err: errors.New("connection refused")}).(*hmacVerifier)
+				v.now = func() time.Time { return now }
+				return v
+			}(),
+			reason: ReasonProviderUnavailable,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			v := tc.verifier
+			if v == nil {
+				v = newTestHMACVerifier(now)
+			}
+			_, err := v.VerifyRequest(tc.request(t))
+			require.Error(t, err)
+			var verificationErr *VerificationError
+			require.ErrorAs(t, err, &verificationErr)
+			assert.Equal(t, ProviderHMAC, verificationErr.Provider)
+			assert.Equal(t, tc.reason, verificationErr.Reason)
+		})
+	}
+}
+
+func TestHMACVerifier_Replay(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	v := newTestHMACVerifier(now)
+
+	_, err := v.VerifyRequest(newSignedRequest(t, testHMACKey, now, "n1", "body"))
+	require.NoError(t, err)
+
+	_, err = v.VerifyRequest(newSignedRequest(t, testHMACKey, now, "n1", "body"))
+	assert.ErrorIs(t, err, ErrReplayed)
+	assert.Equal(t, ReasonReplayed, ReasonOf(err))
+
+	// Requests with an invalid signature don't burn the nonce.
+	_, err = v.VerifyRequest(newSignedRequest(t, HMACKey{ID: "worker-1", Secret: []byte("wrong")}, now, "n2", "body"))
+	assert.Equal(t, ReasonBadSignature, ReasonOf(err))
+	_, err = v.VerifyRequest(newSignedRequest(t, testHMACKey, now, "n2", "body"))
+	assert.NoError(t, err)
+}
+
+func TestHMACVerifier_ClockSkew(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	v := newTestHMACVerifier(now, WithClockSkew(30*time.Second))
+
+	_, err := v.VerifyRequest(newSignedRequest(t, testHMACKey, now.Add(-time.Minute), "n1", ""))
+	assert.Equal(t, ReasonExpired, ReasonOf(err))
+
+	_, err = v.VerifyRequest(newSignedRequest(t, testHMACKey, now.Add(-20*time.Second), "n2", ""))
+	assert.NoError(t, err)
+}
+
+func TestHMACTransport(t *testing.T) {
+	verifier := NewHMACVerifier(NewMemoryHMACKeyStore(testHMACKey))
+	var principal *Principal
+	server := httptest.NewServer(HMACMiddleware(verifier)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, _ = PrincipalFromContext(r.Context())
+		body, _ := io.ReadAll(r.Body)
+		_, _ = w.Write(body)
+	})))
+	defer server.Close()
+
+	client := &http.Client{Transport: NewHMACTransport(testHMACKey, nil)}
+	for i := 0; i < 2; i++ {
+		res, err := client.Post(server.URL+"/v1/jobs?x=1", "text/plain", strings.NewReader("hello"))
+		require.NoError(t, err)
+		body, err := io.ReadAll(res.Body)
+		res.Body.Close()
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, "hello", string(body))
+	}
+
+	require.NotNil(t, principal)
+	assert.Equal(t, "svc-worker", principal.ID)
+	assert.Equal(t, ProviderHMAC, principal.Provider)
+}
+
+func TestHMACMiddleware_Unauthorized(t *testing.T) {
+	verifier := NewHMACVerifier(NewMemoryHMACKeyStore(testHMACKey))
+	handler := HMACMiddleware(verifier)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("handler must not be called")
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, HMACAlgorithm, w.Header().Get("WWW-Authenticate"))
+
+	w = httptest.NewRecorder()
+	r := newSignedRequest(t, testHMACKey, time.Now(), "n1", "")
+	handler = HMACMiddleware(NewHMACVerifier(failingHMACKeyStore{err: errors.New("timeout")}))(handler)
+	handler.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Empty(t, w.Header().Get("WWW-Authenticate"))
+}
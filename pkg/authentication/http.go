@@ -0,0 +1,190 @@
+package authentication
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// MiddlewareOption configures the HTTP middleware and gRPC interceptors.
+type MiddlewareOption func(*middlewareConfig)
+
+// middlewareConfig contains the configuration of the HTTP middleware and gRPC interceptors.
+type middlewareConfig struct {
+	extractor TokenExtractor
+	mapper    PrincipalMapper
+	// requireCertificateBinding rejects tokens that are not certificate-bound.
+	requireCertificateBinding bool
+}
+
+// WithTokenExtractor sets the TokenExtractor used to read tokens from requests.
+// Defaults to BearerTokenExtractor for HTTP, and GRPCBearerTokenExtractor for gRPC.
+func WithTokenExtractor(extractor TokenExtractor) MiddlewareOption {
+	return func(cfg *middlewareConfig) {
+		cfg.extractor = extractor
+	}
+}
+
+// WithPrincipalMapper sets the PrincipalMapper used to build the Principal stored
+// in the request context. Defaults to DefaultPrincipalMapper.
+func WithPrincipalMapper(mapper PrincipalMapper) MiddlewareOption {
+	return func(cfg *middlewareConfig) {
+		cfg.mapper = mapper
+	}
+}
+
+// WithRequiredCertificateBinding rejects access tokens that are not bound to a
+// client certificate, as defined in RFC 8705.
+//
+// Tokens containing a cnf claim with an x5t#S256 member are always rejected
+// unless the request was made using the client certificate with that
+// thumbprint, this option also rejects tokens without it. The client
+// certificate is read from the verified chains of the TLS connection, so servers
+// must request and verify client certificates.
+func WithRequiredCertificateBinding() MiddlewareOption {
+	return func(cfg *middlewareConfig) {
+		cfg.requireCertificateBinding = true
+	}
+}
+
+// verifyTokenBinding verifies the binding of an access token sent as a bearer
+// token. Tokens bound to a DPoP key are rejected, since they must be sent with a
+// proof to DPoPMiddleware. Tokens bound to a client certificate must be sent
+// using the given certificate, and tokens that are not bound to a certificate
+// are only rejected if binding is required.
+func (cfg middlewareConfig) verifyTokenBinding(provider string, claims jwt.Claims, cert *x509.Certificate) error {
+	if err := rejectDPoPBinding(claims); err != nil {
+		return dpopBindingError(provider, err)
+	}
+	err := VerifyCertificateBinding(claims, cert)
+	if errors.Is(err, ErrTokenNotBound) && !cfg.requireCertificateBinding {
+		return nil
+	}
+	if err != nil {
+		return certificateBindingError(provider, err)
+	}
+	return nil
+}
+
+// newMiddlewareConfig applies the given options on top of a configuration that
+// uses the given default TokenExtractor.
+func newMiddlewareConfig(extractor TokenExtractor, opts []MiddlewareOption) middlewareConfig {
+	cfg := middlewareConfig{
+		extractor: extractor,
+		mapper:    DefaultPrincipalMapper(),
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return cfg
+}
+
+// HTTPMiddleware returns an HTTP middleware that verifies the token sent in
+// every request using the given Authentication. Tokens are read from the
+// Authorization header using the Bearer scheme, use WithTokenExtractor to read
+// them from a different place.
+//
+// Requests without a valid token are rejected with the status code returned by
+// HTTPStatusCode, usually 401 Unauthorized. Tokens bound to a client certificate
+// are rejected unless the request was made using that certificate, see
+// WithRequiredCertificateBinding, and tokens bound to a DPoP key are rejected,
+// see DPoPMiddleware. The claims
+// of valid tokens are stored in the request context and can be retrieved by the
+// next handlers using ClaimsFromContext, together with the Principal built from
+// them, see PrincipalFromContext. The RequestMetadata of the request is
+// added to the context before verifying the token.
+//
+//	mux := http.NewServeMux()
+//	mux.Handle("/worlds", HTTPMiddleware(auth)(worldsHandler))
+func HTTPMiddleware(auth Authentication, opts ...MiddlewareOption) func(http.Handler) http.Handler {
+	cfg := newMiddlewareConfig(BearerTokenExtractor(), opts)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r = r.WithContext(WithRequestMetadata(r.Context(), newHTTPRequestMetadata(r)))
+			token, err := cfg.extractor(r)
+			if err != nil {
+				writeVerificationError(w, err)
+				return
+			}
+			claims, err := auth.VerifyJWT(r.Context(), token)
+			if err != nil {
+				writeVerificationError(w, err)
+				return
+			}
+			principal, err := cfg.mapper(claims)
+			if err != nil {
+				writeVerificationError(w, err)
+				return
+			}
+			if err := cfg.verifyTokenBinding(principal.Provider, claims, httpPeerCertificate(r)); err != nil {
+				writeVerificationError(w, err)
+				return
+			}
+			ctx := WithPrincipal(WithClaims(r.Context(), claims), principal)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// newHTTPRequestMetadata returns the RequestMetadata of the given HTTP request.
+func newHTTPRequestMetadata(r *http.Request) RequestMetadata {
+	return RequestMetadata{
+		RemoteAddr: r.RemoteAddr,
+		UserAgent:  r.UserAgent(),
+		Method:     r.Method,
+		Path:       r.URL.Path,
+		RequestID:  r.Header.Get("X-Request-Id"),
+	}
+}
+
+// writeVerificationError responds with the status code matching the given
+// verification error. Unauthorized responses include a Bearer challenge.
+func writeVerificationError(w http.ResponseWriter, err error) {
+	status := HTTPStatusCode(err)
+	switch {
+	case errors.Is(err, ErrMultipleTokens):
+		writeBearerChallenge(w, status, map[string]string{
+			"error": "invalid_request",
+		})
+	case status != http.StatusUnauthorized:
+		http.Error(w, http.StatusText(status), status)
+	case ReasonOf(err) == ReasonNotProvided:
+		writeBearerChallenge(w, status, nil)
+	default:
+		writeBearerChallenge(w, status, map[string]string{
+			"error": "invalid_token",
+		})
+	}
+}
+
+// writeBearerChallenge responds with the given status code and a
+// WWW-Authenticate header using the Bearer scheme and the given parameters,
+// as defined in RFC 6750 Section 3.
+func writeBearerChallenge(w http.ResponseWriter, status int, params map[string]string) {
+	writeChallenge(w, "Bearer", status, params)
+}
+
+// writeChallenge responds with the given status code and a WWW-Authenticate
+// header using the given scheme and parameters.
+func writeChallenge(w http.ResponseWriter, scheme string, status int, params map[string]string) {
+	challenge := scheme
+	if len(params) > 0 {
+		keys := make([]string, 0, len(params))
+		for k := range params {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		attrs := make([]string, 0, len(keys))
+		for _, k := range keys {
+			attrs = append(attrs, fmt.Sprintf("%s=%q", k, params[k]))
+		}
+		challenge += " " + strings.Join(attrs, ", ")
+	}
+	w.Header().Set("WWW-Authenticate", challenge)
+	http.Error(w, http.StatusText(status), status)
+}
@@ -0,0 +1,62 @@
+package authentication
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPMiddleware(t *testing.T) {
+	claims := NewAuth0Claims(jwt.MapClaims{"sub": "gazebo-web"})
+	var called bool
+	handler := HTTPMiddleware(authenticationWithClaims(claims))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		result, ok := ClaimsFromContext(r.Context())
+		require.True(t, ok)
+		sub, err := result.GetSubject()
+		assert.NoError(t, err)
+		assert.Equal(t, "gazebo-web", sub)
+	}))
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Authorization", "Bearer token")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	assert.True(t, called)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestHTTPMiddleware_MissingToken(t *testing.T) {
+	handler := HTTPMiddleware(authenticationWithClaims(jwt.MapClaims{}))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("handler should not be called")
+	}))
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, "Bearer", w.Header().Get("WWW-Authenticate"))
+
+	r.Header.Set("Authorization", "Basic dXNlcjpwYXNz")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestHTTPMiddleware_InvalidToken(t *testing.T) {
+	handler := HTTPMiddleware(authenticationWithError(errors.New("invalid")))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("handler should not be called")
+	}))
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Authorization", "Bearer token")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, `Bearer error="invalid_token"`, w.Header().Get("WWW-Authenticate"))
+}
@@ -0,0 +1,83 @@
+package authentication
+
+import (
+	"context"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Instrumenter receives the events produced while verifying credentials, allowing
+// applications to export metrics and traces to their observability backend.
+//
+// An OpenTelemetry implementation is available in the telemetry package, teams
+// using a different backend such as Prometheus can provide their own.
+type Instrumenter interface {
+	// StartVerification is called before a credential is verified by the given
+	// provider. It returns the context used to perform the verification, and a
+	// function that must be called with the result of the verification.
+	StartVerification(ctx context.Context, provider string) (context.Context, func(err error))
+	// RecordCacheLookup records whether a lookup in the given cache was a hit,
+	// such as the decision cache of the authorization package.
+	RecordCacheLookup(ctx context.Context, cache string, hit bool)
+}
+
+// nopInstrumenter is an Instrumenter implementation that discards every event.
+type nopInstrumenter struct{}
+
+// StartVerification returns the given context and a function that does nothing.
+func (nopInstrumenter) StartVerification(ctx context.Context, provider string) (context.Context, func(err error)) {
+	return ctx, func(error) {}
+}
+
+// RecordCacheLookup does nothing.
+func (nopInstrumenter) RecordCacheLookup(context.Context, string, bool) {}
+
+// NopInstrumenter returns an Instrumenter that discards every event.
+func NopInstrumenter() Instrumenter {
+	return nopInstrumenter{}
+}
+
+// instrumentedAuthentication is an Authentication decorator that reports every
+// verification to an Instrumenter.
+type instrumentedAuthentication struct {
+	authentication Authentication
+	provider       string
+	instrumenter   Instrumenter
+}
+
+// VerifyJWT verifies the given token using the underlying Authentication and
+// reports the result to the Instrumenter.
+func (auth *instrumentedAuthentication) VerifyJWT(ctx context.Context, token string) (jwt.Claims, error) {
+	ctx, end := auth.instrumenter.StartVerification(ctx, auth.provider)
+	claims, err := auth.authentication.VerifyJWT(ctx, token)
+	end(err)
+	return claims, err
+}
+
+// NewInstrumented initializes a new Authentication implementation that wraps the
+// given Authentication and reports every verification performed by the given
+// provider to instrumenter.
+//
+//	instrumenter, err := telemetry.NewInstrumenter(otel.GetTracerProvider(), otel.GetMeterProvider())
+//	if err != nil {
+//		log.Fatalf("failed to initialize instrumenter: %v\n", err)
+//	}
+//	auth := NewInstrumented(NewAuth0(publicKey), ProviderAuth0, instrumenter)
+func NewInstrumented(authentication Authentication, provider string, instrumenter Instrumenter) Authentication {
+	return &instrumentedAuthentication{
+		authentication: authentication,
+		provider:       provider,
+		instrumenter:   instrumenter,
+	}
+}
+
+// NewInstrumentedAccessToken wraps the given AccessTokenAuthentication and reports
+// every verification performed by the given provider to instrumenter.
+func NewInstrumentedAccessToken(authentication AccessTokenAuthentication, provider string, instrumenter Instrumenter) AccessTokenAuthentication {
+	return func(ctx context.Context, token string) error {
+		ctx, end := instrumenter.StartVerification(ctx, provider)
+		err := authentication(ctx, token)
+		end(err)
+		return err
+	}
+}
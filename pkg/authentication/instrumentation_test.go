@@ -0,0 +1,69 @@
+package authentication
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+// recorderInstrumenter is an Instrumenter implementation that records the
+// reported events.
+type recorderInstrumenter struct {
+	providers []string
+	results   []error
+	lookups   map[string][]bool
+}
+
+func (r *recorderInstrumenter) StartVerification(ctx context.Context, provider string) (context.Context, func(err error)) {
+	r.providers = append(r.providers, provider)
+	return ctx, func(err error) {
+		r.results = append(r.results, err)
+	}
+}
+
+func (r *recorderInstrumenter) RecordCacheLookup(ctx context.Context, cache string, hit bool) {
+	if r.lookups == nil {
+		r.lookups = make(map[string][]bool)
+	}
+	r.lookups[cache] = append(r.lookups[cache], hit)
+}
+
+func TestNewInstrumented(t *testing.T) {
+	ctx := context.Background()
+	recorder := &recorderInstrumenter{}
+
+	auth := NewInstrumented(authenticationWithClaims(jwt.MapClaims{"sub": "gazebo-web"}), ProviderAuth0, recorder)
+	_, err := auth.VerifyJWT(ctx, "token")
+	assert.NoError(t, err)
+
+	expected := NewVerificationError(ProviderAuth0, ReasonExpired, nil)
+	auth = NewInstrumented(authenticationWithError(expected), ProviderAuth0, recorder)
+	_, err = auth.VerifyJWT(ctx, "token")
+	assert.ErrorIs(t, err, expected)
+
+	assert.Equal(t, []string{ProviderAuth0, ProviderAuth0}, recorder.providers)
+	assert.Equal(t, []error{nil, expected}, recorder.results)
+}
+
+func TestNewInstrumentedAccessToken(t *testing.T) {
+	recorder := &recorderInstrumenter{}
+	expected := errors.New("invalid")
+	verify := NewInstrumentedAccessToken(func(ctx context.Context, token string) error {
+		return expected
+	}, ProviderGCPIam, recorder)
+
+	assert.ErrorIs(t, verify(context.Background(), "token"), expected)
+	assert.Equal(t, []string{ProviderGCPIam}, recorder.providers)
+	assert.Equal(t, []error{expected}, recorder.results)
+}
+
+func TestNopInstrumenter(t *testing.T) {
+	ctx := context.Background()
+	auth := NewInstrumented(authenticationWithClaims(jwt.MapClaims{}), ProviderAuth0, NopInstrumenter())
+	_, err := auth.VerifyJWT(ctx, "token")
+	assert.NoError(t, err)
+	NopInstrumenter().RecordCacheLookup(ctx, "keys", true)
+}
@@ -0,0 +1,340 @@
+package authentication
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/sync/singleflight"
+)
+
+// ErrUnsupportedKey is returned when a JSON Web Key uses an unsupported key type
+// or curve.
+var ErrUnsupportedKey = errors.New("unsupported key")
+
+// JWK is a public JSON Web Key, as defined in RFC 7517.
+type JWK struct {
+	// Kty is the key type: EC, RSA or OKP.
+	Kty string `json:"kty"`
+	// Kid is the key ID.
+	Kid string `json:"kid,omitempty"`
+	// Alg is the algorithm the key is intended to be used with.
+	Alg string `json:"alg,omitempty"`
+	// Use is the intended use of the key, such as "sig".
+	Use string `json:"use,omitempty"`
+	// Crv is the curve of EC and OKP keys.
+	Crv string `json:"crv,omitempty"`
+	// X is the x coordinate of EC keys, or the public key of OKP keys.
+	X string `json:"x,omitempty"`
+	// Y is the y coordinate of EC keys.
+	Y string `json:"y,omitempty"`
+	// N is the modulus of RSA keys.
+	N string `json:"n,omitempty"`
+	// E is the exponent of RSA keys.
+	E string `json:"e,omitempty"`
+	// D contains the private part of EC, OKP and RSA keys. It's only used to
+	// reject private keys.
+	D string `json:"d,omitempty"`
+}
+
+// NewJWK returns the JWK representation of the given ECDSA, RSA or Ed25519
+// public key.
+func NewJWK(key crypto.PublicKey) (JWK, error) {
+	enc := base64.RawURLEncoding
+	switch k := key.(type) {
+	case *ecdsa.PublicKey:
+		size := (k.Curve.Params().BitSize + 7) / 8
+		return JWK{
+			Kty: "EC",
+			Crv: k.Curve.Params().Name,
+			X:   enc.EncodeToString(k.X.FillBytes(make([]byte, size))),
+			Y:   enc.EncodeToString(k.Y.FillBytes(make([]byte, size))),
+		}, nil
+	case *rsa.PublicKey:
+		return JWK{
+			Kty: "RSA",
+			N:   enc.EncodeToString(k.N.Bytes()),
+			E:   enc.EncodeToString(big.NewInt(int64(k.E)).Bytes()),
+		}, nil
+	case ed25519.PublicKey:
+		return JWK{
+			Kty: "OKP",
+			Crv: "Ed25519",
+			X:   enc.EncodeToString(k),
+		}, nil
+	}
+	return JWK{}, fmt.Errorf("%w: %T", ErrUnsupportedKey, key)
+}
+
+// IsPrivate returns true if the key contains private key material.
+func (k JWK) IsPrivate() bool {
+	return len(k.D) > 0
+}
+
+// PublicKey returns the public key represented by the JWK.
+func (k JWK) PublicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("%w: curve %q", ErrUnsupportedKey, k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, fmt.Errorf("%w: point is not on curve %s", ErrUnsupportedKey, k.Crv)
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 || e.Int64() < 3 {
+			return nil, fmt.Errorf("%w: invalid RSA exponent", ErrUnsupportedKey)
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("%w: curve %q", ErrUnsupportedKey, k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid x value: %s", ErrUnsupportedKey, err)
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("%w: invalid Ed25519 key size", ErrUnsupportedKey)
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, fmt.Errorf("%w: key type %q", ErrUnsupportedKey, k.Kty)
+}
+
+// Thumbprint returns the base64url-encoded SHA-256 thumbprint of the key, as
+// defined in RFC 7638. It's the value used by the jkt confirmation method.
+func (k JWK) Thumbprint() (string, error) {
+	// The thumbprint is computed over the required members only, in
+	// lexicographic order and without whitespace. Struct fields are marshaled in
+	// declaration order.
+	var members any
+	switch k.Kty {
+	case "EC":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		}{k.Crv, k.Kty, k.X, k.Y}
+	case "RSA":
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{k.E, k.Kty, k.N}
+	case "OKP":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{k.Crv, k.Kty, k.X}
+	default:
+		return "", fmt.Errorf("%w: key type %q", ErrUnsupportedKey, k.Kty)
+	}
+	b, err := json.Marshal(members)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// decodeBigInt decodes the given base64url-encoded unsigned big-endian integer.
+func decodeBigInt(value string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil || len(b) == 0 {
+		return nil, fmt.Errorf("%w: invalid key parameter", ErrUnsupportedKey)
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// JWKS is a JSON Web Key Set, as defined in RFC 7517 Section 5.
+type JWKS struct {
+	// Keys contains the keys of the set.
+	Keys []JWK `json:"keys"`
+}
+
+// remoteKeySet fetches and caches the public keys published by a JWKS endpoint.
+// Keys are refreshed when the cache expires, or when a token is signed with an
+// unknown key.
+type remoteKeySet struct {
+	url    string
+	client *http.Client
+	now    func() time.Time
+	group  singleflight.Group
+
+	mu        sync.Mutex
+	keys      map[string]crypto.PublicKey
+	expiresAt time.Time
+	// fetchedAt is the time of the last fetch, successful or not, used to limit
+	// the refreshes caused by expired caches and unknown keys.
+	fetchedAt time.Time
+	// fetchErr is the error of the last fetch, returned for unknown keys until
+	// the next refresh.
+	fetchErr error
+}
+
+// minKeySetRefreshInterval is the minimum time between refreshes.
+const minKeySetRefreshInterval = time.Minute
+
+// defaultKeySetMaxAge is the time keys are cached when the endpoint doesn't
+// provide a Cache-Control max-age directive.
+const defaultKeySetMaxAge = time.Hour
+
+// key returns the public key identified by the given key ID. The key set is
+// fetched without holding the lock, and concurrent fetches are deduplicated.
+func (s *remoteKeySet) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	now := s.now()
+	s.mu.Lock()
+	key, ok := s.keys[kid]
+	fresh := now.Before(s.expiresAt)
+	refresh := now.Sub(s.fetchedAt) >= minKeySetRefreshInterval
+	fetchErr := s.fetchErr
+	s.mu.Unlock()
+	if ok && fresh {
+		return key, nil
+	}
+
+	if refresh {
+		ch := s.group.DoChan("keys", func() (any, error) {
+			return nil, s.fetch(context.WithoutCancel(ctx))
+		})
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case res := <-ch:
+			fetchErr = res.Err
+		}
+		if fetchErr == nil {
+			s.mu.Lock()
+			key, ok = s.keys[kid]
+			s.mu.Unlock()
+		}
+	}
+	// Cached keys are still used while the endpoint is unavailable.
+	if ok {
+		return key, nil
+	}
+	if fetchErr != nil {
+		return nil, fetchErr
+	}
+	return nil, fmt.Errorf("%w: unknown key id %q", jwt.ErrTokenUnverifiable, kid)
+}
+
+// fetch downloads the key set and replaces the cached keys.
+func (s *remoteKeySet) fetch(ctx context.Context) error {
+	keys, maxAge, err := s.download(ctx)
+	now := s.now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fetchedAt = now
+	s.fetchErr = err
+	if err != nil {
+		return err
+	}
+	s.keys = keys
+	s.expiresAt = now.Add(maxAge)
+	return nil
+}
+
+// download requests the key set, and returns its signing keys and the time
+// they can be cached for.
+func (s *remoteKeySet) download(ctx context.Context) (map[string]crypto.PublicKey, time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	res, err := s.client.Do(req)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%w: %s", ErrProviderUnavailable, err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, 0, fmt.Errorf("%w: unexpected status fetching keys: %d", ErrProviderUnavailable, res.StatusCode)
+	}
+	var set JWKS
+	if err := json.NewDecoder(io.LimitReader(res.Body, 1<<20)).Decode(&set); err != nil {
+		return nil, 0, fmt.Errorf("%w: invalid key set: %s", ErrProviderUnavailable, err)
+	}
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if len(k.Use) > 0 && k.Use != "sig" {
+			continue
+		}
+		pub, err := k.PublicKey()
+		if err != nil {
+			continue
+		}
+		keys[k.Kid] = pub
+	}
+	return keys, cacheMaxAge(res.Header.Get("Cache-Control"), defaultKeySetMaxAge), nil
+}
+
+// cacheMaxAge returns the max-age directive of the given Cache-Control header,
+// or the given default if it's not present.
+func cacheMaxAge(header string, def time.Duration) time.Duration {
+	for _, directive := range strings.Split(header, ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(directive), "=")
+		if !ok || !strings.EqualFold(k, "max-age") {
+			continue
+		}
+		seconds, err := strconv.Atoi(v)
+		if err != nil || seconds < 0 {
+			return def
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	return def
+}
+
+// newRemoteKeySet initializes a new remoteKeySet that fetches keys from the
+// given URL.
+func newRemoteKeySet(url string, client *http.Client) *remoteKeySet {
+	return &remoteKeySet{
+		url:    url,
+		client: client,
+		now:    time.Now,
+	}
+}
@@ -0,0 +1,201 @@
+package authentication
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJWK_Thumbprint(t *testing.T) {
+	// Example from RFC 7638 Section 3.1.
+	var key JWK
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"kty": "RSA",
+		"n": "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw",
+		"e": "AQAB",
+		"alg": "RS256",
+		"kid": "2011-04-29"
+	}`), &key))
+
+	thumbprint, err := key.Thumbprint()
+	require.NoError(t, err)
+	assert.Equal(t, "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs", thumbprint)
+
+	_, err = JWK{Kty: "oct"}.Thumbprint()
+	assert.ErrorIs(t, err, ErrUnsupportedKey)
+}
+
+func TestJWK_PublicKey(t *testing.T) {
+	ec, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ed, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	for _, pub := range []any{&ec.PublicKey, &rsaKey.PublicKey, ed} {
+		jwk, err := NewJWK(pub)
+		require.NoError(t, err)
+		assert.False(t, jwk.IsPrivate())
+
+		// Keys survive a JSON round trip.
+		b, err := json.Marshal(jwk)
+		require.NoError(t, err)
+		var decoded JWK
+		require.NoError(t, json.Unmarshal(b, &decoded))
+
+		key, err := decoded.PublicKey()
+		require.NoError(t, err)
+		assert.Equal(t, pub, key)
+	}
+
+	_, err = NewJWK("key")
+	assert.ErrorIs(t, err, ErrUnsupportedKey)
+}
+
+func TestJWK_PublicKeyErrors(t *testing.T) {
+	cases := map[string]JWK{
+		"unknown type":  {Kty: "oct"},
+		"unknown curve": {Kty: "EC", Crv: "P-192", X: "AA", Y: "AA"},
+		"not on curve":  {Kty: "EC", Crv: "P-256", X: "AQ", Y: "AQ"},
+		"invalid rsa":   {Kty: "RSA", N: "!", E: "AQAB"},
+		"invalid okp":   {Kty: "OKP", Crv: "Ed25519", X: "AQ"},
+	}
+	for name, key := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := key.PublicKey()
+			assert.ErrorIs(t, err, ErrUnsupportedKey)
+		})
+	}
+}
+
+func TestRemoteKeySet(t *testing.T) {
+	first, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	second, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	var set atomic.Value
+	set.Store(JWKS{Keys: []JWK{mustJWK(t, &first.PublicKey, "first")}})
+	var status atomic.Int32
+	status.Store(http.StatusOK)
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if code := int(status.Load()); code != http.StatusOK {
+			w.WriteHeader(code)
+			return
+		}
+		w.Header().Set("Cache-Control", "public, max-age=600")
+		require.NoError(t, json.NewEncoder(w).Encode(set.Load()))
+	}))
+	defer srv.Close()
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	keys := newRemoteKeySet(srv.URL, srv.Client())
+	keys.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	key, err := keys.key(ctx, "first")
+	require.NoError(t, err)
+	assert.True(t, first.PublicKey.Equal(key))
+	_, err = keys.key(ctx, "first")
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), requests.Load())
+
+	// Unknown keys don't refresh the cache more than once per interval.
+	set.Store(JWKS{Keys: []JWK{mustJWK(t, &first.PublicKey, "first"), mustJWK(t, &second.PublicKey, "second")}})
+	_, err = keys.key(ctx, "second")
+	assert.ErrorIs(t, err, jwt.ErrTokenUnverifiable)
+	assert.Equal(t, int32(1), requests.Load())
+
+	now = now.Add(minKeySetRefreshInterval)
+	key, err = keys.key(ctx, "second")
+	require.NoError(t, err)
+	assert.True(t, second.PublicKey.Equal(key))
+	assert.Equal(t, int32(2), requests.Load())
+
+	// Cached keys are still used when the endpoint is down.
+	status.Store(http.StatusServiceUnavailable)
+	now = now.Add(time.Hour)
+	key, err = keys.key(ctx, "first")
+	require.NoError(t, err)
+	assert.True(t, first.PublicKey.Equal(key))
+
+	now = now.Add(minKeySetRefreshInterval)
+	_, err = keys.key(ctx, "third")
+	assert.ErrorIs(t, err, ErrProviderUnavailable)
+
+	// Failed fetches aren't retried more than once per interval either.
+	requests.Store(0)
+	_, err = keys.key(ctx, "third")
+	assert.ErrorIs(t, err, ErrProviderUnavailable)
+	assert.Equal(t, int32(0), requests.Load())
+}
+
+func TestRemoteKeySet_ConcurrentFetch(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	release := make(chan struct{})
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		<-release
+		require.NoError(t, json.NewEncoder(w).Encode(JWKS{Keys: []JWK{mustJWK(t, &key.PublicKey, "first")}}))
+	}))
+	defer srv.Close()
+	keys := newRemoteKeySet(srv.URL, srv.Client())
+
+	errs := make(chan error, 10)
+	for i := 0; i < cap(errs); i++ {
+		go func() {
+			_, err := keys.key(context.Background(), "first")
+			errs <- err
+		}()
+	}
+
+	// Callers waiting for a fetch give up when their context is canceled, the
+	// lock isn't held while the key set is downloaded.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = keys.key(ctx, "first")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	close(release)
+	for i := 0; i < cap(errs); i++ {
+		assert.NoError(t, <-errs)
+	}
+	assert.Equal(t, int32(1), requests.Load())
+}
+
+func TestCacheMaxAge(t *testing.T) {
+	def := time.Hour
+	assert.Equal(t, def, cacheMaxAge("", def))
+	assert.Equal(t, def, cacheMaxAge("no-cache", def))
+	assert.Equal(t, def, cacheMaxAge("max-age=abc", def))
+	assert.Equal(t, 300*time.Second, cacheMaxAge("max-age=300", def))
+	assert.Equal(t, 19742*time.Second, cacheMaxAge("public, Max-Age=19742, must-revalidate, no-transform", def))
+}
+
+func mustJWK(t *testing.T, pub any, kid string) JWK {
+	key, err := NewJWK(pub)
+	require.NoError(t, err)
+	key.Kid = kid
+	key.Use = "sig"
+	return key
+}
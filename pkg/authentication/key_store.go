@@ -0,0 +1,370 @@
+package authentication
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// KeyManagementStore is a KeyStore that also allows managing API keys. It's used
+// by an APIKeyManager to issue, rotate and revoke keys.
+type KeyManagementStore interface {
+	KeyStore
+	// CreateKey stores a new API key.
+	CreateKey(ctx context.Context, key *APIKey) error
+	// RevokeKey sets the revocation time of the API key identified by the given
+	// id, unless it has already been revoked. It returns ErrKeyNotFound if the key
+	// doesn't exist.
+	RevokeKey(ctx context.Context, id string, revokedAt time.Time) error
+	// ListKeys returns the API keys of the given owner, sorted by creation time.
+	ListKeys(ctx context.Context, owner string) ([]APIKey, error)
+	// RotateKey sets the expiration time of the API key identified by the given
+	// id and stores the new one atomically: either both changes are applied or
+	// none of them is. It returns ErrKeyNotFound if the old key doesn't exist, and
+	// ErrKeyNotRotatable if it has been revoked.
+	RotateKey(ctx context.Context, id string, expiresAt time.Time, key *APIKey) error
+}
+
+// memoryKeyStore is a KeyManagementStore implementation that keeps API keys in
+// memory.
+type memoryKeyStore struct {
+	mu   sync.RWMutex
+	keys map[string]APIKey
+}
+
+// GetKey returns a copy of the API key identified by the given id.
+func (s *memoryKeyStore) GetKey(ctx context.Context, id string) (*APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	key, ok := s.keys[id]
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+	return &key, nil
+}
+
+// TouchKey sets the last time the API key identified by the given id was used.
+func (s *memoryKeyStore) TouchKey(ctx context.Context, id string, usedAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key, ok := s.keys[id]
+	if !ok {
+		return ErrKeyNotFound
+	}
+	key.LastUsedAt = usedAt
+	s.keys[id] = key
+	return nil
+}
+
+// CreateKey stores a copy of the given API key.
+func (s *memoryKeyStore) CreateKey(ctx context.Context, key *APIKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.keys[key.ID]; ok {
+		return fmt.Errorf("api key %s already exists", key.ID)
+	}
+	s.keys[key.ID] = *key
+	return nil
+}
+
+// RevokeKey sets the revocation time of the API key identified by the given id.
+func (s *memoryKeyStore) RevokeKey(ctx context.Context, id string, revokedAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key, ok := s.keys[id]
+	if !ok {
+		return ErrKeyNotFound
+	}
+	if !key.IsRevoked() {
+		key.RevokedAt = revokedAt
+		s.keys[id] = key
+	}
+	return nil
+}
+
+// RotateKey sets the expiration time of the old API key and stores a copy of the
+// new one.
+func (s *memoryKeyStore) RotateKey(ctx context.Context, id string, expiresAt time.Time, key *APIKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old, ok := s.keys[id]
+	if !ok {
+		return ErrKeyNotFound
+	}
+	if old.IsRevoked() {
+		return fmt.Errorf("%w: %s has been revoked", ErrKeyNotRotatable, id)
+	}
+	if _, ok := s.keys[key.ID]; ok {
+		return fmt.Errorf("api key %s already exists", key.ID)
+	}
+	old.ExpiresAt = expiresAt
+	s.keys[id] = old
+	s.keys[key.ID] = *key
+	return nil
+}
+
+// ListKeys returns the API keys of the given owner.
+func (s *memoryKeyStore) ListKeys(ctx context.Context, owner string) ([]APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var keys []APIKey
+	for _, key := range s.keys {
+		if key.Owner == owner {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].CreatedAt.Equal(keys[j].CreatedAt) {
+			return keys[i].ID < keys[j].ID
+		}
+		return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+	})
+	return keys, nil
+}
+
+// NewMemoryKeyStore initializes a new KeyManagementStore that keeps the given API
+// keys in memory.
+func NewMemoryKeyStore(keys ...APIKey) KeyManagementStore {
+	s := &memoryKeyStore{
+		keys: make(map[string]APIKey, len(keys)),
+	}
+	for _, key := range keys {
+		s.keys[key.ID] = key
+	}
+	return s
+}
+
+// sqlIdentifier matches valid SQL table names.
+var sqlIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+// SQLKeyStoreOption configures a SQL KeyStore.
+type SQLKeyStoreOption func(*sqlKeyStore)
+
+// WithKeyTable sets the name of the table containing the API keys. Defaults to
+// "api_keys". The name must be a valid SQL identifier, optionally qualified by a
+// schema, see NewSQLKeyStore.
+func WithKeyTable(name string) SQLKeyStoreOption {
+	return func(s *sqlKeyStore) {
+		s.table = name
+	}
+}
+
+// WithDollarPlaceholders makes the SQL KeyStore use numbered placeholders ($1,
+// $2, ...), as required by PostgreSQL. Defaults to question marks, as used by
+// MySQL and SQLite.
+func WithDollarPlaceholders() SQLKeyStoreOption {
+	return func(s *sqlKeyStore) {
+		s.dollarPlaceholders = true
+	}
+}
+
+// sqlKeyStore is a KeyManagementStore implementation backed by a SQL database.
+type sqlKeyStore struct {
+	db                 *sql.DB
+	table              string
+	dollarPlaceholders bool
+}
+
+// apiKeyColumns contains the columns of the API keys table.
+const apiKeyColumns = "id, prefix, owner, name, scopes, salt, hash, created_at, expires_at, last_used_at, revoked_at"
+
+// GetKey returns the API key identified by the given id.
+func (s *sqlKeyStore) GetKey(ctx context.Context, id string) (*APIKey, error) {
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE id = %s", apiKeyColumns, s.table, s.placeholder(1))
+	key, err := scanAPIKey(s.db.QueryRowContext(ctx, query, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrKeyNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// TouchKey sets the last time the API key identified by the given id was used.
+func (s *sqlKeyStore) TouchKey(ctx context.Context, id string, usedAt time.Time) error {
+	query := fmt.Sprintf("UPDATE %s SET last_used_at = %s WHERE id = %s", s.table, s.placeholder(1), s.placeholder(2))
+	res, err := s.db.ExecContext(ctx, query, usedAt, id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrKeyNotFound
+	}
+	return nil
+}
+
+// sqlExecer is implemented by *sql.DB and *sql.Tx.
+type sqlExecer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// CreateKey stores a new API key.
+func (s *sqlKeyStore) CreateKey(ctx context.Context, key *APIKey) error {
+	return s.createKey(ctx, s.db, key)
+}
+
+// RevokeKey sets the revocation time of the API key identified by the given id.
+// Keys that have already been revoked are not updated.
+func (s *sqlKeyStore) RevokeKey(ctx context.Context, id string, revokedAt time.Time) error {
+	query := fmt.Sprintf("UPDATE %s SET revoked_at = %s WHERE id = %s AND revoked_at IS NULL",
+		s.table, s.placeholder(1), s.placeholder(2))
+	res, err := s.db.ExecContext(ctx, query, revokedAt, id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		// The key either doesn't exist or has already been revoked.
+		_, err := s.GetKey(ctx, id)
+		return err
+	}
+	return nil
+}
+
+// RotateKey sets the expiration time of the old API key and stores the new one
+// in a transaction. Keys revoked concurrently are not updated.
+func (s *sqlKeyStore) RotateKey(ctx context.Context, id string, expiresAt time.Time, key *APIKey) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	query := fmt.Sprintf("UPDATE %s SET expires_at = %s WHERE id = %s AND revoked_at IS NULL",
+		s.table, s.placeholder(1), s.placeholder(2))
+	res, err := tx.ExecContext(ctx, query, expiresAt, id)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		_ = tx.Rollback()
+		// The key either doesn't exist or has been revoked.
+		if _, err := s.GetKey(ctx, id); err != nil {
+			return err
+		}
+		return fmt.Errorf("%w: %s has been revoked", ErrKeyNotRotatable, id)
+	}
+	if err := s.createKey(ctx, tx, key); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// createKey inserts the given API key using the given execer.
+func (s *sqlKeyStore) createKey(ctx context.Context, db sqlExecer, key *APIKey) error {
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", s.table, apiKeyColumns, s.placeholders(11))
+	_, err := db.ExecContext(ctx, query,
+		key.ID, key.Prefix, key.Owner, key.Name, strings.Join(key.Scopes, " "), key.Salt, key.Hash,
+		key.CreatedAt, nullTime(key.ExpiresAt), nullTime(key.LastUsedAt), nullTime(key.RevokedAt),
+	)
+	return err
+}
+
+// ListKeys returns the API keys of the given owner.
+func (s *sqlKeyStore) ListKeys(ctx context.Context, owner string) ([]APIKey, error) {
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE owner = %s ORDER BY created_at, id", apiKeyColumns, s.table, s.placeholder(1))
+	rows, err := s.db.QueryContext(ctx, query, owner)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var keys []APIKey
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, *key)
+	}
+	return keys, rows.Err()
+}
+
+// placeholders returns a comma-separated list with the placeholders of n query
+// arguments.
+func (s *sqlKeyStore) placeholders(n int) string {
+	list := make([]string, n)
+	for i := range list {
+		list[i] = s.placeholder(i + 1)
+	}
+	return strings.Join(list, ", ")
+}
+
+// placeholder returns the placeholder for the i-th query argument, starting at 1.
+func (s *sqlKeyStore) placeholder(i int) string {
+	if s.dollarPlaceholders {
+		return fmt.Sprintf("$%d", i)
+	}
+	return "?"
+}
+
+// rowScanner is implemented by *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanAPIKey reads an API key from the given row. The columns must be in the
+// order defined by apiKeyColumns.
+func scanAPIKey(row rowScanner) (*APIKey, error) {
+	var key APIKey
+	var name, scopes sql.NullString
+	var expiresAt, lastUsedAt, revokedAt sql.NullTime
+	err := row.Scan(&key.ID, &key.Prefix, &key.Owner, &name, &scopes, &key.Salt, &key.Hash, &key.CreatedAt, &expiresAt, &lastUsedAt, &revokedAt)
+	if err != nil {
+		return nil, err
+	}
+	key.Name = name.String
+	key.Scopes = strings.Fields(scopes.String)
+	key.ExpiresAt = expiresAt.Time
+	key.LastUsedAt = lastUsedAt.Time
+	key.RevokedAt = revokedAt.Time
+	return &key, nil
+}
+
+// nullTime returns nil for the zero time, so it's stored as NULL.
+func nullTime(t time.Time) any {
+	if t.IsZero() {
+		return nil
+	}
+	return t
+}
+
+// NewSQLKeyStore initializes a new KeyManagementStore that stores API keys in a
+// SQL database. Keys are stored in a table with the following columns, scopes are
+// stored as a space-separated list:
+//
+//	CREATE TABLE api_keys (
+//		id           VARCHAR(64) PRIMARY KEY,
+//		prefix       VARCHAR(16) NOT NULL,
+//		owner        VARCHAR(255) NOT NULL,
+//		name         VARCHAR(255),
+//		scopes       TEXT,
+//		salt         BLOB NOT NULL,
+//		hash         BLOB NOT NULL,
+//		created_at   TIMESTAMP NOT NULL,
+//		expires_at   TIMESTAMP NULL,
+//		last_used_at TIMESTAMP NULL,
+//		revoked_at   TIMESTAMP NULL
+//	);
+//	CREATE INDEX api_keys_owner ON api_keys (owner);
+//
+// An error is returned if the table name set with WithKeyTable is not a valid
+// SQL identifier, since it's included in the queries as is.
+func NewSQLKeyStore(db *sql.DB, opts ...SQLKeyStoreOption) (KeyManagementStore, error) {
+	s := &sqlKeyStore{
+		db:    db,
+		table: "api_keys",
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if !sqlIdentifier.MatchString(s.table) {
+		return nil, fmt.Errorf("invalid table name: %q", s.table)
+	}
+	return s, nil
+}
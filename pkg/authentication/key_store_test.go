@@ -0,0 +1,285 @@
+package authentication
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// apiKeyColumnNames contains the columns returned when querying API keys.
+var apiKeyColumnNames = strings.Split(strings.ReplaceAll(apiKeyColumns, " ", ""), ",")
+
+func TestMemoryKeyStore(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryKeyStore(APIKey{ID: "1234", Owner: "ci-bot"})
+
+	key, err := store.GetKey(ctx, "1234")
+	require.NoError(t, err)
+	assert.Equal(t, "ci-bot", key.Owner)
+
+	// Changes to the returned key are not stored.
+	key.Owner = "other"
+	key, err = store.GetKey(ctx, "1234")
+	require.NoError(t, err)
+	assert.Equal(t, "ci-bot", key.Owner)
+
+	usedAt := time.Now()
+	require.NoError(t, store.TouchKey(ctx, "1234", usedAt))
+	key, err = store.GetKey(ctx, "1234")
+	require.NoError(t, err)
+	assert.Equal(t, usedAt, key.LastUsedAt)
+
+	_, err = store.GetKey(ctx, "5678")
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+	assert.ErrorIs(t, store.TouchKey(ctx, "5678", usedAt), ErrKeyNotFound)
+}
+
+func TestSQLKeyStore_GetKey(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	ctx := context.Background()
+	store := newTestSQLKeyStore(t, db)
+	createdAt := time.Now().Add(-time.Hour)
+	expiresAt := time.Now().Add(time.Hour)
+
+	query := regexp.QuoteMeta("SELECT " + apiKeyColumns + " FROM api_keys WHERE id = ?")
+	mock.ExpectQuery(query).WithArgs("1234").WillReturnRows(
+		sqlmock.NewRows(apiKeyColumnNames).
+			AddRow("1234", "gzci", "ci-bot", "CI", "simulations.run worlds.read", []byte("salt"), []byte("hash"), createdAt, expiresAt, nil, nil),
+	)
+	key, err := store.GetKey(ctx, "1234")
+	require.NoError(t, err)
+	assert.Equal(t, &APIKey{
+		ID:        "1234",
+		Prefix:    "gzci",
+		Owner:     "ci-bot",
+		Name:      "CI",
+		Scopes:    []string{"simulations.run", "worlds.read"},
+		Salt:      []byte("salt"),
+		Hash:      []byte("hash"),
+		CreatedAt: createdAt,
+		ExpiresAt: expiresAt,
+	}, key)
+
+	mock.ExpectQuery(query).WithArgs("5678").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	_, err = store.GetKey(ctx, "5678")
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSQLKeyStore_TouchKey(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	ctx := context.Background()
+	store := newTestSQLKeyStore(t, db, WithKeyTable("auth.keys"), WithDollarPlaceholders())
+	usedAt := time.Now()
+
+	query := regexp.QuoteMeta("UPDATE auth.keys SET last_used_at = $1 WHERE id = $2")
+	mock.ExpectExec(query).WithArgs(usedAt, "1234").WillReturnResult(sqlmock.NewResult(0, 1))
+	assert.NoError(t, store.TouchKey(ctx, "1234", usedAt))
+
+	mock.ExpectExec(query).WithArgs(usedAt, "5678").WillReturnResult(sqlmock.NewResult(0, 0))
+	assert.ErrorIs(t, store.TouchKey(ctx, "5678", usedAt), ErrKeyNotFound)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestNewSQLKeyStore_InvalidTableName(t *testing.T) {
+	db, _, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	_, err = NewSQLKeyStore(db, WithKeyTable("api_keys; DROP TABLE users"))
+	assert.Error(t, err)
+}
+
+func TestAPIKeyAuthentication_SQLKeyStore(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	key := newTestAPIKey(t, "gzci", "1234", "secret")
+
+	mock.ExpectQuery("SELECT .* FROM api_keys").WithArgs("1234").WillReturnRows(
+		sqlmock.NewRows(apiKeyColumnNames).
+			AddRow(key.ID, key.Prefix, key.Owner, nil, "simulations.run", key.Salt, key.Hash, key.CreatedAt, nil, nil, nil),
+	)
+	mock.ExpectExec("UPDATE api_keys SET last_used_at").WithArgs(sqlmock.AnyArg(), "1234").WillReturnResult(sqlmock.NewResult(0, 1))
+
+	auth := NewAPIKeyAuthentication(newTestSQLKeyStore(t, db))
+	verified, err := auth.VerifyAPIKey(context.Background(), "gzci_1234_secret")
+	require.NoError(t, err)
+	assert.Equal(t, "ci-bot", verified.Owner)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMemoryKeyStore_Management(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryKeyStore()
+	now := time.Now()
+
+	require.NoError(t, store.CreateKey(ctx, &APIKey{ID: "2", Owner: "ci-bot", CreatedAt: now}))
+	require.NoError(t, store.CreateKey(ctx, &APIKey{ID: "1", Owner: "ci-bot", CreatedAt: now.Add(-time.Hour)}))
+	require.NoError(t, store.CreateKey(ctx, &APIKey{ID: "3", Owner: "other", CreatedAt: now}))
+	assert.Error(t, store.CreateKey(ctx, &APIKey{ID: "1"}))
+
+	keys, err := store.ListKeys(ctx, "ci-bot")
+	require.NoError(t, err)
+	require.Len(t, keys, 2)
+	assert.Equal(t, "1", keys[0].ID)
+	assert.Equal(t, "2", keys[1].ID)
+
+	require.NoError(t, store.RevokeKey(ctx, "1", now))
+	key, err := store.GetKey(ctx, "1")
+	require.NoError(t, err)
+	assert.Equal(t, now, key.RevokedAt)
+
+	// Revoked keys keep their revocation time.
+	require.NoError(t, store.RevokeKey(ctx, "1", now.Add(time.Hour)))
+	key, err = store.GetKey(ctx, "1")
+	require.NoError(t, err)
+	assert.Equal(t, now, key.RevokedAt)
+	assert.ErrorIs(t, store.RevokeKey(ctx, "5678", now), ErrKeyNotFound)
+
+	require.NoError(t, store.RotateKey(ctx, "2", now, &APIKey{ID: "4", Owner: "ci-bot", CreatedAt: now}))
+	key, err = store.GetKey(ctx, "2")
+	require.NoError(t, err)
+	assert.Equal(t, now, key.ExpiresAt)
+
+	// Nothing is changed if the new key can't be stored.
+	assert.Error(t, store.RotateKey(ctx, "2", time.Time{}, &APIKey{ID: "4"}))
+	key, err = store.GetKey(ctx, "2")
+	require.NoError(t, err)
+	assert.Equal(t, now, key.ExpiresAt)
+	assert.ErrorIs(t, store.RotateKey(ctx, "missing", now, &APIKey{ID: "5"}), ErrKeyNotFound)
+	assert.ErrorIs(t, store.RotateKey(ctx, "1", now, &APIKey{ID: "5"}), ErrKeyNotRotatable)
+	_, err = store.GetKey(ctx, "5")
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+}
+
+func TestSQLKeyStore_CreateKey(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	store := newTestSQLKeyStore(t, db)
+	key := &APIKey{
+		ID:        "1234",
+		Prefix:    "gzci",
+		Owner:     "ci-bot",
+		Scopes:    []string{"simulations.run", "worlds.read"},
+		Salt:      []byte("salt"),
+		Hash:      []byte("hash"),
+		CreatedAt: time.Now(),
+	}
+
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO api_keys ("+apiKeyColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)")).
+		WithArgs("1234", "gzci", "ci-bot", "", "simulations.run worlds.read", []byte("salt"), []byte("hash"), key.CreatedAt, nil, nil, nil).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	assert.NoError(t, store.CreateKey(context.Background(), key))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSQLKeyStore_RevokeKey(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	store := newTestSQLKeyStore(t, db, WithDollarPlaceholders())
+	revokedAt := time.Now()
+
+	query := regexp.QuoteMeta("UPDATE api_keys SET revoked_at = $1 WHERE id = $2 AND revoked_at IS NULL")
+	selectKey := regexp.QuoteMeta("SELECT " + apiKeyColumns + " FROM api_keys WHERE id = $1")
+	mock.ExpectExec(query).WithArgs(revokedAt, "1234").WillReturnResult(sqlmock.NewResult(0, 1))
+	assert.NoError(t, store.RevokeKey(context.Background(), "1234", revokedAt))
+
+	// Keys that have already been revoked are not updated.
+	mock.ExpectExec(query).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(selectKey).WithArgs("1234").WillReturnRows(sqlmock.NewRows(apiKeyColumnNames).
+		AddRow("1234", "gzci", "ci-bot", "CI", "", []byte("salt"), []byte("hash"), revokedAt, nil, nil, revokedAt))
+	assert.NoError(t, store.RevokeKey(context.Background(), "1234", revokedAt))
+
+	mock.ExpectExec(query).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(selectKey).WithArgs("5678").WillReturnError(sql.ErrNoRows)
+	assert.ErrorIs(t, store.RevokeKey(context.Background(), "5678", revokedAt), ErrKeyNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSQLKeyStore_RotateKey(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	store := newTestSQLKeyStore(t, db)
+	expiresAt := time.Now()
+	key := &APIKey{ID: "5678", Prefix: "gzci", Owner: "ci-bot", Name: "CI", Salt: []byte("salt"), Hash: []byte("hash"), CreatedAt: expiresAt}
+
+	update := regexp.QuoteMeta("UPDATE api_keys SET expires_at = ? WHERE id = ? AND revoked_at IS NULL")
+	insert := regexp.QuoteMeta("INSERT INTO api_keys (" + apiKeyColumns + ")")
+	selectKey := regexp.QuoteMeta("SELECT " + apiKeyColumns + " FROM api_keys WHERE id = ?")
+
+	mock.ExpectBegin()
+	mock.ExpectExec(update).WithArgs(expiresAt, "1234").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(insert).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	assert.NoError(t, store.RotateKey(context.Background(), "1234", expiresAt, key))
+
+	// The old key is not updated if the new key can't be stored.
+	mock.ExpectBegin()
+	mock.ExpectExec(update).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(insert).WillReturnError(errors.New("duplicate key"))
+	mock.ExpectRollback()
+	assert.Error(t, store.RotateKey(context.Background(), "1234", expiresAt, key))
+
+	// Keys revoked concurrently are not rotated.
+	mock.ExpectBegin()
+	mock.ExpectExec(update).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+	mock.ExpectQuery(selectKey).WithArgs("1234").WillReturnRows(sqlmock.NewRows(apiKeyColumnNames).
+		AddRow("1234", "gzci", "ci-bot", "CI", "", []byte("salt"), []byte("hash"), expiresAt, nil, nil, expiresAt))
+	assert.ErrorIs(t, store.RotateKey(context.Background(), "1234", expiresAt, key), ErrKeyNotRotatable)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(update).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+	mock.ExpectQuery(selectKey).WithArgs("1234").WillReturnError(sql.ErrNoRows)
+	assert.ErrorIs(t, store.RotateKey(context.Background(), "1234", expiresAt, key), ErrKeyNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSQLKeyStore_ListKeys(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	store := newTestSQLKeyStore(t, db)
+	createdAt := time.Now()
+	revokedAt := createdAt.Add(time.Minute)
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT " + apiKeyColumns + " FROM api_keys WHERE owner = ? ORDER BY created_at, id")).
+		WithArgs("ci-bot").
+		WillReturnRows(sqlmock.NewRows(apiKeyColumnNames).
+			AddRow("1", "gzci", "ci-bot", nil, nil, []byte("salt"), []byte("hash"), createdAt, nil, nil, revokedAt).
+			AddRow("2", "gzci", "ci-bot", nil, "worlds.read", []byte("salt"), []byte("hash"), createdAt, nil, nil, nil),
+		)
+	keys, err := store.ListKeys(context.Background(), "ci-bot")
+	require.NoError(t, err)
+	require.Len(t, keys, 2)
+	assert.Equal(t, "1", keys[0].ID)
+	assert.True(t, keys[0].IsRevoked())
+	assert.Equal(t, []string{"worlds.read"}, keys[1].Scopes)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// newTestSQLKeyStore initializes a new SQL KeyManagementStore using the given
+// database and options.
+func newTestSQLKeyStore(t *testing.T, db *sql.DB, opts ...SQLKeyStoreOption) KeyManagementStore {
+	store, err := NewSQLKeyStore(db, opts...)
+	require.NoError(t, err)
+	return store
+}
@@ -0,0 +1,352 @@
+package authentication
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+var (
+	// ErrCertificateNotProvided is returned when the client didn't present a
+	// verified certificate.
+	ErrCertificateNotProvided = errors.New("client certificate not provided")
+	// ErrTrustDomainNotAllowed is returned when the identity of a client
+	// certificate doesn't belong to any of the allowed trust domains.
+	ErrTrustDomainNotAllowed = errors.New("trust domain not allowed")
+	// ErrNoCertificateIdentity is returned when no identity could be extracted
+	// from a client certificate.
+	ErrNoCertificateIdentity = errors.New("client certificate has no identity")
+)
+
+// IdentitySource identifies the part of a client certificate an identity is
+// extracted from.
+type IdentitySource string
+
+const (
+	// IdentitySPIFFE extracts the identity from a SPIFFE ID URI SAN, such as
+	// spiffe://cluster.local/ns/default/sa/worker.
+	IdentitySPIFFE IdentitySource = "spiffe"
+	// IdentityDNS extracts the identity from the first DNS SAN.
+	IdentityDNS IdentitySource = "dns"
+	// IdentityCommonName extracts the identity from the subject common name.
+	IdentityCommonName IdentitySource = "cn"
+)
+
+// CertificateAuthentication authenticates clients using the certificates they
+// present during the TLS handshake.
+//
+// Certificates are expected to be verified by the TLS stack, for example by
+// setting tls.Config.ClientAuth to tls.RequireAndVerifyClientCert. Only
+// verified certificates are accepted.
+type CertificateAuthentication interface {
+	// VerifyCertificate extracts the identity of the given verified client
+	// certificate and returns the Principal it represents.
+	VerifyCertificate(ctx context.Context, cert *x509.Certificate) (*Principal, error)
+}
+
+// CertificateOption configures a CertificateAuthentication.
+type CertificateOption func(*certificateAuthentication)
+
+// WithTrustDomains sets the trust domains client identities must belong to.
+// SPIFFE IDs must use one of the given trust domains, while DNS names and common
+// names must be equal to, or a subdomain of, one of them. Defaults to accepting
+// every identity signed by a trusted certificate authority.
+func WithTrustDomains(domains ...string) CertificateOption {
+	return func(a *certificateAuthentication) {
+		a.trustDomains = domains
+	}
+}
+
+// WithIdentitySources sets the sources identities are extracted from, in order
+// of preference. Defaults to IdentitySPIFFE, IdentityDNS and IdentityCommonName.
+func WithIdentitySources(sources ...IdentitySource) CertificateOption {
+	return func(a *certificateAuthentication) {
+		a.sources = sources
+	}
+}
+
+// certificateAuthentication is a CertificateAuthentication implementation.
+type certificateAuthentication struct {
+	trustDomains []string
+	sources      []IdentitySource
+	now          func() time.Time
+}
+
+// VerifyCertificate extracts the identity of the given verified client
+// certificate. Failures are reported as a *VerificationError.
+//
+// The Principal uses the identity as ID. Its claims mirror the ones of a JWT:
+// sub contains the identity, iss the SPIFFE trust domain or the issuer common
+// name, and x5t#S256 the certificate thumbprint, as defined in RFC 8705.
+func (a *certificateAuthentication) VerifyCertificate(ctx context.Context, cert *x509.Certificate) (*Principal, error) {
+	if cert == nil {
+		return nil, NewVerificationError(ProviderMTLS, ReasonNotProvided, ErrCertificateNotProvided)
+	}
+	now := a.now()
+	if now.Before(cert.NotBefore) {
+		return nil, NewVerificationError(ProviderMTLS, ReasonNotYetValid, errors.New("client certificate is not valid yet"))
+	}
+	if now.After(cert.NotAfter) {
+		return nil, NewVerificationError(ProviderMTLS, ReasonExpired, errors.New("client certificate has expired"))
+	}
+
+	id, issuer, err := a.identity(cert)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := map[string]any{
+		"sub":      id,
+		"iss":      issuer,
+		"x5t#S256": CertificateThumbprint(cert),
+		"serial":   cert.SerialNumber.String(),
+		"nbf":      cert.NotBefore.Unix(),
+		"exp":      cert.NotAfter.Unix(),
+	}
+	if len(cert.DNSNames) > 0 {
+		claims["dns_names"] = cert.DNSNames
+	}
+	p := &Principal{
+		ID:          id,
+		Issuer:      issuer,
+		Provider:    ProviderMTLS,
+		DisplayName: cert.Subject.CommonName,
+		Claims:      claims,
+	}
+	if len(cert.EmailAddresses) > 0 {
+		p.Email = cert.EmailAddresses[0]
+		claims["email"] = p.Email
+	}
+	return p, nil
+}
+
+// identity returns the identity and issuer of the given certificate, using the
+// first configured source present in the certificate.
+func (a *certificateAuthentication) identity(cert *x509.Certificate) (string, string, error) {
+	for _, source := range a.sources {
+		var id, domain string
+		switch source {
+		case IdentitySPIFFE:
+			u := spiffeID(cert)
+			if u == nil {
+				continue
+			}
+			id, domain = u.String(), u.Host
+			if !a.allowed(domain, true) {
+				return "", "", NewVerificationError(ProviderMTLS, ReasonInvalid, fmt.Errorf("%w: %s", ErrTrustDomainNotAllowed, domain))
+			}
+			return id, "spiffe://" + domain, nil
+		case IdentityDNS:
+			if len(cert.DNSNames) == 0 {
+				continue
+			}
+			id = cert.DNSNames[0]
+		case IdentityCommonName:
+			if len(cert.Subject.CommonName) == 0 {
+				continue
+			}
+			id = cert.Subject.CommonName
+		default:
+			continue
+		}
+		if !a.allowed(id, false) {
+			return "", "", NewVerificationError(ProviderMTLS, ReasonInvalid, fmt.Errorf("%w: %s", ErrTrustDomainNotAllowed, id))
+		}
+		return id, cert.Issuer.CommonName, nil
+	}
+	return "", "", NewVerificationError(ProviderMTLS, ReasonInvalid, ErrNoCertificateIdentity)
+}
+
+// allowed returns true if the given name belongs to one of the allowed trust
+// domains. If exact is true, subdomains are not accepted.
+func (a *certificateAuthentication) allowed(name string, exact bool) bool {
+	if len(a.trustDomains) == 0 {
+		return true
+	}
+	name = strings.ToLower(name)
+	for _, domain := range a.trustDomains {
+		domain = strings.ToLower(domain)
+		if name == domain || (!exact && strings.HasSuffix(name, "."+domain)) {
+			return true
+		}
+	}
+	return false
+}
+
+// NewCertificateAuthentication initializes a new CertificateAuthentication that
+// extracts identities from verified client certificates.
+//
+// Without WithTrustDomains, every identity of a certificate signed by any of the
+// certificate authorities trusted by the server is accepted, including the
+// common name of certificates without SPIFFE IDs or DNS names. Servers whose
+// client CA pool is shared with other services should always set the trust
+// domains, or restrict the identity sources with WithIdentitySources.
+//
+//	auth := NewCertificateAuthentication(WithTrustDomains("cluster.local"))
+func NewCertificateAuthentication(opts ...CertificateOption) CertificateAuthentication {
+	a := &certificateAuthentication{
+		sources: []IdentitySource{IdentitySPIFFE, IdentityDNS, IdentityCommonName},
+		now:     time.Now,
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
+}
+
+// spiffeID returns the SPIFFE ID contained in the URI SANs of the given
+// certificate, or nil if there is none.
+func spiffeID(cert *x509.Certificate) *url.URL {
+	for _, u := range cert.URIs {
+		if u.Scheme == "spiffe" && len(u.Host) > 0 {
+			return u
+		}
+	}
+	return nil
+}
+
+// CertificateThumbprint returns the base64url-encoded SHA-256 thumbprint of the
+// given certificate, as used in the x5t#S256 confirmation method of RFC 8705.
+func CertificateThumbprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// httpPeerCertificate returns the verified client certificate of the given
+// HTTP request.
+func httpPeerCertificate(r *http.Request) *x509.Certificate {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return r.TLS.VerifiedChains[0][0]
+}
+
+// grpcPeerCertificate returns the verified client certificate of the gRPC
+// request identified by the given context.
+func grpcPeerCertificate(ctx context.Context) *x509.Certificate {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil
+	}
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(info.State.VerifiedChains) == 0 || len(info.State.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return info.State.VerifiedChains[0][0]
+}
+
+// CertificateMiddleware returns an HTTP middleware that authenticates every
+// request using the verified client certificate presented during the TLS
+// handshake. Requests without a valid certificate are rejected with the status
+// code returned by HTTPStatusCode.
+//
+// The Principal is stored in the request context, see PrincipalFromContext, and
+// its claims can be retrieved using ClaimsFromContext. The Principal returned by
+// the CertificateAuthentication is used unless a PrincipalMapper is set with
+// WithPrincipalMapper, in which case it's built from the certificate claims.
+// Verifications can be audited by wrapping auth with NewAuditedCertificate.
+//
+//	server := &http.Server{
+//		Handler:   CertificateMiddleware(auth)(mux),
+//		TLSConfig: &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: pool},
+//	}
+func CertificateMiddleware(auth CertificateAuthentication, opts ...MiddlewareOption) func(http.Handler) http.Handler {
+	cfg := newCertificateMiddlewareConfig(opts)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := WithRequestMetadata(r.Context(), newHTTPRequestMetadata(r))
+			ctx, err := cfg.verifyCertificate(ctx, auth, httpPeerCertificate(r))
+			if err != nil {
+				status := HTTPStatusCode(err)
+				http.Error(w, http.StatusText(status), status)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// newCertificateMiddlewareConfig applies the given options on top of an empty
+// configuration, which keeps the Principal returned by the
+// CertificateAuthentication.
+func newCertificateMiddlewareConfig(opts []MiddlewareOption) middlewareConfig {
+	var cfg middlewareConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return cfg
+}
+
+// verifyCertificate verifies the given client certificate using auth, and
+// returns a new context with the principal and its claims.
+func (cfg middlewareConfig) verifyCertificate(ctx context.Context, auth CertificateAuthentication, cert *x509.Certificate) (context.Context, error) {
+	principal, err := auth.VerifyCertificate(ctx, cert)
+	if err != nil {
+		return nil, err
+	}
+	claims := jwt.MapClaims(principal.Claims)
+	if cfg.mapper != nil {
+		principal, err = cfg.mapper(claims)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return WithPrincipal(WithClaims(ctx, claims), principal), nil
+}
+
+// CertificateUnaryServerInterceptor returns a gRPC unary server interceptor that
+// authenticates every request using the verified client certificate of the
+// peer. See CertificateMiddleware for more information.
+//
+//	server := grpc.NewServer(
+//		grpc.Creds(credentials.NewTLS(tlsConfig)),
+//		grpc.UnaryInterceptor(CertificateUnaryServerInterceptor(auth)),
+//	)
+func CertificateUnaryServerInterceptor(auth CertificateAuthentication, opts ...MiddlewareOption) grpc.UnaryServerInterceptor {
+	cfg := newCertificateMiddlewareConfig(opts)
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx, err := authenticateCertificateGRPC(ctx, info.FullMethod, auth, cfg)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// CertificateStreamServerInterceptor returns a gRPC stream server interceptor
+// that authenticates every stream using the verified client certificate of the
+// peer. See CertificateMiddleware for more information.
+func CertificateStreamServerInterceptor(auth CertificateAuthentication, opts ...MiddlewareOption) grpc.StreamServerInterceptor {
+	cfg := newCertificateMiddlewareConfig(opts)
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := authenticateCertificateGRPC(ss.Context(), info.FullMethod, auth, cfg)
+		if err != nil {
+			return err
+		}
+		return handler(srv, NewServerStream(ss, ctx))
+	}
+}
+
+// authenticateCertificateGRPC verifies the client certificate of the gRPC
+// request identified by the given context and method, and returns a new context
+// with the principal and its claims.
+func authenticateCertificateGRPC(ctx context.Context, method string, auth CertificateAuthentication, cfg middlewareConfig) (context.Context, error) {
+	ctx = WithRequestMetadata(ctx, newGRPCRequestMetadata(ctx, method))
+	ctx, err := cfg.verifyCertificate(ctx, auth, grpcPeerCertificate(ctx))
+	if err != nil {
+		return nil, grpcVerificationError(err)
+	}
+	return ctx, nil
+}
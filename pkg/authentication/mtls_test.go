@@ -0,0 +1,321 @@
+package authentication
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// testCA is a certificate authority used to issue client certificates in tests.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pool *x509.CertPool
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Gazebo Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return &testCA{cert: cert, key: key, pool: pool}
+}
+
+// issue issues a new client certificate after applying the given function to
+// the certificate template.
+func (ca *testCA) issue(t *testing.T, fn func(*x509.Certificate)) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	if fn != nil {
+		fn(template)
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+	leaf, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+func withSPIFFEID(id string) func(*x509.Certificate) {
+	return func(c *x509.Certificate) {
+		u, _ := url.Parse(id)
+		c.URIs = append(c.URIs, u)
+	}
+}
+
+func TestCertificateAuthentication_VerifyCertificate(t *testing.T) {
+	ca := newTestCA(t)
+	cert := ca.issue(t, func(c *x509.Certificate) {
+		c.Subject.CommonName = "worker"
+		c.DNSNames = []string{"worker.default.svc.cluster.local"}
+		c.EmailAddresses = []string{"worker@gazebosim.org"}
+		withSPIFFEID("spiffe://cluster.local/ns/default/sa/worker")(c)
+	})
+
+	auth := NewCertificateAuthentication(WithTrustDomains("cluster.local"))
+	p, err := auth.VerifyCertificate(context.Background(), cert.Leaf)
+	require.NoError(t, err)
+	assert.Equal(t, "spiffe://cluster.local/ns/default/sa/worker", p.ID)
+	assert.Equal(t, "spiffe://cluster.local", p.Issuer)
+	assert.Equal(t, ProviderMTLS, p.Provider)
+	assert.Equal(t, "worker", p.DisplayName)
+	assert.Equal(t, "worker@gazebosim.org", p.Email)
+	assert.Equal(t, p.ID, p.Claims["sub"])
+	assert.Equal(t, CertificateThumbprint(cert.Leaf), p.Claims["x5t#S256"])
+}
+
+func TestCertificateAuthentication_IdentitySources(t *testing.T) {
+	ca := newTestCA(t)
+	ctx := context.Background()
+
+	dns := ca.issue(t, func(c *x509.Certificate) {
+		c.Subject.CommonName = "worker"
+		c.DNSNames = []string{"worker.gazebosim.org"}
+	})
+	p, err := NewCertificateAuthentication().VerifyCertificate(ctx, dns.Leaf)
+	require.NoError(t, err)
+	assert.Equal(t, "worker.gazebosim.org", p.ID)
+	assert.Equal(t, "Gazebo Test CA", p.Issuer)
+
+	p, err = NewCertificateAuthentication(WithIdentitySources(IdentityCommonName)).VerifyCertificate(ctx, dns.Leaf)
+	require.NoError(t, err)
+	assert.Equal(t, "worker", p.ID)
+
+	empty := ca.issue(t, nil)
+	_, err = NewCertificateAuthentication().VerifyCertificate(ctx, empty.Leaf)
+	assert.ErrorIs(t, err, ErrNoCertificateIdentity)
+	assert.Equal(t, http.StatusUnauthorized, HTTPStatusCode(err))
+}
+
+func TestCertificateAuthentication_TrustDomains(t *testing.T) {
+	ca := newTestCA(t)
+	ctx := context.Background()
+	auth := NewCertificateAuthentication(WithTrustDomains("cluster.local", "gazebosim.org"))
+
+	cases := []struct {
+		name    string
+		cert    tls.Certificate
+		allowed bool
+	}{
+		{name: "spiffe", cert: ca.issue(t, withSPIFFEID("spiffe://cluster.local/sa/worker")), allowed: true},
+		{name: "spiffe subdomain", cert: ca.issue(t, withSPIFFEID("spiffe://evil.cluster.local/sa/worker")), allowed: false},
+		{name: "spiffe other domain", cert: ca.issue(t, withSPIFFEID("spiffe://example.com/sa/worker")), allowed: false},
+		{name: "dns subdomain", cert: ca.issue(t, func(c *x509.Certificate) { c.DNSNames = []string{"api.gazebosim.org"} }), allowed: true},
+		{name: "dns suffix", cert: ca.issue(t, func(c *x509.Certificate) { c.DNSNames = []string{"evilgazebosim.org"} }), allowed: false},
+		{name: "common name", cert: ca.issue(t, func(c *x509.Certificate) { c.Subject.CommonName = "GAZEBOSIM.ORG" }), allowed: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := auth.VerifyCertificate(ctx, tc.cert.Leaf)
+			if tc.allowed {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, ErrTrustDomainNotAllowed)
+			assert.Equal(t, http.StatusForbidden, HTTPStatusCode(err))
+			assert.Equal(t, codes.PermissionDenied, GRPCStatusCode(err))
+		})
+	}
+}
+
+func TestCertificateAuthentication_Validity(t *testing.T) {
+	ca := newTestCA(t)
+	cert := ca.issue(t, withSPIFFEID("spiffe://cluster.local/sa/worker"))
+	auth := NewCertificateAuthentication().(*certificateAuthentication)
+
+	auth.now = func() time.Time { return cert.Leaf.NotAfter.Add(time.Second) }
+	_, err := auth.VerifyCertificate(context.Background(), cert.Leaf)
+	assert.Equal(t, ReasonExpired, ReasonOf(err))
+
+	auth.now = func() time.Time { return cert.Leaf.NotBefore.Add(-time.Second) }
+	_, err = auth.VerifyCertificate(context.Background(), cert.Leaf)
+	assert.Equal(t, ReasonNotYetValid, ReasonOf(err))
+
+	_, err = auth.VerifyCertificate(context.Background(), nil)
+	assert.ErrorIs(t, err, ErrCertificateNotProvided)
+	assert.ErrorIs(t, err, ErrTokenNotProvided)
+}
+
+func TestCertificateMiddleware(t *testing.T) {
+	ca := newTestCA(t)
+	var principal *Principal
+	handler := CertificateMiddleware(NewCertificateAuthentication(WithTrustDomains("cluster.local")))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, _ = PrincipalFromContext(r.Context())
+			claims, ok := ClaimsFromContext(r.Context())
+			require.True(t, ok)
+			sub, err := claims.GetSubject()
+			require.NoError(t, err)
+			_, _ = io.WriteString(w, sub)
+		}),
+	)
+	server := httptest.NewUnstartedServer(handler)
+	server.TLS = &tls.Config{ClientAuth: tls.VerifyClientCertIfGiven, ClientCAs: ca.pool}
+	server.StartTLS()
+	defer server.Close()
+
+	newClient := func(certs ...tls.Certificate) *http.Client {
+		client := server.Client()
+		transport := client.Transport.(*http.Transport).Clone()
+		transport.TLSClientConfig.Certificates = certs
+		client.Transport = transport
+		return client
+	}
+
+	res, err := newClient(ca.issue(t, withSPIFFEID("spiffe://cluster.local/sa/worker"))).Get(server.URL)
+	require.NoError(t, err)
+	body, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "spiffe://cluster.local/sa/worker", string(body))
+	require.NotNil(t, principal)
+	assert.Equal(t, ProviderMTLS, principal.Provider)
+
+	res, err = newClient().Get(server.URL)
+	require.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+
+	res, err = newClient(ca.issue(t, withSPIFFEID("spiffe://example.com/sa/worker"))).Get(server.URL)
+	require.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusForbidden, res.StatusCode)
+}
+
+func TestCertificateMiddleware_UnverifiedCertificate(t *testing.T) {
+	ca := newTestCA(t)
+	cert := ca.issue(t, withSPIFFEID("spiffe://cluster.local/sa/worker"))
+	handler := CertificateMiddleware(NewCertificateAuthentication())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("handler must not be called")
+	}))
+
+	// Certificates that were presented but not verified by the TLS stack are ignored.
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert.Leaf}}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestCertificateUnaryServerInterceptor(t *testing.T) {
+	ca := newTestCA(t)
+	cert := ca.issue(t, withSPIFFEID("spiffe://cluster.local/sa/worker"))
+	interceptor := CertificateUnaryServerInterceptor(NewCertificateAuthentication(WithTrustDomains("cluster.local")))
+	info := &grpc.UnaryServerInfo{FullMethod: "/gazebo.Worlds/List"}
+
+	ctx := peer.NewContext(context.Background(), &peer.Peer{
+		AuthInfo: credentials.TLSInfo{State: tls.ConnectionState{
+			VerifiedChains: [][]*x509.Certificate{{cert.Leaf, ca.cert}},
+		}},
+	})
+	res, err := interceptor(ctx, nil, info, func(ctx context.Context, req any) (any, error) {
+		principal, ok := PrincipalFromContext(ctx)
+		require.True(t, ok)
+		return principal.ID, nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "spiffe://cluster.local/sa/worker", res)
+
+	_, err = interceptor(context.Background(), nil, info, func(ctx context.Context, req any) (any, error) {
+		t.Fatal("handler must not be called")
+		return nil, nil
+	})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestCertificateUnaryServerInterceptor_Options(t *testing.T) {
+	ca := newTestCA(t)
+	cert := ca.issue(t, withSPIFFEID("spiffe://cluster.local/sa/worker"))
+	sink := &memoryAuditSink{}
+	mapper := func(claims jwt.Claims) (*Principal, error) {
+		sub, err := claims.GetSubject()
+		if err != nil {
+			return nil, err
+		}
+		return &Principal{ID: sub, Provider: ProviderMTLS, Roles: []string{"worker"}}, nil
+	}
+	interceptor := CertificateUnaryServerInterceptor(
+		NewAuditedCertificate(NewCertificateAuthentication(WithTrustDomains("cluster.local")), sink),
+		WithPrincipalMapper(mapper),
+	)
+	info := &grpc.UnaryServerInfo{FullMethod: "/gazebo.Worlds/List"}
+
+	ctx := peer.NewContext(context.Background(), &peer.Peer{
+		AuthInfo: credentials.TLSInfo{State: tls.ConnectionState{
+			VerifiedChains: [][]*x509.Certificate{{cert.Leaf, ca.cert}},
+		}},
+	})
+	res, err := interceptor(ctx, nil, info, func(ctx context.Context, req any) (any, error) {
+		principal, ok := PrincipalFromContext(ctx)
+		require.True(t, ok)
+		return principal.Roles, nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"worker"}, res)
+
+	require.Len(t, sink.events, 1)
+	assert.Equal(t, AuditOutcomeSuccess, sink.events[0].Outcome)
+	assert.Equal(t, "spiffe://cluster.local/sa/worker", sink.events[0].Subject)
+	assert.NotEmpty(t, sink.events[0].TokenFingerprint)
+	require.NotNil(t, sink.events[0].Request)
+	assert.Equal(t, "/gazebo.Worlds/List", sink.events[0].Request.Path)
+}
+
+func TestCertificateStreamServerInterceptor(t *testing.T) {
+	ca := newTestCA(t)
+	cert := ca.issue(t, func(c *x509.Certificate) { c.DNSNames = []string{"worker.gazebosim.org"} })
+	interceptor := CertificateStreamServerInterceptor(NewCertificateAuthentication(WithTrustDomains("cluster.local")))
+	info := &grpc.StreamServerInfo{FullMethod: "/gazebo.Worlds/Watch"}
+
+	ctx := peer.NewContext(context.Background(), &peer.Peer{
+		AuthInfo: credentials.TLSInfo{State: tls.ConnectionState{
+			VerifiedChains: [][]*x509.Certificate{{cert.Leaf, ca.cert}},
+		}},
+	})
+	err := interceptor(nil, &testServerStream{ctx: ctx}, info, func(srv any, ss grpc.ServerStream) error {
+		t.Fatal("handler must not be called")
+		return nil
+	})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
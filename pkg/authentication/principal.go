@@ -0,0 +1,233 @@
+package authentication
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Principal is a provider-neutral representation of an authenticated entity,
+// built from the claims returned by any Authentication provider.
+type Principal struct {
+	// ID is the unique identifier of the principal within its issuer.
+	ID string
+	// Issuer is the entity that issued the credential.
+	Issuer string
+	// Provider is the name of the provider that verified the credential.
+	Provider string
+	// Email is the email address of the principal, if any.
+	Email string
+	// DisplayName is the human-readable name of the principal, if any.
+	DisplayName string
+	// Roles contains the roles assigned to the principal.
+	Roles []string
+	// Scopes contains the scopes granted to the credential.
+	Scopes []string
+	// Tenant is the identifier of the tenant or organization the principal
+	// authenticated into, if any.
+	Tenant string
+	// Claims contains the raw claims of the credential.
+	Claims map[string]any
+}
+
+// HasRole returns true if the principal has the given role.
+func (p *Principal) HasRole(role string) bool {
+	return contains(p.Roles, role)
+}
+
+// HasScope returns true if the credential was granted the given scope.
+func (p *Principal) HasScope(scope string) bool {
+	return contains(p.Scopes, scope)
+}
+
+// PrincipalMapper builds a Principal from a set of verified claims.
+type PrincipalMapper func(claims jwt.Claims) (*Principal, error)
+
+// DefaultPrincipalMapper returns a PrincipalMapper that picks the mapper matching
+// the provider that produced the claims: FirebasePrincipalMapper for Firebase,
+// Auth0PrincipalMapper for Auth0 claims and for tokens issued by an auth0.com
+// tenant, GenericPrincipalMapper with the
+// ProviderGCPIDToken provider for Google-signed ID tokens, and
+// GenericPrincipalMapper otherwise.
+func DefaultPrincipalMapper() PrincipalMapper {
+	auth0 := Auth0PrincipalMapper("")
+	firebase := FirebasePrincipalMapper()
+	gcp := GenericPrincipalMapper(ProviderGCPIDToken)
+	generic := GenericPrincipalMapper("")
+	return func(claims jwt.Claims) (*Principal, error) {
+		switch claims.(type) {
+		case auth0Claims:
+			return auth0(claims)
+		case firebaseClaims:
+			return firebase(claims)
+		case gcpIDTokenClaims:
+			return gcp(claims)
+		}
+		if iss, err := claims.GetIssuer(); err == nil && isAuth0Issuer(iss) {
+			return auth0(claims)
+		}
+		return generic(claims)
+	}
+}
+
+// isAuth0Issuer returns true if the given issuer is an auth0.com tenant, such as
+// https://gazebo.us.auth0.com/.
+func isAuth0Issuer(iss string) bool {
+	u, err := url.Parse(iss)
+	return err == nil && u.Scheme == "https" && strings.HasSuffix(u.Hostname(), ".auth0.com")
+}
+
+// GenericPrincipalMapper returns a PrincipalMapper that uses the standard JWT and
+// OpenID Connect claims:
+//
+//   - ID: sub
+//   - Email: email
+//   - DisplayName: name
+//   - Roles: roles
+//   - Scopes: scope (space-delimited) or scp (list)
+//   - Tenant: tenant
+func GenericPrincipalMapper(provider string) PrincipalMapper {
+	return func(claims jwt.Claims) (*Principal, error) {
+		return newPrincipal(provider, claims, "roles", "tenant")
+	}
+}
+
+// Auth0PrincipalMapper returns a PrincipalMapper for claims issued by Auth0.
+// Auth0 requires custom claims to be namespaced, roles are read from the
+// "<namespace>roles" claim, such as "https://gazebosim.org/roles", falling back to
+// the "roles" claim. The permissions granted by Auth0 RBAC are added to the scopes,
+// and the organization (org_id) is used as the tenant.
+func Auth0PrincipalMapper(namespace string) PrincipalMapper {
+	return func(claims jwt.Claims) (*Principal, error) {
+		p, err := newPrincipal(ProviderAuth0, claims, namespace+"roles", "org_id")
+		if err != nil {
+			return nil, err
+		}
+		if len(p.Roles) == 0 {
+			p.Roles, _ = getStringsClaim(claims, "roles")
+		}
+		if len(p.DisplayName) == 0 {
+			p.DisplayName, _ = getStringClaim(claims, "nickname")
+		}
+		if permissions, err := getStringsClaim(claims, "permissions"); err == nil {
+			p.Scopes = appendUnique(p.Scopes, permissions...)
+		}
+		return p, nil
+	}
+}
+
+// FirebasePrincipalMapper returns a PrincipalMapper for claims issued by Firebase.
+// Roles are read from the "roles" custom claim, and the tenant from the Firebase
+// tenant the user signed in to.
+func FirebasePrincipalMapper() PrincipalMapper {
+	return func(claims jwt.Claims) (*Principal, error) {
+		p, err := newPrincipal(ProviderFirebase, claims, "roles", "tenant")
+		if err != nil {
+			return nil, err
+		}
+		if fc, ok := claims.(firebaseClaims); ok {
+			if len(fc.UID) > 0 {
+				p.ID = fc.UID
+			}
+			if len(fc.Firebase.Tenant) > 0 {
+				p.Tenant = fc.Firebase.Tenant
+			}
+		}
+		return p, nil
+	}
+}
+
+// newPrincipal builds a Principal using the standard claims and the given role
+// and tenant claim keys.
+func newPrincipal(provider string, claims jwt.Claims, rolesKey string, tenantKey string) (*Principal, error) {
+	sub, err := claims.GetSubject()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrTokenInvalid, err)
+	}
+	iss, _ := claims.GetIssuer()
+	p := &Principal{
+		ID:       sub,
+		Issuer:   iss,
+		Provider: provider,
+		Claims:   claimsMap(claims),
+	}
+	p.Email, _ = getEmail(claims)
+	p.DisplayName, _ = getStringClaim(claims, "name")
+	p.Roles, _ = getStringsClaim(claims, rolesKey)
+	p.Tenant, _ = getStringClaim(claims, tenantKey)
+	if scope, err := getStringClaim(claims, "scope"); err == nil {
+		p.Scopes = strings.Fields(scope)
+	} else if scp, err := getStringsClaim(claims, "scp"); err == nil {
+		p.Scopes = scp
+	}
+	return p, nil
+}
+
+// claimsMap returns the raw claims contained in the given jwt.Claims.
+func claimsMap(claims jwt.Claims) map[string]any {
+	result := make(map[string]any)
+	switch c := claims.(type) {
+	case jwt.MapClaims:
+		for k, v := range c {
+			result[k] = v
+		}
+		return result
+	case auth0Claims:
+		for k, v := range c.MapClaims {
+			result[k] = v
+		}
+		return result
+	case firebaseClaims:
+		for k, v := range c.Claims {
+			result[k] = v
+		}
+	case gcpIDTokenClaims:
+		for k, v := range c.MapClaims {
+			result[k] = v
+		}
+		return result
+	}
+	if v, err := claims.GetSubject(); err == nil && len(v) > 0 {
+		result["sub"] = v
+	}
+	if v, err := claims.GetIssuer(); err == nil && len(v) > 0 {
+		result["iss"] = v
+	}
+	if v, err := claims.GetAudience(); err == nil && len(v) > 0 {
+		result["aud"] = []string(v)
+	}
+	if v, err := claims.GetExpirationTime(); err == nil && v != nil {
+		result["exp"] = v.Unix()
+	}
+	if v, err := claims.GetIssuedAt(); err == nil && v != nil {
+		result["iat"] = v.Unix()
+	}
+	return result
+}
+
+// appendUnique appends the given values to list, skipping the ones already present.
+func appendUnique(list []string, values ...string) []string {
+	for _, v := range values {
+		if !contains(list, v) {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+// principalContextKey is the key used to store the Principal in a context.Context.
+type principalContextKey struct{}
+
+// WithPrincipal returns a copy of ctx that carries the given principal.
+func WithPrincipal(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalContextKey{}, principal)
+}
+
+// PrincipalFromContext returns the principal stored in ctx by WithPrincipal.
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	principal, ok := ctx.Value(principalContextKey{}).(*Principal)
+	return principal, ok && principal != nil
+}
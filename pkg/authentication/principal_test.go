@@ -0,0 +1,162 @@
+package authentication
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenericPrincipalMapper(t *testing.T) {
+	claims := jwt.MapClaims{
+		"sub":    "gazebo-web",
+		"iss":    "https://issuer.gazebosim.org",
+		"email":  "test@gazebosim.org",
+		"name":   "Gazebo Web",
+		"roles":  []any{"admin", "user"},
+		"scope":  "read:worlds write:worlds",
+		"tenant": "openrobotics",
+	}
+	p, err := GenericPrincipalMapper("custom")(claims)
+	require.NoError(t, err)
+	assert.Equal(t, "gazebo-web", p.ID)
+	assert.Equal(t, "https://issuer.gazebosim.org", p.Issuer)
+	assert.Equal(t, "custom", p.Provider)
+	assert.Equal(t, "test@gazebosim.org", p.Email)
+	assert.Equal(t, "Gazebo Web", p.DisplayName)
+	assert.Equal(t, []string{"admin", "user"}, p.Roles)
+	assert.Equal(t, []string{"read:worlds", "write:worlds"}, p.Scopes)
+	assert.Equal(t, "openrobotics", p.Tenant)
+	assert.Equal(t, "gazebo-web", p.Claims["sub"])
+	assert.True(t, p.HasRole("admin"))
+	assert.False(t, p.HasRole("owner"))
+	assert.True(t, p.HasScope("write:worlds"))
+}
+
+func TestGenericPrincipalMapper_ScpClaim(t *testing.T) {
+	p, err := GenericPrincipalMapper("")(jwt.MapClaims{"sub": "gazebo-web", "scp": []any{"read", "write"}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"read", "write"}, p.Scopes)
+}
+
+func TestGenericPrincipalMapper_InvalidSubject(t *testing.T) {
+	_, err := GenericPrincipalMapper("")(jwt.MapClaims{"sub": 1234})
+	assert.ErrorIs(t, err, ErrTokenInvalid)
+}
+
+func TestAuth0PrincipalMapper(t *testing.T) {
+	claims := NewAuth0Claims(jwt.MapClaims{
+		"sub":                         "auth0|1234",
+		"nickname":                    "gazebo",
+		"https://gazebosim.org/roles": []any{"admin"},
+		"scope":                       "openid read:worlds",
+		"permissions":                 []any{"read:worlds", "delete:worlds"},
+		"org_id":                      "org_1234",
+	})
+	p, err := Auth0PrincipalMapper("https://gazebosim.org/")(claims)
+	require.NoError(t, err)
+	assert.Equal(t, "auth0|1234", p.ID)
+	assert.Equal(t, ProviderAuth0, p.Provider)
+	assert.Equal(t, "gazebo", p.DisplayName)
+	assert.Equal(t, []string{"admin"}, p.Roles)
+	assert.Equal(t, []string{"openid", "read:worlds", "delete:worlds"}, p.Scopes)
+	assert.Equal(t, "org_1234", p.Tenant)
+}
+
+func TestAuth0PrincipalMapper_FallbackRoles(t *testing.T) {
+	p, err := Auth0PrincipalMapper("https://gazebosim.org/")(NewAuth0Claims(jwt.MapClaims{
+		"sub":   "auth0|1234",
+		"roles": []any{"user"},
+	}))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"user"}, p.Roles)
+}
+
+func TestFirebasePrincipalMapper(t *testing.T) {
+	token := NewFirebaseTestToken()
+	token.Firebase.Tenant = "tenant-1"
+	token.Claims["roles"] = []any{"user"}
+
+	p, err := FirebasePrincipalMapper()(NewFirebaseClaims(token))
+	require.NoError(t, err)
+	assert.Equal(t, "1234", p.ID)
+	assert.Equal(t, "firebase", p.Issuer)
+	assert.Equal(t, ProviderFirebase, p.Provider)
+	assert.Equal(t, "test@gazebosim.org", p.Email)
+	assert.Equal(t, []string{"user"}, p.Roles)
+	assert.Equal(t, "tenant-1", p.Tenant)
+	assert.Equal(t, "gazebo-web", p.Claims["sub"])
+	assert.Equal(t, "test@gazebosim.org", p.Claims["email"])
+}
+
+func TestDefaultPrincipalMapper(t *testing.T) {
+	mapper := DefaultPrincipalMapper()
+
+	p, err := mapper(NewAuth0Claims(jwt.MapClaims{"sub": "auth0|1234"}))
+	require.NoError(t, err)
+	assert.Equal(t, ProviderAuth0, p.Provider)
+
+	p, err = mapper(NewFirebaseClaims(NewFirebaseTestToken()))
+	require.NoError(t, err)
+	assert.Equal(t, ProviderFirebase, p.Provider)
+
+	// Claims returned by the Auth0 Authentication are matched by their issuer.
+	p, err = mapper(jwt.MapClaims{"sub": "auth0|1234", "iss": "https://gazebo.us.auth0.com/"})
+	require.NoError(t, err)
+	assert.Equal(t, ProviderAuth0, p.Provider)
+
+	p, err = mapper(jwt.MapClaims{"sub": "gazebo-web"})
+	require.NoError(t, err)
+	assert.Empty(t, p.Provider)
+	assert.Equal(t, "gazebo-web", p.ID)
+}
+
+func TestPrincipalFromContext(t *testing.T) {
+	_, ok := PrincipalFromContext(context.Background())
+	assert.False(t, ok)
+
+	ctx := WithPrincipal(context.Background(), &Principal{ID: "gazebo-web"})
+	p, ok := PrincipalFromContext(ctx)
+	require.True(t, ok)
+	assert.Equal(t, "gazebo-web", p.ID)
+}
+
+func TestHTTPMiddleware_Principal(t *testing.T) {
+	mapper := func(claims jwt.Claims) (*Principal, error) {
+		return &Principal{ID: "mapped"}, nil
+	}
+	var called bool
+	handler := HTTPMiddleware(authenticationWithClaims(jwt.MapClaims{"sub": "gazebo-web"}), WithPrincipalMapper(mapper))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			called = true
+			p, ok := PrincipalFromContext(r.Context())
+			require.True(t, ok)
+			assert.Equal(t, "mapped", p.ID)
+		}),
+	)
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Authorization", "Bearer token")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	assert.True(t, called)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestHTTPMiddleware_PrincipalMapperError(t *testing.T) {
+	handler := HTTPMiddleware(authenticationWithClaims(jwt.MapClaims{"sub": 1234}))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			t.Fatal("handler should not be called")
+		}),
+	)
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Authorization", "Bearer token")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
@@ -0,0 +1,170 @@
+package authentication
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ErrReplayed is returned when a single-use credential, such as a signed request,
+// a DPoP proof or a one-time token, is used more than once.
+var ErrReplayed = errors.New("credential replayed")
+
+// ErrReplayedRequest is returned when a signed request is sent more than once.
+// It's the same error as ErrReplayed.
+var ErrReplayedRequest = ErrReplayed
+
+// ReplayCache keeps track of the identifiers of single-use credentials, such as
+// the jti claim of JWTs or the nonce of signed requests, in order to reject
+// replayed credentials.
+//
+// Implementations shared by multiple servers, such as the ones backed by Redis
+// or a SQL database, protect against replays sent to different servers.
+type ReplayCache interface {
+	// Use records the given identifier until expiresAt. It returns false if the
+	// identifier was already recorded and hasn't expired yet.
+	Use(ctx context.Context, id string, expiresAt time.Time) (bool, error)
+}
+
+// NonceStore is an alias of ReplayCache, named after the nonces of signed
+// requests. See WithNonceStore.
+type NonceStore = ReplayCache
+
+// ReplayCacheOption configures the in-memory ReplayCache.
+type ReplayCacheOption func(*memoryReplayCache)
+
+// WithReplayCacheShards sets the number of shards of the in-memory ReplayCache.
+// Every shard has its own lock, more shards reduce contention between concurrent
+// requests. Defaults to 32.
+func WithReplayCacheShards(n int) ReplayCacheOption {
+	return func(c *memoryReplayCache) {
+		if n > 0 {
+			c.shards = make([]replayCacheShard, n)
+		}
+	}
+}
+
+// memoryReplayCache is a ReplayCache implementation that keeps identifiers in
+// memory, split in shards by their hash.
+type memoryReplayCache struct {
+	shards []replayCacheShard
+	now    func() time.Time
+}
+
+// replayCacheShard contains a subset of the identifiers of a memoryReplayCache.
+type replayCacheShard struct {
+	mu      sync.Mutex
+	entries map[string]time.Time
+	// nextSweep is the time when expired entries are removed next.
+	nextSweep time.Time
+}
+
+// Use records the given identifier until expiresAt.
+func (c *memoryReplayCache) Use(ctx context.Context, id string, expiresAt time.Time) (bool, error) {
+	h := fnv.New32a()
+	h.Write([]byte(id))
+	shard := &c.shards[h.Sum32()%uint32(len(c.shards))]
+
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	now := c.now()
+	if now.After(shard.nextSweep) {
+		for k, exp := range shard.entries {
+			if !now.Before(exp) {
+				delete(shard.entries, k)
+			}
+		}
+		shard.nextSweep = now.Add(time.Minute)
+	}
+	if exp, ok := shard.entries[id]; ok && now.Before(exp) {
+		return false, nil
+	}
+	if shard.entries == nil {
+		shard.entries = make(map[string]time.Time)
+	}
+	shard.entries[id] = expiresAt
+	return true, nil
+}
+
+// len returns the number of identifiers recorded in the cache, including the
+// expired ones that haven't been removed yet.
+func (c *memoryReplayCache) len() int {
+	var n int
+	for i := range c.shards {
+		c.shards[i].mu.Lock()
+		n += len(c.shards[i].entries)
+		c.shards[i].mu.Unlock()
+	}
+	return n
+}
+
+// NewMemoryReplayCache initializes a new ReplayCache that keeps identifiers in
+// memory until they expire. Expired identifiers are removed periodically.
+func NewMemoryReplayCache(opts ...ReplayCacheOption) ReplayCache {
+	c := &memoryReplayCache{
+		shards: make([]replayCacheShard, 32),
+		now:    time.Now,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// NewMemoryNonceStore initializes a new NonceStore that keeps nonces in memory.
+// It's the same as NewMemoryReplayCache with the default options.
+func NewMemoryNonceStore() NonceStore {
+	return NewMemoryReplayCache()
+}
+
+// singleUseAuthentication is an Authentication decorator that only accepts every
+// token once.
+type singleUseAuthentication struct {
+	authentication Authentication
+	cache          ReplayCache
+}
+
+// VerifyJWT verifies the given token using the underlying Authentication and
+// records its jti claim until the token expires.
+func (auth *singleUseAuthentication) VerifyJWT(ctx context.Context, token string) (jwt.Claims, error) {
+	claims, err := auth.authentication.VerifyJWT(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	jti, err := getStringClaim(claims, "jti")
+	if err != nil || len(jti) == 0 {
+		return nil, fmt.Errorf("%w: missing jti claim", ErrTokenInvalid)
+	}
+	exp, err := claims.GetExpirationTime()
+	if err != nil || exp == nil {
+		return nil, fmt.Errorf("%w: missing exp claim", ErrTokenInvalid)
+	}
+	// Token identifiers are only unique within their issuer.
+	iss, _ := claims.GetIssuer()
+	ok, err := auth.cache.Use(ctx, iss+"\x00"+jti, exp.Time)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrProviderUnavailable, err)
+	}
+	if !ok {
+		return nil, ErrReplayed
+	}
+	return claims, nil
+}
+
+// NewSingleUse initializes a new Authentication implementation that wraps the
+// given Authentication and only accepts every JWT once, such as the tokens used
+// in one-time links. Tokens must contain the jti and exp claims, their
+// identifiers are recorded in the given ReplayCache until they expire.
+//
+//	auth := NewSingleUse(NewAuth0(publicKey), NewMemoryReplayCache())
+func NewSingleUse(authentication Authentication, cache ReplayCache) Authentication {
+	return &singleUseAuthentication{
+		authentication: authentication,
+		cache:          cache,
+	}
+}
@@ -0,0 +1,136 @@
+package authentication
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// failingReplayCache is a ReplayCache implementation that always fails.
+type failingReplayCache struct {
+	err error
+}
+
+func (c failingReplayCache) Use(ctx context.Context, id string, expiresAt time.Time) (bool, error) {
+	return false, c.err
+}
+
+func TestMemoryReplayCache_Use(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	cache := NewMemoryReplayCache().(*memoryReplayCache)
+	cache.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	ok, err := cache.Use(ctx, "a", now.Add(time.Minute))
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, err = cache.Use(ctx, "a", now.Add(time.Minute))
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	ok, err = cache.Use(ctx, "b", now.Add(time.Minute))
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	// Identifiers can be reused after they expire.
+	now = now.Add(2 * time.Minute)
+	ok, err = cache.Use(ctx, "a", now.Add(time.Minute))
+	require.NoError(t, err)
+	assert.True(t, ok)
+}
+
+func TestMemoryReplayCache_Sweep(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	cache := NewMemoryReplayCache(WithReplayCacheShards(1)).(*memoryReplayCache)
+	cache.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	for _, id := range []string{"a", "b", "c"} {
+		_, err := cache.Use(ctx, id, now.Add(time.Minute))
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 3, cache.len())
+
+	now = now.Add(5 * time.Minute)
+	_, err := cache.Use(ctx, "d", now.Add(time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, 1, cache.len())
+}
+
+func TestMemoryReplayCache_Concurrent(t *testing.T) {
+	cache := NewMemoryReplayCache(WithReplayCacheShards(4))
+	expiresAt := time.Now().Add(time.Minute)
+
+	var accepted atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				ok, err := cache.Use(context.Background(), fmt.Sprintf("id-%d", j), expiresAt)
+				assert.NoError(t, err)
+				if ok {
+					accepted.Add(1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(100), accepted.Load())
+}
+
+func TestSingleUse(t *testing.T) {
+	exp := float64(time.Now().Add(time.Hour).Unix())
+	claims := jwt.MapClaims{"sub": "gazebo-web", "iss": "https://gazebosim.org", "jti": "1", "exp": exp}
+	auth := NewSingleUse(authenticationWithClaims(claims), NewMemoryReplayCache())
+
+	_, err := auth.VerifyJWT(context.Background(), "token")
+	require.NoError(t, err)
+
+	_, err = auth.VerifyJWT(context.Background(), "token")
+	assert.ErrorIs(t, err, ErrReplayed)
+	assert.Equal(t, ReasonReplayed, ReasonOf(err))
+	assert.Equal(t, http.StatusUnauthorized, HTTPStatusCode(err))
+}
+
+func TestSingleUse_IssuerScope(t *testing.T) {
+	exp := float64(time.Now().Add(time.Hour).Unix())
+	cache := NewMemoryReplayCache()
+	a := NewSingleUse(authenticationWithClaims(jwt.MapClaims{"iss": "a", "jti": "1", "exp": exp}), cache)
+	b := NewSingleUse(authenticationWithClaims(jwt.MapClaims{"iss": "b", "jti": "1", "exp": exp}), cache)
+
+	_, err := a.VerifyJWT(context.Background(), "token")
+	require.NoError(t, err)
+	_, err = b.VerifyJWT(context.Background(), "token")
+	assert.NoError(t, err)
+}
+
+func TestSingleUse_Errors(t *testing.T) {
+	exp := float64(time.Now().Add(time.Hour).Unix())
+	ctx := context.Background()
+
+	_, err := NewSingleUse(authenticationWithClaims(jwt.MapClaims{"exp": exp}), NewMemoryReplayCache()).VerifyJWT(ctx, "token")
+	assert.ErrorIs(t, err, ErrTokenInvalid)
+
+	_, err = NewSingleUse(authenticationWithClaims(jwt.MapClaims{"jti": "1"}), NewMemoryReplayCache()).VerifyJWT(ctx, "token")
+	assert.ErrorIs(t, err, ErrTokenInvalid)
+
+	_, err = NewSingleUse(authenticationWithError(ErrTokenNotProvided), NewMemoryReplayCache()).VerifyJWT(ctx, "token")
+	assert.ErrorIs(t, err, ErrTokenNotProvided)
+
+	failing := failingReplayCache{err: errors.New("connection refused")}
+	_, err = NewSingleUse(authenticationWithClaims(jwt.MapClaims{"jti": "1", "exp": exp}), failing).VerifyJWT(ctx, "token")
+	assert.ErrorIs(t, err, ErrProviderUnavailable)
+	assert.True(t, IsRetryable(err))
+}
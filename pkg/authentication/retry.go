@@ -0,0 +1,129 @@
+package authentication
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// RetryPolicy defines how operations that fail due to transient provider
+// outages are retried. Only errors for which IsRetryable returns true are retried.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts, including the first one.
+	// Defaults to 3.
+	MaxAttempts int
+	// InitialBackoff is the time to wait before the first retry. Defaults to 100ms.
+	InitialBackoff time.Duration
+	// MaxBackoff is the maximum time to wait between attempts. Defaults to 2s.
+	MaxBackoff time.Duration
+	// Multiplier is the factor used to increase the backoff after every attempt.
+	// Defaults to 2.
+	Multiplier float64
+	// Jitter is the fraction, between 0 and 1, of every backoff that is randomized
+	// in order to avoid synchronized retries from multiple clients.
+	Jitter float64
+}
+
+// withDefaults returns a copy of the policy with the default values set.
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = 3
+	}
+	if p.InitialBackoff <= 0 {
+		p.InitialBackoff = 100 * time.Millisecond
+	}
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = 2 * time.Second
+	}
+	if p.Multiplier < 1 {
+		p.Multiplier = 2
+	}
+	return p
+}
+
+// backoff returns the time to wait before the given retry attempt, starting at 1.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d := float64(p.InitialBackoff)
+	for i := 1; i < attempt; i++ {
+		d *= p.Multiplier
+	}
+	if d > float64(p.MaxBackoff) {
+		d = float64(p.MaxBackoff)
+	}
+	if p.Jitter > 0 {
+		d -= d * p.Jitter * rand.Float64()
+	}
+	return time.Duration(d)
+}
+
+// do runs fn until it succeeds, it returns a non-retryable error, the maximum
+// number of attempts is reached or ctx is done.
+func (p RetryPolicy) do(ctx context.Context, fn func() error) error {
+	p = p.withDefaults()
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = fn()
+		if err == nil || !IsRetryable(err) || attempt >= p.MaxAttempts {
+			return err
+		}
+		timer := time.NewTimer(p.backoff(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// retryAuthentication is an Authentication decorator that retries verifications
+// that fail due to transient provider outages.
+type retryAuthentication struct {
+	authentication Authentication
+	policy         RetryPolicy
+}
+
+// VerifyJWT verifies the given token using the underlying Authentication,
+// retrying the verification if the provider is unavailable.
+func (auth *retryAuthentication) VerifyJWT(ctx context.Context, token string) (jwt.Claims, error) {
+	var claims jwt.Claims
+	err := auth.policy.do(ctx, func() error {
+		var err error
+		claims, err = auth.authentication.VerifyJWT(ctx, token)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// NewRetry initializes a new Authentication implementation that wraps the given
+// Authentication and retries verifications that fail with ErrProviderUnavailable,
+// such as when the Firebase public keys cannot be fetched.
+//
+//	auth := NewRetry(NewFirebaseWithTokenVerifier(fbAuth), RetryPolicy{
+//		MaxAttempts:    3,
+//		InitialBackoff: 200 * time.Millisecond,
+//	})
+func NewRetry(authentication Authentication, policy RetryPolicy) Authentication {
+	return &retryAuthentication{
+		authentication: authentication,
+		policy:         policy,
+	}
+}
+
+// NewAccessTokenRetry wraps the given AccessTokenAuthentication and retries
+// verifications that fail with ErrProviderUnavailable, such as when the GCP IAM
+// API cannot be reached.
+//
+//	verify := NewAccessTokenRetry(GCPIamServiceAccountAccessToken(project, name), RetryPolicy{})
+func NewAccessTokenRetry(authentication AccessTokenAuthentication, policy RetryPolicy) AccessTokenAuthentication {
+	return func(ctx context.Context, token string) error {
+		return policy.do(ctx, func() error {
+			return authentication(ctx, token)
+		})
+	}
+}
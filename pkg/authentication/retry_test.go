@@ -0,0 +1,92 @@
+package authentication
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+// flakyAuthentication is an Authentication implementation that fails with the
+// given error a number of times before succeeding.
+type flakyAuthentication struct {
+	failures int
+	err      error
+	calls    int
+}
+
+func (auth *flakyAuthentication) VerifyJWT(ctx context.Context, token string) (jwt.Claims, error) {
+	auth.calls++
+	if auth.calls <= auth.failures {
+		return nil, auth.err
+	}
+	return jwt.MapClaims{"sub": "gazebo-web"}, nil
+}
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	policy := RetryPolicy{
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     300 * time.Millisecond,
+	}.withDefaults()
+	assert.Equal(t, 100*time.Millisecond, policy.backoff(1))
+	assert.Equal(t, 200*time.Millisecond, policy.backoff(2))
+	assert.Equal(t, 300*time.Millisecond, policy.backoff(3))
+
+	policy.Jitter = 0.5
+	for i := 0; i < 10; i++ {
+		d := policy.backoff(1)
+		assert.GreaterOrEqual(t, d, 50*time.Millisecond)
+		assert.LessOrEqual(t, d, 100*time.Millisecond)
+	}
+}
+
+func TestNewRetry(t *testing.T) {
+	ctx := context.Background()
+	unavailable := NewVerificationError(ProviderFirebase, ReasonProviderUnavailable, errors.New("timeout"))
+	policy := RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}
+
+	flaky := &flakyAuthentication{failures: 2, err: unavailable}
+	claims, err := NewRetry(flaky, policy).VerifyJWT(ctx, "token")
+	assert.NoError(t, err)
+	assert.NotNil(t, claims)
+	assert.Equal(t, 3, flaky.calls)
+
+	flaky = &flakyAuthentication{failures: 3, err: unavailable}
+	_, err = NewRetry(flaky, policy).VerifyJWT(ctx, "token")
+	assert.ErrorIs(t, err, ErrProviderUnavailable)
+	assert.Equal(t, 3, flaky.calls)
+
+	invalid := NewVerificationError(ProviderFirebase, ReasonBadSignature, nil)
+	flaky = &flakyAuthentication{failures: 1, err: invalid}
+	_, err = NewRetry(flaky, policy).VerifyJWT(ctx, "token")
+	assert.ErrorIs(t, err, ErrTokenInvalid)
+	assert.Equal(t, 1, flaky.calls)
+}
+
+func TestNewRetry_ContextCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	unavailable := NewVerificationError(ProviderFirebase, ReasonProviderUnavailable, nil)
+
+	flaky := &flakyAuthentication{failures: 5, err: unavailable}
+	_, err := NewRetry(flaky, RetryPolicy{MaxAttempts: 5, InitialBackoff: time.Hour}).VerifyJWT(ctx, "token")
+	assert.ErrorIs(t, err, ErrProviderUnavailable)
+	assert.Equal(t, 1, flaky.calls)
+}
+
+func TestNewAccessTokenRetry(t *testing.T) {
+	var calls int
+	verify := NewAccessTokenRetry(func(ctx context.Context, token string) error {
+		calls++
+		if calls < 2 {
+			return NewVerificationError(ProviderGCPIam, ReasonProviderUnavailable, nil)
+		}
+		return nil
+	}, RetryPolicy{InitialBackoff: time.Millisecond})
+
+	assert.NoError(t, verify(context.Background(), "token"))
+	assert.Equal(t, 2, calls)
+}
@@ -0,0 +1,327 @@
+package authentication
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	// ErrSessionExpired is returned when the credential used by a Session expires.
+	ErrSessionExpired = errors.New("session credential expired")
+
+	// ErrSessionRevoked is returned when the credential used by a Session is revoked.
+	ErrSessionRevoked = errors.New("session credential revoked")
+
+	// ErrSessionClosed is returned when a Session is closed by the application.
+	ErrSessionClosed = errors.New("session closed")
+
+	// ErrSubjectMismatch is returned when a Session is refreshed with a credential
+	// that belongs to a different subject.
+	ErrSubjectMismatch = errors.New("token subject does not match the session subject")
+)
+
+// RefreshMessageType is the type of the in-band messages used to refresh the
+// credential of a Session. See ParseRefreshMessage.
+const RefreshMessageType = "auth.refresh"
+
+// RefreshMessage is the in-band message sent by clients of long-lived
+// connections to replace the credential used by a Session before it expires:
+//
+//	{"type": "auth.refresh", "token": "<token>"}
+type RefreshMessage struct {
+	Type  string `json:"type"`
+	Token string `json:"token"`
+}
+
+// ParseRefreshMessage returns the token contained in the given message if it's
+// a RefreshMessage. It returns false if the message is not a refresh message,
+// allowing applications to handle it as a regular message.
+func ParseRefreshMessage(data []byte) (string, bool) {
+	var msg RefreshMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return "", false
+	}
+	if msg.Type != RefreshMessageType || len(msg.Token) == 0 {
+		return "", false
+	}
+	return msg.Token, true
+}
+
+// SessionConfig contains the configuration of a Session.
+type SessionConfig struct {
+	// Extractor is used to read the token from the upgrade request.
+	// Defaults to BearerTokenExtractor.
+	Extractor TokenExtractor
+	// RevocationCheck is called periodically to check if the credential has
+	// been revoked. The session ends with ErrSessionRevoked when it returns an
+	// error, unless the error is retryable, see IsRetryable.
+	RevocationCheck func(ctx context.Context, claims jwt.Claims) error
+	// RevocationInterval is the interval between revocation checks. Defaults to 1 minute.
+	RevocationInterval time.Duration
+	// TTL is the lifetime of credentials without an exp claim, counted from the
+	// time they are verified. Defaults to 1 hour.
+	TTL time.Duration
+	// RequireCertificateBinding rejects tokens that are not bound to the client
+	// certificate of the connection, see WithRequiredCertificateBinding.
+	RequireCertificateBinding bool
+}
+
+// Session tracks the credential used to authenticate a long-lived connection,
+// such as a WebSocket or a server-sent events stream. It signals the application
+// when the credential expires or is revoked, so the connection can be closed.
+//
+// Clients can extend a Session before its credential expires by sending a new
+// token, see Refresh and ParseRefreshMessage.
+//
+// Like HTTPMiddleware, tokens bound to a DPoP key are rejected, and tokens bound
+// to a client certificate must be sent over a connection that uses it, both when
+// the Session is created and when it's refreshed.
+type Session struct {
+	auth   Authentication
+	config SessionConfig
+	// binding verifies the binding of tokens to the client certificate.
+	binding middlewareConfig
+	// cert is the verified client certificate of the connection, if any.
+	cert *x509.Certificate
+
+	mu        sync.Mutex
+	claims    jwt.Claims
+	subject   string
+	expiresAt time.Time
+	timer     *time.Timer
+	version   int
+	done      chan struct{}
+	err       error
+	cancel    context.CancelFunc
+}
+
+// NewSession authenticates the given upgrade request using the given
+// Authentication, and returns a Session that tracks the expiration of the
+// verified token.
+//
+//	session, err := NewSession(r, auth, SessionConfig{
+//		Extractor: WebSocketProtocolTokenExtractor("access_token."),
+//	})
+//	if err != nil {
+//		http.Error(w, err.Error(), HTTPStatusCode(err))
+//		return
+//	}
+//	defer session.Close()
+//	conn := upgrade(w, r)
+//	go func() {
+//		<-session.Done()
+//		conn.Close()
+//	}()
+//	for msg := range conn.Messages() {
+//		if token, ok := ParseRefreshMessage(msg); ok {
+//			if err := session.Refresh(ctx, token); err != nil {
+//				break
+//			}
+//			continue
+//		}
+//		handle(msg)
+//	}
+func NewSession(r *http.Request, auth Authentication, config SessionConfig) (*Session, error) {
+	if config.Extractor == nil {
+		config.Extractor = BearerTokenExtractor()
+	}
+	if config.RevocationInterval <= 0 {
+		config.RevocationInterval = time.Minute
+	}
+	if config.TTL <= 0 {
+		config.TTL = time.Hour
+	}
+	token, err := config.Extractor(r)
+	if err != nil {
+		return nil, err
+	}
+	claims, err := auth.VerifyJWT(r.Context(), token)
+	if err != nil {
+		return nil, err
+	}
+	subject, err := claims.GetSubject()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrTokenInvalid, err)
+	}
+	binding := middlewareConfig{requireCertificateBinding: config.RequireCertificateBinding}
+	cert := httpPeerCertificate(r)
+	if err := binding.verifyTokenBinding(sessionProvider(claims), claims, cert); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Session{
+		auth:    auth,
+		config:  config,
+		binding: binding,
+		cert:    cert,
+		subject: subject,
+		done:    make(chan struct{}),
+		cancel:  cancel,
+	}
+	s.mu.Lock()
+	s.setClaims(claims)
+	s.mu.Unlock()
+	if config.RevocationCheck != nil {
+		go s.checkRevocation(ctx)
+	}
+	return s, nil
+}
+
+// Claims returns the claims of the credential currently used by the session.
+func (s *Session) Claims() jwt.Claims {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.claims
+}
+
+// ExpiresAt returns the time when the current credential expires. Credentials
+// without an exp claim expire when the configured TTL elapses.
+func (s *Session) ExpiresAt() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.expiresAt
+}
+
+// Done returns a channel that is closed when the session ends. The application
+// should close the connection when this happens.
+func (s *Session) Done() <-chan struct{} {
+	return s.done
+}
+
+// Err returns the reason why the session ended: ErrSessionExpired,
+// ErrSessionRevoked or ErrSessionClosed. It returns nil while the session is active.
+func (s *Session) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// Refresh replaces the credential used by the session with the given token,
+// extending the session until the new token expires. The token must belong to
+// the same subject that opened the session, and is subject to the same binding
+// checks. The current credential is kept if the new token is rejected.
+func (s *Session) Refresh(ctx context.Context, token string) error {
+	claims, err := s.auth.VerifyJWT(ctx, token)
+	if err != nil {
+		return err
+	}
+	subject, err := claims.GetSubject()
+	if err != nil || subject != s.subject {
+		return ErrSubjectMismatch
+	}
+	if err := s.binding.verifyTokenBinding(sessionProvider(claims), claims, s.cert); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	s.setClaims(claims)
+	return nil
+}
+
+// Revoke ends the session with ErrSessionRevoked.
+func (s *Session) Revoke() {
+	s.end(ErrSessionRevoked)
+}
+
+// Close ends the session with ErrSessionClosed and releases its resources.
+// It must be called when the connection is closed.
+func (s *Session) Close() {
+	s.end(ErrSessionClosed)
+}
+
+// setClaims sets the claims of the current credential and schedules the end of
+// the session when it expires, or when the TTL elapses if it doesn't have an
+// exp claim. The caller must hold s.mu.
+func (s *Session) setClaims(claims jwt.Claims) {
+	s.claims = claims
+	s.version++
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+	s.expiresAt = time.Now().Add(s.config.TTL)
+	if exp, err := claims.GetExpirationTime(); err == nil && exp != nil {
+		s.expiresAt = exp.Time
+	}
+	version := s.version
+	s.timer = time.AfterFunc(time.Until(s.expiresAt), func() {
+		s.expire(version)
+	})
+}
+
+// sessionProvider returns the name of the provider that produced the given
+// claims, used in binding errors.
+func sessionProvider(claims jwt.Claims) string {
+	principal, err := DefaultPrincipalMapper()(claims)
+	if err != nil {
+		return ""
+	}
+	return principal.Provider
+}
+
+// expire ends the session with ErrSessionExpired, unless the credential has been
+// refreshed since the timer identified by the given version was scheduled.
+func (s *Session) expire(version int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.version != version {
+		return
+	}
+	s.endLocked(ErrSessionExpired)
+}
+
+// end ends the session with the given error. Only the first call has effect.
+func (s *Session) end(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.endLocked(err)
+}
+
+// endLocked ends the session with the given error. Only the first call has
+// effect. The caller must hold s.mu.
+func (s *Session) endLocked(err error) {
+	if s.err != nil {
+		return
+	}
+	s.err = err
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+	s.cancel()
+	close(s.done)
+}
+
+// checkRevocation periodically calls the configured RevocationCheck until the
+// session ends.
+func (s *Session) checkRevocation(ctx context.Context) {
+	ticker := time.NewTicker(s.config.RevocationInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := s.config.RevocationCheck(ctx, s.Claims())
+			if err == nil || ctx.Err() != nil {
+				continue
+			}
+			// Transient failures are checked again on the next tick.
+			if IsRetryable(err) {
+				continue
+			}
+			s.end(ErrSessionRevoked)
+			return
+		}
+	}
+}
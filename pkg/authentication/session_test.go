@@ -0,0 +1,229 @@
+package authentication
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// tokenAuthentication is an Authentication implementation that returns the
+// claims registered for every token.
+type tokenAuthentication map[string]jwt.Claims
+
+func (auth tokenAuthentication) VerifyJWT(ctx context.Context, token string) (jwt.Claims, error) {
+	claims, ok := auth[token]
+	if !ok {
+		return nil, ErrTokenInvalid
+	}
+	return claims, nil
+}
+
+func newSessionRequest(token string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/ws", nil)
+	if len(token) > 0 {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	return r
+}
+
+func expiringClaims(sub string, d time.Duration) jwt.Claims {
+	return jwt.MapClaims{
+		"sub": sub,
+		"exp": float64(time.Now().Add(d).UnixNano()) / float64(time.Second),
+	}
+}
+
+func TestNewSession_Errors(t *testing.T) {
+	auth := tokenAuthentication{}
+	_, err := NewSession(newSessionRequest(""), auth, SessionConfig{})
+	assert.ErrorIs(t, err, ErrTokenNotProvided)
+
+	_, err = NewSession(newSessionRequest("invalid"), auth, SessionConfig{})
+	assert.ErrorIs(t, err, ErrTokenInvalid)
+}
+
+func TestSession_Expires(t *testing.T) {
+	auth := tokenAuthentication{"a": expiringClaims("gazebo-web", 50*time.Millisecond)}
+	session, err := NewSession(newSessionRequest("a"), auth, SessionConfig{})
+	require.NoError(t, err)
+	defer session.Close()
+
+	assert.NoError(t, session.Err())
+	assert.False(t, session.ExpiresAt().IsZero())
+
+	select {
+	case <-session.Done():
+	case <-time.After(time.Second):
+		t.Fatal("session should have expired")
+	}
+	assert.ErrorIs(t, session.Err(), ErrSessionExpired)
+}
+
+func TestSession_Refresh(t *testing.T) {
+	auth := tokenAuthentication{
+		"a":     expiringClaims("gazebo-web", 50*time.Millisecond),
+		"b":     expiringClaims("gazebo-web", time.Hour),
+		"other": expiringClaims("someone-else", time.Hour),
+	}
+	session, err := NewSession(newSessionRequest("a"), auth, SessionConfig{})
+	require.NoError(t, err)
+	defer session.Close()
+
+	ctx := context.Background()
+	assert.ErrorIs(t, session.Refresh(ctx, "other"), ErrSubjectMismatch)
+	assert.ErrorIs(t, session.Refresh(ctx, "invalid"), ErrTokenInvalid)
+
+	msg, ok := ParseRefreshMessage([]byte(`{"type":"auth.refresh","token":"b"}`))
+	require.True(t, ok)
+	require.NoError(t, session.Refresh(ctx, msg))
+	assert.Equal(t, auth["b"], session.Claims())
+
+	select {
+	case <-session.Done():
+		t.Fatal("session should have been extended")
+	case <-time.After(100 * time.Millisecond):
+	}
+	assert.NoError(t, session.Err())
+}
+
+func TestSession_Revoke(t *testing.T) {
+	auth := tokenAuthentication{"a": jwt.MapClaims{"sub": "gazebo-web"}}
+	session, err := NewSession(newSessionRequest("a"), auth, SessionConfig{})
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), session.ExpiresAt(), time.Minute)
+
+	session.Revoke()
+	<-session.Done()
+	assert.ErrorIs(t, session.Err(), ErrSessionRevoked)
+
+	session.Close()
+	assert.ErrorIs(t, session.Err(), ErrSessionRevoked)
+	assert.ErrorIs(t, session.Refresh(context.Background(), "a"), ErrSessionRevoked)
+}
+
+func TestSession_TTL(t *testing.T) {
+	auth := tokenAuthentication{"a": jwt.MapClaims{"sub": "gazebo-web"}}
+	session, err := NewSession(newSessionRequest("a"), auth, SessionConfig{TTL: 50 * time.Millisecond})
+	require.NoError(t, err)
+	defer session.Close()
+
+	select {
+	case <-session.Done():
+	case <-time.After(time.Second):
+		t.Fatal("session should have expired")
+	}
+	assert.ErrorIs(t, session.Err(), ErrSessionExpired)
+}
+
+func TestSession_CertificateBinding(t *testing.T) {
+	ca := newTestCA(t)
+	cert := ca.issue(t, withSPIFFEID("spiffe://cluster.local/sa/worker")).Leaf
+	other := ca.issue(t, withSPIFFEID("spiffe://cluster.local/sa/other")).Leaf
+	auth := tokenAuthentication{
+		"bound":   jwt.MapClaims{"sub": "worker", "cnf": map[string]any{"x5t#S256": CertificateThumbprint(cert)}},
+		"other":   jwt.MapClaims{"sub": "worker", "cnf": map[string]any{"x5t#S256": CertificateThumbprint(other)}},
+		"dpop":    jwt.MapClaims{"sub": "worker", "cnf": map[string]any{"jkt": "abc"}},
+		"unbound": jwt.MapClaims{"sub": "worker"},
+	}
+	newRequest := func(token string) *http.Request {
+		r := newTLSRequest(cert)
+		r.Header.Set("Authorization", "Bearer "+token)
+		return r
+	}
+
+	_, err := NewSession(newRequest("other"), auth, SessionConfig{})
+	assert.Equal(t, ReasonBindingMismatch, ReasonOf(err))
+
+	session, err := NewSession(newRequest("bound"), auth, SessionConfig{RequireCertificateBinding: true})
+	require.NoError(t, err)
+	defer session.Close()
+
+	// Refreshed tokens must be bound to the certificate of the connection too.
+	ctx := context.Background()
+	assert.Equal(t, ReasonBindingMismatch, ReasonOf(session.Refresh(ctx, "other")))
+	assert.Equal(t, ReasonBindingMismatch, ReasonOf(session.Refresh(ctx, "dpop")))
+	assert.Equal(t, ReasonBindingMismatch, ReasonOf(session.Refresh(ctx, "unbound")))
+	assert.Equal(t, auth["bound"], session.Claims())
+	assert.NoError(t, session.Refresh(ctx, "bound"))
+}
+
+func TestSession_RevocationCheck(t *testing.T) {
+	auth := tokenAuthentication{"a": jwt.MapClaims{"sub": "gazebo-web"}}
+	session, err := NewSession(newSessionRequest("a"), auth, SessionConfig{
+		RevocationInterval: 10 * time.Millisecond,
+		RevocationCheck: func(ctx context.Context, claims jwt.Claims) error {
+			return errors.New("revoked")
+		},
+	})
+	require.NoError(t, err)
+	defer session.Close()
+
+	select {
+	case <-session.Done():
+	case <-time.After(time.Second):
+		t.Fatal("session should have been revoked")
+	}
+	assert.ErrorIs(t, session.Err(), ErrSessionRevoked)
+}
+
+func TestSession_RevocationCheckUnavailable(t *testing.T) {
+	auth := tokenAuthentication{"a": jwt.MapClaims{"sub": "gazebo-web"}}
+	var calls atomic.Int32
+	session, err := NewSession(newSessionRequest("a"), auth, SessionConfig{
+		RevocationInterval: 10 * time.Millisecond,
+		RevocationCheck: func(ctx context.Context, claims jwt.Claims) error {
+			if calls.Add(1) < 3 {
+				return NewVerificationError(ProviderAuth0, ReasonProviderUnavailable, ErrProviderUnavailable)
+			}
+			return errors.New("revoked")
+		},
+	})
+	require.NoError(t, err)
+	defer session.Close()
+
+	select {
+	case <-session.Done():
+	case <-time.After(time.Second):
+		t.Fatal("session should have been revoked")
+	}
+	assert.ErrorIs(t, session.Err(), ErrSessionRevoked)
+	assert.Equal(t, int32(3), calls.Load())
+}
+
+func TestSession_ExpireAfterRefresh(t *testing.T) {
+	auth := tokenAuthentication{
+		"a": jwt.MapClaims{"sub": "gazebo-web", "exp": float64(time.Now().Add(time.Hour).Unix())},
+		"b": jwt.MapClaims{"sub": "gazebo-web", "exp": float64(time.Now().Add(2 * time.Hour).Unix())},
+	}
+	session, err := NewSession(newSessionRequest("a"), auth, SessionConfig{})
+	require.NoError(t, err)
+	defer session.Close()
+
+	session.mu.Lock()
+	version := session.version
+	session.mu.Unlock()
+	require.NoError(t, session.Refresh(context.Background(), "b"))
+
+	// A timer scheduled for the previous credential doesn't end the session.
+	session.expire(version)
+	assert.NoError(t, session.Err())
+}
+
+func TestParseRefreshMessage(t *testing.T) {
+	_, ok := ParseRefreshMessage([]byte(`{"type":"chat","token":"a"}`))
+	assert.False(t, ok)
+
+	_, ok = ParseRefreshMessage([]byte(`not json`))
+	assert.False(t, ok)
+
+	_, ok = ParseRefreshMessage([]byte(`{"type":"auth.refresh"}`))
+	assert.False(t, ok)
+}
@@ -0,0 +1,130 @@
+package authorization
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/gazebo-web/auth/pkg/authentication"
+)
+
+// ErrPermissionDenied is returned when a principal is not allowed to perform an
+// action.
+var ErrPermissionDenied = errors.New("permission denied")
+
+// ErrPrincipalNotProvided is returned when an authorization check is performed
+// without an authenticated principal.
+var ErrPrincipalNotProvided = errors.New("principal not provided")
+
+// ErrInvalidResource is returned when an authorization check is performed on a
+// resource that is not fully identified.
+var ErrInvalidResource = errors.New("invalid resource")
+
+// Resource identifies the resource an action is performed on.
+type Resource struct {
+	// Type is the type of the resource, such as "world" or "organization".
+	Type string
+	// ID is the unique identifier of the resource.
+	ID string
+	// Attributes contains additional information about the resource, such as its
+	// owner, used by attribute-based policies.
+	Attributes map[string]any
+}
+
+// String returns the resource in the "type:id" format.
+func (r Resource) String() string {
+	if len(r.ID) == 0 {
+		return r.Type
+	}
+	return r.Type + ":" + r.ID
+}
+
+// Authorization contains a set of methods to check whether authenticated
+// principals are allowed to perform actions on resources.
+type Authorization interface {
+	// Check returns nil if the given principal has the given permission on the
+	// given resource. It returns a *DeniedError if it doesn't.
+	Check(ctx context.Context, principal *authentication.Principal, permission string, resource Resource) error
+	// BulkCheck checks whether the given principal has the given permission on
+	// each of the given resources. The returned list contains one decision for
+	// every resource, in the same order. An error is returned if any of the
+	// checks failed for a reason other than the permission being denied.
+	BulkCheck(ctx context.Context, principal *authentication.Principal, permission string, resources []Resource) ([]bool, error)
+}
+
+// DeniedError contains the details of a denied authorization check. It can be
+// matched with errors.Is using ErrPermissionDenied.
+type DeniedError struct {
+	// Principal is the identifier of the principal that was denied.
+	Principal string
+	// Permission is the permission that was missing.
+	Permission string
+	// Resource is the resource the permission was checked on.
+	Resource Resource
+	// Reason describes why the permission was denied.
+	Reason string
+}
+
+// Error returns the error message.
+func (e *DeniedError) Error() string {
+	msg := fmt.Sprintf("%s: missing permission %q", ErrPermissionDenied, e.Permission)
+	if r := e.Resource.String(); len(r) > 0 {
+		msg += fmt.Sprintf(" on %q", r)
+	}
+	if len(e.Reason) > 0 {
+		msg += ": " + e.Reason
+	}
+	return msg
+}
+
+// Unwrap returns ErrPermissionDenied.
+func (e *DeniedError) Unwrap() error {
+	return ErrPermissionDenied
+}
+
+// newDeniedError initializes a new DeniedError for the given principal.
+func newDeniedError(principal *authentication.Principal, permission string, resource Resource, reason string) error {
+	return &DeniedError{
+		Principal:  principal.ID,
+		Permission: permission,
+		Resource:   resource,
+		Reason:     reason,
+	}
+}
+
+// bulkCheck implements BulkCheck by calling the given check function for each
+// resource.
+func bulkCheck(ctx context.Context, principal *authentication.Principal, permission string, resources []Resource,
+	check func(context.Context, *authentication.Principal, string, Resource) error) ([]bool, error) {
+	if principal == nil {
+		return nil, ErrPrincipalNotProvided
+	}
+	results := make([]bool, len(resources))
+	for i, resource := range resources {
+		err := check(ctx, principal, permission, resource)
+		if err != nil && !errors.Is(err, ErrPermissionDenied) {
+			return nil, err
+		}
+		results[i] = err == nil
+	}
+	return results, nil
+}
+
+// consistencyTokenContextKey is the key used to store the consistency token in a
+// context.Context.
+type consistencyTokenContextKey struct{}
+
+// WithConsistencyToken returns a copy of ctx that carries the given consistency
+// token. Cached authorization decisions are only reused for requests carrying the
+// same token, clients can pass a new token after changing permissions to avoid
+// reading stale decisions.
+func WithConsistencyToken(ctx context.Context, token string) context.Context {
+	return context.WithValue(ctx, consistencyTokenContextKey{}, token)
+}
+
+// ConsistencyTokenFromContext returns the consistency token stored in ctx by
+// WithConsistencyToken.
+func ConsistencyTokenFromContext(ctx context.Context) (string, bool) {
+	token, ok := ctx.Value(consistencyTokenContextKey{}).(string)
+	return token, ok
+}
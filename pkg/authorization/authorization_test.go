@@ -0,0 +1,29 @@
+package authorization
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeniedError(t *testing.T) {
+	err := &DeniedError{
+		Principal:  "gazebo-web",
+		Permission: "worlds.write",
+		Resource:   Resource{Type: "world", ID: "1234"},
+		Reason:     "no role grants the permission",
+	}
+	assert.ErrorIs(t, err, ErrPermissionDenied)
+	assert.Equal(t, `permission denied: missing permission "worlds.write" on "world:1234": no role grants the permission`, err.Error())
+
+	var denied *DeniedError
+	assert.True(t, errors.As(error(err), &denied))
+	assert.Equal(t, "worlds.write", denied.Permission)
+}
+
+func TestResource_String(t *testing.T) {
+	assert.Equal(t, "", Resource{}.String())
+	assert.Equal(t, "world", Resource{Type: "world"}.String())
+	assert.Equal(t, "world:1234", Resource{Type: "world", ID: "1234"}.String())
+}
@@ -0,0 +1,245 @@
+package authorization
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gazebo-web/auth/pkg/authentication"
+)
+
+// CachedAuthorization is an Authorization decorator that caches decisions.
+type CachedAuthorization interface {
+	Authorization
+	// Invalidate removes every cached decision. It should be called when
+	// permissions change, see ReBAC.OnWrite.
+	Invalidate()
+}
+
+// CacheOption configures a CachedAuthorization.
+type CacheOption func(*cachedAuthorization)
+
+// WithMaxEntries sets the maximum number of cached decisions. Defaults to 10000.
+func WithMaxEntries(n int) CacheOption {
+	return func(c *cachedAuthorization) {
+		c.maxEntries = n
+	}
+}
+
+// WithCacheInstrumenter sets the authentication.Instrumenter used to record cache
+// hits and misses. Lookups are recorded using the "authorization" cache name.
+func WithCacheInstrumenter(instrumenter authentication.Instrumenter) CacheOption {
+	return func(c *cachedAuthorization) {
+		c.instrumenter = instrumenter
+	}
+}
+
+// cacheKey identifies a cached decision.
+type cacheKey struct {
+	issuer  string
+	subject string
+	// fingerprint identifies the roles, scopes and tenant of the principal,
+	// which authorizers such as RBAC decide on. Claims that change every time a
+	// token is refreshed, such as iat and exp, are not part of the key.
+	fingerprint [sha256.Size]byte
+	permission  string
+	resource    string
+	token       string
+}
+
+// cacheEntry is a cached decision.
+type cacheEntry struct {
+	err       error
+	expiresAt time.Time
+}
+
+// cachedAuthorization is a CachedAuthorization implementation.
+type cachedAuthorization struct {
+	authorization Authorization
+	ttl           time.Duration
+	maxEntries    int
+	instrumenter  authentication.Instrumenter
+	now           func() time.Time
+	// mu protects entries and generation.
+	mu      sync.Mutex
+	entries map[cacheKey]cacheEntry
+	// generation is incremented every time the cache is invalidated, decisions
+	// checked before an invalidation are not cached.
+	generation uint64
+}
+
+// Check returns the cached decision for the given principal, permission, resource
+// and consistency token, or checks it using the underlying Authorization.
+// Decisions are only cached when the permission is granted or denied, other
+// errors are not cached.
+func (c *cachedAuthorization) Check(ctx context.Context, principal *authentication.Principal, permission string, resource Resource) error {
+	if principal == nil {
+		return ErrPrincipalNotProvided
+	}
+	key := newCacheKey(ctx, principal, permission, resource)
+	entry, generation, ok := c.lookup(ctx, key)
+	if ok {
+		return entry.err
+	}
+	err := c.authorization.Check(ctx, principal, permission, resource)
+	if err == nil || errors.Is(err, ErrPermissionDenied) {
+		c.store(key, err, generation)
+	}
+	return err
+}
+
+// BulkCheck returns the cached decisions for the given resources, and checks the
+// remaining ones in a single call to the underlying Authorization. Only granted
+// permissions are cached, since bulk checks don't return the reason of denials.
+func (c *cachedAuthorization) BulkCheck(ctx context.Context, principal *authentication.Principal, permission string, resources []Resource) ([]bool, error) {
+	if principal == nil {
+		return nil, ErrPrincipalNotProvided
+	}
+	results := make([]bool, len(resources))
+	keys := make([]cacheKey, len(resources))
+	var missing []int
+	var generation uint64
+	for i, resource := range resources {
+		keys[i] = newCacheKey(ctx, principal, permission, resource)
+		var entry cacheEntry
+		var ok bool
+		entry, generation, ok = c.lookup(ctx, keys[i])
+		if !ok {
+			missing = append(missing, i)
+			continue
+		}
+		results[i] = entry.err == nil
+	}
+	if len(missing) == 0 {
+		return results, nil
+	}
+
+	pending := make([]Resource, len(missing))
+	for i, index := range missing {
+		pending[i] = resources[index]
+	}
+	decisions, err := c.authorization.BulkCheck(ctx, principal, permission, pending)
+	if err != nil {
+		return nil, err
+	}
+	for i, index := range missing {
+		results[index] = decisions[i]
+		if decisions[i] {
+			c.store(keys[index], nil, generation)
+		}
+	}
+	return results, nil
+}
+
+// Invalidate removes every cached decision. Decisions of checks in progress are
+// not cached.
+func (c *cachedAuthorization) Invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = make(map[cacheKey]cacheEntry)
+	c.generation++
+}
+
+// lookup returns the cached decision identified by the given key, and the
+// current generation of the cache, which must be passed to store.
+func (c *cachedAuthorization) lookup(ctx context.Context, key cacheKey) (cacheEntry, uint64, bool) {
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	if ok && !c.now().Before(entry.expiresAt) {
+		delete(c.entries, key)
+		ok = false
+	}
+	generation := c.generation
+	c.mu.Unlock()
+	c.instrumenter.RecordCacheLookup(ctx, "authorization", ok)
+	return entry, generation, ok
+}
+
+// store caches the given decision, unless the cache was invalidated after the
+// given generation. If the cache is full, expired decisions are removed, and
+// every decision is removed if it's still full.
+func (c *cachedAuthorization) store(key cacheKey, err error, generation uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if generation != c.generation {
+		return
+	}
+	now := c.now()
+	if len(c.entries) >= c.maxEntries {
+		for k, entry := range c.entries {
+			if !now.Before(entry.expiresAt) {
+				delete(c.entries, k)
+			}
+		}
+		if len(c.entries) >= c.maxEntries {
+			c.entries = make(map[cacheKey]cacheEntry)
+		}
+	}
+	c.entries[key] = cacheEntry{err: err, expiresAt: now.Add(c.ttl)}
+}
+
+// newCacheKey returns the key used to cache the decision for the given request.
+func newCacheKey(ctx context.Context, principal *authentication.Principal, permission string, resource Resource) cacheKey {
+	token, _ := ConsistencyTokenFromContext(ctx)
+	r := resource.String()
+	if len(resource.Attributes) > 0 {
+		// fmt prints maps sorted by key, so equal attributes produce equal keys.
+		r += fmt.Sprintf("%v", resource.Attributes)
+	}
+	return cacheKey{
+		issuer:      principal.Issuer,
+		subject:     principal.ID,
+		fingerprint: principalFingerprint(principal),
+		permission:  permission,
+		resource:    r,
+		token:       token,
+	}
+}
+
+// principalFingerprint returns a digest of the roles, scopes and tenant of the
+// given principal. Roles and scopes are sorted, so refreshed tokens of the same
+// credential produce the same fingerprint.
+func principalFingerprint(principal *authentication.Principal) [sha256.Size]byte {
+	roles := append([]string(nil), principal.Roles...)
+	sort.Strings(roles)
+	scopes := append([]string(nil), principal.Scopes...)
+	sort.Strings(scopes)
+	data, _ := json.Marshal(struct {
+		Roles  []string
+		Scopes []string
+		Tenant string
+	}{roles, scopes, principal.Tenant})
+	return sha256.Sum256(data)
+}
+
+// NewCache initializes a new CachedAuthorization that caches the decisions of the
+// given Authorization for the given TTL. Decisions are keyed by principal ID,
+// issuer, roles, scopes and tenant, permission, resource and the consistency
+// token stored in the context, see WithConsistencyToken. Other claims are not
+// part of the key, don't cache authorizers that decide on them.
+//
+// Cached decisions may be stale for up to the TTL after permissions change, use
+// short TTLs and call Invalidate when permissions are changed locally:
+//
+//	engine := NewReBAC(schema, store)
+//	authz := NewCache(engine, 5*time.Second)
+//	engine.OnWrite(func(ctx context.Context, tuples []Tuple) { authz.Invalidate() })
+func NewCache(authorization Authorization, ttl time.Duration, opts ...CacheOption) CachedAuthorization {
+	c := &cachedAuthorization{
+		authorization: authorization,
+		ttl:           ttl,
+		maxEntries:    10000,
+		instrumenter:  authentication.NopInstrumenter(),
+		now:           time.Now,
+		entries:       make(map[cacheKey]cacheEntry),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
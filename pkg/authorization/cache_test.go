@@ -0,0 +1,233 @@
+package authorization
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gazebo-web/auth/pkg/authentication"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// lookupRecorder is an authentication.Instrumenter that records cache lookups.
+type lookupRecorder struct {
+	authentication.Instrumenter
+	lookups map[string][]bool
+}
+
+func (r *lookupRecorder) RecordCacheLookup(ctx context.Context, cache string, hit bool) {
+	if r.lookups == nil {
+		r.lookups = make(map[string][]bool)
+	}
+	r.lookups[cache] = append(r.lookups[cache], hit)
+}
+
+func TestCache_Check(t *testing.T) {
+	ctx := context.Background()
+	fake := &fakeAuthorization{}
+	recorder := &lookupRecorder{Instrumenter: authentication.NopInstrumenter()}
+	authz := NewCache(fake, time.Minute, WithCacheInstrumenter(recorder))
+	principal := &authentication.Principal{ID: "a"}
+	world := Resource{Type: "world", ID: "1"}
+
+	assert.NoError(t, authz.Check(ctx, principal, "worlds.read", world))
+	assert.NoError(t, authz.Check(ctx, principal, "worlds.read", world))
+	assert.Equal(t, 1, fake.calls)
+	assert.Equal(t, []bool{false, true}, recorder.lookups["authorization"])
+
+	// Different permissions, resources, principals and consistency tokens are
+	// cached separately.
+	assert.NoError(t, authz.Check(ctx, principal, "worlds.write", world))
+	assert.NoError(t, authz.Check(ctx, principal, "worlds.read", Resource{Type: "world", ID: "2"}))
+	assert.NoError(t, authz.Check(ctx, &authentication.Principal{ID: "b"}, "worlds.read", world))
+	assert.NoError(t, authz.Check(WithConsistencyToken(ctx, "1"), principal, "worlds.read", world))
+	assert.NoError(t, authz.Check(ctx, principal, "worlds.read", Resource{Type: "world", ID: "1", Attributes: map[string]any{"owner": "a"}}))
+	assert.Equal(t, 6, fake.calls)
+
+	authz.Invalidate()
+	assert.NoError(t, authz.Check(ctx, principal, "worlds.read", world))
+	assert.Equal(t, 7, fake.calls)
+
+	assert.ErrorIs(t, authz.Check(ctx, nil, "worlds.read", world), ErrPrincipalNotProvided)
+}
+
+func TestCache_Check_Denied(t *testing.T) {
+	ctx := context.Background()
+	fake := &fakeAuthorization{err: &DeniedError{Permission: "worlds.read"}}
+	authz := NewCache(fake, time.Minute)
+	principal := &authentication.Principal{ID: "a"}
+
+	assert.ErrorIs(t, authz.Check(ctx, principal, "worlds.read", Resource{}), ErrPermissionDenied)
+	assert.ErrorIs(t, authz.Check(ctx, principal, "worlds.read", Resource{}), ErrPermissionDenied)
+	assert.Equal(t, 1, fake.calls)
+
+	fake.err = errors.New("unavailable")
+	assert.Error(t, authz.Check(ctx, principal, "worlds.write", Resource{}))
+	assert.Error(t, authz.Check(ctx, principal, "worlds.write", Resource{}))
+	assert.Equal(t, 3, fake.calls)
+}
+
+func TestCache_PrincipalFingerprint(t *testing.T) {
+	ctx := context.Background()
+	authz := NewCache(newTestRBAC(t), time.Minute)
+	viewer := &authentication.Principal{ID: "a", Issuer: "https://issuer", Roles: []string{"viewer"}}
+	narrower := &authentication.Principal{ID: "a", Issuer: "https://issuer"}
+
+	assert.NoError(t, authz.Check(ctx, viewer, "worlds.read", Resource{}))
+	// A token of the same subject without the role must not reuse the decision.
+	assert.ErrorIs(t, authz.Check(ctx, narrower, "worlds.read", Resource{}), ErrPermissionDenied)
+
+	otherTenant := &authentication.Principal{ID: "a", Issuer: "https://issuer", Roles: []string{"viewer"}, Tenant: "b"}
+	assert.NotEqual(t, newCacheKey(ctx, viewer, "worlds.read", Resource{}), newCacheKey(ctx, otherTenant, "worlds.read", Resource{}))
+
+	reordered := &authentication.Principal{ID: "a", Roles: []string{"b", "a"}, Scopes: []string{"y", "x"}}
+	sorted := &authentication.Principal{ID: "a", Roles: []string{"a", "b"}, Scopes: []string{"x", "y"}}
+	assert.Equal(t, newCacheKey(ctx, reordered, "worlds.read", Resource{}), newCacheKey(ctx, sorted, "worlds.read", Resource{}))
+
+	// Refreshed tokens of the same credential reuse the decision.
+	first := &authentication.Principal{ID: "a", Scopes: []string{"x"}, Claims: map[string]any{"iat": 1, "exp": 2}}
+	refreshed := &authentication.Principal{ID: "a", Scopes: []string{"x"}, Claims: map[string]any{"iat": 3, "exp": 4}}
+	assert.Equal(t, newCacheKey(ctx, first, "worlds.read", Resource{}), newCacheKey(ctx, refreshed, "worlds.read", Resource{}))
+}
+
+// invalidatingAuthorization is an Authorization that invalidates the cache
+// while checking permissions, like a concurrent ReBAC write.
+type invalidatingAuthorization struct {
+	fakeAuthorization
+	cache CachedAuthorization
+}
+
+func (a *invalidatingAuthorization) Check(ctx context.Context, principal *authentication.Principal, permission string, resource Resource) error {
+	err := a.fakeAuthorization.Check(ctx, principal, permission, resource)
+	a.cache.Invalidate()
+	return err
+}
+
+func (a *invalidatingAuthorization) BulkCheck(ctx context.Context, principal *authentication.Principal, permission string, resources []Resource) ([]bool, error) {
+	results, err := a.fakeAuthorization.BulkCheck(ctx, principal, permission, resources)
+	a.cache.Invalidate()
+	return results, err
+}
+
+func TestCache_InvalidateDuringCheck(t *testing.T) {
+	ctx := context.Background()
+	backend := &invalidatingAuthorization{}
+	authz := NewCache(backend, time.Minute)
+	backend.cache = authz
+	principal := &authentication.Principal{ID: "a"}
+	world := Resource{Type: "world", ID: "1"}
+
+	// Decisions checked before an invalidation are not cached.
+	assert.NoError(t, authz.Check(ctx, principal, "worlds.read", world))
+	assert.NoError(t, authz.Check(ctx, principal, "worlds.read", world))
+	assert.Equal(t, 2, backend.calls)
+
+	_, err := authz.BulkCheck(ctx, principal, "worlds.read", []Resource{world})
+	require.NoError(t, err)
+	_, err = authz.BulkCheck(ctx, principal, "worlds.read", []Resource{world})
+	require.NoError(t, err)
+	assert.Equal(t, 4, backend.calls)
+}
+
+func TestCache_Expiration(t *testing.T) {
+	ctx := context.Background()
+	fake := &fakeAuthorization{}
+	authz := NewCache(fake, time.Second).(*cachedAuthorization)
+	now := time.Now()
+	authz.now = func() time.Time { return now }
+	principal := &authentication.Principal{ID: "a"}
+
+	assert.NoError(t, authz.Check(ctx, principal, "worlds.read", Resource{}))
+	now = now.Add(999 * time.Millisecond)
+	assert.NoError(t, authz.Check(ctx, principal, "worlds.read", Resource{}))
+	assert.Equal(t, 1, fake.calls)
+
+	now = now.Add(time.Millisecond)
+	assert.NoError(t, authz.Check(ctx, principal, "worlds.read", Resource{}))
+	assert.Equal(t, 2, fake.calls)
+}
+
+func TestCache_MaxEntries(t *testing.T) {
+	ctx := context.Background()
+	authz := NewCache(&fakeAuthorization{}, time.Minute, WithMaxEntries(2)).(*cachedAuthorization)
+	principal := &authentication.Principal{ID: "a"}
+	for _, id := range []string{"1", "2", "3"} {
+		require.NoError(t, authz.Check(ctx, principal, "worlds.read", Resource{Type: "world", ID: id}))
+	}
+	assert.Len(t, authz.entries, 1)
+}
+
+func TestCache_BulkCheck(t *testing.T) {
+	ctx := context.Background()
+	authz, err := NewRBAC(RBACPolicy{Roles: []Role{{Name: "viewer", Permissions: []string{"worlds.read"}}}})
+	require.NoError(t, err)
+	fake := &fakeAuthorization{}
+	cache := NewCache(fake, time.Minute)
+	principal := &authentication.Principal{ID: "a", Roles: []string{"viewer"}}
+	worlds := []Resource{{Type: "world", ID: "1"}, {Type: "world", ID: "2"}, {Type: "world", ID: "3"}}
+
+	require.NoError(t, cache.Check(ctx, principal, "worlds.read", worlds[1]))
+	fake.resources = nil
+
+	results, err := cache.BulkCheck(ctx, principal, "worlds.read", worlds)
+	require.NoError(t, err)
+	assert.Equal(t, []bool{true, true, true}, results)
+	assert.Equal(t, []Resource{worlds[0], worlds[2]}, fake.resources)
+	assert.Equal(t, 2, fake.calls)
+
+	results, err = cache.BulkCheck(ctx, principal, "worlds.read", worlds)
+	require.NoError(t, err)
+	assert.Equal(t, []bool{true, true, true}, results)
+	assert.Equal(t, 2, fake.calls)
+
+	// Denied decisions are not cached, so Check returns the reason of the denial.
+	cache = NewCache(authz, time.Minute)
+	results, err = cache.BulkCheck(ctx, principal, "worlds.write", worlds[:1])
+	require.NoError(t, err)
+	assert.Equal(t, []bool{false}, results)
+	err = cache.Check(ctx, principal, "worlds.write", worlds[0])
+	var denied *DeniedError
+	require.ErrorAs(t, err, &denied)
+	assert.NotEmpty(t, denied.Reason)
+
+	fake.err = errors.New("unavailable")
+	_, err = NewCache(fake, time.Minute).BulkCheck(ctx, principal, "worlds.read", worlds)
+	assert.Error(t, err)
+
+	_, err = cache.BulkCheck(ctx, nil, "worlds.read", worlds)
+	assert.ErrorIs(t, err, ErrPrincipalNotProvided)
+}
+
+func TestCache_ReBACInvalidation(t *testing.T) {
+	ctx := context.Background()
+	schema, err := ParseSchema("definition user {}\ndefinition world { relation viewer: user }")
+	require.NoError(t, err)
+	engine := NewReBAC(schema, NewMemoryTupleStore())
+	authz := NewCache(engine, time.Minute)
+	var written []Tuple
+	engine.OnWrite(func(ctx context.Context, tuples []Tuple) {
+		written = append(written, tuples...)
+		authz.Invalidate()
+	})
+	principal := &authentication.Principal{ID: "alice"}
+	world := Resource{Type: "world", ID: "1"}
+
+	assert.ErrorIs(t, authz.Check(ctx, principal, "viewer", world), ErrPermissionDenied)
+	tuple := mustParseTuple(t, "world:1#viewer@user:alice")
+	require.NoError(t, engine.Write(ctx, tuple))
+	assert.NoError(t, authz.Check(ctx, principal, "viewer", world))
+	require.NoError(t, engine.Delete(ctx, tuple))
+	assert.ErrorIs(t, authz.Check(ctx, principal, "viewer", world), ErrPermissionDenied)
+	assert.Equal(t, []Tuple{tuple, tuple}, written)
+}
+
+func TestConsistencyTokenFromContext(t *testing.T) {
+	_, ok := ConsistencyTokenFromContext(context.Background())
+	assert.False(t, ok)
+
+	token, ok := ConsistencyTokenFromContext(WithConsistencyToken(context.Background(), "1"))
+	assert.True(t, ok)
+	assert.Equal(t, "1", token)
+}
@@ -0,0 +1,255 @@
+package authorization
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/gazebo-web/auth/pkg/authentication"
+	"github.com/google/cel-go/cel"
+	"gopkg.in/yaml.v3"
+)
+
+// CELRule is an attribute-based rule written in the Common Expression Language.
+// Expressions must evaluate to a boolean and have access to the following
+// variables:
+//
+//   - principal: map with the id, issuer, provider, email, display_name, roles,
+//     scopes and tenant of the principal.
+//   - claims: map with the raw claims of the principal.
+//   - action: the permission being checked.
+//   - resource: map with the attributes of the resource, plus its type and id.
+//
+// For example:
+//
+//	claims.sub == resource.owner || resource.org in principal.roles
+type CELRule struct {
+	// Name identifies the rule in deny reasons.
+	Name string `yaml:"name" json:"name"`
+	// Permission is the permission the rule applies to. A permission ending with
+	// "*" applies to every permission starting with the given prefix.
+	Permission string `yaml:"permission" json:"permission"`
+	// Expression is the CEL expression that grants the permission when it
+	// evaluates to true.
+	Expression string `yaml:"expression" json:"expression"`
+}
+
+// CELPolicy contains the set of rules used by a CEL Authorization. A permission is
+// granted if any of the rules that apply to it evaluates to true.
+//
+//	rules:
+//	  - name: world-owner
+//	    permission: worlds.write
+//	    expression: claims.sub == resource.owner
+type CELPolicy struct {
+	Rules []CELRule `yaml:"rules" json:"rules"`
+}
+
+// ParseCELPolicy parses the given YAML or JSON policy.
+func ParseCELPolicy(data []byte) (CELPolicy, error) {
+	var policy CELPolicy
+	if err := yaml.Unmarshal(data, &policy); err != nil {
+		return CELPolicy{}, fmt.Errorf("failed to parse cel policy: %w", err)
+	}
+	return policy, nil
+}
+
+// LoadCELPolicy reads the YAML or JSON policy file located at the given path.
+func LoadCELPolicy(path string) (CELPolicy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return CELPolicy{}, err
+	}
+	return ParseCELPolicy(data)
+}
+
+// CELAuthorization is an Authorization implementation that evaluates CEL policies.
+type CELAuthorization interface {
+	Authorization
+	// Update replaces the policy used to authorize requests. Expressions that were
+	// already compiled are reused. The current policy is kept if the new one is
+	// invalid.
+	Update(policy CELPolicy) error
+}
+
+// compiledCELRule is a CELRule with its compiled program.
+type compiledCELRule struct {
+	CELRule
+	program cel.Program
+}
+
+// CELOption configures a CELAuthorization.
+type CELOption func(*celAuthorization)
+
+// WithCELLogger sets the logger used to report rules that fail to evaluate. It
+// defaults to slog.Default().
+func WithCELLogger(logger *slog.Logger) CELOption {
+	return func(a *celAuthorization) {
+		a.logger = logger
+	}
+}
+
+// celAuthorization is a CELAuthorization implementation.
+type celAuthorization struct {
+	env    *cel.Env
+	logger *slog.Logger
+	// mu protects rules and programs.
+	mu    sync.RWMutex
+	rules []compiledCELRule
+	// programs caches the compiled programs by expression.
+	programs map[string]cel.Program
+}
+
+// Check evaluates the rules that apply to the given permission, and returns a
+// *DeniedError describing why each of them denied the permission if none of them
+// granted it. Evaluation errors are logged, the deny reason only includes the
+// name of the rules that failed.
+func (a *celAuthorization) Check(ctx context.Context, principal *authentication.Principal, permission string, resource Resource) error {
+	if principal == nil {
+		return ErrPrincipalNotProvided
+	}
+	a.mu.RLock()
+	rules := a.rules
+	a.mu.RUnlock()
+
+	vars := celVariables(principal, permission, resource)
+	var reasons []string
+	for _, rule := range rules {
+		if !matchPermission(rule.Permission, permission) {
+			continue
+		}
+		out, _, err := rule.program.ContextEval(ctx, vars)
+		if err != nil {
+			a.logger.WarnContext(ctx, "cel rule evaluation failed", "rule", rule.Name, "permission", permission, "error", err)
+			reasons = append(reasons, fmt.Sprintf("rule %q failed", rule.Name))
+			continue
+		}
+		if allowed, ok := out.Value().(bool); ok && allowed {
+			return nil
+		}
+		reasons = append(reasons, fmt.Sprintf("rule %q denied", rule.Name))
+	}
+	if len(reasons) == 0 {
+		return newDeniedError(principal, permission, resource, "no rule applies to the permission")
+	}
+	return newDeniedError(principal, permission, resource, strings.Join(reasons, "; "))
+}
+
+// BulkCheck evaluates the rules that apply to the given permission for each of the
+// given resources.
+func (a *celAuthorization) BulkCheck(ctx context.Context, principal *authentication.Principal, permission string, resources []Resource) ([]bool, error) {
+	return bulkCheck(ctx, principal, permission, resources, a.Check)
+}
+
+// Update replaces the policy used to authorize requests.
+func (a *celAuthorization) Update(policy CELPolicy) error {
+	a.mu.RLock()
+	cache := a.programs
+	a.mu.RUnlock()
+
+	programs := make(map[string]cel.Program, len(policy.Rules))
+	rules := make([]compiledCELRule, 0, len(policy.Rules))
+	for _, rule := range policy.Rules {
+		if len(rule.Name) == 0 || len(rule.Permission) == 0 {
+			return fmt.Errorf("invalid cel policy: rules must have a name and a permission")
+		}
+		program, ok := programs[rule.Expression]
+		if !ok {
+			program, ok = cache[rule.Expression]
+		}
+		if !ok {
+			var err error
+			program, err = a.compile(rule.Expression)
+			if err != nil {
+				return fmt.Errorf("invalid cel policy: rule %q: %w", rule.Name, err)
+			}
+		}
+		programs[rule.Expression] = program
+		rules = append(rules, compiledCELRule{CELRule: rule, program: program})
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.rules = rules
+	a.programs = programs
+	return nil
+}
+
+// compile compiles the given expression, and checks that it evaluates to a boolean.
+func (a *celAuthorization) compile(expression string) (cel.Program, error) {
+	ast, issues := a.env.Compile(expression)
+	if issues != nil && issues.Err() != nil {
+		return nil, issues.Err()
+	}
+	if ast.OutputType() != cel.BoolType {
+		return nil, fmt.Errorf("expression must evaluate to a bool, got %s", ast.OutputType())
+	}
+	return a.env.Program(ast, cel.InterruptCheckFrequency(100))
+}
+
+// NewCEL initializes a new CELAuthorization that evaluates the rules defined in
+// the given policy. Every expression is compiled when the policy is loaded, an
+// error is returned if any of them is invalid.
+//
+//	authz, err := NewCEL(CELPolicy{Rules: []CELRule{{
+//		Name:       "world-owner",
+//		Permission: "worlds.write",
+//		Expression: "claims.sub == resource.owner || resource.org in principal.roles",
+//	}}})
+func NewCEL(policy CELPolicy, opts ...CELOption) (CELAuthorization, error) {
+	env, err := cel.NewEnv(
+		cel.Variable("principal", cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable("claims", cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable("action", cel.StringType),
+		cel.Variable("resource", cel.MapType(cel.StringType, cel.DynType)),
+	)
+	if err != nil {
+		return nil, err
+	}
+	a := &celAuthorization{env: env, logger: slog.Default()}
+	for _, opt := range opts {
+		opt(a)
+	}
+	if err := a.Update(policy); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// celVariables returns the variables used to evaluate CEL expressions.
+func celVariables(principal *authentication.Principal, permission string, resource Resource) map[string]any {
+	res := make(map[string]any, len(resource.Attributes)+2)
+	for k, v := range resource.Attributes {
+		res[k] = v
+	}
+	res["type"] = resource.Type
+	res["id"] = resource.ID
+
+	claims := principal.Claims
+	if claims == nil {
+		claims = map[string]any{}
+	}
+	return map[string]any{
+		"principal": map[string]any{
+			"id":           principal.ID,
+			"issuer":       principal.Issuer,
+			"provider":     principal.Provider,
+			"email":        principal.Email,
+			"display_name": principal.DisplayName,
+			"roles":        stringList(principal.Roles),
+			"scopes":       stringList(principal.Scopes),
+			"tenant":       principal.Tenant,
+		},
+		"claims":   claims,
+		"action":   permission,
+		"resource": res,
+	}
+}
+
+// stringList returns a non-nil copy of the given list.
+func stringList(list []string) []string {
+	return append([]string{}, list...)
+}
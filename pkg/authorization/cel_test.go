@@ -0,0 +1,148 @@
+package authorization
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"testing"
+
+	"github.com/gazebo-web/auth/pkg/authentication"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestCEL(t *testing.T) CELAuthorization {
+	policy, err := LoadCELPolicy("testdata/cel_policy.yaml")
+	require.NoError(t, err)
+	authz, err := NewCEL(policy)
+	require.NoError(t, err)
+	return authz
+}
+
+func TestLoadCELPolicy(t *testing.T) {
+	policy, err := LoadCELPolicy("testdata/cel_policy.yaml")
+	require.NoError(t, err)
+	require.Len(t, policy.Rules, 2)
+	assert.Equal(t, "world-owner", policy.Rules[0].Name)
+	assert.Equal(t, "claims.sub == resource.owner", policy.Rules[0].Expression)
+
+	_, err = LoadCELPolicy("testdata/missing.yaml")
+	assert.Error(t, err)
+}
+
+func TestCEL_Check(t *testing.T) {
+	authz := newTestCEL(t)
+	ctx := context.Background()
+	owner := &authentication.Principal{ID: "a", Claims: map[string]any{"sub": "a"}}
+	member := &authentication.Principal{ID: "b", Roles: []string{"openrobotics"}, Claims: map[string]any{"sub": "b"}}
+	world := Resource{Type: "world", ID: "1234", Attributes: map[string]any{"owner": "a", "org": "openrobotics"}}
+
+	assert.NoError(t, authz.Check(ctx, owner, "worlds.write", world))
+	assert.NoError(t, authz.Check(ctx, member, "worlds.write", world))
+	assert.NoError(t, authz.Check(ctx, member, "worlds.delete", world))
+
+	err := authz.Check(ctx, owner, "worlds.delete", world)
+	assert.ErrorIs(t, err, ErrPermissionDenied)
+	var denied *DeniedError
+	require.ErrorAs(t, err, &denied)
+	assert.Equal(t, `rule "org-member" denied`, denied.Reason)
+
+	err = authz.Check(ctx, owner, "worlds.write", Resource{Type: "world", ID: "5678", Attributes: map[string]any{"owner": "c"}})
+	require.ErrorAs(t, err, &denied)
+	assert.Equal(t, `rule "world-owner" denied; rule "org-member" denied`, denied.Reason)
+
+	err = authz.Check(ctx, owner, "users.read", world)
+	require.ErrorAs(t, err, &denied)
+	assert.Equal(t, "no rule applies to the permission", denied.Reason)
+
+	assert.ErrorIs(t, authz.Check(ctx, nil, "worlds.write", world), ErrPrincipalNotProvided)
+}
+
+func TestCEL_EvaluationError(t *testing.T) {
+	var logs bytes.Buffer
+	authz, err := NewCEL(CELPolicy{Rules: []CELRule{{
+		Name:       "world-owner",
+		Permission: "worlds.write",
+		Expression: "claims.sub == resource.owner",
+	}}}, WithCELLogger(slog.New(slog.NewTextHandler(&logs, nil))))
+	require.NoError(t, err)
+
+	err = authz.Check(context.Background(), &authentication.Principal{ID: "a"}, "worlds.write", Resource{Type: "world"})
+	var denied *DeniedError
+	require.ErrorAs(t, err, &denied)
+	assert.Equal(t, `rule "world-owner" failed`, denied.Reason)
+	assert.Contains(t, logs.String(), "no such key")
+}
+
+func TestCEL_Variables(t *testing.T) {
+	authz, err := NewCEL(CELPolicy{Rules: []CELRule{{
+		Name:       "all",
+		Permission: "*",
+		Expression: `action == "worlds.read" && resource.type == "world" && resource.id == "1234" && ` +
+			`principal.tenant == "openrobotics" && "worlds.read" in principal.scopes && principal.email.endsWith("@gazebosim.org")`,
+	}}})
+	require.NoError(t, err)
+
+	principal := &authentication.Principal{
+		ID:     "a",
+		Email:  "a@gazebosim.org",
+		Scopes: []string{"worlds.read"},
+		Tenant: "openrobotics",
+	}
+	assert.NoError(t, authz.Check(context.Background(), principal, "worlds.read", Resource{Type: "world", ID: "1234"}))
+	assert.ErrorIs(t, authz.Check(context.Background(), principal, "worlds.write", Resource{Type: "world", ID: "1234"}), ErrPermissionDenied)
+}
+
+func TestNewCEL_InvalidPolicy(t *testing.T) {
+	testCases := []struct {
+		name string
+		rule CELRule
+	}{
+		{name: "missing name", rule: CELRule{Permission: "worlds.read", Expression: "true"}},
+		{name: "missing permission", rule: CELRule{Name: "rule", Expression: "true"}},
+		{name: "syntax error", rule: CELRule{Name: "rule", Permission: "worlds.read", Expression: "claims.sub =="}},
+		{name: "unknown variable", rule: CELRule{Name: "rule", Permission: "worlds.read", Expression: "user.id == 'a'"}},
+		{name: "not a bool", rule: CELRule{Name: "rule", Permission: "worlds.read", Expression: "action"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewCEL(CELPolicy{Rules: []CELRule{tc.rule}})
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestCEL_Update(t *testing.T) {
+	authz := newTestCEL(t)
+	impl := authz.(*celAuthorization)
+	cached := impl.programs["claims.sub == resource.owner"]
+	require.NotNil(t, cached)
+
+	err := authz.Update(CELPolicy{Rules: []CELRule{
+		{Name: "world-owner", Permission: "worlds.delete", Expression: "claims.sub == resource.owner"},
+	}})
+	require.NoError(t, err)
+	assert.Len(t, impl.programs, 1)
+	assert.Equal(t, cached, impl.programs["claims.sub == resource.owner"])
+
+	principal := &authentication.Principal{ID: "a", Claims: map[string]any{"sub": "a"}}
+	world := Resource{Type: "world", Attributes: map[string]any{"owner": "a"}}
+	assert.NoError(t, authz.Check(context.Background(), principal, "worlds.delete", world))
+	assert.ErrorIs(t, authz.Check(context.Background(), principal, "worlds.write", world), ErrPermissionDenied)
+
+	err = authz.Update(CELPolicy{Rules: []CELRule{{Name: "invalid", Permission: "worlds.write", Expression: "=="}}})
+	assert.Error(t, err)
+	assert.NoError(t, authz.Check(context.Background(), principal, "worlds.delete", world))
+}
+
+func TestCEL_BulkCheck(t *testing.T) {
+	authz := newTestCEL(t)
+	principal := &authentication.Principal{ID: "a", Claims: map[string]any{"sub": "a"}}
+	worlds := []Resource{
+		{Type: "world", ID: "1", Attributes: map[string]any{"owner": "a"}},
+		{Type: "world", ID: "2", Attributes: map[string]any{"owner": "b"}},
+	}
+	results, err := authz.BulkCheck(context.Background(), principal, "worlds.write", worlds)
+	require.NoError(t, err)
+	assert.Equal(t, []bool{true, false}, results)
+}
@@ -0,0 +1,107 @@
+package authorization
+
+import (
+	"context"
+	"errors"
+
+	"github.com/gazebo-web/auth/pkg/authentication"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ErrMethodNotMapped is returned when a gRPC method is neither mapped to a
+// permission nor declared as public, see WithPublicMethods.
+var ErrMethodNotMapped = errors.New("method is not mapped to a permission")
+
+// GRPCResourceFunc returns the resource targeted by the gRPC request sent to the
+// given method. req is nil for streams.
+type GRPCResourceFunc func(fullMethod string, req any) Resource
+
+// UnaryServerInterceptor returns a gRPC unary server interceptor that checks that
+// the authenticated principal has the permission required by the called method.
+// permissions maps gRPC full method names to permissions. Methods not present in
+// permissions are rejected with codes.PermissionDenied unless they are declared
+// as public using WithPublicMethods. It must be chained after
+// authentication.UnaryServerInterceptor, which stores the principal in the
+// request context.
+//
+// Denied requests are rejected with codes.PermissionDenied and a message that
+// includes the missing permission.
+//
+//	server := grpc.NewServer(grpc.ChainUnaryInterceptor(
+//		authentication.UnaryServerInterceptor(auth),
+//		UnaryServerInterceptor(authz, map[string]string{"/gazebo.Worlds/Delete": "worlds.delete"},
+//			WithPublicMethods("/grpc.health.v1.Health/Check"),
+//		),
+//	))
+func UnaryServerInterceptor(authz Authorization, permissions map[string]string, opts ...MiddlewareOption) grpc.UnaryServerInterceptor {
+	cfg := newMiddlewareConfig(opts)
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if err := authorizeGRPC(ctx, authz, permissions, cfg, info.FullMethod, req); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor returns a gRPC stream server interceptor that checks
+// that the authenticated principal has the permission required to open a stream.
+// See UnaryServerInterceptor for more information.
+func StreamServerInterceptor(authz Authorization, permissions map[string]string, opts ...MiddlewareOption) grpc.StreamServerInterceptor {
+	cfg := newMiddlewareConfig(opts)
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := authorizeGRPC(ss.Context(), authz, permissions, cfg, info.FullMethod, nil); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
+
+// authorizeGRPC checks that the principal stored in ctx has the permission
+// required by the given method. Public methods are not checked.
+func authorizeGRPC(ctx context.Context, authz Authorization, permissions map[string]string, cfg middlewareConfig, method string, req any) error {
+	if cfg.publicMethods[method] {
+		return nil
+	}
+	permission, ok := permissions[method]
+	if !ok {
+		return status.Error(GRPCStatusCode(ErrMethodNotMapped), ErrMethodNotMapped.Error())
+	}
+	resource := cfg.grpcResource(method, req)
+	principal, ok := authentication.PrincipalFromContext(ctx)
+	if !ok {
+		return status.Error(GRPCStatusCode(ErrPrincipalNotProvided), ErrPrincipalNotProvided.Error())
+	}
+	if err := authz.Check(ctx, principal, permission, resource); err != nil {
+		return grpcAuthorizationError(err)
+	}
+	return nil
+}
+
+// grpcAuthorizationError converts the given authorization error into a gRPC
+// status error. Unexpected errors are returned with a generic message to avoid
+// exposing internal details to clients.
+func grpcAuthorizationError(err error) error {
+	code := GRPCStatusCode(err)
+	if code == codes.Internal {
+		return status.Error(code, "internal error")
+	}
+	return status.Error(code, err.Error())
+}
+
+// GRPCStatusCode returns the gRPC status code that should be returned to clients
+// when an authorization check fails with the given error.
+func GRPCStatusCode(err error) codes.Code {
+	switch {
+	case err == nil:
+		return codes.OK
+	case errors.Is(err, ErrPermissionDenied), errors.Is(err, ErrMethodNotMapped):
+		return codes.PermissionDenied
+	case errors.Is(err, ErrPrincipalNotProvided):
+		return codes.Unauthenticated
+	case errors.Is(err, ErrInvalidResource):
+		return codes.InvalidArgument
+	}
+	return codes.Internal
+}
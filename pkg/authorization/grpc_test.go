@@ -0,0 +1,98 @@
+package authorization
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/gazebo-web/auth/pkg/authentication"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// testServerStream is a grpc.ServerStream implementation used for testing purposes.
+type testServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *testServerStream) Context() context.Context {
+	return s.ctx
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	permissions := map[string]string{
+		"/gazebo.Worlds/List":   "worlds.read",
+		"/gazebo.Worlds/Delete": "worlds.delete",
+	}
+	interceptor := UnaryServerInterceptor(newTestRBAC(t), permissions, WithPublicMethods("/gazebo.Worlds/Public"))
+	handler := func(ctx context.Context, req any) (any, error) {
+		return "ok", nil
+	}
+	ctx := authentication.WithPrincipal(context.Background(), &authentication.Principal{ID: "a", Roles: []string{"viewer"}})
+
+	res, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: "/gazebo.Worlds/List"}, handler)
+	assert.NoError(t, err)
+	assert.Equal(t, "ok", res)
+
+	res, err = interceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/gazebo.Worlds/Public"}, handler)
+	assert.NoError(t, err)
+	assert.Equal(t, "ok", res)
+
+	// Methods that are not mapped to a permission are denied.
+	_, err = interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: "/gazebo.Worlds/Unmapped"}, handler)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	_, err = interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: "/gazebo.Worlds/Delete"}, handler)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	assert.Contains(t, status.Convert(err).Message(), `missing permission "worlds.delete"`)
+
+	_, err = interceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/gazebo.Worlds/List"}, handler)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestUnaryServerInterceptor_Resource(t *testing.T) {
+	authz := &fakeAuthorization{}
+	interceptor := UnaryServerInterceptor(authz, map[string]string{"/gazebo.Worlds/Get": "worlds.read"},
+		WithGRPCResource(func(fullMethod string, req any) Resource {
+			return Resource{Type: "world", ID: req.(string)}
+		}),
+	)
+	ctx := authentication.WithPrincipal(context.Background(), &authentication.Principal{ID: "a"})
+	_, err := interceptor(ctx, "1234", &grpc.UnaryServerInfo{FullMethod: "/gazebo.Worlds/Get"}, func(ctx context.Context, req any) (any, error) {
+		return nil, nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []Resource{{Type: "world", ID: "1234"}}, authz.resources)
+}
+
+func TestUnaryServerInterceptor_InternalError(t *testing.T) {
+	authz := &fakeAuthorization{err: errors.New("dial tcp 10.0.0.1:5432: connection refused")}
+	interceptor := UnaryServerInterceptor(authz, map[string]string{"/gazebo.Worlds/Get": "worlds.read"})
+	ctx := authentication.WithPrincipal(context.Background(), &authentication.Principal{ID: "a"})
+	_, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: "/gazebo.Worlds/Get"}, func(ctx context.Context, req any) (any, error) {
+		t.Fatal("handler should not be called")
+		return nil, nil
+	})
+	assert.Equal(t, codes.Internal, status.Code(err))
+	assert.NotContains(t, status.Convert(err).Message(), "10.0.0.1")
+}
+
+func TestStreamServerInterceptor(t *testing.T) {
+	interceptor := StreamServerInterceptor(newTestRBAC(t), map[string]string{"/gazebo.Worlds/Watch": "worlds.write"})
+	ctx := authentication.WithPrincipal(context.Background(), &authentication.Principal{ID: "a", Roles: []string{"viewer"}})
+	err := interceptor(nil, &testServerStream{ctx: ctx}, &grpc.StreamServerInfo{FullMethod: "/gazebo.Worlds/Watch"}, func(srv any, stream grpc.ServerStream) error {
+		t.Fatal("handler should not be called")
+		return nil
+	})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
+
+func TestGRPCStatusCode(t *testing.T) {
+	assert.Equal(t, codes.OK, GRPCStatusCode(nil))
+	assert.Equal(t, codes.PermissionDenied, GRPCStatusCode(&DeniedError{}))
+	assert.Equal(t, codes.Unauthenticated, GRPCStatusCode(ErrPrincipalNotProvided))
+	assert.Equal(t, codes.Internal, GRPCStatusCode(errors.New("failed")))
+}
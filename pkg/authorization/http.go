@@ -0,0 +1,121 @@
+package authorization
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gazebo-web/auth/pkg/authentication"
+)
+
+// MiddlewareOption configures the HTTP middleware and gRPC interceptors.
+type MiddlewareOption func(*middlewareConfig)
+
+// middlewareConfig contains the configuration of the HTTP middleware and gRPC
+// interceptors.
+type middlewareConfig struct {
+	httpResource func(r *http.Request) Resource
+	grpcResource GRPCResourceFunc
+	// publicMethods contains the gRPC methods that are not checked.
+	publicMethods map[string]bool
+}
+
+// WithHTTPResource sets the function used to get the resource targeted by an
+// HTTP request. Defaults to an empty resource.
+func WithHTTPResource(fn func(r *http.Request) Resource) MiddlewareOption {
+	return func(cfg *middlewareConfig) {
+		cfg.httpResource = fn
+	}
+}
+
+// WithGRPCResource sets the function used to get the resource targeted by a gRPC
+// request. Defaults to an empty resource.
+func WithGRPCResource(fn GRPCResourceFunc) MiddlewareOption {
+	return func(cfg *middlewareConfig) {
+		cfg.grpcResource = fn
+	}
+}
+
+// WithPublicMethods sets the gRPC full method names that are not checked by the
+// gRPC interceptors, such as health checks or reflection. Every other method must
+// be mapped to a permission.
+func WithPublicMethods(methods ...string) MiddlewareOption {
+	return func(cfg *middlewareConfig) {
+		for _, method := range methods {
+			cfg.publicMethods[method] = true
+		}
+	}
+}
+
+// newMiddlewareConfig applies the given options to the default configuration.
+func newMiddlewareConfig(opts []MiddlewareOption) middlewareConfig {
+	cfg := middlewareConfig{
+		httpResource:  func(r *http.Request) Resource { return Resource{} },
+		grpcResource:  func(fullMethod string, req any) Resource { return Resource{} },
+		publicMethods: make(map[string]bool),
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return cfg
+}
+
+// HTTPMiddleware returns an HTTP middleware that only lets requests through if
+// the authenticated principal has the given permission. It must be chained after
+// authentication.HTTPMiddleware, which stores the principal in the request
+// context.
+//
+// Requests without a principal are rejected with 401 Unauthorized. Denied
+// requests are rejected with 403 Forbidden and an insufficient_scope challenge
+// that includes the missing permission.
+//
+//	handler := authentication.HTTPMiddleware(auth)(HTTPMiddleware(authz, "worlds.write")(next))
+func HTTPMiddleware(authz Authorization, permission string, opts ...MiddlewareOption) func(http.Handler) http.Handler {
+	cfg := newMiddlewareConfig(opts)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, ok := authentication.PrincipalFromContext(r.Context())
+			if !ok {
+				writeAuthorizationError(w, ErrPrincipalNotProvided)
+				return
+			}
+			if err := authz.Check(r.Context(), principal, permission, cfg.httpResource(r)); err != nil {
+				writeAuthorizationError(w, err)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// HTTPStatusCode returns the HTTP status code that should be returned to clients
+// when an authorization check fails with the given error.
+func HTTPStatusCode(err error) int {
+	switch {
+	case err == nil:
+		return http.StatusOK
+	case errors.Is(err, ErrPermissionDenied):
+		return http.StatusForbidden
+	case errors.Is(err, ErrPrincipalNotProvided):
+		return http.StatusUnauthorized
+	case errors.Is(err, ErrInvalidResource):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// writeAuthorizationError writes the response for a failed authorization check.
+func writeAuthorizationError(w http.ResponseWriter, err error) {
+	status := HTTPStatusCode(err)
+	var denied *DeniedError
+	switch {
+	case errors.As(err, &denied):
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer error="insufficient_scope", scope=%q`, denied.Permission))
+		http.Error(w, http.StatusText(status), status)
+	case status == http.StatusUnauthorized:
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, http.StatusText(status), status)
+	default:
+		http.Error(w, http.StatusText(status), status)
+	}
+}
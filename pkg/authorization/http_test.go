@@ -0,0 +1,109 @@
+package authorization
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gazebo-web/auth/pkg/authentication"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeAuthorization is an Authorization implementation used for testing purposes.
+type fakeAuthorization struct {
+	err       error
+	resources []Resource
+	calls     int
+}
+
+func (f *fakeAuthorization) Check(ctx context.Context, principal *authentication.Principal, permission string, resource Resource) error {
+	f.calls++
+	f.resources = append(f.resources, resource)
+	return f.err
+}
+
+func (f *fakeAuthorization) BulkCheck(ctx context.Context, principal *authentication.Principal, permission string, resources []Resource) ([]bool, error) {
+	f.calls++
+	f.resources = append(f.resources, resources...)
+	if f.err != nil && !errors.Is(f.err, ErrPermissionDenied) {
+		return nil, f.err
+	}
+	results := make([]bool, len(resources))
+	for i := range results {
+		results[i] = f.err == nil
+	}
+	return results, nil
+}
+
+func newTestRBAC(t *testing.T) Authorizer {
+	authz, err := NewRBAC(RBACPolicy{Roles: []Role{
+		{Name: "viewer", Permissions: []string{"worlds.read"}},
+	}})
+	require.NoError(t, err)
+	return authz
+}
+
+func TestHTTPMiddleware(t *testing.T) {
+	var called bool
+	handler := HTTPMiddleware(newTestRBAC(t), "worlds.read")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+
+	r := httptest.NewRequest(http.MethodGet, "/worlds", nil)
+	r = r.WithContext(authentication.WithPrincipal(r.Context(), &authentication.Principal{ID: "a", Roles: []string{"viewer"}}))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	assert.True(t, called)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestHTTPMiddleware_Denied(t *testing.T) {
+	handler := HTTPMiddleware(newTestRBAC(t), "worlds.write")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("handler should not be called")
+	}))
+
+	r := httptest.NewRequest(http.MethodPost, "/worlds", nil)
+	r = r.WithContext(authentication.WithPrincipal(r.Context(), &authentication.Principal{ID: "a", Roles: []string{"viewer"}}))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Equal(t, `Bearer error="insufficient_scope", scope="worlds.write"`, w.Header().Get("WWW-Authenticate"))
+	assert.Equal(t, "Forbidden\n", w.Body.String())
+}
+
+func TestHTTPMiddleware_MissingPrincipal(t *testing.T) {
+	handler := HTTPMiddleware(newTestRBAC(t), "worlds.read")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("handler should not be called")
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/worlds", nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, "Bearer", w.Header().Get("WWW-Authenticate"))
+}
+
+func TestHTTPMiddleware_Resource(t *testing.T) {
+	authz := &fakeAuthorization{err: errors.New("unavailable")}
+	handler := HTTPMiddleware(authz, "worlds.read", WithHTTPResource(func(r *http.Request) Resource {
+		return Resource{Type: "world", ID: r.URL.Query().Get("id")}
+	}))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("handler should not be called")
+	}))
+
+	r := httptest.NewRequest(http.MethodGet, "/worlds?id=1234", nil)
+	r = r.WithContext(authentication.WithPrincipal(r.Context(), &authentication.Principal{ID: "a"}))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, []Resource{{Type: "world", ID: "1234"}}, authz.resources)
+}
+
+func TestHTTPStatusCode(t *testing.T) {
+	assert.Equal(t, http.StatusOK, HTTPStatusCode(nil))
+	assert.Equal(t, http.StatusForbidden, HTTPStatusCode(&DeniedError{}))
+	assert.Equal(t, http.StatusUnauthorized, HTTPStatusCode(ErrPrincipalNotProvided))
+	assert.Equal(t, http.StatusInternalServerError, HTTPStatusCode(errors.New("failed")))
+}
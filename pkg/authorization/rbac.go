@@ -0,0 +1,248 @@
+package authorization
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/gazebo-web/auth/pkg/authentication"
+	"gopkg.in/yaml.v3"
+)
+
+// Role is a named set of permissions. Roles can inherit the permissions of other
+// roles.
+type Role struct {
+	// Name is the unique name of the role.
+	Name string `yaml:"name" json:"name"`
+	// Permissions contains the permissions granted by the role. A permission
+	// ending with "*" grants every permission starting with the given prefix,
+	// "*" alone grants every permission.
+	Permissions []string `yaml:"permissions,omitempty" json:"permissions,omitempty"`
+	// Inherits contains the names of the roles this role inherits permissions from.
+	Inherits []string `yaml:"inherits,omitempty" json:"inherits,omitempty"`
+}
+
+// RBACPolicy contains the set of roles used by a role-based Authorizer.
+//
+//	roles:
+//	  - name: viewer
+//	    permissions: ["worlds.read"]
+//	  - name: editor
+//	    inherits: ["viewer"]
+//	    permissions: ["worlds.write"]
+type RBACPolicy struct {
+	Roles []Role `yaml:"roles" json:"roles"`
+}
+
+// ParseRBACPolicy parses the given YAML or JSON policy.
+func ParseRBACPolicy(data []byte) (RBACPolicy, error) {
+	var policy RBACPolicy
+	if err := yaml.Unmarshal(data, &policy); err != nil {
+		return RBACPolicy{}, fmt.Errorf("failed to parse rbac policy: %w", err)
+	}
+	return policy, nil
+}
+
+// LoadRBACPolicy reads the YAML or JSON policy file located at the given path.
+func LoadRBACPolicy(path string) (RBACPolicy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return RBACPolicy{}, err
+	}
+	return ParseRBACPolicy(data)
+}
+
+// RoleExtractor returns the roles assigned to the given principal.
+type RoleExtractor func(principal *authentication.Principal) []string
+
+// PrincipalRoles returns a RoleExtractor that uses the roles set by the
+// authentication.PrincipalMapper that built the principal.
+func PrincipalRoles() RoleExtractor {
+	return func(principal *authentication.Principal) []string {
+		return principal.Roles
+	}
+}
+
+// ClaimRoles returns a RoleExtractor that reads the roles from the given claims
+// of the principal. Claims can contain a list of roles or a space-separated
+// string. This allows reading roles from namespaced Auth0 claims, such as
+// "https://gazebosim.org/roles", or Firebase custom claims.
+func ClaimRoles(keys ...string) RoleExtractor {
+	return func(principal *authentication.Principal) []string {
+		var roles []string
+		for _, key := range keys {
+			switch v := principal.Claims[key].(type) {
+			case string:
+				roles = append(roles, strings.Fields(v)...)
+			case []string:
+				roles = append(roles, v...)
+			case []any:
+				for _, role := range v {
+					if s, ok := role.(string); ok {
+						roles = append(roles, s)
+					}
+				}
+			}
+		}
+		return roles
+	}
+}
+
+// Authorizer is an Authorization implementation based on roles.
+type Authorizer interface {
+	Authorization
+	// Can returns true if any of the roles of the given principal grants the
+	// given permission.
+	Can(principal *authentication.Principal, permission string) bool
+	// Permissions returns the permissions granted to the given role, including
+	// the ones inherited from other roles.
+	Permissions(role string) []string
+}
+
+// RBACOption configures a role-based Authorizer.
+type RBACOption func(*rbac)
+
+// WithRoleExtractor sets the RoleExtractor used to get the roles of a principal.
+// Defaults to PrincipalRoles.
+func WithRoleExtractor(extractor RoleExtractor) RBACOption {
+	return func(r *rbac) {
+		r.extractor = extractor
+	}
+}
+
+// rbac is an Authorizer implementation that grants permissions based on the
+// roles of a principal.
+type rbac struct {
+	permissions map[string][]string
+	extractor   RoleExtractor
+}
+
+// Check returns a *DeniedError if the principal doesn't have the given permission.
+// The resource is ignored, roles apply to every resource.
+func (r *rbac) Check(ctx context.Context, principal *authentication.Principal, permission string, resource Resource) error {
+	if principal == nil {
+		return ErrPrincipalNotProvided
+	}
+	if !r.Can(principal, permission) {
+		return newDeniedError(principal, permission, resource, "no role grants the permission")
+	}
+	return nil
+}
+
+// BulkCheck checks whether the principal has the given permission. Roles apply to
+// every resource, the same decision is returned for all of them.
+func (r *rbac) BulkCheck(ctx context.Context, principal *authentication.Principal, permission string, resources []Resource) ([]bool, error) {
+	if principal == nil {
+		return nil, ErrPrincipalNotProvided
+	}
+	allowed := r.Can(principal, permission)
+	results := make([]bool, len(resources))
+	for i := range results {
+		results[i] = allowed
+	}
+	return results, nil
+}
+
+// Can returns true if any of the roles of the given principal grants the given
+// permission.
+func (r *rbac) Can(principal *authentication.Principal, permission string) bool {
+	if principal == nil {
+		return false
+	}
+	for _, role := range r.extractor(principal) {
+		for _, granted := range r.permissions[role] {
+			if matchPermission(granted, permission) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Permissions returns the permissions granted to the given role.
+func (r *rbac) Permissions(role string) []string {
+	return append([]string(nil), r.permissions[role]...)
+}
+
+// NewRBAC initializes a new role-based Authorizer using the roles defined in the
+// given policy. It returns an error if a role is defined twice, inherits from an
+// unknown role or the inheritance contains a cycle.
+//
+//	policy, err := LoadRBACPolicy("rbac.yaml")
+//	authz, err := NewRBAC(policy, WithRoleExtractor(ClaimRoles("https://gazebosim.org/roles")))
+func NewRBAC(policy RBACPolicy, opts ...RBACOption) (Authorizer, error) {
+	roles := make(map[string]Role, len(policy.Roles))
+	for _, role := range policy.Roles {
+		if len(role.Name) == 0 {
+			return nil, fmt.Errorf("invalid rbac policy: role name is empty")
+		}
+		if _, ok := roles[role.Name]; ok {
+			return nil, fmt.Errorf("invalid rbac policy: role %q is defined more than once", role.Name)
+		}
+		roles[role.Name] = role
+	}
+	r := &rbac{
+		permissions: make(map[string][]string, len(roles)),
+		extractor:   PrincipalRoles(),
+	}
+	for name := range roles {
+		permissions, err := resolvePermissions(roles, name, nil)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rbac policy: %w", err)
+		}
+		r.permissions[name] = permissions
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r, nil
+}
+
+// resolvePermissions returns the permissions of the given role including the ones
+// inherited from other roles. path contains the roles being resolved, and it's
+// used to detect cycles.
+func resolvePermissions(roles map[string]Role, name string, path []string) ([]string, error) {
+	for _, p := range path {
+		if p == name {
+			return nil, fmt.Errorf("role inheritance cycle: %s", strings.Join(append(path, name), " -> "))
+		}
+	}
+	role, ok := roles[name]
+	if !ok {
+		return nil, fmt.Errorf("role %q inherits from unknown role %q", path[len(path)-1], name)
+	}
+	path = append(path, name)
+	permissions := append([]string(nil), role.Permissions...)
+	for _, parent := range role.Inherits {
+		inherited, err := resolvePermissions(roles, parent, path)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range inherited {
+			if !contains(permissions, p) {
+				permissions = append(permissions, p)
+			}
+		}
+	}
+	return permissions, nil
+}
+
+// matchPermission returns true if the granted permission matches the requested
+// one. Granted permissions ending with "*" match any permission with that prefix.
+func matchPermission(granted, permission string) bool {
+	if strings.HasSuffix(granted, "*") {
+		return strings.HasPrefix(permission, granted[:len(granted)-1])
+	}
+	return granted == permission
+}
+
+// contains returns true if the given list contains value.
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,137 @@
+package authorization
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gazebo-web/auth/pkg/authentication"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadRBACPolicy(t *testing.T) {
+	policy, err := LoadRBACPolicy("testdata/rbac.yaml")
+	require.NoError(t, err)
+	require.Len(t, policy.Roles, 3)
+	assert.Equal(t, "editor", policy.Roles[1].Name)
+	assert.Equal(t, []string{"viewer"}, policy.Roles[1].Inherits)
+
+	_, err = LoadRBACPolicy("testdata/missing.yaml")
+	assert.Error(t, err)
+
+	_, err = ParseRBACPolicy([]byte("roles: {"))
+	assert.Error(t, err)
+}
+
+func TestNewRBAC_Inheritance(t *testing.T) {
+	policy, err := LoadRBACPolicy("testdata/rbac.yaml")
+	require.NoError(t, err)
+	authz, err := NewRBAC(policy)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"worlds.read"}, authz.Permissions("viewer"))
+	assert.ElementsMatch(t, []string{"worlds.read", "worlds.write"}, authz.Permissions("editor"))
+	assert.Empty(t, authz.Permissions("unknown"))
+
+	editor := &authentication.Principal{ID: "editor", Roles: []string{"editor"}}
+	assert.True(t, authz.Can(editor, "worlds.read"))
+	assert.True(t, authz.Can(editor, "worlds.write"))
+	assert.False(t, authz.Can(editor, "worlds.delete"))
+
+	admin := &authentication.Principal{ID: "admin", Roles: []string{"admin"}}
+	assert.True(t, authz.Can(admin, "worlds.delete"))
+
+	assert.False(t, authz.Can(nil, "worlds.read"))
+	assert.False(t, authz.Can(&authentication.Principal{ID: "guest"}, "worlds.read"))
+}
+
+func TestNewRBAC_InvalidPolicy(t *testing.T) {
+	testCases := []struct {
+		name   string
+		policy RBACPolicy
+	}{
+		{
+			name:   "empty name",
+			policy: RBACPolicy{Roles: []Role{{Permissions: []string{"worlds.read"}}}},
+		},
+		{
+			name:   "duplicated role",
+			policy: RBACPolicy{Roles: []Role{{Name: "viewer"}, {Name: "viewer"}}},
+		},
+		{
+			name:   "unknown parent",
+			policy: RBACPolicy{Roles: []Role{{Name: "editor", Inherits: []string{"viewer"}}}},
+		},
+		{
+			name: "cycle",
+			policy: RBACPolicy{Roles: []Role{
+				{Name: "a", Inherits: []string{"b"}},
+				{Name: "b", Inherits: []string{"a"}},
+			}},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewRBAC(tc.policy)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestRBAC_Check(t *testing.T) {
+	authz, err := NewRBAC(RBACPolicy{Roles: []Role{{Name: "editor", Permissions: []string{"worlds.*"}}}})
+	require.NoError(t, err)
+	ctx := context.Background()
+	resource := Resource{Type: "world", ID: "1234"}
+
+	assert.NoError(t, authz.Check(ctx, &authentication.Principal{ID: "a", Roles: []string{"editor"}}, "worlds.write", resource))
+
+	err = authz.Check(ctx, &authentication.Principal{ID: "b", Roles: []string{"viewer"}}, "worlds.write", resource)
+	assert.ErrorIs(t, err, ErrPermissionDenied)
+	var denied *DeniedError
+	require.ErrorAs(t, err, &denied)
+	assert.Equal(t, "b", denied.Principal)
+	assert.Equal(t, "worlds.write", denied.Permission)
+	assert.Equal(t, resource, denied.Resource)
+
+	assert.ErrorIs(t, authz.Check(ctx, nil, "worlds.write", resource), ErrPrincipalNotProvided)
+}
+
+func TestClaimRoles(t *testing.T) {
+	principal := &authentication.Principal{
+		ID: "gazebo-web",
+		Claims: map[string]any{
+			"https://gazebosim.org/roles": []any{"editor", 1},
+			"roles":                       "viewer admin",
+			"groups":                      []string{"team"},
+		},
+	}
+	roles := ClaimRoles("https://gazebosim.org/roles", "roles", "groups", "missing")(principal)
+	assert.Equal(t, []string{"editor", "viewer", "admin", "team"}, roles)
+
+	authz, err := NewRBAC(
+		RBACPolicy{Roles: []Role{{Name: "editor", Permissions: []string{"worlds.write"}}}},
+		WithRoleExtractor(ClaimRoles("https://gazebosim.org/roles")),
+	)
+	require.NoError(t, err)
+	assert.True(t, authz.Can(principal, "worlds.write"))
+}
+
+func TestRBAC_BulkCheck(t *testing.T) {
+	authz, err := NewRBAC(RBACPolicy{Roles: []Role{{Name: "viewer", Permissions: []string{"worlds.read"}}}})
+	require.NoError(t, err)
+	ctx := context.Background()
+	principal := &authentication.Principal{ID: "a", Roles: []string{"viewer"}}
+	worlds := []Resource{{Type: "world", ID: "1"}, {Type: "world", ID: "2"}}
+
+	results, err := authz.BulkCheck(ctx, principal, "worlds.read", worlds)
+	require.NoError(t, err)
+	assert.Equal(t, []bool{true, true}, results)
+
+	results, err = authz.BulkCheck(ctx, principal, "worlds.write", worlds)
+	require.NoError(t, err)
+	assert.Equal(t, []bool{false, false}, results)
+
+	_, err = authz.BulkCheck(ctx, nil, "worlds.read", worlds)
+	assert.ErrorIs(t, err, ErrPrincipalNotProvided)
+}
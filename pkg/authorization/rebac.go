@@ -0,0 +1,577 @@
+package authorization
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/gazebo-web/auth/pkg/authentication"
+)
+
+// ErrMaxDepthExceeded is returned when computing a permission requires following
+// more relationships than allowed, usually caused by cyclic relationships.
+var ErrMaxDepthExceeded = errors.New("max depth exceeded")
+
+// ObjectRef identifies an object.
+type ObjectRef struct {
+	// Type is the type of the object, as defined in the Schema.
+	Type string
+	// ID is the unique identifier of the object.
+	ID string
+}
+
+// String returns the object in the "type:id" format.
+func (o ObjectRef) String() string {
+	return o.Type + ":" + o.ID
+}
+
+// SubjectRef identifies the subject of a relationship: an object, every object
+// of a type when ID is "*", or the set of subjects that have the given relation
+// with an object.
+type SubjectRef struct {
+	// Object is the subject object.
+	Object ObjectRef
+	// Relation is the optional relation of the subject set.
+	Relation string
+}
+
+// String returns the subject in the "type:id" or "type:id#relation" format.
+func (s SubjectRef) String() string {
+	if len(s.Relation) == 0 {
+		return s.Object.String()
+	}
+	return s.Object.String() + "#" + s.Relation
+}
+
+// Tuple is a relationship between a resource and a subject.
+type Tuple struct {
+	// Resource is the object the relationship is defined on.
+	Resource ObjectRef
+	// Relation is the name of the relation.
+	Relation string
+	// Subject is the subject of the relationship.
+	Subject SubjectRef
+}
+
+// String returns the tuple in the "type:id#relation@subject" format.
+func (t Tuple) String() string {
+	return t.Resource.String() + "#" + t.Relation + "@" + t.Subject.String()
+}
+
+// ParseTuple parses a tuple in the "type:id#relation@subject" format, such as
+// "world:1234#owner@user:alice" or "world:1234#viewer@organization:acme#member".
+func ParseTuple(s string) (Tuple, error) {
+	resource, subject, ok := strings.Cut(strings.TrimSpace(s), "@")
+	if !ok {
+		return Tuple{}, fmt.Errorf("invalid tuple %q: missing subject", s)
+	}
+	object, relation, ok := strings.Cut(resource, "#")
+	if !ok || len(relation) == 0 {
+		return Tuple{}, fmt.Errorf("invalid tuple %q: missing relation", s)
+	}
+	t := Tuple{Relation: relation}
+	var err error
+	if t.Resource, err = parseObjectRef(object); err != nil {
+		return Tuple{}, fmt.Errorf("invalid tuple %q: %w", s, err)
+	}
+	subjectObject, subjectRelation, _ := strings.Cut(subject, "#")
+	if t.Subject.Object, err = parseObjectRef(subjectObject); err != nil {
+		return Tuple{}, fmt.Errorf("invalid tuple %q: %w", s, err)
+	}
+	t.Subject.Relation = subjectRelation
+	return t, nil
+}
+
+// validateTupleRefs checks that the types, IDs and relations of the given tuple
+// can be written in the tuple format and parsed back by ParseTuple.
+func validateTupleRefs(t Tuple) error {
+	for _, v := range []string{t.Resource.Type, t.Resource.ID, t.Relation, t.Subject.Object.Type, t.Subject.Object.ID} {
+		if len(v) == 0 || strings.ContainsAny(v, ":#@") || strings.IndexFunc(v, unicode.IsSpace) >= 0 {
+			return fmt.Errorf("invalid tuple %q: %q must not be empty or contain ':', '#', '@' or spaces", t, v)
+		}
+	}
+	if strings.ContainsAny(t.Subject.Relation, ":#@") || strings.IndexFunc(t.Subject.Relation, unicode.IsSpace) >= 0 {
+		return fmt.Errorf("invalid tuple %q: %q must not contain ':', '#', '@' or spaces", t, t.Subject.Relation)
+	}
+	return nil
+}
+
+// parseObjectRef parses an object in the "type:id" format.
+func parseObjectRef(s string) (ObjectRef, error) {
+	typ, id, ok := strings.Cut(s, ":")
+	if !ok || len(typ) == 0 || len(id) == 0 {
+		return ObjectRef{}, fmt.Errorf("invalid object %q", s)
+	}
+	return ObjectRef{Type: typ, ID: id}, nil
+}
+
+// TupleStore persists the relationships used by a ReBAC engine.
+type TupleStore interface {
+	// Write stores the given tuples. Existing tuples are ignored.
+	Write(ctx context.Context, tuples ...Tuple) error
+	// Delete removes the given tuples. Missing tuples are ignored.
+	Delete(ctx context.Context, tuples ...Tuple) error
+	// Read returns the tuples of the given resource and relation.
+	Read(ctx context.Context, resource ObjectRef, relation string) ([]Tuple, error)
+}
+
+// relationKey identifies the tuples of a resource and relation.
+type relationKey struct {
+	resource ObjectRef
+	relation string
+}
+
+// memoryTupleStore is a TupleStore implementation that keeps tuples in memory.
+type memoryTupleStore struct {
+	mu     sync.RWMutex
+	tuples map[relationKey]map[SubjectRef]struct{}
+}
+
+// Write stores the given tuples.
+func (s *memoryTupleStore) Write(ctx context.Context, tuples ...Tuple) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, t := range tuples {
+		key := relationKey{resource: t.Resource, relation: t.Relation}
+		if s.tuples[key] == nil {
+			s.tuples[key] = make(map[SubjectRef]struct{})
+		}
+		s.tuples[key][t.Subject] = struct{}{}
+	}
+	return nil
+}
+
+// Delete removes the given tuples.
+func (s *memoryTupleStore) Delete(ctx context.Context, tuples ...Tuple) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, t := range tuples {
+		key := relationKey{resource: t.Resource, relation: t.Relation}
+		delete(s.tuples[key], t.Subject)
+		if len(s.tuples[key]) == 0 {
+			delete(s.tuples, key)
+		}
+	}
+	return nil
+}
+
+// Read returns the tuples of the given resource and relation.
+func (s *memoryTupleStore) Read(ctx context.Context, resource ObjectRef, relation string) ([]Tuple, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	subjects := s.tuples[relationKey{resource: resource, relation: relation}]
+	tuples := make([]Tuple, 0, len(subjects))
+	for subject := range subjects {
+		tuples = append(tuples, Tuple{Resource: resource, Relation: relation, Subject: subject})
+	}
+	return tuples, nil
+}
+
+// all returns every tuple in the store sorted by their string representation.
+func (s *memoryTupleStore) all() []Tuple {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var tuples []Tuple
+	for key, subjects := range s.tuples {
+		for subject := range subjects {
+			tuples = append(tuples, Tuple{Resource: key.resource, Relation: key.relation, Subject: subject})
+		}
+	}
+	sort.Slice(tuples, func(i, j int) bool {
+		return tuples[i].String() < tuples[j].String()
+	})
+	return tuples
+}
+
+// NewMemoryTupleStore initializes a new TupleStore that keeps tuples in memory.
+func NewMemoryTupleStore() TupleStore {
+	return newMemoryTupleStore()
+}
+
+// newMemoryTupleStore initializes a new memoryTupleStore.
+func newMemoryTupleStore() *memoryTupleStore {
+	return &memoryTupleStore{
+		tuples: make(map[relationKey]map[SubjectRef]struct{}),
+	}
+}
+
+// fileTupleStore is a TupleStore implementation that keeps tuples in memory and
+// persists them to a file after every change.
+type fileTupleStore struct {
+	*memoryTupleStore
+	// mu serializes changes to the file.
+	mu   sync.Mutex
+	path string
+}
+
+// Write persists the given tuples to the file and stores them. Tuples that can't
+// be read back from the file are rejected.
+func (s *fileTupleStore) Write(ctx context.Context, tuples ...Tuple) error {
+	for _, t := range tuples {
+		if err := validateTupleRefs(t); err != nil {
+			return err
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// The file is saved first, so memory isn't changed if saving fails.
+	if err := s.save(s.apply(tuples, nil)); err != nil {
+		return err
+	}
+	return s.memoryTupleStore.Write(ctx, tuples...)
+}
+
+// Delete persists the removal of the given tuples to the file and removes them.
+func (s *fileTupleStore) Delete(ctx context.Context, tuples ...Tuple) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.save(s.apply(nil, tuples)); err != nil {
+		return err
+	}
+	return s.memoryTupleStore.Delete(ctx, tuples...)
+}
+
+// apply returns every tuple in the store after writing and deleting the given
+// tuples, sorted by their string representation. The store is not changed.
+func (s *fileTupleStore) apply(written []Tuple, deleted []Tuple) []Tuple {
+	set := make(map[Tuple]struct{})
+	for _, t := range s.all() {
+		set[t] = struct{}{}
+	}
+	for _, t := range written {
+		set[t] = struct{}{}
+	}
+	for _, t := range deleted {
+		delete(set, t)
+	}
+	tuples := make([]Tuple, 0, len(set))
+	for t := range set {
+		tuples = append(tuples, t)
+	}
+	sort.Slice(tuples, func(i, j int) bool {
+		return tuples[i].String() < tuples[j].String()
+	})
+	return tuples
+}
+
+// save writes the given tuples to a temporary file and replaces the store file
+// with it.
+func (s *fileTupleStore) save(tuples []Tuple) error {
+	var buf bytes.Buffer
+	for _, t := range tuples {
+		buf.WriteString(t.String())
+		buf.WriteByte('\n')
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
+
+// NewFileTupleStore initializes a new TupleStore that persists tuples to the file
+// located at the given path, one tuple per line. Tuples in the file are loaded
+// into memory, the file is created when the first tuple is written if it doesn't
+// exist. Empty lines and lines starting with "//" are ignored.
+func NewFileTupleStore(path string) (TupleStore, error) {
+	s := &fileTupleStore{
+		memoryTupleStore: newMemoryTupleStore(),
+		path:             path,
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if len(text) == 0 || strings.HasPrefix(text, "//") {
+			continue
+		}
+		t, err := ParseTuple(text)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		if err := s.memoryTupleStore.Write(context.Background(), t); err != nil {
+			return nil, err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// ReBAC is a relationship-based Authorization implementation. Permissions are
+// computed from the relationships stored as tuples, following the rules defined
+// in a Schema.
+type ReBAC interface {
+	Authorization
+	// Write validates the given tuples against the schema and stores them.
+	Write(ctx context.Context, tuples ...Tuple) error
+	// Delete removes the given tuples.
+	Delete(ctx context.Context, tuples ...Tuple) error
+	// CheckPermission returns true if the given subject has the given relation or
+	// permission on the given resource.
+	CheckPermission(ctx context.Context, resource ObjectRef, permission string, subject ObjectRef) (bool, error)
+	// OnWrite registers a hook that is called after tuples are written or deleted,
+	// such as the Invalidate method of a CachedAuthorization.
+	OnWrite(hook WriteHook)
+}
+
+// WriteHook is called after the given tuples are written or deleted.
+type WriteHook func(ctx context.Context, tuples []Tuple)
+
+// ReBACOption configures a ReBAC engine.
+type ReBACOption func(*rebac)
+
+// WithSubjectType sets the object type used to represent principals when
+// checking permissions with Check. Defaults to "user".
+func WithSubjectType(subjectType string) ReBACOption {
+	return func(e *rebac) {
+		e.subjectType = subjectType
+	}
+}
+
+// WithMaxDepth sets the maximum number of relationships followed to compute a
+// permission. Defaults to 50.
+func WithMaxDepth(depth int) ReBACOption {
+	return func(e *rebac) {
+		e.maxDepth = depth
+	}
+}
+
+// rebac is a ReBAC implementation.
+type rebac struct {
+	schema      *Schema
+	store       TupleStore
+	subjectType string
+	maxDepth    int
+	// mu protects hooks.
+	mu    sync.RWMutex
+	hooks []WriteHook
+}
+
+// Check returns nil if the principal has the given permission on the given
+// resource. The principal is represented by an object with the configured
+// subject type and the principal ID.
+func (e *rebac) Check(ctx context.Context, principal *authentication.Principal, permission string, resource Resource) error {
+	if principal == nil {
+		return ErrPrincipalNotProvided
+	}
+	if len(resource.Type) == 0 || len(resource.ID) == 0 {
+		return fmt.Errorf("%w: resource type and id are required, got %q", ErrInvalidResource, resource)
+	}
+	allowed, err := e.CheckPermission(ctx, ObjectRef{Type: resource.Type, ID: resource.ID}, permission, ObjectRef{Type: e.subjectType, ID: principal.ID})
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return newDeniedError(principal, permission, resource, "no relationship grants the permission")
+	}
+	return nil
+}
+
+// BulkCheck checks whether the principal has the given permission on each of the
+// given resources.
+func (e *rebac) BulkCheck(ctx context.Context, principal *authentication.Principal, permission string, resources []Resource) ([]bool, error) {
+	return bulkCheck(ctx, principal, permission, resources, e.Check)
+}
+
+// CheckPermission returns true if the given subject has the given relation or
+// permission on the given resource.
+func (e *rebac) CheckPermission(ctx context.Context, resource ObjectRef, permission string, subject ObjectRef) (bool, error) {
+	def, ok := e.schema.definitions[resource.Type]
+	if !ok {
+		return false, fmt.Errorf("unknown resource type %q", resource.Type)
+	}
+	if !def.has(permission) {
+		return false, fmt.Errorf("%s has no relation or permission %q", resource.Type, permission)
+	}
+	return e.check(ctx, resource, permission, subject, 0)
+}
+
+// check returns true if the subject has the given relation or permission on the
+// given object.
+func (e *rebac) check(ctx context.Context, object ObjectRef, name string, subject ObjectRef, depth int) (bool, error) {
+	if depth > e.maxDepth {
+		return false, ErrMaxDepthExceeded
+	}
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	def, ok := e.schema.definitions[object.Type]
+	if !ok {
+		return false, nil
+	}
+	if r, ok := def.permissions[name]; ok {
+		return r.check(ctx, e, object, subject, depth+1)
+	}
+	if _, ok := def.relations[name]; !ok {
+		return false, nil
+	}
+	tuples, err := e.store.Read(ctx, object, name)
+	if err != nil {
+		return false, err
+	}
+	for _, t := range tuples {
+		s := t.Subject
+		if len(s.Relation) == 0 {
+			if s.Object == subject || (s.Object.Type == subject.Type && s.Object.ID == "*") {
+				return true, nil
+			}
+			continue
+		}
+		ok, err := e.check(ctx, s.Object, s.Relation, subject, depth+1)
+		if err != nil || ok {
+			return ok, err
+		}
+	}
+	return false, nil
+}
+
+func (r computedRewrite) check(ctx context.Context, e *rebac, object ObjectRef, subject ObjectRef, depth int) (bool, error) {
+	return e.check(ctx, object, r.name, subject, depth)
+}
+
+func (r arrowRewrite) check(ctx context.Context, e *rebac, object ObjectRef, subject ObjectRef, depth int) (bool, error) {
+	tuples, err := e.store.Read(ctx, object, r.tupleset)
+	if err != nil {
+		return false, err
+	}
+	for _, t := range tuples {
+		ok, err := e.check(ctx, t.Subject.Object, r.computed, subject, depth)
+		if err != nil || ok {
+			return ok, err
+		}
+	}
+	return false, nil
+}
+
+func (r setRewrite) check(ctx context.Context, e *rebac, object ObjectRef, subject ObjectRef, depth int) (bool, error) {
+	left, err := r.left.check(ctx, e, object, subject, depth)
+	if err != nil {
+		return false, err
+	}
+	switch r.op {
+	case '+':
+		if left {
+			return true, nil
+		}
+	case '&', '-':
+		if !left {
+			return false, nil
+		}
+	}
+	right, err := r.right.check(ctx, e, object, subject, depth)
+	if err != nil {
+		return false, err
+	}
+	if r.op == '-' {
+		return !right, nil
+	}
+	return right, nil
+}
+
+// Write validates the given tuples against the schema and stores them.
+func (e *rebac) Write(ctx context.Context, tuples ...Tuple) error {
+	for _, t := range tuples {
+		if err := e.validateTuple(t); err != nil {
+			return err
+		}
+	}
+	if err := e.store.Write(ctx, tuples...); err != nil {
+		return err
+	}
+	e.notify(ctx, tuples)
+	return nil
+}
+
+// Delete removes the given tuples.
+func (e *rebac) Delete(ctx context.Context, tuples ...Tuple) error {
+	if err := e.store.Delete(ctx, tuples...); err != nil {
+		return err
+	}
+	e.notify(ctx, tuples)
+	return nil
+}
+
+// OnWrite registers a hook that is called after tuples are written or deleted.
+func (e *rebac) OnWrite(hook WriteHook) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.hooks = append(e.hooks, hook)
+}
+
+// notify calls the registered hooks with the given tuples.
+func (e *rebac) notify(ctx context.Context, tuples []Tuple) {
+	e.mu.RLock()
+	hooks := e.hooks
+	e.mu.RUnlock()
+	for _, hook := range hooks {
+		hook(ctx, tuples)
+	}
+}
+
+// validateTuple checks that the given tuple is well formed and allowed by the
+// schema.
+func (e *rebac) validateTuple(t Tuple) error {
+	if err := validateTupleRefs(t); err != nil {
+		return err
+	}
+	def, ok := e.schema.definitions[t.Resource.Type]
+	if !ok {
+		return fmt.Errorf("invalid tuple %q: unknown resource type %q", t, t.Resource.Type)
+	}
+	if _, ok := def.relations[t.Relation]; !ok {
+		return fmt.Errorf("invalid tuple %q: %s has no relation %q", t, t.Resource.Type, t.Relation)
+	}
+	if !e.schema.allows(def, t.Relation, t.Subject) {
+		return fmt.Errorf("invalid tuple %q: subject type is not allowed by %s#%s", t, t.Resource.Type, t.Relation)
+	}
+	return nil
+}
+
+// NewReBAC initializes a new ReBAC engine that computes permissions using the
+// given schema and the relationships stored in the given TupleStore.
+//
+//	schema, err := LoadSchema("schema.zed")
+//	store, err := NewFileTupleStore("tuples.txt")
+//	authz := NewReBAC(schema, store)
+//	err = authz.Write(ctx, Tuple{
+//		Resource: ObjectRef{Type: "world", ID: "1234"},
+//		Relation: "owner",
+//		Subject:  SubjectRef{Object: ObjectRef{Type: "user", ID: "alice"}},
+//	})
+func NewReBAC(schema *Schema, store TupleStore, opts ...ReBACOption) ReBAC {
+	e := &rebac{
+		schema:      schema,
+		store:       store,
+		subjectType: "user",
+		maxDepth:    50,
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	return e
+}
@@ -0,0 +1,436 @@
+package authorization
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// Schema defines the object types, relations and permissions used by a ReBAC
+// engine. Schemas are written in a subset of the SpiceDB schema language:
+//
+//	definition user {}
+//
+//	definition organization {
+//		relation admin: user
+//		relation member: user
+//	}
+//
+//	definition world {
+//		relation org: organization
+//		relation owner: user
+//		relation viewer: user | user:* | organization#member
+//		relation banned: user
+//
+//		permission edit = owner + org->admin
+//		permission view = (edit + viewer + org->member) - banned
+//	}
+//
+// Relations list the subject types they accept: objects of a type (user),
+// every object of a type (user:*) or the subjects that have a relation with
+// another object (organization#member). Permissions are computed from
+// relations and other permissions using unions (+), intersections (&),
+// exclusions (-) and arrows (org->admin), which follow the objects of a
+// relation and check a relation or permission on them. Operators have the same
+// precedence and are evaluated from left to right, use parentheses to group
+// them.
+type Schema struct {
+	definitions map[string]*definition
+}
+
+// definition is an object type defined in a Schema.
+type definition struct {
+	name        string
+	relations   map[string][]subjectType
+	permissions map[string]rewrite
+}
+
+// subjectType is a subject type accepted by a relation.
+type subjectType struct {
+	typ      string
+	relation string
+	wildcard bool
+}
+
+// String returns the subject type in the schema format.
+func (s subjectType) String() string {
+	switch {
+	case s.wildcard:
+		return s.typ + ":*"
+	case len(s.relation) > 0:
+		return s.typ + "#" + s.relation
+	}
+	return s.typ
+}
+
+// rewrite is a permission expression.
+type rewrite interface {
+	// check returns true if the subject has the permission on the given object.
+	check(ctx context.Context, e *rebac, object ObjectRef, subject ObjectRef, depth int) (bool, error)
+	// validate checks that the expression only references existing relations.
+	validate(s *Schema, def *definition) error
+}
+
+// computedRewrite references a relation or permission of the same object.
+type computedRewrite struct {
+	name string
+}
+
+// arrowRewrite follows the objects related through tupleset, and checks the
+// computed relation or permission on them.
+type arrowRewrite struct {
+	tupleset string
+	computed string
+}
+
+// setRewrite combines two expressions using the given operator.
+type setRewrite struct {
+	op          byte
+	left, right rewrite
+}
+
+func (r computedRewrite) validate(s *Schema, def *definition) error {
+	if !def.has(r.name) {
+		return fmt.Errorf("%s: unknown relation or permission %q", def.name, r.name)
+	}
+	return nil
+}
+
+func (r arrowRewrite) validate(s *Schema, def *definition) error {
+	types, ok := def.relations[r.tupleset]
+	if !ok {
+		return fmt.Errorf("%s: arrow %s->%s must start with a relation", def.name, r.tupleset, r.computed)
+	}
+	// Relations accepting several types can be followed as long as one of them
+	// defines the computed relation or permission, like in SpiceDB.
+	for _, t := range types {
+		if target, ok := s.definitions[t.typ]; ok && target.has(r.computed) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s: arrow %s->%s: unknown relation or permission %q on the types of %s", def.name, r.tupleset, r.computed, r.computed, r.tupleset)
+}
+
+func (r setRewrite) validate(s *Schema, def *definition) error {
+	if err := r.left.validate(s, def); err != nil {
+		return err
+	}
+	return r.right.validate(s, def)
+}
+
+// has returns true if the definition contains a relation or permission with the
+// given name.
+func (d *definition) has(name string) bool {
+	_, isRelation := d.relations[name]
+	_, isPermission := d.permissions[name]
+	return isRelation || isPermission
+}
+
+// ParseSchema parses the given schema.
+func ParseSchema(schema string) (*Schema, error) {
+	tokens, err := tokenizeSchema(schema)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse schema: %w", err)
+	}
+	p := &schemaParser{tokens: tokens}
+	s, err := p.parse()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse schema: %w", err)
+	}
+	if err := s.validate(); err != nil {
+		return nil, fmt.Errorf("invalid schema: %w", err)
+	}
+	return s, nil
+}
+
+// LoadSchema reads the schema file located at the given path.
+func LoadSchema(path string) (*Schema, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseSchema(string(data))
+}
+
+// validate checks that the relations and permissions of the schema only reference
+// existing types, relations and permissions.
+func (s *Schema) validate() error {
+	for _, def := range s.definitions {
+		for name, types := range def.relations {
+			for _, t := range types {
+				target, ok := s.definitions[t.typ]
+				if !ok {
+					return fmt.Errorf("%s#%s: unknown type %q", def.name, name, t.typ)
+				}
+				if len(t.relation) > 0 && !target.has(t.relation) {
+					return fmt.Errorf("%s#%s: unknown relation %q", def.name, name, t.String())
+				}
+			}
+		}
+		for _, r := range def.permissions {
+			if err := r.validate(s, def); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// allows returns true if the given relation accepts the given subject.
+func (s *Schema) allows(def *definition, relation string, subject SubjectRef) bool {
+	for _, t := range def.relations[relation] {
+		if t.typ != subject.Object.Type || t.relation != subject.Relation {
+			continue
+		}
+		if t.wildcard == (subject.Object.ID == "*") {
+			return true
+		}
+	}
+	return false
+}
+
+// schemaToken is a token of the schema language.
+type schemaToken struct {
+	value string
+	line  int
+}
+
+// tokenizeSchema splits the given schema into tokens. Comments starting with "//"
+// are ignored.
+func tokenizeSchema(schema string) ([]schemaToken, error) {
+	var tokens []schemaToken
+	for i, line := range strings.Split(schema, "\n") {
+		if c := strings.Index(line, "//"); c >= 0 {
+			line = line[:c]
+		}
+		runes := []rune(line)
+		for j := 0; j < len(runes); {
+			r := runes[j]
+			switch {
+			case unicode.IsSpace(r):
+				j++
+			case r == '-' && j+1 < len(runes) && runes[j+1] == '>':
+				tokens = append(tokens, schemaToken{value: "->", line: i + 1})
+				j += 2
+			case strings.ContainsRune("{}:|#=+&-()*", r):
+				tokens = append(tokens, schemaToken{value: string(r), line: i + 1})
+				j++
+			case isIdentifierRune(r):
+				start := j
+				for j < len(runes) && isIdentifierRune(runes[j]) {
+					j++
+				}
+				tokens = append(tokens, schemaToken{value: string(runes[start:j]), line: i + 1})
+			default:
+				return nil, fmt.Errorf("line %d: unexpected character %q", i+1, r)
+			}
+		}
+	}
+	return tokens, nil
+}
+
+// isIdentifierRune returns true if r can be part of an identifier.
+func isIdentifierRune(r rune) bool {
+	return r == '_' || r == '/' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// isIdentifier returns true if the given token is an identifier.
+func isIdentifier(value string) bool {
+	for _, r := range value {
+		if !isIdentifierRune(r) {
+			return false
+		}
+	}
+	return len(value) > 0
+}
+
+// schemaParser is a recursive descent parser for the schema language.
+type schemaParser struct {
+	tokens []schemaToken
+	pos    int
+}
+
+// peek returns the next token without consuming it.
+func (p *schemaParser) peek() string {
+	if p.pos >= len(p.tokens) {
+		return ""
+	}
+	return p.tokens[p.pos].value
+}
+
+// next consumes and returns the next token.
+func (p *schemaParser) next() string {
+	v := p.peek()
+	p.pos++
+	return v
+}
+
+// errorf returns a parsing error for the current token.
+func (p *schemaParser) errorf(format string, args ...any) error {
+	if p.pos >= len(p.tokens) {
+		return fmt.Errorf("unexpected end of schema: "+format, args...)
+	}
+	return fmt.Errorf("line %d: "+format, append([]any{p.tokens[p.pos].line}, args...)...)
+}
+
+// expect consumes the next token and checks that it matches value.
+func (p *schemaParser) expect(value string) error {
+	if p.peek() != value {
+		return p.errorf("expected %q, got %q", value, p.peek())
+	}
+	p.next()
+	return nil
+}
+
+// identifier consumes the next token and checks that it's an identifier.
+func (p *schemaParser) identifier() (string, error) {
+	if !isIdentifier(p.peek()) {
+		return "", p.errorf("expected identifier, got %q", p.peek())
+	}
+	return p.next(), nil
+}
+
+func (p *schemaParser) parse() (*Schema, error) {
+	s := &Schema{definitions: make(map[string]*definition)}
+	for p.pos < len(p.tokens) {
+		def, err := p.parseDefinition()
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := s.definitions[def.name]; ok {
+			return nil, fmt.Errorf("definition %q is defined more than once", def.name)
+		}
+		s.definitions[def.name] = def
+	}
+	return s, nil
+}
+
+func (p *schemaParser) parseDefinition() (*definition, error) {
+	if err := p.expect("definition"); err != nil {
+		return nil, err
+	}
+	name, err := p.identifier()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	def := &definition{
+		name:        name,
+		relations:   make(map[string][]subjectType),
+		permissions: make(map[string]rewrite),
+	}
+	for p.peek() != "}" {
+		keyword := p.next()
+		if keyword != "relation" && keyword != "permission" {
+			p.pos--
+			return nil, p.errorf("expected relation or permission, got %q", keyword)
+		}
+		member, err := p.identifier()
+		if err != nil {
+			return nil, err
+		}
+		if def.has(member) {
+			return nil, fmt.Errorf("%s: %q is defined more than once", name, member)
+		}
+		if keyword == "relation" {
+			types, err := p.parseSubjectTypes()
+			if err != nil {
+				return nil, err
+			}
+			def.relations[member] = types
+			continue
+		}
+		if err := p.expect("="); err != nil {
+			return nil, err
+		}
+		r, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+		def.permissions[member] = r
+	}
+	p.next()
+	return def, nil
+}
+
+func (p *schemaParser) parseSubjectTypes() ([]subjectType, error) {
+	if err := p.expect(":"); err != nil {
+		return nil, err
+	}
+	var types []subjectType
+	for {
+		typ, err := p.identifier()
+		if err != nil {
+			return nil, err
+		}
+		t := subjectType{typ: typ}
+		switch p.peek() {
+		case "#":
+			p.next()
+			if t.relation, err = p.identifier(); err != nil {
+				return nil, err
+			}
+		case ":":
+			p.next()
+			if err := p.expect("*"); err != nil {
+				return nil, err
+			}
+			t.wildcard = true
+		}
+		types = append(types, t)
+		if p.peek() != "|" {
+			return types, nil
+		}
+		p.next()
+	}
+}
+
+func (p *schemaParser) parseExpression() (rewrite, error) {
+	left, err := p.parseTerm()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := p.peek()
+		if op != "+" && op != "&" && op != "-" {
+			return left, nil
+		}
+		p.next()
+		right, err := p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		left = setRewrite{op: op[0], left: left, right: right}
+	}
+}
+
+func (p *schemaParser) parseTerm() (rewrite, error) {
+	if p.peek() == "(" {
+		p.next()
+		r, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		return r, nil
+	}
+	name, err := p.identifier()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek() != "->" {
+		return computedRewrite{name: name}, nil
+	}
+	p.next()
+	computed, err := p.identifier()
+	if err != nil {
+		return nil, err
+	}
+	return arrowRewrite{tupleset: name, computed: computed}, nil
+}
@@ -0,0 +1,65 @@
+package authorization
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadSchema(t *testing.T) {
+	schema, err := LoadSchema("testdata/schema.zed")
+	require.NoError(t, err)
+	require.Len(t, schema.definitions, 3)
+
+	world := schema.definitions["world"]
+	require.NotNil(t, world)
+	assert.Equal(t, []subjectType{
+		{typ: "user"},
+		{typ: "user", wildcard: true},
+		{typ: "organization", relation: "member"},
+	}, world.relations["viewer"])
+	assert.Equal(t, setRewrite{
+		op:    '+',
+		left:  computedRewrite{name: "owner"},
+		right: arrowRewrite{tupleset: "org", computed: "admin"},
+	}, world.permissions["edit"])
+	assert.Equal(t, setRewrite{
+		op: '-',
+		left: setRewrite{
+			op:    '+',
+			left:  setRewrite{op: '+', left: computedRewrite{name: "edit"}, right: computedRewrite{name: "viewer"}},
+			right: arrowRewrite{tupleset: "org", computed: "member"},
+		},
+		right: computedRewrite{name: "banned"},
+	}, world.permissions["view"])
+
+	_, err = LoadSchema("testdata/missing.zed")
+	assert.Error(t, err)
+}
+
+func TestParseSchema_Errors(t *testing.T) {
+	testCases := []struct {
+		name   string
+		schema string
+	}{
+		{name: "unexpected character", schema: "definition user { relation a: user! }"},
+		{name: "missing brace", schema: "definition user {"},
+		{name: "unknown keyword", schema: "definition user { attribute a: user }"},
+		{name: "duplicated definition", schema: "definition user {}\ndefinition user {}"},
+		{name: "duplicated member", schema: "definition user { relation a: user\n permission a = a }"},
+		{name: "unknown type", schema: "definition world { relation owner: user }"},
+		{name: "unknown subject relation", schema: "definition user {}\ndefinition team { relation member: team#admin }"},
+		{name: "unknown relation", schema: "definition user {}\ndefinition world { relation owner: user\n permission edit = writer }"},
+		{name: "arrow from permission", schema: "definition user { relation a: user\n permission b = a\n permission c = b->a }"},
+		{name: "arrow to unknown relation", schema: "definition user {}\ndefinition team { relation member: user }\ndefinition world { relation team: team\n permission view = team->members }"},
+		{name: "unclosed parenthesis", schema: "definition user { relation a: user\n permission b = (a + a }"},
+		{name: "missing operand", schema: "definition user { relation a: user\n permission b = a + }"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := ParseSchema(tc.schema)
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,214 @@
+package authorization
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gazebo-web/auth/pkg/authentication"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"google.golang.org/grpc/codes"
+)
+
+type rebacTestSuite struct {
+	suite.Suite
+	authz ReBAC
+}
+
+func TestReBACTestSuite(t *testing.T) {
+	suite.Run(t, new(rebacTestSuite))
+}
+
+func (suite *rebacTestSuite) SetupTest() {
+	schema, err := LoadSchema("testdata/schema.zed")
+	suite.Require().NoError(err)
+	store, err := NewFileTupleStore("testdata/tuples.txt")
+	suite.Require().NoError(err)
+	suite.authz = NewReBAC(schema, NewMemoryTupleStore())
+	suite.Require().NoError(suite.authz.Write(context.Background(), store.(*fileTupleStore).all()...))
+}
+
+func (suite *rebacTestSuite) check(permission, user string) bool {
+	ok, err := suite.authz.CheckPermission(context.Background(), ObjectRef{Type: "world", ID: "shapes"}, permission, ObjectRef{Type: "user", ID: user})
+	suite.Require().NoError(err)
+	return ok
+}
+
+func (suite *rebacTestSuite) TestUnionAndArrow() {
+	suite.True(suite.check("edit", "carol"))
+	suite.True(suite.check("edit", "alice"))
+	suite.False(suite.check("edit", "bob"))
+	suite.False(suite.check("edit", "dave"))
+}
+
+func (suite *rebacTestSuite) TestExclusion() {
+	suite.True(suite.check("view", "alice"))
+	suite.True(suite.check("view", "carol"))
+	suite.False(suite.check("view", "bob"))
+	suite.False(suite.check("view", "dave"))
+}
+
+func (suite *rebacTestSuite) TestIntersection() {
+	// alice is a member of the organization through the admin subject set.
+	suite.True(suite.check("manage", "alice"))
+	suite.False(suite.check("manage", "carol"))
+}
+
+func (suite *rebacTestSuite) TestWildcard() {
+	ctx := context.Background()
+	suite.Require().NoError(suite.authz.Write(ctx, mustParseTuple(suite.T(), "world:shapes#viewer@user:*")))
+	suite.True(suite.check("view", "dave"))
+	suite.False(suite.check("view", "bob"))
+
+	suite.Require().NoError(suite.authz.Delete(ctx, mustParseTuple(suite.T(), "world:shapes#viewer@user:*")))
+	suite.False(suite.check("view", "dave"))
+}
+
+func (suite *rebacTestSuite) TestCheck() {
+	ctx := context.Background()
+	world := Resource{Type: "world", ID: "shapes"}
+	suite.NoError(suite.authz.Check(ctx, &authentication.Principal{ID: "carol"}, "edit", world))
+
+	err := suite.authz.Check(ctx, &authentication.Principal{ID: "bob"}, "edit", world)
+	suite.ErrorIs(err, ErrPermissionDenied)
+	var denied *DeniedError
+	suite.Require().ErrorAs(err, &denied)
+	suite.Equal("edit", denied.Permission)
+
+	suite.ErrorIs(suite.authz.Check(ctx, nil, "edit", world), ErrPrincipalNotProvided)
+
+	err = suite.authz.Check(ctx, &authentication.Principal{ID: "carol"}, "delete", world)
+	suite.Error(err)
+	suite.NotErrorIs(err, ErrPermissionDenied)
+
+	err = suite.authz.Check(ctx, &authentication.Principal{ID: "carol"}, "edit", Resource{Type: "robot", ID: "1"})
+	suite.Error(err)
+
+	err = suite.authz.Check(ctx, &authentication.Principal{ID: "carol"}, "edit", Resource{Type: "world"})
+	suite.ErrorIs(err, ErrInvalidResource)
+	suite.Equal(http.StatusBadRequest, HTTPStatusCode(err))
+	suite.Equal(codes.InvalidArgument, GRPCStatusCode(err))
+}
+
+func (suite *rebacTestSuite) TestBulkCheck() {
+	ctx := context.Background()
+	suite.Require().NoError(suite.authz.Write(ctx, mustParseTuple(suite.T(), "world:cubes#owner@user:bob")))
+	worlds := []Resource{{Type: "world", ID: "shapes"}, {Type: "world", ID: "cubes"}}
+
+	results, err := suite.authz.BulkCheck(ctx, &authentication.Principal{ID: "bob"}, "edit", worlds)
+	suite.Require().NoError(err)
+	suite.Equal([]bool{false, true}, results)
+
+	_, err = suite.authz.BulkCheck(ctx, &authentication.Principal{ID: "bob"}, "delete", worlds)
+	suite.Error(err)
+}
+
+func (suite *rebacTestSuite) TestWrite_Validation() {
+	ctx := context.Background()
+	for _, tuple := range []string{
+		"robot:1#owner@user:alice",
+		"world:shapes#edit@user:alice",
+		"world:shapes#owner@organization:openrobotics",
+		"world:shapes#owner@user:*",
+		"world:shapes#viewer@organization:openrobotics#admin",
+	} {
+		suite.Error(suite.authz.Write(ctx, mustParseTuple(suite.T(), tuple)), tuple)
+	}
+	suite.NoError(suite.authz.Write(ctx, mustParseTuple(suite.T(), "world:shapes#viewer@organization:openrobotics#member")))
+}
+
+func (suite *rebacTestSuite) TestMaxDepth() {
+	schema, err := ParseSchema("definition user {}\ndefinition group { relation member: user | group#member }")
+	suite.Require().NoError(err)
+	authz := NewReBAC(schema, NewMemoryTupleStore(), WithMaxDepth(5))
+	ctx := context.Background()
+	suite.Require().NoError(authz.Write(ctx,
+		mustParseTuple(suite.T(), "group:a#member@group:b#member"),
+		mustParseTuple(suite.T(), "group:b#member@group:a#member"),
+	))
+	_, err = authz.CheckPermission(ctx, ObjectRef{Type: "group", ID: "a"}, "member", ObjectRef{Type: "user", ID: "alice"})
+	suite.ErrorIs(err, ErrMaxDepthExceeded)
+}
+
+func (suite *rebacTestSuite) TestWrite_InvalidID() {
+	for _, id := range []string{"", "a:b", "a#b", "a@b", "a b"} {
+		err := suite.authz.Write(context.Background(), Tuple{
+			Resource: ObjectRef{Type: "world", ID: id},
+			Relation: "owner",
+			Subject:  SubjectRef{Object: ObjectRef{Type: "user", ID: "alice"}},
+		})
+		suite.Error(err, id)
+	}
+}
+
+func TestParseTuple(t *testing.T) {
+	tuple, err := ParseTuple("world:1234#viewer@organization:acme#member")
+	require.NoError(t, err)
+	assert.Equal(t, Tuple{
+		Resource: ObjectRef{Type: "world", ID: "1234"},
+		Relation: "viewer",
+		Subject:  SubjectRef{Object: ObjectRef{Type: "organization", ID: "acme"}, Relation: "member"},
+	}, tuple)
+	assert.Equal(t, "world:1234#viewer@organization:acme#member", tuple.String())
+
+	for _, s := range []string{"world:1234#viewer", "world:1234@user:alice", "world#viewer@user:alice", "world:1234#viewer@user"} {
+		_, err := ParseTuple(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestFileTupleStore(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "tuples.txt")
+	store, err := NewFileTupleStore(path)
+	require.NoError(t, err)
+
+	alice := mustParseTuple(t, "world:1#owner@user:alice")
+	bob := mustParseTuple(t, "world:1#owner@user:bob")
+	require.NoError(t, store.Write(ctx, alice, bob))
+	require.NoError(t, store.Delete(ctx, bob))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "world:1#owner@user:alice\n", string(data))
+
+	reloaded, err := NewFileTupleStore(path)
+	require.NoError(t, err)
+	tuples, err := reloaded.Read(ctx, ObjectRef{Type: "world", ID: "1"}, "owner")
+	require.NoError(t, err)
+	assert.Equal(t, []Tuple{alice}, tuples)
+
+	require.NoError(t, os.WriteFile(path, []byte("invalid\n"), 0o600))
+	_, err = NewFileTupleStore(path)
+	assert.Error(t, err)
+}
+
+func TestFileTupleStore_SaveFailure(t *testing.T) {
+	ctx := context.Background()
+	dir := filepath.Join(t.TempDir(), "tuples")
+	require.NoError(t, os.Mkdir(dir, 0o700))
+	store, err := NewFileTupleStore(filepath.Join(dir, "tuples.txt"))
+	require.NoError(t, err)
+
+	alice := mustParseTuple(t, "world:1#owner@user:alice")
+	require.NoError(t, store.Write(ctx, alice))
+
+	// Saving fails once the directory is gone, the tuples in memory must not change.
+	require.NoError(t, os.RemoveAll(dir))
+	assert.Error(t, store.Write(ctx, mustParseTuple(t, "world:1#owner@user:bob")))
+	assert.Error(t, store.Delete(ctx, alice))
+
+	tuples, err := store.Read(ctx, ObjectRef{Type: "world", ID: "1"}, "owner")
+	require.NoError(t, err)
+	assert.Equal(t, []Tuple{alice}, tuples)
+}
+
+func mustParseTuple(t *testing.T, s string) Tuple {
+	tuple, err := ParseTuple(s)
+	require.NoError(t, err)
+	return tuple
+}
@@ -0,0 +1,146 @@
+package oauth
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// ClientCredentialsConfig contains the configuration of the client credentials
+// grant, as defined in RFC 6749 Section 4.4.
+type ClientCredentialsConfig struct {
+	// TokenURL is the URL of the token endpoint, such as
+	// https://gazebo.us.auth0.com/oauth/token or
+	// https://keycloak.gazebosim.org/realms/gazebo/protocol/openid-connect/token.
+	TokenURL string
+	// ClientID is the identifier of the client.
+	ClientID string
+	// ClientSecret is the secret of the client.
+	ClientSecret string
+	// Scopes contains the scopes requested for the tokens.
+	Scopes []string
+	// Audience is the identifier of the API the tokens are requested for. It's
+	// required by Auth0.
+	Audience string
+	// EndpointParams contains additional parameters sent to the token endpoint.
+	EndpointParams url.Values
+	// AuthStyle defines how the client credentials are sent. Defaults to
+	// AuthStyleHeader.
+	AuthStyle AuthStyle
+}
+
+// form returns the body of the token request.
+func (cfg ClientCredentialsConfig) form() url.Values {
+	form := url.Values{}
+	for k, v := range cfg.EndpointParams {
+		form[k] = append([]string(nil), v...)
+	}
+	form.Set("grant_type", "client_credentials")
+	if len(cfg.Scopes) > 0 {
+		form.Set("scope", strings.Join(cfg.Scopes, " "))
+	}
+	if len(cfg.Audience) > 0 {
+		form.Set("audience", cfg.Audience)
+	}
+	return form
+}
+
+// expiryDelta is the time before expiring when cached tokens are no longer used,
+// accounting for the latency of the requests that use them.
+const expiryDelta = 10 * time.Second
+
+// backgroundRefreshInterval is the minimum time between background refreshes.
+const backgroundRefreshInterval = 5 * time.Second
+
+// clientCredentials is a TokenSource implementation using the client
+// credentials grant.
+type clientCredentials struct {
+	options
+	cfg ClientCredentialsConfig
+
+	mu    sync.Mutex
+	token *Token
+	// nextRefresh is the earliest time when the next background refresh can
+	// start, preventing failed refreshes from being retried on every call.
+	nextRefresh time.Time
+	group       singleflight.Group
+}
+
+// Token returns the cached token if it's still valid, or requests a new one.
+// Tokens about to expire are refreshed in the background. Concurrent requests
+// for a new token are deduplicated.
+func (s *clientCredentials) Token(ctx context.Context) (*Token, error) {
+	now := s.now()
+	s.mu.Lock()
+	token := s.token
+	background := token != nil && !token.ExpiresAt.IsZero() &&
+		!now.Before(token.ExpiresAt.Add(-s.refreshBefore)) && !now.Before(s.nextRefresh)
+	if background {
+		s.nextRefresh = now.Add(backgroundRefreshInterval)
+	}
+	s.mu.Unlock()
+
+	if token != nil && !token.Expired(now.Add(expiryDelta)) {
+		if background {
+			// The refresh uses its own context, it must not be canceled when the
+			// request that triggered it completes.
+			go func() {
+				_, _, _ = s.group.Do("token", func() (any, error) {
+					return s.refresh(context.WithoutCancel(ctx))
+				})
+			}()
+		}
+		return token, nil
+	}
+
+	ch := s.group.DoChan("token", func() (any, error) {
+		return s.refresh(context.WithoutCancel(ctx))
+	})
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case res := <-ch:
+		if res.Err != nil {
+			return nil, res.Err
+		}
+		return res.Val.(*Token), nil
+	}
+}
+
+// refresh requests a new token and caches it.
+func (s *clientCredentials) refresh(ctx context.Context) (*Token, error) {
+	form, header := s.cfg.form(), http.Header{}
+	authenticateClient(form, header, s.cfg.ClientID, s.cfg.ClientSecret, s.cfg.AuthStyle)
+	token, _, err := s.requestToken(ctx, s.cfg.TokenURL, form, header)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	s.token = token
+	s.mu.Unlock()
+	return token, nil
+}
+
+// NewClientCredentials initializes a new TokenSource that obtains tokens using
+// the client credentials grant. Tokens are cached until they are about to
+// expire.
+//
+//	source := NewClientCredentials(ClientCredentialsConfig{
+//		TokenURL:     "https://gazebo.us.auth0.com/oauth/token",
+//		ClientID:     clientID,
+//		ClientSecret: clientSecret,
+//		Audience:     "https://api.gazebosim.org",
+//		AuthStyle:    AuthStyleParams,
+//	})
+//	client := &http.Client{Transport: NewTransport(source, nil)}
+func NewClientCredentials(cfg ClientCredentialsConfig, opts ...Option) TokenSource {
+	return &clientCredentials{
+		options: newOptions(opts),
+		cfg:     cfg,
+	}
+}
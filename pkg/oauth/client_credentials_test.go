@@ -0,0 +1,187 @@
+package oauth
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientCredentials_Request(t *testing.T) {
+	server := newTestTokenServer(t)
+	server.handle = func(w http.ResponseWriter, r *http.Request) {
+		id, secret, ok := r.BasicAuth()
+		require.True(t, ok)
+		assert.Equal(t, "worker%3A1", id)
+		assert.Equal(t, "s3cr3t", secret)
+		assert.Equal(t, "client_credentials", r.PostForm.Get("grant_type"))
+		assert.Equal(t, "worlds.read worlds.write", r.PostForm.Get("scope"))
+		assert.Equal(t, "https://api.gazebosim.org", r.PostForm.Get("audience"))
+		assert.Equal(t, "gazebo", r.PostForm.Get("organization"))
+		assert.Empty(t, r.PostForm.Get("client_secret"))
+		writeTestToken(w, "token", 3600)
+	}
+
+	source := NewClientCredentials(ClientCredentialsConfig{
+		TokenURL:       server.URL,
+		ClientID:       "worker:1",
+		ClientSecret:   "s3cr3t",
+		Scopes:         []string{"worlds.read", "worlds.write"},
+		Audience:       "https://api.gazebosim.org",
+		EndpointParams: url.Values{"organization": {"gazebo"}},
+	})
+	token, err := source.Token(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "token", token.AccessToken)
+}
+
+func TestClientCredentials_AuthStyleParams(t *testing.T) {
+	server := newTestTokenServer(t)
+	server.handle = func(w http.ResponseWriter, r *http.Request) {
+		_, _, ok := r.BasicAuth()
+		assert.False(t, ok)
+		assert.Equal(t, "worker", r.PostForm.Get("client_id"))
+		assert.Equal(t, "s3cr3t", r.PostForm.Get("client_secret"))
+		writeTestToken(w, "token", 3600)
+	}
+
+	source := NewClientCredentials(ClientCredentialsConfig{
+		TokenURL:     server.URL,
+		ClientID:     "worker",
+		ClientSecret: "s3cr3t",
+		AuthStyle:    AuthStyleParams,
+	})
+	_, err := source.Token(context.Background())
+	require.NoError(t, err)
+}
+
+func TestClientCredentials_Cache(t *testing.T) {
+	server := newTestTokenServer(t)
+	now := time.Now()
+	source := NewClientCredentials(ClientCredentialsConfig{TokenURL: server.URL}).(*clientCredentials)
+	source.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		_, err := source.Token(ctx)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, int32(1), server.requests.Load())
+
+	// Expired tokens are refreshed synchronously.
+	now = now.Add(time.Hour)
+	_, err := source.Token(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), server.requests.Load())
+}
+
+func TestClientCredentials_BackgroundRefresh(t *testing.T) {
+	server := newTestTokenServer(t)
+	var mu sync.Mutex
+	issued := 0
+	server.handle = func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		issued++
+		token := "token-" + string(rune('0'+issued))
+		mu.Unlock()
+		writeTestToken(w, token, 3600)
+	}
+
+	var nowMu sync.Mutex
+	now := time.Now()
+	source := NewClientCredentials(ClientCredentialsConfig{TokenURL: server.URL}, WithRefreshBefore(5*time.Minute)).(*clientCredentials)
+	source.now = func() time.Time {
+		nowMu.Lock()
+		defer nowMu.Unlock()
+		return now
+	}
+	ctx := context.Background()
+
+	token, err := source.Token(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "token-1", token.AccessToken)
+
+	// Tokens about to expire are still returned while a new one is requested.
+	nowMu.Lock()
+	now = now.Add(57 * time.Minute)
+	nowMu.Unlock()
+	token, err = source.Token(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "token-1", token.AccessToken)
+
+	assert.Eventually(t, func() bool {
+		token, err := source.Token(ctx)
+		return err == nil && token.AccessToken == "token-2"
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, int32(2), server.requests.Load())
+}
+
+func TestClientCredentials_ConcurrentRefresh(t *testing.T) {
+	server := newTestTokenServer(t)
+	release := make(chan struct{})
+	server.handle = func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		writeTestToken(w, "token", 3600)
+	}
+	source := NewClientCredentials(ClientCredentialsConfig{TokenURL: server.URL})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			token, err := source.Token(context.Background())
+			assert.NoError(t, err)
+			assert.Equal(t, "token", token.AccessToken)
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	assert.Equal(t, int32(1), server.requests.Load())
+}
+
+func TestClientCredentials_ContextCanceled(t *testing.T) {
+	server := newTestTokenServer(t)
+	release := make(chan struct{})
+	server.handle = func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		writeTestToken(w, "token", 3600)
+	}
+	source := NewClientCredentials(ClientCredentialsConfig{TokenURL: server.URL})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := source.Token(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// The refresh started by the canceled request completes and is cached.
+	close(release)
+	assert.Eventually(t, func() bool {
+		_, err := source.Token(context.Background())
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, int32(1), server.requests.Load())
+}
+
+func TestClientCredentials_Error(t *testing.T) {
+	server := newTestTokenServer(t)
+	server.handle = func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte(`{"error":"invalid_client"}`))
+	}
+	source := NewClientCredentials(ClientCredentialsConfig{TokenURL: server.URL})
+
+	_, err := source.Token(context.Background())
+	assert.ErrorIs(t, err, ErrTokenRequestFailed)
+
+	// Failures are not cached.
+	_, err = source.Token(context.Background())
+	assert.Error(t, err)
+	assert.Equal(t, int32(2), server.requests.Load())
+}
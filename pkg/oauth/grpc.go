@@ -0,0 +1,60 @@
+package oauth
+
+import (
+	"context"
+
+	"google.golang.org/grpc/credentials"
+)
+
+// PerRPCOption configures the gRPC credentials returned by NewPerRPCCredentials.
+type PerRPCOption func(*perRPCCredentials)
+
+// WithInsecureTransport allows sending tokens over connections without transport
+// security. It should only be used for local development and tests.
+func WithInsecureTransport() PerRPCOption {
+	return func(c *perRPCCredentials) {
+		c.requireTLS = false
+	}
+}
+
+// perRPCCredentials is a credentials.PerRPCCredentials implementation that
+// authorizes every call using the tokens returned by a TokenSource.
+type perRPCCredentials struct {
+	source     TokenSource
+	requireTLS bool
+}
+
+// GetRequestMetadata returns the authorization metadata of the call.
+func (c *perRPCCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	token, err := c.source.Token(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{"authorization": token.authorization()}, nil
+}
+
+// RequireTransportSecurity returns true if tokens can only be sent over secure
+// connections.
+func (c *perRPCCredentials) RequireTransportSecurity() bool {
+	return c.requireTLS
+}
+
+// NewPerRPCCredentials initializes a new credentials.PerRPCCredentials that
+// authorizes every gRPC call using the tokens returned by the given
+// TokenSource. Tokens are only sent over connections with transport security,
+// see WithInsecureTransport.
+//
+//	conn, err := grpc.Dial(target,
+//		grpc.WithTransportCredentials(credentials.NewTLS(nil)),
+//		grpc.WithPerRPCCredentials(NewPerRPCCredentials(source)),
+//	)
+func NewPerRPCCredentials(source TokenSource, opts ...PerRPCOption) credentials.PerRPCCredentials {
+	c := &perRPCCredentials{
+		source:     source,
+		requireTLS: true,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
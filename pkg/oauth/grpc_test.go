@@ -0,0 +1,24 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPerRPCCredentials(t *testing.T) {
+	creds := NewPerRPCCredentials(staticTokenSource{token: &Token{AccessToken: "abc", TokenType: "bearer"}})
+	assert.True(t, creds.RequireTransportSecurity())
+
+	md, err := creds.GetRequestMetadata(context.Background(), "https://api.gazebosim.org")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"authorization": "Bearer abc"}, md)
+
+	creds = NewPerRPCCredentials(staticTokenSource{err: errors.New("unavailable")}, WithInsecureTransport())
+	assert.False(t, creds.RequireTransportSecurity())
+	_, err = creds.GetRequestMetadata(context.Background())
+	assert.Error(t, err)
+}
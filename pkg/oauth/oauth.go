@@ -0,0 +1,248 @@
+// Package oauth provides OAuth 2.0 clients used to obtain access tokens for
+// outbound calls to other services.
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ErrTokenRequestFailed is returned when the token endpoint rejects a token
+// request.
+var ErrTokenRequestFailed = errors.New("token request failed")
+
+// AuthStyle defines how clients authenticate against the token endpoint.
+type AuthStyle int
+
+const (
+	// AuthStyleHeader sends the client credentials using HTTP Basic
+	// authentication (client_secret_basic).
+	AuthStyleHeader AuthStyle = iota
+	// AuthStyleParams sends the client credentials in the request body
+	// (client_secret_post). Auth0 applications use this method by default.
+	AuthStyleParams
+)
+
+// authenticateClient adds the given client credentials to the form or the
+// headers of a token request, depending on the given AuthStyle.
+func authenticateClient(form url.Values, header http.Header, id, secret string, style AuthStyle) {
+	if len(id) == 0 {
+		return
+	}
+	if style == AuthStyleParams {
+		form.Set("client_id", id)
+		form.Set("client_secret", secret)
+		return
+	}
+	// Credentials must be form-encoded before being used as Basic credentials,
+	// see RFC 6749 Section 2.3.1.
+	r := &http.Request{Header: header}
+	r.SetBasicAuth(url.QueryEscape(id), url.QueryEscape(secret))
+}
+
+// Option configures the clients of this package.
+type Option func(*options)
+
+// WithHTTPClient sets the HTTP client used to call the token endpoint. Defaults
+// to a client with a 30 seconds timeout, which is also applied to clients
+// without a timeout.
+func WithHTTPClient(client *http.Client) Option {
+	return func(o *options) {
+		o.client = client
+	}
+}
+
+// WithRefreshBefore sets how long before expiring tokens are refreshed in the
+// background. Requests made during this period still use the cached token while
+// the new one is obtained. Defaults to 1 minute.
+func WithRefreshBefore(d time.Duration) Option {
+	return func(o *options) {
+		o.refreshBefore = d
+	}
+}
+
+// defaultRequestTimeout is the timeout of token requests made with HTTP clients
+// without a timeout.
+const defaultRequestTimeout = 30 * time.Second
+
+// options contains the configuration shared by the clients of this package.
+type options struct {
+	client        *http.Client
+	refreshBefore time.Duration
+	now           func() time.Time
+}
+
+// newOptions applies the given options on top of the default configuration.
+func newOptions(opts []Option) options {
+	o := options{
+		client:        &http.Client{Timeout: defaultRequestTimeout},
+		refreshBefore: time.Minute,
+		now:           time.Now,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// requestToken sends the given form to the token endpoint identified by
+// tokenURL, and parses the response.
+func (o options) requestToken(ctx context.Context, tokenURL string, form url.Values, header http.Header) (*Token, tokenResponse, error) {
+	timeout := o.client.Timeout
+	if timeout <= 0 {
+		timeout = defaultRequestTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	return requestToken(ctx, o.client, tokenURL, form, header, o.now())
+}
+
+// Token is an access token issued by an authorization server.
+type Token struct {
+	// AccessToken is the token used to authorize requests.
+	AccessToken string
+	// TokenType is the type of the token, usually Bearer.
+	TokenType string
+	// Scope contains the space-separated scopes granted to the token.
+	Scope string
+	// IssuedTokenType is the type of the token issued by a token exchange, such
+	// as TokenTypeAccessToken.
+	IssuedTokenType string
+	// ExpiresAt is the time when the token expires. It's zero if the
+	// authorization server didn't provide the token lifetime.
+	ExpiresAt time.Time
+}
+
+// Expired returns true if the token is expired at the given time.
+func (t *Token) Expired(now time.Time) bool {
+	return !t.ExpiresAt.IsZero() && !now.Before(t.ExpiresAt)
+}
+
+// SetAuthHeader sets the Authorization header of the given request using the
+// token.
+func (t *Token) SetAuthHeader(r *http.Request) {
+	r.Header.Set("Authorization", t.authorization())
+}
+
+// authorization returns the value of the Authorization header for the token.
+func (t *Token) authorization() string {
+	tokenType := t.TokenType
+	if len(tokenType) == 0 || strings.EqualFold(tokenType, "bearer") {
+		tokenType = "Bearer"
+	}
+	return tokenType + " " + t.AccessToken
+}
+
+// TokenSource returns access tokens.
+type TokenSource interface {
+	// Token returns a valid access token.
+	Token(ctx context.Context) (*Token, error)
+}
+
+// TokenError contains the error returned by the token endpoint, as defined in
+// RFC 6749 Section 5.2. It can be matched with errors.Is using
+// ErrTokenRequestFailed.
+type TokenError struct {
+	// StatusCode is the HTTP status code of the response.
+	StatusCode int
+	// Code is the error code, such as invalid_client.
+	Code string
+	// Description is the human-readable description of the error.
+	Description string
+}
+
+// Error returns the error message.
+func (e *TokenError) Error() string {
+	msg := fmt.Sprintf("%s: status %d", ErrTokenRequestFailed, e.StatusCode)
+	if len(e.Code) > 0 {
+		msg += ": " + e.Code
+	}
+	if len(e.Description) > 0 {
+		msg += ": " + e.Description
+	}
+	return msg
+}
+
+// Unwrap returns ErrTokenRequestFailed.
+func (e *TokenError) Unwrap() error {
+	return ErrTokenRequestFailed
+}
+
+// Temporary returns true if the request failed due to a server error, and it
+// can be retried.
+func (e *TokenError) Temporary() bool {
+	return e.StatusCode >= http.StatusInternalServerError || e.StatusCode == http.StatusTooManyRequests
+}
+
+// tokenResponse is the successful response of the token endpoint, as defined in
+// RFC 6749 Section 5.1 and RFC 8693 Section 2.2.1.
+type tokenResponse struct {
+	AccessToken     string `json:"access_token"`
+	TokenType       string `json:"token_type"`
+	ExpiresIn       int64  `json:"expires_in"`
+	Scope           string `json:"scope"`
+	IssuedTokenType string `json:"issued_token_type,omitempty"`
+}
+
+// errorResponse is the error response of the token endpoint.
+type errorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// requestToken sends the given form to the token endpoint identified by
+// tokenURL, and parses the response.
+func requestToken(ctx context.Context, client *http.Client, tokenURL string, form url.Values, header http.Header, now time.Time) (*Token, tokenResponse, error) {
+	var body tokenResponse
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, body, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, body, err
+	}
+	defer res.Body.Close()
+	raw, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return nil, body, err
+	}
+	if res.StatusCode != http.StatusOK {
+		tokenErr := &TokenError{StatusCode: res.StatusCode}
+		var e errorResponse
+		if json.Unmarshal(raw, &e) == nil {
+			tokenErr.Code = e.Error
+			tokenErr.Description = e.ErrorDescription
+		}
+		return nil, body, tokenErr
+	}
+	if err := json.Unmarshal(raw, &body); err != nil {
+		return nil, body, fmt.Errorf("%w: invalid response: %s", ErrTokenRequestFailed, err)
+	}
+	if len(body.AccessToken) == 0 {
+		return nil, body, fmt.Errorf("%w: response does not contain an access token", ErrTokenRequestFailed)
+	}
+	token := &Token{
+		AccessToken:     body.AccessToken,
+		TokenType:       body.TokenType,
+		Scope:           body.Scope,
+		IssuedTokenType: body.IssuedTokenType,
+	}
+	if body.ExpiresIn > 0 {
+		token.ExpiresAt = now.Add(time.Duration(body.ExpiresIn) * time.Second)
+	}
+	return token, body, nil
+}
@@ -0,0 +1,109 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testTokenServer is a token endpoint stand-in used in tests.
+type testTokenServer struct {
+	*httptest.Server
+	requests atomic.Int32
+	// handle responds to token requests. It defaults to issuing tokens that
+	// expire in one hour.
+	handle func(w http.ResponseWriter, r *http.Request)
+}
+
+func newTestTokenServer(t *testing.T) *testTokenServer {
+	s := &testTokenServer{}
+	s.handle = func(w http.ResponseWriter, r *http.Request) {
+		writeTestToken(w, "token", 3600)
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.requests.Add(1)
+		require.NoError(t, r.ParseForm())
+		s.handle(w, r)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func writeTestToken(w http.ResponseWriter, token string, expiresIn int64) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"access_token": token,
+		"token_type":   "bearer",
+		"expires_in":   expiresIn,
+	})
+}
+
+func TestToken(t *testing.T) {
+	now := time.Now()
+	token := &Token{AccessToken: "abc", TokenType: "bearer", ExpiresAt: now.Add(time.Minute)}
+	assert.False(t, token.Expired(now))
+	assert.True(t, token.Expired(now.Add(time.Minute)))
+	assert.False(t, (&Token{AccessToken: "abc"}).Expired(now))
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	token.SetAuthHeader(r)
+	assert.Equal(t, "Bearer abc", r.Header.Get("Authorization"))
+
+	(&Token{AccessToken: "abc", TokenType: "DPoP"}).SetAuthHeader(r)
+	assert.Equal(t, "DPoP abc", r.Header.Get("Authorization"))
+}
+
+func TestRequestToken(t *testing.T) {
+	server := newTestTokenServer(t)
+	server.handle = func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "client_credentials", r.PostForm.Get("grant_type"))
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"access_token":"abc","token_type":"Bearer","expires_in":60,"scope":"a b"}`))
+	}
+	now := time.Now()
+	token, _, err := requestToken(context.Background(), server.Client(), server.URL, url.Values{"grant_type": {"client_credentials"}}, nil, now)
+	require.NoError(t, err)
+	assert.Equal(t, "abc", token.AccessToken)
+	assert.Equal(t, "a b", token.Scope)
+	assert.Equal(t, now.Add(time.Minute), token.ExpiresAt)
+}
+
+func TestRequestToken_Errors(t *testing.T) {
+	server := newTestTokenServer(t)
+	ctx := context.Background()
+
+	server.handle = func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte(`{"error":"invalid_client","error_description":"Unknown client"}`))
+	}
+	_, _, err := requestToken(ctx, server.Client(), server.URL, url.Values{}, nil, time.Now())
+	assert.ErrorIs(t, err, ErrTokenRequestFailed)
+	var tokenErr *TokenError
+	require.ErrorAs(t, err, &tokenErr)
+	assert.Equal(t, http.StatusUnauthorized, tokenErr.StatusCode)
+	assert.Equal(t, "invalid_client", tokenErr.Code)
+	assert.Equal(t, "Unknown client", tokenErr.Description)
+	assert.False(t, tokenErr.Temporary())
+	assert.Equal(t, "token request failed: status 401: invalid_client: Unknown client", err.Error())
+
+	server.handle = func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}
+	_, _, err = requestToken(ctx, server.Client(), server.URL, url.Values{}, nil, time.Now())
+	require.ErrorAs(t, err, &tokenErr)
+	assert.True(t, tokenErr.Temporary())
+
+	server.handle = func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"token_type":"Bearer"}`))
+	}
+	_, _, err = requestToken(ctx, server.Client(), server.URL, url.Values{}, nil, time.Now())
+	assert.ErrorIs(t, err, ErrTokenRequestFailed)
+}
@@ -0,0 +1,34 @@
+package oauth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestSigner(t *testing.T) (TokenSigner, *ecdsa.PublicKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	return NewJWTSigner(jwt.SigningMethodES256, key, "test-key"), &key.PublicKey
+}
+
+func TestJWTSigner(t *testing.T) {
+	signer, pub := newTestSigner(t)
+	signed, err := signer.Sign(context.Background(), jwt.MapClaims{"sub": "gazebo-web"})
+	require.NoError(t, err)
+
+	token, err := jwt.Parse(signed, func(token *jwt.Token) (any, error) {
+		assert.Equal(t, "test-key", token.Header["kid"])
+		return pub, nil
+	}, jwt.WithValidMethods([]string{"ES256"}))
+	require.NoError(t, err)
+	sub, err := token.Claims.GetSubject()
+	require.NoError(t, err)
+	assert.Equal(t, "gazebo-web", sub)
+}
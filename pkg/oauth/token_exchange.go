@@ -0,0 +1,150 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// GrantTypeTokenExchange is the grant type of token exchange requests, as
+// defined in RFC 8693.
+const GrantTypeTokenExchange = "urn:ietf:params:oauth:grant-type:token-exchange"
+
+// Token types defined in RFC 8693 Section 3.
+const (
+	// TokenTypeAccessToken identifies OAuth 2.0 access tokens.
+	TokenTypeAccessToken = "urn:ietf:params:oauth:token-type:access_token"
+	// TokenTypeRefreshToken identifies OAuth 2.0 refresh tokens.
+	TokenTypeRefreshToken = "urn:ietf:params:oauth:token-type:refresh_token"
+	// TokenTypeIDToken identifies OpenID Connect ID tokens.
+	TokenTypeIDToken = "urn:ietf:params:oauth:token-type:id_token"
+	// TokenTypeJWT identifies JWTs.
+	TokenTypeJWT = "urn:ietf:params:oauth:token-type:jwt"
+)
+
+// ErrSubjectTokenNotProvided is returned when a token exchange request doesn't
+// contain a subject token.
+var ErrSubjectTokenNotProvided = errors.New("subject token not provided")
+
+// TokenExchangeRequest contains the parameters of a token exchange request, as
+// defined in RFC 8693 Section 2.1.
+type TokenExchangeRequest struct {
+	// SubjectToken is the token representing the identity of the party on
+	// behalf of whom the request is made.
+	SubjectToken string
+	// SubjectTokenType is the type of SubjectToken. Defaults to
+	// TokenTypeAccessToken.
+	SubjectTokenType string
+	// ActorToken is the token representing the identity of the acting party,
+	// used for delegation. Optional.
+	ActorToken string
+	// ActorTokenType is the type of ActorToken. Defaults to TokenTypeAccessToken
+	// if ActorToken is set.
+	ActorTokenType string
+	// Audiences contains the logical names of the services the token is
+	// requested for.
+	Audiences []string
+	// Resources contains the URIs of the services the token is requested for.
+	Resources []string
+	// Scopes contains the scopes requested for the token. They must be a subset
+	// of the scopes of the subject token.
+	Scopes []string
+	// RequestedTokenType is the type of the requested token. Optional.
+	RequestedTokenType string
+}
+
+// form returns the body of the token exchange request.
+func (r TokenExchangeRequest) form() url.Values {
+	form := url.Values{}
+	form.Set("grant_type", GrantTypeTokenExchange)
+	form.Set("subject_token", r.SubjectToken)
+	form.Set("subject_token_type", defaultTokenType(r.SubjectTokenType))
+	if len(r.ActorToken) > 0 {
+		form.Set("actor_token", r.ActorToken)
+		form.Set("actor_token_type", defaultTokenType(r.ActorTokenType))
+	}
+	for _, aud := range r.Audiences {
+		form.Add("audience", aud)
+	}
+	for _, res := range r.Resources {
+		form.Add("resource", res)
+	}
+	if len(r.Scopes) > 0 {
+		form.Set("scope", strings.Join(r.Scopes, " "))
+	}
+	if len(r.RequestedTokenType) > 0 {
+		form.Set("requested_token_type", r.RequestedTokenType)
+	}
+	return form
+}
+
+// defaultTokenType returns the given token type, or TokenTypeAccessToken if
+// it's empty.
+func defaultTokenType(tokenType string) string {
+	if len(tokenType) == 0 {
+		return TokenTypeAccessToken
+	}
+	return tokenType
+}
+
+// TokenExchangeConfig contains the configuration of a token exchange client.
+type TokenExchangeConfig struct {
+	// TokenURL is the URL of the token endpoint.
+	TokenURL string
+	// ClientID is the identifier of the client. Optional, some authorization
+	// servers accept unauthenticated token exchange requests.
+	ClientID string
+	// ClientSecret is the secret of the client.
+	ClientSecret string
+	// AuthStyle defines how the client credentials are sent. Defaults to
+	// AuthStyleHeader.
+	AuthStyle AuthStyle
+}
+
+// TokenExchanger exchanges tokens for new tokens, usually issued for a different
+// audience.
+type TokenExchanger interface {
+	// Exchange sends the given token exchange request, and returns the issued
+	// token.
+	Exchange(ctx context.Context, req TokenExchangeRequest) (*Token, error)
+}
+
+// tokenExchanger is a TokenExchanger implementation that sends requests to a
+// token endpoint.
+type tokenExchanger struct {
+	options
+	cfg TokenExchangeConfig
+}
+
+// Exchange sends the given token exchange request to the token endpoint.
+func (e *tokenExchanger) Exchange(ctx context.Context, req TokenExchangeRequest) (*Token, error) {
+	if len(req.SubjectToken) == 0 {
+		return nil, ErrSubjectTokenNotProvided
+	}
+	form, header := req.form(), http.Header{}
+	authenticateClient(form, header, e.cfg.ClientID, e.cfg.ClientSecret, e.cfg.AuthStyle)
+	token, _, err := e.requestToken(ctx, e.cfg.TokenURL, form, header)
+	return token, err
+}
+
+// NewTokenExchanger initializes a new TokenExchanger that sends token exchange
+// requests, as defined in RFC 8693, to the given token endpoint.
+//
+//	exchanger := NewTokenExchanger(TokenExchangeConfig{
+//		TokenURL:     "https://auth.gazebosim.org/oauth/token",
+//		ClientID:     clientID,
+//		ClientSecret: clientSecret,
+//	})
+//	token, err := exchanger.Exchange(ctx, TokenExchangeRequest{
+//		SubjectToken: userToken,
+//		Audiences:    []string{"simulations"},
+//		Scopes:       []string{"simulations.run"},
+//	})
+func NewTokenExchanger(cfg TokenExchangeConfig, opts ...Option) TokenExchanger {
+	return &tokenExchanger{
+		options: newOptions(opts),
+		cfg:     cfg,
+	}
+}
@@ -0,0 +1,394 @@
+package oauth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gazebo-web/auth/pkg/authentication"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ExchangePolicy defines which tokens can be issued by a token exchange handler.
+type ExchangePolicy struct {
+	// Issuer is the iss claim of the issued tokens.
+	Issuer string
+	// Audiences contains the audiences tokens can be issued for. Requests for
+	// any other audience are rejected.
+	Audiences []string
+	// DefaultAudience is the audience used when requests don't specify one.
+	// Optional, requests must specify an audience if empty.
+	DefaultAudience string
+	// Scopes contains the scopes that can be granted to the issued tokens.
+	// Optional, if empty every scope of the subject token can be granted.
+	Scopes []string
+	// TTL is the lifetime of the issued tokens. Tokens never outlive the subject
+	// token. Defaults to 5 minutes.
+	TTL time.Duration
+	// SubjectAudiences contains the audiences subject tokens must be issued for.
+	// Subject tokens are rejected unless their aud claim contains one of them.
+	// Optional, if empty subject tokens issued for any audience are accepted.
+	SubjectAudiences []string
+	// AllowMissingActor accepts requests that don't identify an actor. By
+	// default, requests must identify an actor, either with an actor token or
+	// with a Principal authenticated by a previous middleware.
+	AllowMissingActor bool
+	// Claims contains the claims copied from the subject token to the issued
+	// tokens, such as email or org_id.
+	Claims []string
+}
+
+// minSubjectTokenLifetime is the minimum time subject tokens must be valid for.
+// Issued tokens never outlive the subject token, and a lifetime under a second
+// would be sent as expires_in 0, which clients read as a token that never
+// expires.
+const minSubjectTokenLifetime = time.Second
+
+// ExchangeOption configures a token exchange handler.
+type ExchangeOption func(*tokenExchangeHandler)
+
+// WithActorAuthentication sets the Authentication used to verify actor tokens.
+// Actor tokens are rejected if it's not set, actors must then be authenticated
+// by a previous middleware.
+func WithActorAuthentication(auth authentication.Authentication) ExchangeOption {
+	return func(h *tokenExchangeHandler) {
+		h.actor = auth
+	}
+}
+
+// WithExchangePrincipalMapper sets the PrincipalMapper used to read the
+// identity and scopes of subject and actor tokens. Defaults to
+// authentication.DefaultPrincipalMapper.
+func WithExchangePrincipalMapper(mapper authentication.PrincipalMapper) ExchangeOption {
+	return func(h *tokenExchangeHandler) {
+		h.mapper = mapper
+	}
+}
+
+// exchangeError is an error response of the token exchange handler, as defined
+// in RFC 6749 Section 5.2 and RFC 8693 Section 2.2.2.
+type exchangeError struct {
+	status      int
+	code        string
+	description string
+}
+
+// Error returns the error message.
+func (e *exchangeError) Error() string {
+	return e.code + ": " + e.description
+}
+
+// newExchangeError initializes a new exchangeError with status 400 Bad Request.
+func newExchangeError(code string, format string, args ...any) *exchangeError {
+	return &exchangeError{
+		status:      http.StatusBadRequest,
+		code:        code,
+		description: fmt.Sprintf(format, args...),
+	}
+}
+
+// tokenExchangeHandler is an http.Handler implementing the token endpoint of
+// the token exchange grant.
+type tokenExchangeHandler struct {
+	subject authentication.Authentication
+	actor   authentication.Authentication
+	mapper  authentication.PrincipalMapper
+	signer  TokenSigner
+	policy  ExchangePolicy
+	now     func() time.Time
+}
+
+// ServeHTTP handles token exchange requests.
+func (h *tokenExchangeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	res, err := h.exchange(r)
+	if err != nil {
+		writeExchangeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	_ = json.NewEncoder(w).Encode(res)
+}
+
+// exchange validates the given token exchange request and issues a new token.
+func (h *tokenExchangeHandler) exchange(r *http.Request) (*tokenResponse, error) {
+	ctx := r.Context()
+	if err := r.ParseForm(); err != nil {
+		return nil, newExchangeError("invalid_request", "invalid form: %s", err)
+	}
+	form := r.PostForm
+	if grantType := form.Get("grant_type"); grantType != GrantTypeTokenExchange {
+		return nil, newExchangeError("unsupported_grant_type", "unsupported grant type %q", grantType)
+	}
+
+	issuedType := form.Get("requested_token_type")
+	switch issuedType {
+	case "":
+		issuedType = TokenTypeAccessToken
+	case TokenTypeAccessToken, TokenTypeJWT:
+	default:
+		return nil, newExchangeError("invalid_request", "unsupported requested token type %q", issuedType)
+	}
+
+	subject, subjectClaims, err := h.verify(r, h.subject, "subject_token")
+	if err != nil {
+		return nil, err
+	}
+	if subject == nil {
+		return nil, newExchangeError("invalid_request", "missing subject_token")
+	}
+	if err := h.verifySubjectAudience(subjectClaims); err != nil {
+		return nil, err
+	}
+
+	var actor *authentication.Principal
+	if len(form.Get("actor_token")) > 0 {
+		if h.actor == nil {
+			return nil, newExchangeError("invalid_request", "actor_token is not supported")
+		}
+		actor, _, err = h.verify(r, h.actor, "actor_token")
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		// Clients authenticated by a previous middleware, such as mTLS or API
+		// keys, act on behalf of the subject.
+		actor, _ = authentication.PrincipalFromContext(ctx)
+	}
+	if actor == nil && !h.policy.AllowMissingActor {
+		return nil, newExchangeError("invalid_request", "missing actor_token")
+	}
+	// A subject can't act on its own behalf, otherwise a subject token alone
+	// would be enough to issue delegated tokens.
+	if actor != nil && actor.ID == subject.ID && actor.Issuer == subject.Issuer {
+		return nil, newExchangeError("invalid_request", "the actor can't be the subject")
+	}
+
+	audiences, err := h.audiences(form["audience"])
+	if err != nil {
+		return nil, err
+	}
+	scopes, err := h.scopes(subject, form.Get("scope"))
+	if err != nil {
+		return nil, err
+	}
+
+	now := h.now()
+	exp := now.Add(h.policy.TTL)
+	if subjectExp, err := subjectClaims.GetExpirationTime(); err == nil && subjectExp != nil && subjectExp.Before(exp) {
+		if subjectExp.Sub(now) < minSubjectTokenLifetime {
+			return nil, newExchangeError("invalid_request", "subject_token expires too soon")
+		}
+		exp = subjectExp.Time
+	}
+	jti := make([]byte, 16)
+	if _, err := rand.Read(jti); err != nil {
+		return nil, err
+	}
+
+	claims := jwt.MapClaims{
+		"iss": h.policy.Issuer,
+		"sub": subject.ID,
+		"iat": now.Unix(),
+		"exp": exp.Unix(),
+		"jti": hex.EncodeToString(jti),
+	}
+	if len(audiences) == 1 {
+		claims["aud"] = audiences[0]
+	} else {
+		claims["aud"] = audiences
+	}
+	if len(scopes) > 0 {
+		claims["scope"] = strings.Join(scopes, " ")
+	}
+	for _, key := range h.policy.Claims {
+		if v, ok := subject.Claims[key]; ok {
+			claims[key] = v
+		}
+	}
+	if act := actClaim(actor, subject); act != nil {
+		claims["act"] = act
+	}
+
+	token, err := h.signer.Sign(ctx, claims)
+	if err != nil {
+		return nil, err
+	}
+	return &tokenResponse{
+		AccessToken:     token,
+		IssuedTokenType: issuedType,
+		TokenType:       "Bearer",
+		ExpiresIn:       int64(exp.Sub(now).Seconds()),
+		Scope:           strings.Join(scopes, " "),
+	}, nil
+}
+
+// verify verifies the token sent in the given form parameter using the given
+// Authentication. It returns a nil Principal if the parameter is empty.
+func (h *tokenExchangeHandler) verify(r *http.Request, auth authentication.Authentication, param string) (*authentication.Principal, jwt.Claims, error) {
+	token := r.PostForm.Get(param)
+	if len(token) == 0 {
+		return nil, nil, nil
+	}
+	switch tokenType := r.PostForm.Get(param + "_type"); tokenType {
+	case TokenTypeAccessToken, TokenTypeJWT, TokenTypeIDToken:
+	default:
+		return nil, nil, newExchangeError("invalid_request", "unsupported %s_type %q", param, tokenType)
+	}
+	claims, err := auth.VerifyJWT(r.Context(), token)
+	if authentication.IsRetryable(err) {
+		return nil, nil, &exchangeError{
+			status:      http.StatusServiceUnavailable,
+			code:        "temporarily_unavailable",
+			description: "the " + param + " couldn't be verified",
+		}
+	}
+	if err != nil {
+		return nil, nil, newExchangeError("invalid_request", "invalid %s: %s", param, authentication.ReasonOf(err))
+	}
+	p, err := h.mapper(claims)
+	if err != nil {
+		return nil, nil, newExchangeError("invalid_request", "invalid %s", param)
+	}
+	return p, claims, nil
+}
+
+// verifySubjectAudience verifies that the subject token with the given claims
+// was issued for one of the subject audiences of the policy.
+func (h *tokenExchangeHandler) verifySubjectAudience(claims jwt.Claims) error {
+	if len(h.policy.SubjectAudiences) == 0 {
+		return nil
+	}
+	audiences, _ := claims.GetAudience()
+	for _, aud := range audiences {
+		if contains(h.policy.SubjectAudiences, aud) {
+			return nil
+		}
+	}
+	return newExchangeError("invalid_request", "subject_token audience is not allowed")
+}
+
+// audiences returns the audiences of the issued token, validating the requested
+// ones against the policy.
+func (h *tokenExchangeHandler) audiences(requested []string) ([]string, error) {
+	if len(requested) == 0 {
+		if len(h.policy.DefaultAudience) == 0 {
+			return nil, newExchangeError("invalid_target", "missing audience")
+		}
+		return []string{h.policy.DefaultAudience}, nil
+	}
+	for _, aud := range requested {
+		if !contains(h.policy.Audiences, aud) {
+			return nil, newExchangeError("invalid_target", "audience %q is not allowed", aud)
+		}
+	}
+	return requested, nil
+}
+
+// scopes returns the scopes of the issued token. Tokens can only be down-scoped:
+// requested scopes must be granted to the subject and allowed by the policy. If
+// no scope is requested, the scopes of the subject allowed by the policy are
+// used.
+func (h *tokenExchangeHandler) scopes(subject *authentication.Principal, requested string) ([]string, error) {
+	allowed := func(scope string) bool {
+		return subject.HasScope(scope) && (len(h.policy.Scopes) == 0 || contains(h.policy.Scopes, scope))
+	}
+	if len(requested) == 0 {
+		var scopes []string
+		for _, scope := range subject.Scopes {
+			if allowed(scope) {
+				scopes = append(scopes, scope)
+			}
+		}
+		return scopes, nil
+	}
+	scopes := strings.Fields(requested)
+	for _, scope := range scopes {
+		if !allowed(scope) {
+			return nil, newExchangeError("invalid_scope", "scope %q is not allowed", scope)
+		}
+	}
+	return scopes, nil
+}
+
+// actClaim returns the act claim identifying the given actor, as defined in
+// RFC 8693 Section 4.1. The act claim of the subject token, if any, is nested
+// to preserve the delegation chain.
+func actClaim(actor *authentication.Principal, subject *authentication.Principal) map[string]any {
+	prior, _ := subject.Claims["act"].(map[string]any)
+	if actor == nil {
+		return prior
+	}
+	act := map[string]any{"sub": actor.ID}
+	if len(actor.Issuer) > 0 {
+		act["iss"] = actor.Issuer
+	}
+	if prior != nil {
+		act["act"] = prior
+	}
+	return act
+}
+
+// writeExchangeError writes the error response matching the given error.
+func writeExchangeError(w http.ResponseWriter, err error) {
+	var e *exchangeError
+	if !errors.As(err, &e) {
+		e = &exchangeError{status: http.StatusInternalServerError, code: "server_error", description: "failed to issue token"}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(e.status)
+	_ = json.NewEncoder(w).Encode(errorResponse{Error: e.code, ErrorDescription: e.description})
+}
+
+// contains returns true if list contains value.
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// NewTokenExchangeHandler initializes a new http.Handler implementing the token
+// exchange grant, as defined in RFC 8693. Subject tokens are verified using the
+// given Authentication, and the issued tokens are signed using the given
+// TokenSigner after applying the given ExchangePolicy.
+//
+// The actor of a delegation is identified by the actor token, verified with
+// the Authentication set by WithActorAuthentication, or by the Principal stored
+// in the request context by a previous authentication middleware. It's recorded in the act claim of the issued token. Requests that
+// don't identify an actor are rejected unless the policy allows it.
+//
+//	handler := NewTokenExchangeHandler(auth, NewJWTSigner(jwt.SigningMethodES256, key, "2024-01"), ExchangePolicy{
+//		Issuer:    "https://auth.gazebosim.org",
+//		Audiences: []string{"simulations"},
+//	})
+//	mux.Handle("/oauth/token", authentication.CertificateMiddleware(mtls)(handler))
+func NewTokenExchangeHandler(subject authentication.Authentication, signer TokenSigner, policy ExchangePolicy, opts ...ExchangeOption) http.Handler {
+	if policy.TTL <= 0 {
+		policy.TTL = 5 * time.Minute
+	}
+	h := &tokenExchangeHandler{
+		subject: subject,
+		mapper:  authentication.DefaultPrincipalMapper(),
+		signer:  signer,
+		policy:  policy,
+		now:     time.Now,
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
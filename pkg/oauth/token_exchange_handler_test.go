@@ -0,0 +1,413 @@
+package oauth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gazebo-web/auth/pkg/authentication"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+// testAuthentication is an authentication.Authentication implementation that
+// returns predefined claims for every known token.
+type testAuthentication map[string]jwt.MapClaims
+
+func (a testAuthentication) VerifyJWT(ctx context.Context, token string) (jwt.Claims, error) {
+	if claims, ok := a[token]; ok {
+		return claims, nil
+	}
+	if token == "unavailable" {
+		return nil, authentication.NewVerificationError("test", authentication.ReasonProviderUnavailable, nil)
+	}
+	return nil, authentication.NewVerificationError("test", authentication.ReasonBadSignature, authentication.ErrTokenInvalid)
+}
+
+type tokenExchangeHandlerTestSuite struct {
+	suite.Suite
+	now     time.Time
+	pub     *ecdsa.PublicKey
+	handler http.Handler
+	policy  ExchangePolicy
+	auth    testAuthentication
+}
+
+func TestTokenExchangeHandler(t *testing.T) {
+	suite.Run(t, new(tokenExchangeHandlerTestSuite))
+}
+
+func (s *tokenExchangeHandlerTestSuite) SetupTest() {
+	s.now = time.Now().Truncate(time.Second)
+	s.auth = testAuthentication{
+		"user-token": {
+			"sub":   "user-1",
+			"iss":   "https://gazebo.us.auth0.com/",
+			"scope": "worlds.read simulations.run simulations.stop",
+			"aud":   "https://api.gazebosim.org",
+			"email": "user@gazebosim.org",
+			"exp":   float64(s.now.Add(time.Hour).Unix()),
+		},
+		"expiring-token": {
+			"sub":   "user-1",
+			"scope": "simulations.run",
+			"exp":   float64(s.now.Unix()),
+		},
+		"short-token": {
+			"sub":   "user-1",
+			"scope": "simulations.run",
+			"exp":   float64(s.now.Add(time.Minute).Unix()),
+		},
+		"delegated-token": {
+			"sub":   "user-1",
+			"scope": "simulations.run",
+			"act":   map[string]any{"sub": "web-api"},
+		},
+		"service-token": {
+			"sub": "web-api",
+			"iss": "https://gazebo.us.auth0.com/",
+		},
+	}
+	s.policy = ExchangePolicy{
+		Issuer:          "https://auth.gazebosim.org",
+		Audiences:       []string{"simulations", "storage"},
+		DefaultAudience: "simulations",
+		Scopes:          []string{"simulations.run", "simulations.stop"},
+		Claims:          []string{"email"},
+		// Actors are covered by the actor tests.
+		AllowMissingActor: true,
+	}
+	s.setupHandler()
+}
+
+func (s *tokenExchangeHandlerTestSuite) setupHandler(opts ...ExchangeOption) {
+	signer, pub := newTestSigner(s.T())
+	s.pub = pub
+	h := NewTokenExchangeHandler(s.auth, signer, s.policy, opts...).(*tokenExchangeHandler)
+	h.now = func() time.Time { return s.now }
+	s.handler = h
+}
+
+func (s *tokenExchangeHandlerTestSuite) exchange(ctx context.Context, form url.Values) *httptest.ResponseRecorder {
+	if len(form.Get("grant_type")) == 0 {
+		form.Set("grant_type", GrantTypeTokenExchange)
+	}
+	r := httptest.NewRequest(http.MethodPost, "/oauth/token", strings.NewReader(form.Encode())).WithContext(ctx)
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	s.handler.ServeHTTP(w, r)
+	return w
+}
+
+// issued parses the response of a successful exchange, and returns the claims
+// of the issued token.
+func (s *tokenExchangeHandlerTestSuite) issued(w *httptest.ResponseRecorder) (tokenResponse, jwt.MapClaims) {
+	s.Require().Equal(http.StatusOK, w.Code, w.Body.String())
+	s.Equal("no-store", w.Header().Get("Cache-Control"))
+	var res tokenResponse
+	s.Require().NoError(json.Unmarshal(w.Body.Bytes(), &res))
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(res.AccessToken, claims, func(*jwt.Token) (any, error) { return s.pub, nil })
+	s.Require().NoError(err)
+	return res, claims
+}
+
+func (s *tokenExchangeHandlerTestSuite) errorCode(w *httptest.ResponseRecorder) string {
+	var res errorResponse
+	s.Require().NoError(json.Unmarshal(w.Body.Bytes(), &res))
+	return res.Error
+}
+
+func (s *tokenExchangeHandlerTestSuite) TestExchange() {
+	w := s.exchange(context.Background(), url.Values{
+		"subject_token":      {"user-token"},
+		"subject_token_type": {TokenTypeAccessToken},
+		"audience":           {"simulations"},
+		"scope":              {"simulations.run"},
+	})
+	res, claims := s.issued(w)
+	s.Equal(TokenTypeAccessToken, res.IssuedTokenType)
+	s.Equal("Bearer", res.TokenType)
+	s.Equal(int64(300), res.ExpiresIn)
+	s.Equal("simulations.run", res.Scope)
+
+	s.Equal("https://auth.gazebosim.org", claims["iss"])
+	s.Equal("user-1", claims["sub"])
+	s.Equal("simulations", claims["aud"])
+	s.Equal("simulations.run", claims["scope"])
+	s.Equal("user@gazebosim.org", claims["email"])
+	s.Equal(float64(s.now.Add(5*time.Minute).Unix()), claims["exp"])
+	s.NotEmpty(claims["jti"])
+	s.NotContains(claims, "act")
+}
+
+func (s *tokenExchangeHandlerTestSuite) TestDefaults() {
+	// Without an audience and scopes, the default audience and the subject
+	// scopes allowed by the policy are used.
+	_, claims := s.issued(s.exchange(context.Background(), url.Values{
+		"subject_token":      {"user-token"},
+		"subject_token_type": {TokenTypeJWT},
+	}))
+	s.Equal("simulations", claims["aud"])
+	s.Equal("simulations.run simulations.stop", claims["scope"])
+}
+
+func (s *tokenExchangeHandlerTestSuite) TestMultipleAudiences() {
+	_, claims := s.issued(s.exchange(context.Background(), url.Values{
+		"subject_token":      {"user-token"},
+		"subject_token_type": {TokenTypeAccessToken},
+		"audience":           {"simulations", "storage"},
+	}))
+	s.Equal([]any{"simulations", "storage"}, claims["aud"])
+}
+
+func (s *tokenExchangeHandlerTestSuite) TestSubjectExpiration() {
+	res, claims := s.issued(s.exchange(context.Background(), url.Values{
+		"subject_token":      {"short-token"},
+		"subject_token_type": {TokenTypeAccessToken},
+	}))
+	s.Equal(int64(60), res.ExpiresIn)
+	s.Equal(float64(s.now.Add(time.Minute).Unix()), claims["exp"])
+}
+
+func (s *tokenExchangeHandlerTestSuite) TestActorToken() {
+	s.setupHandler(WithActorAuthentication(s.auth))
+	_, claims := s.issued(s.exchange(context.Background(), url.Values{
+		"subject_token":      {"user-token"},
+		"subject_token_type": {TokenTypeAccessToken},
+		"actor_token":        {"service-token"},
+		"actor_token_type":   {TokenTypeAccessToken},
+	}))
+	s.Equal(map[string]any{"sub": "web-api", "iss": "https://gazebo.us.auth0.com/"}, claims["act"])
+}
+
+func (s *tokenExchangeHandlerTestSuite) TestActorTokenNotSupported() {
+	// Actor tokens are only accepted with an actor Authentication.
+	w := s.exchange(context.Background(), url.Values{
+		"subject_token":      {"user-token"},
+		"subject_token_type": {TokenTypeAccessToken},
+		"actor_token":        {"service-token"},
+		"actor_token_type":   {TokenTypeAccessToken},
+	})
+	s.Equal(http.StatusBadRequest, w.Code)
+	s.Equal("invalid_request", s.errorCode(w))
+}
+
+func (s *tokenExchangeHandlerTestSuite) TestActorIsSubject() {
+	s.policy.AllowMissingActor = false
+	s.setupHandler(WithActorAuthentication(s.auth))
+	// A subject token alone can't be used to issue delegated tokens.
+	w := s.exchange(context.Background(), url.Values{
+		"subject_token":      {"user-token"},
+		"subject_token_type": {TokenTypeAccessToken},
+		"actor_token":        {"user-token"},
+		"actor_token_type":   {TokenTypeAccessToken},
+	})
+	s.Equal(http.StatusBadRequest, w.Code)
+	s.Equal("invalid_request", s.errorCode(w))
+
+	ctx := authentication.WithPrincipal(context.Background(), &authentication.Principal{ID: "user-1", Issuer: "https://gazebo.us.auth0.com/"})
+	w = s.exchange(ctx, url.Values{
+		"subject_token":      {"user-token"},
+		"subject_token_type": {TokenTypeAccessToken},
+	})
+	s.Equal("invalid_request", s.errorCode(w))
+}
+
+func (s *tokenExchangeHandlerTestSuite) TestActorFromContext() {
+	ctx := authentication.WithPrincipal(context.Background(), &authentication.Principal{ID: "spiffe://cluster.local/sa/web-api"})
+	_, claims := s.issued(s.exchange(ctx, url.Values{
+		"subject_token":      {"delegated-token"},
+		"subject_token_type": {TokenTypeAccessToken},
+	}))
+	// The delegation chain of the subject token is preserved.
+	s.Equal(map[string]any{
+		"sub": "spiffe://cluster.local/sa/web-api",
+		"act": map[string]any{"sub": "web-api"},
+	}, claims["act"])
+}
+
+func (s *tokenExchangeHandlerTestSuite) TestMissingActor() {
+	s.policy.AllowMissingActor = false
+	s.setupHandler()
+	w := s.exchange(context.Background(), url.Values{
+		"subject_token":      {"user-token"},
+		"subject_token_type": {TokenTypeAccessToken},
+	})
+	s.Equal(http.StatusBadRequest, w.Code)
+	s.Equal("invalid_request", s.errorCode(w))
+
+	ctx := authentication.WithPrincipal(context.Background(), &authentication.Principal{ID: "web-api"})
+	_, claims := s.issued(s.exchange(ctx, url.Values{
+		"subject_token":      {"user-token"},
+		"subject_token_type": {TokenTypeAccessToken},
+	}))
+	s.Equal(map[string]any{"sub": "web-api"}, claims["act"])
+}
+
+func (s *tokenExchangeHandlerTestSuite) TestSubjectAudiences() {
+	s.policy.SubjectAudiences = []string{"https://api.gazebosim.org"}
+	s.setupHandler()
+	s.issued(s.exchange(context.Background(), url.Values{
+		"subject_token":      {"user-token"},
+		"subject_token_type": {TokenTypeAccessToken},
+	}))
+
+	// Subject tokens issued for other audiences, or without an audience, are
+	// rejected.
+	w := s.exchange(context.Background(), url.Values{
+		"subject_token":      {"short-token"},
+		"subject_token_type": {TokenTypeAccessToken},
+	})
+	s.Equal(http.StatusBadRequest, w.Code)
+	s.Equal("invalid_request", s.errorCode(w))
+}
+
+func (s *tokenExchangeHandlerTestSuite) TestActorAuthentication() {
+	s.setupHandler(WithActorAuthentication(testAuthentication{"client-token": {"sub": "worker"}}))
+	_, claims := s.issued(s.exchange(context.Background(), url.Values{
+		"subject_token":      {"user-token"},
+		"subject_token_type": {TokenTypeAccessToken},
+		"actor_token":        {"client-token"},
+		"actor_token_type":   {TokenTypeAccessToken},
+	}))
+	s.Equal(map[string]any{"sub": "worker"}, claims["act"])
+
+	// Actor tokens are not verified with the subject Authentication.
+	w := s.exchange(context.Background(), url.Values{
+		"subject_token":      {"user-token"},
+		"subject_token_type": {TokenTypeAccessToken},
+		"actor_token":        {"service-token"},
+		"actor_token_type":   {TokenTypeAccessToken},
+	})
+	s.Equal("invalid_request", s.errorCode(w))
+}
+
+func (s *tokenExchangeHandlerTestSuite) TestErrors() {
+	cases := []struct {
+		name   string
+		form   url.Values
+		status int
+		code   string
+	}{
+		{
+			name:   "unsupported grant",
+			form:   url.Values{"grant_type": {"client_credentials"}},
+			status: http.StatusBadRequest,
+			code:   "unsupported_grant_type",
+		},
+		{
+			name:   "missing subject",
+			form:   url.Values{},
+			status: http.StatusBadRequest,
+			code:   "invalid_request",
+		},
+		{
+			name:   "invalid subject",
+			form:   url.Values{"subject_token": {"forged"}, "subject_token_type": {TokenTypeAccessToken}},
+			status: http.StatusBadRequest,
+			code:   "invalid_request",
+		},
+		{
+			name:   "unsupported subject type",
+			form:   url.Values{"subject_token": {"user-token"}, "subject_token_type": {TokenTypeRefreshToken}},
+			status: http.StatusBadRequest,
+			code:   "invalid_request",
+		},
+		{
+			name:   "unsupported requested type",
+			form:   url.Values{"subject_token": {"user-token"}, "subject_token_type": {TokenTypeAccessToken}, "requested_token_type": {TokenTypeIDToken}},
+			status: http.StatusBadRequest,
+			code:   "invalid_request",
+		},
+		{
+			name:   "audience not allowed",
+			form:   url.Values{"subject_token": {"user-token"}, "subject_token_type": {TokenTypeAccessToken}, "audience": {"billing"}},
+			status: http.StatusBadRequest,
+			code:   "invalid_target",
+		},
+		{
+			name:   "scope not granted to subject",
+			form:   url.Values{"subject_token": {"short-token"}, "subject_token_type": {TokenTypeAccessToken}, "scope": {"simulations.stop"}},
+			status: http.StatusBadRequest,
+			code:   "invalid_scope",
+		},
+		{
+			name:   "scope not allowed by policy",
+			form:   url.Values{"subject_token": {"user-token"}, "subject_token_type": {TokenTypeAccessToken}, "scope": {"worlds.read"}},
+			status: http.StatusBadRequest,
+			code:   "invalid_scope",
+		},
+		{
+			name:   "subject expires too soon",
+			form:   url.Values{"subject_token": {"expiring-token"}, "subject_token_type": {TokenTypeAccessToken}},
+			status: http.StatusBadRequest,
+			code:   "invalid_request",
+		},
+		{
+			name:   "provider unavailable",
+			form:   url.Values{"subject_token": {"unavailable"}, "subject_token_type": {TokenTypeAccessToken}},
+			status: http.StatusServiceUnavailable,
+			code:   "temporarily_unavailable",
+		},
+	}
+	for _, tc := range cases {
+		s.Run(tc.name, func() {
+			w := s.exchange(context.Background(), tc.form)
+			s.Equal(tc.status, w.Code)
+			s.Equal(tc.code, s.errorCode(w))
+		})
+	}
+}
+
+func (s *tokenExchangeHandlerTestSuite) TestMissingAudience() {
+	s.policy.DefaultAudience = ""
+	s.setupHandler()
+	w := s.exchange(context.Background(), url.Values{
+		"subject_token":      {"user-token"},
+		"subject_token_type": {TokenTypeAccessToken},
+	})
+	s.Equal("invalid_target", s.errorCode(w))
+}
+
+func (s *tokenExchangeHandlerTestSuite) TestMethodNotAllowed() {
+	w := httptest.NewRecorder()
+	s.handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/oauth/token", nil))
+	s.Equal(http.StatusMethodNotAllowed, w.Code)
+}
+
+func TestTokenExchange_EndToEnd(t *testing.T) {
+	signer, pub := newTestSigner(t)
+	auth := testAuthentication{
+		"user-token":    {"sub": "user-1", "scope": "simulations.run"},
+		"service-token": {"sub": "web-api"},
+	}
+	server := httptest.NewServer(NewTokenExchangeHandler(auth, signer, ExchangePolicy{
+		Issuer:    "https://auth.gazebosim.org",
+		Audiences: []string{"simulations"},
+	}, WithActorAuthentication(auth)))
+	defer server.Close()
+
+	exchanger := NewTokenExchanger(TokenExchangeConfig{TokenURL: server.URL})
+	token, err := exchanger.Exchange(context.Background(), TokenExchangeRequest{
+		SubjectToken: "user-token",
+		ActorToken:   "service-token",
+		Audiences:    []string{"simulations"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, TokenTypeAccessToken, token.IssuedTokenType)
+	assert.Equal(t, "simulations.run", token.Scope)
+
+	claims := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(token.AccessToken, claims, func(*jwt.Token) (any, error) { return pub, nil })
+	require.NoError(t, err)
+	assert.Equal(t, "user-1", claims["sub"])
+}
@@ -0,0 +1,59 @@
+package oauth
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenExchanger_Exchange(t *testing.T) {
+	server := newTestTokenServer(t)
+	server.handle = func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, GrantTypeTokenExchange, r.PostForm.Get("grant_type"))
+		assert.Equal(t, "user-token", r.PostForm.Get("subject_token"))
+		assert.Equal(t, TokenTypeAccessToken, r.PostForm.Get("subject_token_type"))
+		assert.Equal(t, "service-token", r.PostForm.Get("actor_token"))
+		assert.Equal(t, TokenTypeJWT, r.PostForm.Get("actor_token_type"))
+		assert.Equal(t, []string{"simulations", "storage"}, r.PostForm["audience"])
+		assert.Equal(t, "simulations.run", r.PostForm.Get("scope"))
+		id, _, ok := r.BasicAuth()
+		assert.True(t, ok)
+		assert.Equal(t, "web-api", id)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"access_token":"exchanged","issued_token_type":"urn:ietf:params:oauth:token-type:access_token","token_type":"Bearer","expires_in":300}`))
+	}
+
+	exchanger := NewTokenExchanger(TokenExchangeConfig{TokenURL: server.URL, ClientID: "web-api", ClientSecret: "s3cr3t"})
+	token, err := exchanger.Exchange(context.Background(), TokenExchangeRequest{
+		SubjectToken:   "user-token",
+		ActorToken:     "service-token",
+		ActorTokenType: TokenTypeJWT,
+		Audiences:      []string{"simulations", "storage"},
+		Scopes:         []string{"simulations.run"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "exchanged", token.AccessToken)
+	assert.Equal(t, TokenTypeAccessToken, token.IssuedTokenType)
+	assert.False(t, token.ExpiresAt.IsZero())
+}
+
+func TestTokenExchanger_Errors(t *testing.T) {
+	server := newTestTokenServer(t)
+	server.handle = func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"error":"invalid_target"}`))
+	}
+	exchanger := NewTokenExchanger(TokenExchangeConfig{TokenURL: server.URL})
+
+	_, err := exchanger.Exchange(context.Background(), TokenExchangeRequest{})
+	assert.ErrorIs(t, err, ErrSubjectTokenNotProvided)
+	assert.Equal(t, int32(0), server.requests.Load())
+
+	_, err = exchanger.Exchange(context.Background(), TokenExchangeRequest{SubjectToken: "user-token"})
+	var tokenErr *TokenError
+	require.ErrorAs(t, err, &tokenErr)
+	assert.Equal(t, "invalid_target", tokenErr.Code)
+}
@@ -0,0 +1,43 @@
+package oauth
+
+import (
+	"net/http"
+)
+
+// transport is an http.RoundTripper that authorizes every request using the
+// tokens returned by a TokenSource.
+type transport struct {
+	source TokenSource
+	base   http.RoundTripper
+}
+
+// RoundTrip sets the Authorization header of a copy of the given request and
+// sends it using the base RoundTripper.
+func (t *transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	token, err := t.source.Token(r.Context())
+	if err != nil {
+		if r.Body != nil {
+			r.Body.Close()
+		}
+		return nil, err
+	}
+	// RoundTrippers must not modify the original request.
+	authorized := r.Clone(r.Context())
+	token.SetAuthHeader(authorized)
+	return t.base.RoundTrip(authorized)
+}
+
+// NewTransport initializes a new http.RoundTripper that authorizes every request
+// using the tokens returned by the given TokenSource before sending it using
+// base. If base is nil, http.DefaultTransport is used.
+//
+//	client := &http.Client{Transport: NewTransport(source, nil)}
+func NewTransport(source TokenSource, base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &transport{
+		source: source,
+		base:   base,
+	}
+}
@@ -0,0 +1,62 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// staticTokenSource is a TokenSource that always returns the same token or error.
+type staticTokenSource struct {
+	token *Token
+	err   error
+}
+
+func (s staticTokenSource) Token(ctx context.Context) (*Token, error) {
+	return s.token, s.err
+}
+
+func TestTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer abc", r.Header.Get("Authorization"))
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: NewTransport(staticTokenSource{token: &Token{AccessToken: "abc"}}, nil)}
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+	res, err := client.Do(req)
+	require.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	// The original request is not modified.
+	assert.Empty(t, req.Header.Get("Authorization"))
+}
+
+func TestTransport_Error(t *testing.T) {
+	client := &http.Client{Transport: NewTransport(staticTokenSource{err: errors.New("unavailable")}, nil)}
+	_, err := client.Get("http://localhost")
+	assert.ErrorContains(t, err, "unavailable")
+}
+
+func TestTransport_ClientCredentials(t *testing.T) {
+	tokens := newTestTokenServer(t)
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+	}))
+	defer api.Close()
+
+	client := &http.Client{Transport: NewTransport(NewClientCredentials(ClientCredentialsConfig{TokenURL: tokens.URL}), nil)}
+	for i := 0; i < 3; i++ {
+		res, err := client.Get(api.URL)
+		require.NoError(t, err)
+		res.Body.Close()
+	}
+	assert.Equal(t, int32(1), tokens.requests.Load())
+}
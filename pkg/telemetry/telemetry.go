@@ -0,0 +1,124 @@
+// Package telemetry provides an OpenTelemetry implementation of the
+// authentication.Instrumenter interface.
+package telemetry
+
+import (
+	"context"
+	"time"
+
+	"github.com/gazebo-web/auth/pkg/authentication"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName is the name used to identify the tracer and meter used by
+// this package.
+const instrumentationName = "github.com/gazebo-web/auth"
+
+const (
+	// resultSuccess is the result attribute value used for successful operations.
+	resultSuccess = "success"
+	// resultFailure is the result attribute value used for failed operations.
+	resultFailure = "failure"
+)
+
+var (
+	// attrProvider is the attribute key used to identify the authentication provider.
+	attrProvider = attribute.Key("auth.provider")
+	// attrResult is the attribute key used to identify the result of an operation.
+	attrResult = attribute.Key("auth.result")
+	// attrReason is the attribute key used to identify the reason of a failure.
+	attrReason = attribute.Key("auth.reason")
+	// attrCache is the attribute key used to identify a cache.
+	attrCache = attribute.Key("auth.cache")
+	// attrHit is the attribute key used to identify whether a cache lookup was a hit.
+	attrHit = attribute.Key("auth.cache.hit")
+)
+
+// instrumenter is an authentication.Instrumenter implementation using OpenTelemetry.
+type instrumenter struct {
+	tracer        trace.Tracer
+	duration      metric.Float64Histogram
+	verifications metric.Int64Counter
+	cacheLookups  metric.Int64Counter
+}
+
+// StartVerification starts a new span for the verification performed by the
+// given provider. The returned function ends the span and records the
+// verification metrics.
+func (i *instrumenter) StartVerification(ctx context.Context, provider string) (context.Context, func(err error)) {
+	start := time.Now()
+	ctx, span := i.tracer.Start(ctx, "auth.VerifyCredential",
+		trace.WithSpanKind(trace.SpanKindInternal),
+		trace.WithAttributes(attrProvider.String(provider)),
+	)
+	return ctx, func(err error) {
+		attrs := []attribute.KeyValue{attrProvider.String(provider)}
+		if err != nil {
+			reason := string(authentication.ReasonOf(err))
+			attrs = append(attrs, attrResult.String(resultFailure), attrReason.String(reason))
+			span.SetAttributes(attrReason.String(reason))
+			span.SetStatus(codes.Error, err.Error())
+		} else {
+			attrs = append(attrs, attrResult.String(resultSuccess))
+			span.SetStatus(codes.Ok, "")
+		}
+		set := metric.WithAttributes(attrs...)
+		i.duration.Record(ctx, time.Since(start).Seconds(), set)
+		i.verifications.Add(ctx, 1, set)
+		span.End()
+	}
+}
+
+// RecordCacheLookup increments the cache lookups counter. The hit ratio of a
+// cache can be computed by dividing the lookups where auth.cache.hit is true by
+// the total amount of lookups.
+func (i *instrumenter) RecordCacheLookup(ctx context.Context, cache string, hit bool) {
+	i.cacheLookups.Add(ctx, 1, metric.WithAttributes(attrCache.String(cache), attrHit.Bool(hit)))
+}
+
+// NewInstrumenter initializes a new authentication.Instrumenter that emits
+// OpenTelemetry spans using the given tracer provider, and metrics using the
+// given meter provider:
+//
+//   - auth.verification.duration: Histogram with the verification latency in seconds.
+//   - auth.verifications: Counter of verifications by provider, result and failure reason.
+//   - auth.cache.lookups: Counter of cache lookups by cache and hit.
+//
+// Example:
+//
+//	instrumenter, err := telemetry.NewInstrumenter(otel.GetTracerProvider(), otel.GetMeterProvider())
+//	if err != nil {
+//		log.Fatalf("failed to initialize instrumenter: %v\n", err)
+//	}
+//	auth := authentication.NewInstrumented(authentication.NewAuth0(publicKey), authentication.ProviderAuth0, instrumenter)
+func NewInstrumenter(tp trace.TracerProvider, mp metric.MeterProvider) (authentication.Instrumenter, error) {
+	meter := mp.Meter(instrumentationName)
+	duration, err := meter.Float64Histogram("auth.verification.duration",
+		metric.WithDescription("Duration of credential verifications."),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	verifications, err := meter.Int64Counter("auth.verifications",
+		metric.WithDescription("Number of credential verifications."),
+	)
+	if err != nil {
+		return nil, err
+	}
+	cacheLookups, err := meter.Int64Counter("auth.cache.lookups",
+		metric.WithDescription("Number of cache lookups."),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &instrumenter{
+		tracer:        tp.Tracer(instrumentationName),
+		duration:      duration,
+		verifications: verifications,
+		cacheLookups:  cacheLookups,
+	}, nil
+}
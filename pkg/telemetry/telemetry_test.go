@@ -0,0 +1,82 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/gazebo-web/auth/pkg/authentication"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/codes"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestInstrumenter(t *testing.T) {
+	ctx := context.Background()
+	spans := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans))
+	reader := sdkmetric.NewManualReader()
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+
+	instrumenter, err := NewInstrumenter(tp, mp)
+	require.NoError(t, err)
+
+	_, end := instrumenter.StartVerification(ctx, authentication.ProviderAuth0)
+	end(nil)
+
+	_, end = instrumenter.StartVerification(ctx, authentication.ProviderAuth0)
+	end(authentication.NewVerificationError(authentication.ProviderAuth0, authentication.ReasonExpired, errors.New("expired")))
+
+	instrumenter.RecordCacheLookup(ctx, "keys", true)
+	instrumenter.RecordCacheLookup(ctx, "keys", false)
+	instrumenter.RecordCacheLookup(ctx, "keys", true)
+
+	ended := spans.Ended()
+	require.Len(t, ended, 2)
+	assert.Equal(t, "auth.VerifyCredential", ended[0].Name())
+	assert.Equal(t, codes.Ok, ended[0].Status().Code)
+	assert.Equal(t, codes.Error, ended[1].Status().Code)
+	assert.Contains(t, ended[1].Attributes(), attrReason.String("expired"))
+
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(ctx, &rm))
+	require.Len(t, rm.ScopeMetrics, 1)
+
+	metrics := make(map[string]metricdata.Metrics)
+	for _, m := range rm.ScopeMetrics[0].Metrics {
+		metrics[m.Name] = m
+	}
+
+	verifications, ok := metrics["auth.verifications"].Data.(metricdata.Sum[int64])
+	require.True(t, ok)
+	require.Len(t, verifications.DataPoints, 2)
+	for _, dp := range verifications.DataPoints {
+		assert.Equal(t, int64(1), dp.Value)
+		result, ok := dp.Attributes.Value(attrResult)
+		require.True(t, ok)
+		if result.AsString() == resultFailure {
+			reason, ok := dp.Attributes.Value(attrReason)
+			require.True(t, ok)
+			assert.Equal(t, "expired", reason.AsString())
+		}
+	}
+
+	duration, ok := metrics["auth.verification.duration"].Data.(metricdata.Histogram[float64])
+	require.True(t, ok)
+	assert.Len(t, duration.DataPoints, 2)
+
+	lookups, ok := metrics["auth.cache.lookups"].Data.(metricdata.Sum[int64])
+	require.True(t, ok)
+	hits := make(map[bool]int64)
+	for _, dp := range lookups.DataPoints {
+		hit, ok := dp.Attributes.Value(attrHit)
+		require.True(t, ok)
+		hits[hit.AsBool()] = dp.Value
+		assert.True(t, dp.Attributes.HasValue(attrCache))
+	}
+	assert.Equal(t, map[bool]int64{true: 2, false: 1}, hits)
+}
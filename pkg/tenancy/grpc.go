@@ -0,0 +1,86 @@
+package tenancy
+
+import (
+	"context"
+	"errors"
+
+	"github.com/gazebo-web/auth/pkg/authentication"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// UnaryServerInterceptor returns a gRPC unary server interceptor that resolves
+// the tenant targeted by every request and stores it in the request context. The
+// request passed to the Resolver contains the incoming metadata as headers, and
+// the :authority pseudo-header as host. See HTTPMiddleware for more information.
+//
+//	server := grpc.NewServer(grpc.ChainUnaryInterceptor(
+//		authentication.UnaryServerInterceptor(auth),
+//		UnaryServerInterceptor(HeaderResolver("x-tenant-id"), store),
+//	))
+func UnaryServerInterceptor(resolver Resolver, store MembershipStore, opts ...MiddlewareOption) grpc.UnaryServerInterceptor {
+	cfg := newMiddlewareConfig(opts)
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx, err := resolveGRPCTenant(ctx, resolver, store, cfg)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor returns a gRPC stream server interceptor that resolves
+// the tenant targeted when opening every stream and stores it in the stream
+// context. See UnaryServerInterceptor for more information.
+func StreamServerInterceptor(resolver Resolver, store MembershipStore, opts ...MiddlewareOption) grpc.StreamServerInterceptor {
+	cfg := newMiddlewareConfig(opts)
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := resolveGRPCTenant(ss.Context(), resolver, store, cfg)
+		if err != nil {
+			return err
+		}
+		return handler(srv, authentication.NewServerStream(ss, ctx))
+	}
+}
+
+// resolveGRPCTenant resolves the tenant targeted by the gRPC request identified by
+// the given context.
+func resolveGRPCTenant(ctx context.Context, resolver Resolver, store MembershipStore, cfg middlewareConfig) (context.Context, error) {
+	ctx, err := resolveTenant(ctx, authentication.NewGRPCRequest(ctx), resolver, store, cfg)
+	if err != nil {
+		return nil, grpcTenancyError(err)
+	}
+	return ctx, nil
+}
+
+// grpcTenancyError converts the given error into a gRPC status error. Only the
+// generic error messages are exposed to clients.
+func grpcTenancyError(err error) error {
+	code := GRPCStatusCode(err)
+	switch code {
+	case codes.InvalidArgument:
+		return status.Error(code, ErrTenantNotProvided.Error())
+	case codes.PermissionDenied:
+		return status.Error(code, ErrNotMember.Error())
+	case codes.Unauthenticated:
+		return status.Error(code, ErrPrincipalNotProvided.Error())
+	}
+	return status.Error(code, "failed to resolve tenant")
+}
+
+// GRPCStatusCode returns the gRPC status code that should be returned to clients
+// when the tenant of a request couldn't be resolved with the given error.
+func GRPCStatusCode(err error) codes.Code {
+	switch {
+	case err == nil:
+		return codes.OK
+	case errors.Is(err, ErrTenantNotProvided):
+		return codes.InvalidArgument
+	case errors.Is(err, ErrNotMember):
+		return codes.PermissionDenied
+	case errors.Is(err, ErrPrincipalNotProvided):
+		return codes.Unauthenticated
+	}
+	return codes.Internal
+}
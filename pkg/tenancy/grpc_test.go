@@ -0,0 +1,113 @@
+package tenancy
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/gazebo-web/auth/pkg/authentication"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// testServerStream is a grpc.ServerStream implementation used for testing purposes.
+type testServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *testServerStream) Context() context.Context {
+	return s.ctx
+}
+
+func newTestGRPCContext(principal *authentication.Principal, pairs ...string) context.Context {
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(pairs...))
+	return authentication.WithPrincipal(ctx, principal)
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	interceptor := UnaryServerInterceptor(HeaderResolver("x-tenant-id"), newTestStore())
+	info := &grpc.UnaryServerInfo{FullMethod: "/gazebo.Worlds/List"}
+	handler := func(ctx context.Context, req any) (any, error) {
+		tenant, ok := TenantFromContext(ctx)
+		require.True(t, ok)
+		return tenant.ID, nil
+	}
+
+	res, err := interceptor(newTestGRPCContext(&authentication.Principal{ID: "alice", Issuer: "https://issuer"}, "x-tenant-id", "openrobotics"), nil, info, handler)
+	assert.NoError(t, err)
+	assert.Equal(t, "openrobotics", res)
+
+	_, err = interceptor(newTestGRPCContext(&authentication.Principal{ID: "bob", Issuer: "https://issuer"}, "x-tenant-id", "openrobotics"), nil, info, handler)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	assert.Equal(t, ErrNotMember.Error(), status.Convert(err).Message())
+
+	// The same identifier assigned by a different issuer is a different principal.
+	_, err = interceptor(newTestGRPCContext(&authentication.Principal{ID: "alice", Issuer: "https://other"}, "x-tenant-id", "openrobotics"), nil, info, handler)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	_, err = interceptor(newTestGRPCContext(&authentication.Principal{ID: "alice", Issuer: "https://issuer"}), nil, info, handler)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = interceptor(context.Background(), nil, info, handler)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestUnaryServerInterceptor_Subdomain(t *testing.T) {
+	interceptor := UnaryServerInterceptor(SubdomainResolver("gazebosim.org"), newTestStore())
+	ctx := newTestGRPCContext(&authentication.Principal{ID: "alice", Issuer: "https://issuer"}, ":authority", "openrobotics.gazebosim.org:443")
+	res, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{}, func(ctx context.Context, req any) (any, error) {
+		tenant, _ := TenantFromContext(ctx)
+		return tenant.ID, nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "openrobotics", res)
+}
+
+func TestStreamServerInterceptor(t *testing.T) {
+	interceptor := StreamServerInterceptor(HeaderResolver("x-tenant-id"), newTestStore())
+	info := &grpc.StreamServerInfo{FullMethod: "/gazebo.Worlds/Watch"}
+
+	ctx := newTestGRPCContext(&authentication.Principal{ID: "alice", Issuer: "https://issuer"}, "x-tenant-id", "openrobotics")
+	err := interceptor(nil, &testServerStream{ctx: ctx}, info, func(srv any, stream grpc.ServerStream) error {
+		tenant, ok := TenantFromContext(stream.Context())
+		require.True(t, ok)
+		assert.Equal(t, "openrobotics", tenant.ID)
+		return nil
+	})
+	assert.NoError(t, err)
+
+	ctx = newTestGRPCContext(&authentication.Principal{ID: "bob", Issuer: "https://issuer"}, "x-tenant-id", "openrobotics")
+	err = interceptor(nil, &testServerStream{ctx: ctx}, info, func(srv any, stream grpc.ServerStream) error {
+		t.Fatal("handler should not be called")
+		return nil
+	})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
+
+func TestUnaryServerInterceptor_ResolverError(t *testing.T) {
+	resolver := func(r *http.Request, principal *authentication.Principal) (string, error) {
+		return "", errors.New("database unavailable")
+	}
+	interceptor := UnaryServerInterceptor(resolver, newTestStore())
+	ctx := newTestGRPCContext(&authentication.Principal{ID: "alice", Issuer: "https://issuer"})
+	_, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{}, func(ctx context.Context, req any) (any, error) {
+		t.Fatal("handler should not be called")
+		return nil, nil
+	})
+	assert.Equal(t, codes.Internal, status.Code(err))
+	assert.NotContains(t, status.Convert(err).Message(), "database")
+}
+
+func TestGRPCStatusCode(t *testing.T) {
+	assert.Equal(t, codes.OK, GRPCStatusCode(nil))
+	assert.Equal(t, codes.InvalidArgument, GRPCStatusCode(ErrTenantNotProvided))
+	assert.Equal(t, codes.PermissionDenied, GRPCStatusCode(&MembershipError{}))
+	assert.Equal(t, codes.Unauthenticated, GRPCStatusCode(ErrPrincipalNotProvided))
+	assert.Equal(t, codes.Internal, GRPCStatusCode(errors.New("failed")))
+}
@@ -0,0 +1,111 @@
+package tenancy
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/gazebo-web/auth/pkg/authentication"
+)
+
+// MiddlewareOption configures the HTTP middleware and gRPC interceptors.
+type MiddlewareOption func(*middlewareConfig)
+
+// middlewareConfig contains the configuration of the HTTP middleware and gRPC
+// interceptors.
+type middlewareConfig struct {
+	optional bool
+}
+
+// WithOptionalTenant lets requests that don't target a tenant through. By
+// default, they are rejected with ErrTenantNotProvided.
+func WithOptionalTenant() MiddlewareOption {
+	return func(cfg *middlewareConfig) {
+		cfg.optional = true
+	}
+}
+
+// newMiddlewareConfig applies the given options to the default configuration.
+func newMiddlewareConfig(opts []MiddlewareOption) middlewareConfig {
+	var cfg middlewareConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return cfg
+}
+
+// HTTPMiddleware returns an HTTP middleware that resolves the tenant targeted by
+// every request using the given Resolver, checks that the authenticated principal
+// belongs to it using the given MembershipStore, and stores the Tenant in the
+// request context. It must be chained after authentication.HTTPMiddleware, which
+// stores the principal in the request context.
+//
+// Requests are rejected with the status code returned by HTTPStatusCode when the
+// tenant can't be resolved or the principal doesn't belong to it. The active
+// tenant can be retrieved by the handlers using TenantFromContext.
+//
+//	handler := authentication.HTTPMiddleware(auth)(HTTPMiddleware(SubdomainResolver("gazebosim.org"), store)(next))
+func HTTPMiddleware(resolver Resolver, store MembershipStore, opts ...MiddlewareOption) func(http.Handler) http.Handler {
+	cfg := newMiddlewareConfig(opts)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, err := resolveTenant(r.Context(), r, resolver, store, cfg)
+			if err != nil {
+				writeTenancyError(w, err)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// resolveTenant resolves the tenant targeted by the given request, and returns a
+// new context with the tenant if the principal stored in ctx belongs to it.
+func resolveTenant(ctx context.Context, r *http.Request, resolver Resolver, store MembershipStore, cfg middlewareConfig) (context.Context, error) {
+	principal, ok := authentication.PrincipalFromContext(ctx)
+	if !ok {
+		return nil, ErrPrincipalNotProvided
+	}
+	tenant, err := resolver(r, principal)
+	if err != nil {
+		return nil, err
+	}
+	if len(tenant) == 0 {
+		if cfg.optional {
+			return ctx, nil
+		}
+		return nil, ErrTenantNotProvided
+	}
+	membership, err := store.GetMembership(ctx, tenant, principal.Issuer, principal.ID)
+	if err != nil {
+		return nil, err
+	}
+	return WithTenant(ctx, Tenant{ID: tenant, Roles: membership.Roles}), nil
+}
+
+// HTTPStatusCode returns the HTTP status code that should be returned to clients
+// when the tenant of a request couldn't be resolved with the given error.
+func HTTPStatusCode(err error) int {
+	switch {
+	case err == nil:
+		return http.StatusOK
+	case errors.Is(err, ErrTenantNotProvided):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrNotMember):
+		return http.StatusForbidden
+	case errors.Is(err, ErrPrincipalNotProvided):
+		return http.StatusUnauthorized
+	}
+	return http.StatusInternalServerError
+}
+
+// writeTenancyError writes the response for a request whose tenant couldn't be
+// resolved. Unexpected errors are not exposed to clients.
+func writeTenancyError(w http.ResponseWriter, err error) {
+	status := HTTPStatusCode(err)
+	if status == http.StatusInternalServerError {
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+	http.Error(w, err.Error(), status)
+}
@@ -0,0 +1,104 @@
+package tenancy
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gazebo-web/auth/pkg/authentication"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestStore() MembershipStore {
+	return NewMemoryMembershipStore(
+		Membership{Tenant: "openrobotics", Issuer: "https://issuer", Principal: "alice", Roles: []string{"admin"}},
+	)
+}
+
+func newTestRequest(principal *authentication.Principal, tenant string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	if len(tenant) > 0 {
+		r.Header.Set("X-Tenant-Id", tenant)
+	}
+	if principal != nil {
+		r = r.WithContext(authentication.WithPrincipal(r.Context(), principal))
+	}
+	return r
+}
+
+func TestHTTPMiddleware(t *testing.T) {
+	var called bool
+	handler := HTTPMiddleware(HeaderResolver("X-Tenant-Id"), newTestStore())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		tenant, ok := TenantFromContext(r.Context())
+		require.True(t, ok)
+		assert.Equal(t, "openrobotics", tenant.ID)
+		assert.Equal(t, []string{"admin"}, tenant.Roles)
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, newTestRequest(&authentication.Principal{ID: "alice", Issuer: "https://issuer"}, "openrobotics"))
+	assert.True(t, called)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestHTTPMiddleware_Errors(t *testing.T) {
+	handler := HTTPMiddleware(HeaderResolver("X-Tenant-Id"), newTestStore())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("handler should not be called")
+	}))
+
+	testCases := []struct {
+		name     string
+		request  *http.Request
+		expected int
+	}{
+		{name: "missing principal", request: newTestRequest(nil, "openrobotics"), expected: http.StatusUnauthorized},
+		{name: "missing tenant", request: newTestRequest(&authentication.Principal{ID: "alice", Issuer: "https://issuer"}, ""), expected: http.StatusBadRequest},
+		{name: "not a member", request: newTestRequest(&authentication.Principal{ID: "bob", Issuer: "https://issuer"}, "openrobotics"), expected: http.StatusForbidden},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, tc.request)
+			assert.Equal(t, tc.expected, w.Code)
+		})
+	}
+}
+
+func TestHTTPMiddleware_ResolverError(t *testing.T) {
+	resolver := func(r *http.Request, principal *authentication.Principal) (string, error) {
+		return "", errors.New("database unavailable")
+	}
+	handler := HTTPMiddleware(resolver, newTestStore())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("handler should not be called")
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, newTestRequest(&authentication.Principal{ID: "alice", Issuer: "https://issuer"}, ""))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.NotContains(t, w.Body.String(), "database")
+}
+
+func TestHTTPMiddleware_OptionalTenant(t *testing.T) {
+	var called bool
+	handler := HTTPMiddleware(HeaderResolver("X-Tenant-Id"), newTestStore(), WithOptionalTenant())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		_, ok := TenantFromContext(r.Context())
+		assert.False(t, ok)
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, newTestRequest(&authentication.Principal{ID: "bob", Issuer: "https://issuer"}, ""))
+	assert.True(t, called)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestHTTPStatusCode(t *testing.T) {
+	assert.Equal(t, http.StatusOK, HTTPStatusCode(nil))
+	assert.Equal(t, http.StatusBadRequest, HTTPStatusCode(ErrTenantNotProvided))
+	assert.Equal(t, http.StatusForbidden, HTTPStatusCode(&MembershipError{}))
+	assert.Equal(t, http.StatusUnauthorized, HTTPStatusCode(ErrPrincipalNotProvided))
+	assert.Equal(t, http.StatusInternalServerError, HTTPStatusCode(errors.New("failed")))
+}
@@ -0,0 +1,89 @@
+package tenancy
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// Membership describes the roles of a principal within a tenant.
+type Membership struct {
+	// Tenant is the identifier of the tenant.
+	Tenant string
+	// Issuer is the issuer of the credentials of the principal, see
+	// authentication.Principal.
+	Issuer string
+	// Principal is the identifier of the principal within its issuer.
+	Principal string
+	// Roles contains the roles of the principal within the tenant.
+	Roles []string
+}
+
+// MembershipStore contains the memberships of principals to tenants. Principals
+// are identified by their issuer and their identifier within the issuer, given
+// that different issuers may assign the same identifier to different principals.
+type MembershipStore interface {
+	// GetMembership returns the membership of the given principal to the given
+	// tenant. It returns a *MembershipError if the principal doesn't belong to it.
+	GetMembership(ctx context.Context, tenant string, issuer string, principal string) (Membership, error)
+	// ListMemberships returns the memberships of the given principal, sorted by
+	// tenant.
+	ListMemberships(ctx context.Context, issuer string, principal string) ([]Membership, error)
+}
+
+// membershipKey identifies a membership.
+type membershipKey struct {
+	tenant    string
+	issuer    string
+	principal string
+}
+
+// memoryMembershipStore is a MembershipStore implementation that keeps
+// memberships in memory.
+type memoryMembershipStore struct {
+	mu          sync.RWMutex
+	memberships map[membershipKey]Membership
+}
+
+// GetMembership returns the membership of the given principal to the given tenant.
+func (s *memoryMembershipStore) GetMembership(ctx context.Context, tenant string, issuer string, principal string) (Membership, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	m, ok := s.memberships[membershipKey{tenant: tenant, issuer: issuer, principal: principal}]
+	if !ok {
+		return Membership{}, &MembershipError{Issuer: issuer, Principal: principal, Tenant: tenant}
+	}
+	return m, nil
+}
+
+// ListMemberships returns the memberships of the given principal.
+func (s *memoryMembershipStore) ListMemberships(ctx context.Context, issuer string, principal string) ([]Membership, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var memberships []Membership
+	for key, m := range s.memberships {
+		if key.issuer == issuer && key.principal == principal {
+			memberships = append(memberships, m)
+		}
+	}
+	sort.Slice(memberships, func(i, j int) bool {
+		return memberships[i].Tenant < memberships[j].Tenant
+	})
+	return memberships, nil
+}
+
+// NewMemoryMembershipStore initializes a new MembershipStore that keeps the given
+// memberships in memory.
+//
+//	store := NewMemoryMembershipStore(
+//		Membership{Tenant: "openrobotics", Issuer: "https://gazebosim.auth0.com/", Principal: "alice", Roles: []string{"admin"}},
+//	)
+func NewMemoryMembershipStore(memberships ...Membership) MembershipStore {
+	s := &memoryMembershipStore{
+		memberships: make(map[membershipKey]Membership, len(memberships)),
+	}
+	for _, m := range memberships {
+		s.memberships[membershipKey{tenant: m.Tenant, issuer: m.Issuer, principal: m.Principal}] = m
+	}
+	return s
+}
@@ -0,0 +1,44 @@
+package tenancy
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryMembershipStore(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryMembershipStore(
+		Membership{Tenant: "openrobotics", Issuer: "https://issuer", Principal: "alice", Roles: []string{"admin"}},
+		Membership{Tenant: "gazebo", Issuer: "https://issuer", Principal: "alice", Roles: []string{"member"}},
+		Membership{Tenant: "openrobotics", Issuer: "https://issuer", Principal: "bob"},
+		Membership{Tenant: "example", Issuer: "https://other", Principal: "alice"},
+	)
+
+	m, err := store.GetMembership(ctx, "openrobotics", "https://issuer", "alice")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"admin"}, m.Roles)
+
+	_, err = store.GetMembership(ctx, "openrobotics", "https://other", "alice")
+	assert.ErrorIs(t, err, ErrNotMember)
+
+	_, err = store.GetMembership(ctx, "gazebo", "https://issuer", "bob")
+	assert.ErrorIs(t, err, ErrNotMember)
+	var membershipErr *MembershipError
+	require.ErrorAs(t, err, &membershipErr)
+	assert.Equal(t, "https://issuer", membershipErr.Issuer)
+	assert.Equal(t, "bob", membershipErr.Principal)
+	assert.Equal(t, "gazebo", membershipErr.Tenant)
+
+	memberships, err := store.ListMemberships(ctx, "https://issuer", "alice")
+	require.NoError(t, err)
+	require.Len(t, memberships, 2)
+	assert.Equal(t, "gazebo", memberships[0].Tenant)
+	assert.Equal(t, "openrobotics", memberships[1].Tenant)
+
+	memberships, err = store.ListMemberships(ctx, "https://issuer", "carol")
+	require.NoError(t, err)
+	assert.Empty(t, memberships)
+}
@@ -0,0 +1,80 @@
+package tenancy
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/gazebo-web/auth/pkg/authentication"
+)
+
+// Resolver returns the identifier of the tenant targeted by the given request,
+// or an empty string if the request doesn't target a tenant.
+type Resolver func(r *http.Request, principal *authentication.Principal) (string, error)
+
+// PrincipalResolver returns a Resolver that uses the tenant set by the
+// authentication.PrincipalMapper that built the principal, such as the Auth0
+// organization (org_id) or the Firebase tenant.
+func PrincipalResolver() Resolver {
+	return func(r *http.Request, principal *authentication.Principal) (string, error) {
+		return principal.Tenant, nil
+	}
+}
+
+// ClaimResolver returns a Resolver that reads the tenant from the given claim of
+// the principal.
+func ClaimResolver(key string) Resolver {
+	return func(r *http.Request, principal *authentication.Principal) (string, error) {
+		tenant, _ := principal.Claims[key].(string)
+		return tenant, nil
+	}
+}
+
+// HeaderResolver returns a Resolver that reads the tenant from the given request
+// header. gRPC requests read it from the metadata key with the same name.
+func HeaderResolver(name string) Resolver {
+	return func(r *http.Request, principal *authentication.Principal) (string, error) {
+		return strings.TrimSpace(r.Header.Get(name)), nil
+	}
+}
+
+// SubdomainResolver returns a Resolver that reads the tenant from the subdomain of
+// the given base domain the request was sent to. For example, requests sent to
+// "openrobotics.gazebosim.org" resolve to "openrobotics" when using
+// "gazebosim.org" as the base domain. Nested subdomains are ignored.
+func SubdomainResolver(baseDomain string) Resolver {
+	suffix := "." + strings.ToLower(strings.Trim(baseDomain, "."))
+	return func(r *http.Request, principal *authentication.Principal) (string, error) {
+		host := strings.ToLower(r.Host)
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if !strings.HasSuffix(host, suffix) {
+			return "", nil
+		}
+		subdomain := host[:len(host)-len(suffix)]
+		if strings.Contains(subdomain, ".") {
+			return "", nil
+		}
+		return subdomain, nil
+	}
+}
+
+// FirstResolver returns a Resolver that returns the first tenant resolved by the
+// given resolvers.
+//
+//	resolver := FirstResolver(PrincipalResolver(), HeaderResolver("X-Tenant-Id"))
+func FirstResolver(resolvers ...Resolver) Resolver {
+	return func(r *http.Request, principal *authentication.Principal) (string, error) {
+		for _, resolver := range resolvers {
+			tenant, err := resolver(r, principal)
+			if err != nil {
+				return "", err
+			}
+			if len(tenant) > 0 {
+				return tenant, nil
+			}
+		}
+		return "", nil
+	}
+}
@@ -0,0 +1,65 @@
+package tenancy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gazebo-web/auth/pkg/authentication"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func resolve(t *testing.T, resolver Resolver, r *http.Request, principal *authentication.Principal) string {
+	tenant, err := resolver(r, principal)
+	require.NoError(t, err)
+	return tenant
+}
+
+func TestPrincipalResolver(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	assert.Equal(t, "org_1234", resolve(t, PrincipalResolver(), r, &authentication.Principal{Tenant: "org_1234"}))
+	assert.Empty(t, resolve(t, PrincipalResolver(), r, &authentication.Principal{}))
+}
+
+func TestClaimResolver(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	principal := &authentication.Principal{Claims: map[string]any{"org_id": "org_1234", "tenant": 1}}
+	assert.Equal(t, "org_1234", resolve(t, ClaimResolver("org_id"), r, principal))
+	assert.Empty(t, resolve(t, ClaimResolver("tenant"), r, principal))
+	assert.Empty(t, resolve(t, ClaimResolver("missing"), r, principal))
+}
+
+func TestHeaderResolver(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("X-Tenant-Id", " openrobotics ")
+	assert.Equal(t, "openrobotics", resolve(t, HeaderResolver("X-Tenant-Id"), r, &authentication.Principal{}))
+	assert.Empty(t, resolve(t, HeaderResolver("X-Org"), r, &authentication.Principal{}))
+}
+
+func TestSubdomainResolver(t *testing.T) {
+	resolver := SubdomainResolver("gazebosim.org")
+	testCases := map[string]string{
+		"openrobotics.gazebosim.org":      "openrobotics",
+		"OpenRobotics.GazeboSim.org:8080": "openrobotics",
+		"gazebosim.org":                   "",
+		"a.b.gazebosim.org":               "",
+		"openrobotics.example.com":        "",
+		"notgazebosim.org":                "",
+	}
+	for host, expected := range testCases {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Host = host
+		assert.Equal(t, expected, resolve(t, resolver, r, &authentication.Principal{}), host)
+	}
+}
+
+func TestFirstResolver(t *testing.T) {
+	resolver := FirstResolver(PrincipalResolver(), HeaderResolver("X-Tenant-Id"))
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("X-Tenant-Id", "header")
+
+	assert.Equal(t, "token", resolve(t, resolver, r, &authentication.Principal{Tenant: "token"}))
+	assert.Equal(t, "header", resolve(t, resolver, r, &authentication.Principal{}))
+	assert.Empty(t, resolve(t, FirstResolver(), r, &authentication.Principal{}))
+}
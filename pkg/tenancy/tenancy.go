@@ -0,0 +1,73 @@
+package tenancy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrTenantNotProvided is returned when the tenant of a request couldn't be
+// resolved.
+var ErrTenantNotProvided = errors.New("tenant not provided")
+
+// ErrNotMember is returned when a principal doesn't belong to the tenant it's
+// trying to access.
+var ErrNotMember = errors.New("not a member of the tenant")
+
+// ErrPrincipalNotProvided is returned when the tenant of a request is resolved
+// without an authenticated principal.
+var ErrPrincipalNotProvided = errors.New("principal not provided")
+
+// MembershipError contains the details of a principal that doesn't belong to a
+// tenant. It can be matched with errors.Is using ErrNotMember.
+type MembershipError struct {
+	// Issuer is the issuer of the credentials of the principal.
+	Issuer string
+	// Principal is the identifier of the principal within its issuer.
+	Principal string
+	// Tenant is the identifier of the tenant.
+	Tenant string
+}
+
+// Error returns the error message.
+func (e *MembershipError) Error() string {
+	return fmt.Sprintf("%s: %q is not a member of %q", ErrNotMember, e.Principal, e.Tenant)
+}
+
+// Unwrap returns ErrNotMember.
+func (e *MembershipError) Unwrap() error {
+	return ErrNotMember
+}
+
+// Tenant is the tenant, such as an organization, a request is performed on
+// behalf of.
+type Tenant struct {
+	// ID is the unique identifier of the tenant.
+	ID string
+	// Roles contains the roles of the principal within the tenant.
+	Roles []string
+}
+
+// HasRole returns true if the principal has the given role within the tenant.
+func (t Tenant) HasRole(role string) bool {
+	for _, r := range t.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// tenantContextKey is the key used to store the Tenant in a context.Context.
+type tenantContextKey struct{}
+
+// WithTenant returns a copy of ctx that carries the given tenant.
+func WithTenant(ctx context.Context, tenant Tenant) context.Context {
+	return context.WithValue(ctx, tenantContextKey{}, tenant)
+}
+
+// TenantFromContext returns the tenant stored in ctx by WithTenant.
+func TenantFromContext(ctx context.Context) (Tenant, bool) {
+	tenant, ok := ctx.Value(tenantContextKey{}).(Tenant)
+	return tenant, ok
+}
@@ -0,0 +1,26 @@
+package tenancy
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMembershipError(t *testing.T) {
+	err := &MembershipError{Principal: "alice", Tenant: "openrobotics"}
+	assert.ErrorIs(t, err, ErrNotMember)
+	assert.Equal(t, `not a member of the tenant: "alice" is not a member of "openrobotics"`, err.Error())
+}
+
+func TestTenantFromContext(t *testing.T) {
+	_, ok := TenantFromContext(context.Background())
+	assert.False(t, ok)
+
+	ctx := WithTenant(context.Background(), Tenant{ID: "openrobotics", Roles: []string{"admin"}})
+	tenant, ok := TenantFromContext(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, "openrobotics", tenant.ID)
+	assert.True(t, tenant.HasRole("admin"))
+	assert.False(t, tenant.HasRole("member"))
+}